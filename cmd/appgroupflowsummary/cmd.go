@@ -2,6 +2,7 @@ package appgroupflowsummary
 
 import (
 	"fmt"
+	"os"
 	"sort"
 	"strings"
 	"time"
@@ -11,8 +12,9 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var app, start, end, outputFileName string
+var app, start, end, graphFormat, outputFileName string
 var exclAllowed, exclPotentiallyBlocked, exclBlocked, appGroupLoc, ignoreIPGroup, consolidate bool
+var hops, maxServices int
 var pce illumioapi.PCE
 var err error
 
@@ -27,6 +29,9 @@ func init() {
 	AppGroupFlowSummaryCmd.Flags().BoolVarP(&appGroupLoc, "appgrp-loc", "l", false, "use location in app group")
 	AppGroupFlowSummaryCmd.Flags().BoolVarP(&ignoreIPGroup, "ignore-ip", "i", false, "exlude IP address app groups from output")
 	AppGroupFlowSummaryCmd.Flags().BoolVarP(&consolidate, "consolidate", "c", false, "consolidate all communication between 2 app groups into one CSV entry. See description below for example of output formats.")
+	AppGroupFlowSummaryCmd.Flags().StringVarP(&graphFormat, "graph", "g", "", "export a dependency graph instead of a csv. options are dot, graphml, or mermaid.")
+	AppGroupFlowSummaryCmd.Flags().IntVar(&hops, "hops", 1, "with --graph and --app, include app groups up to this many hops from the app's app groups.")
+	AppGroupFlowSummaryCmd.Flags().IntVar(&maxServices, "max-services", 5, "with --graph, maximum services in each edge label.")
 	AppGroupFlowSummaryCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the output file location. default is current location with a timestamped filename.")
 
 	AppGroupFlowSummaryCmd.Flags().SortFlags = false
@@ -63,6 +68,10 @@ Including the consolidate flag (--consolidate, -c) will combine all entries betw
 | 45.54.45.54                  | Point-of-Sale | Staging      |                      | 443 TCP (126 flows)              |                      |
 +------------------------------+------------------------------+----------------------+----------------------------------+----------------------+
 
+Including the graph flag (--graph, -g) exports an app group dependency graph in Graphviz DOT (dot), GraphML (graphml), or Mermaid (mermaid) format instead of the csv. Each edge is labeled with its top services by flow count (--max-services) and the total flows. Edges are colored by the most restrictive policy decision: green for allowed, orange for potentially blocked, and red for blocked. IP addresses are ellipses.
+
+With --app and --graph, the graph is limited to the app's app groups (highlighted) and the app groups within --hops in either direction. If --hops is more than 1, explorer is queried for all traffic and the neighborhood is filtered from the results.
+
 The update-pce and --no-prompt flags are ignored for this command.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -124,8 +133,23 @@ func flowSummary() {
 	}
 	tq.EndTime = tq.EndTime.In(time.UTC)
 
+	// Validate the graph flags
+	graphFormat = strings.ToLower(graphFormat)
+	if graphFormat != "" && graphFormat != "dot" && graphFormat != "graphml" && graphFormat != "mermaid" {
+		utils.LogErrorf("%s is not a valid graph format. options are dot, graphml, or mermaid.", graphFormat)
+	}
+	if hops < 1 {
+		utils.LogError("hops must be at least 1")
+	}
+
+	// A multi-hop neighborhood needs all traffic so the app only limits the query for one hop
+	queryApp := app
+	if graphFormat != "" && hops > 1 {
+		queryApp = ""
+	}
+
 	// If an app is provided, adjust query to include it
-	if app != "" {
+	if queryApp != "" {
 		utils.LogInfof(false, "app label value: %s", app)
 		label, a, err := pce.GetLabelByKeyValue("app", app)
 		utils.LogAPIRespV2("GetLabelbyKeyValue", a)
@@ -149,7 +173,7 @@ func flowSummary() {
 	utils.LogInfof(false, "first traffic query result count: %d", len(traffic))
 
 	// If app is provided, switch to the destination include, clear the sources include, run query again, append to previous result
-	if app != "" {
+	if queryApp != "" {
 		tq.DestinationsInclude = tq.SourcesInclude
 		tq.SourcesInclude = [][]string{}
 		traffic2, a, err := pce.GetTrafficAnalysis(tq)
@@ -209,6 +233,12 @@ func flowSummary() {
 		entryMap[entry][svc] = entryMap[entry][svc] + int(t.NumConnections)
 	}
 
+	// Export the graph
+	if graphFormat != "" {
+		exportGraph(entryMap)
+		return
+	}
+
 	// Build the data slices
 	data := [][]string{{"src_app_group", "dst_app_group", "service", "allowed_flows", "potentially_blocked_flows", "blocked_flows"}}
 	if consolidate {
@@ -272,3 +302,36 @@ func flowSummary() {
 	}
 
 }
+
+// exportGraph writes the app group dependency graph
+func exportGraph(entryMap map[summary]map[svcSummary]int) {
+	g := newDependencyGraph(entryMap)
+	if app != "" {
+		g.neighborhood(app, hops)
+		if len(g.focus) == 0 {
+			utils.LogInfof(true, "no app groups for the %s app in the explorer data", app)
+			return
+		}
+	}
+	if len(g.edges) == 0 {
+		utils.LogInfo("no explorer data to graph", true)
+		return
+	}
+
+	var graph, ext string
+	switch graphFormat {
+	case "dot":
+		graph, ext = g.dot(maxServices), "dot"
+	case "graphml":
+		graph, ext = g.graphML(maxServices), "graphml"
+	case "mermaid":
+		graph, ext = g.mermaid(maxServices), "mmd"
+	}
+	if outputFileName == "" {
+		outputFileName = fmt.Sprintf("workloader-flowsummary-%s.%s", time.Now().Format("20060102_150405"), ext)
+	}
+	if err := os.WriteFile(outputFileName, []byte(graph), 0644); err != nil {
+		utils.LogError(err.Error())
+	}
+	utils.LogInfof(true, "%d app groups and %d edges exported to %s", len(g.nodes), len(g.edges), outputFileName)
+}
@@ -0,0 +1,264 @@
+package appgroupflowsummary
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// decisionColors are the edge colors for each policy decision
+var decisionColors = map[string]string{"allowed": "#2e7d32", "potentially_blocked": "#ef6c00", "blocked": "#c62828"}
+
+// graphEdge is the flows from one app group to another
+type graphEdge struct {
+	src      string
+	dst      string
+	services map[string]int
+	statuses map[string]int
+	flows    int
+}
+
+// decision returns the most restrictive policy decision on the edge
+func (e *graphEdge) decision() string {
+	for _, d := range []string{"blocked", "potentially_blocked", "allowed"} {
+		if e.statuses[d] > 0 {
+			return d
+		}
+	}
+	return ""
+}
+
+// label returns the services with the most flows and the total flows
+func (e *graphEdge) label(maxServices int) []string {
+	svcs := []string{}
+	for s := range e.services {
+		svcs = append(svcs, s)
+	}
+	sort.Slice(svcs, func(i, j int) bool {
+		if e.services[svcs[i]] != e.services[svcs[j]] {
+			return e.services[svcs[i]] > e.services[svcs[j]]
+		}
+		return svcs[i] < svcs[j]
+	})
+	lines := []string{}
+	for i, s := range svcs {
+		if i == maxServices {
+			lines = append(lines, fmt.Sprintf("+%d more", len(svcs)-maxServices))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("%s (%d)", s, e.services[s]))
+	}
+	return append(lines, fmt.Sprintf("%d flows", e.flows))
+}
+
+// dependencyGraph is the app group dependency graph
+type dependencyGraph struct {
+	nodes []string
+	edges []*graphEdge
+	focus map[string]bool
+}
+
+// newDependencyGraph builds the graph from the flow summaries
+func newDependencyGraph(entryMap map[summary]map[svcSummary]int) *dependencyGraph {
+	edges := make(map[[2]string]*graphEdge)
+	for s, svcs := range entryMap {
+		k := [2]string{s.srcAppGroup, s.dstAppGroup}
+		if _, ok := edges[k]; !ok {
+			edges[k] = &graphEdge{src: s.srcAppGroup, dst: s.dstAppGroup, services: make(map[string]int), statuses: make(map[string]int)}
+		}
+		for svc, count := range svcs {
+			edges[k].services[fmt.Sprintf("%d %s", svc.port, svc.proto)] += count
+			edges[k].statuses[s.policyStatus] += count
+			edges[k].flows += count
+		}
+	}
+	g := &dependencyGraph{focus: make(map[string]bool)}
+	nodes := make(map[string]bool)
+	for _, e := range edges {
+		g.edges = append(g.edges, e)
+		nodes[e.src], nodes[e.dst] = true, true
+	}
+	for n := range nodes {
+		g.nodes = append(g.nodes, n)
+	}
+	g.sort()
+	return g
+}
+
+func (g *dependencyGraph) sort() {
+	sort.Strings(g.nodes)
+	sort.Slice(g.edges, func(i, j int) bool {
+		if g.edges[i].src != g.edges[j].src {
+			return g.edges[i].src < g.edges[j].src
+		}
+		return g.edges[i].dst < g.edges[j].dst
+	})
+}
+
+// neighborhood limits the graph to the app groups of the app and the app groups within the hops in either direction
+func (g *dependencyGraph) neighborhood(app string, hops int) {
+	adjacent := make(map[string][]string)
+	for _, e := range g.edges {
+		adjacent[e.src] = append(adjacent[e.src], e.dst)
+		adjacent[e.dst] = append(adjacent[e.dst], e.src)
+	}
+
+	// The app's app groups are the starting point
+	distance := make(map[string]int)
+	queue := []string{}
+	for _, n := range g.nodes {
+		if strings.Split(n, " | ")[0] == app {
+			g.focus[n] = true
+			distance[n] = 0
+			queue = append(queue, n)
+		}
+	}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if distance[n] == hops {
+			continue
+		}
+		for _, a := range adjacent[n] {
+			if _, ok := distance[a]; !ok {
+				distance[a] = distance[n] + 1
+				queue = append(queue, a)
+			}
+		}
+	}
+
+	nodes := []string{}
+	for _, n := range g.nodes {
+		if _, ok := distance[n]; ok {
+			nodes = append(nodes, n)
+		}
+	}
+	edges := []*graphEdge{}
+	for _, e := range g.edges {
+		_, srcOK := distance[e.src]
+		_, dstOK := distance[e.dst]
+		if srcOK && dstOK {
+			edges = append(edges, e)
+		}
+	}
+	g.nodes, g.edges = nodes, edges
+}
+
+// isIP returns true if the node is an ip address instead of an app group
+func isIP(n string) bool {
+	return net.ParseIP(n) != nil
+}
+
+// dot returns the graph in Graphviz DOT format
+func (g *dependencyGraph) dot(maxServices int) string {
+	quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	var b strings.Builder
+	b.WriteString("digraph appgroups {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box, style=rounded, fontname=\"Helvetica\"];\n")
+	b.WriteString("  edge [fontname=\"Helvetica\", fontsize=10];\n")
+	for _, n := range g.nodes {
+		attrs := []string{fmt.Sprintf("label=\"%s\"", quote.Replace(n))}
+		if isIP(n) {
+			attrs = append(attrs, "shape=ellipse")
+		}
+		if g.focus[n] {
+			attrs = append(attrs, "style=\"rounded,filled\"", "fillcolor=\"#bbdefb\"")
+		}
+		fmt.Fprintf(&b, "  \"%s\" [%s];\n", quote.Replace(n), strings.Join(attrs, ", "))
+	}
+	for _, e := range g.edges {
+		lines := []string{}
+		for _, l := range e.label(maxServices) {
+			lines = append(lines, quote.Replace(l))
+		}
+		fmt.Fprintf(&b, "  \"%s\" -> \"%s\" [label=\"%s\", color=\"%s\", fontcolor=\"%s\", tooltip=\"%s\"];\n", quote.Replace(e.src), quote.Replace(e.dst), strings.Join(lines, `\n`), decisionColors[e.decision()], decisionColors[e.decision()], e.decision())
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// mermaid returns the graph as a Mermaid flowchart
+func (g *dependencyGraph) mermaid(maxServices int) string {
+	text := strings.NewReplacer(`"`, "#quot;", "\n", " ")
+	ids := make(map[string]string)
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	for i, n := range g.nodes {
+		ids[n] = fmt.Sprintf("n%d", i)
+		if isIP(n) {
+			fmt.Fprintf(&b, "  %s([\"%s\"])\n", ids[n], text.Replace(n))
+		} else {
+			fmt.Fprintf(&b, "  %s[\"%s\"]\n", ids[n], text.Replace(n))
+		}
+	}
+	for _, e := range g.edges {
+		lines := []string{}
+		for _, l := range e.label(maxServices) {
+			lines = append(lines, text.Replace(l))
+		}
+		fmt.Fprintf(&b, "  %s -->|\"%s\"| %s\n", ids[e.src], strings.Join(lines, "<br/>"), ids[e.dst])
+	}
+	for i, e := range g.edges {
+		fmt.Fprintf(&b, "  linkStyle %d stroke:%s,color:%s\n", i, decisionColors[e.decision()], decisionColors[e.decision()])
+	}
+	focus := []string{}
+	for _, n := range g.nodes {
+		if g.focus[n] {
+			focus = append(focus, ids[n])
+		}
+	}
+	if len(focus) > 0 {
+		b.WriteString("  classDef focus fill:#bbdefb\n")
+		fmt.Fprintf(&b, "  class %s focus\n", strings.Join(focus, ","))
+	}
+	return b.String()
+}
+
+// graphML returns the graph in GraphML format
+func (g *dependencyGraph) graphML(maxServices int) string {
+	esc := func(s string) string {
+		var buf bytes.Buffer
+		xml.EscapeText(&buf, []byte(s))
+		return buf.String()
+	}
+	ids := make(map[string]string)
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString("<graphml xmlns=\"http://graphml.graphdrawing.org/xmlns\">\n")
+	b.WriteString("  <key id=\"label\" for=\"node\" attr.name=\"label\" attr.type=\"string\"/>\n")
+	b.WriteString("  <key id=\"type\" for=\"node\" attr.name=\"type\" attr.type=\"string\"/>\n")
+	b.WriteString("  <key id=\"focus\" for=\"node\" attr.name=\"focus\" attr.type=\"boolean\"/>\n")
+	b.WriteString("  <key id=\"services\" for=\"edge\" attr.name=\"services\" attr.type=\"string\"/>\n")
+	b.WriteString("  <key id=\"flows\" for=\"edge\" attr.name=\"flows\" attr.type=\"int\"/>\n")
+	b.WriteString("  <key id=\"policy_decision\" for=\"edge\" attr.name=\"policy_decision\" attr.type=\"string\"/>\n")
+	b.WriteString("  <key id=\"color\" for=\"edge\" attr.name=\"color\" attr.type=\"string\"/>\n")
+	b.WriteString("  <graph id=\"appgroups\" edgedefault=\"directed\">\n")
+	for i, n := range g.nodes {
+		ids[n] = fmt.Sprintf("n%d", i)
+		nodeType := "app_group"
+		if isIP(n) {
+			nodeType = "ip_address"
+		}
+		fmt.Fprintf(&b, "    <node id=\"%s\">\n", ids[n])
+		fmt.Fprintf(&b, "      <data key=\"label\">%s</data>\n", esc(n))
+		fmt.Fprintf(&b, "      <data key=\"type\">%s</data>\n", nodeType)
+		fmt.Fprintf(&b, "      <data key=\"focus\">%t</data>\n", g.focus[n])
+		b.WriteString("    </node>\n")
+	}
+	for i, e := range g.edges {
+		label := e.label(maxServices)
+		fmt.Fprintf(&b, "    <edge id=\"e%d\" source=\"%s\" target=\"%s\">\n", i, ids[e.src], ids[e.dst])
+		fmt.Fprintf(&b, "      <data key=\"services\">%s</data>\n", esc(strings.Join(label[:len(label)-1], "; ")))
+		fmt.Fprintf(&b, "      <data key=\"flows\">%d</data>\n", e.flows)
+		fmt.Fprintf(&b, "      <data key=\"policy_decision\">%s</data>\n", e.decision())
+		fmt.Fprintf(&b, "      <data key=\"color\">%s</data>\n", decisionColors[e.decision()])
+		b.WriteString("    </edge>\n")
+	}
+	b.WriteString("  </graph>\n")
+	b.WriteString("</graphml>\n")
+	return b.String()
+}
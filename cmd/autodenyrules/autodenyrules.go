@@ -10,6 +10,8 @@ import (
 	"time"
 
 	"github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/cmd/denyruleexport"
+	"github.com/brian1917/workloader/cmd/ruleexport"
 	"github.com/brian1917/workloader/utils"
 	"github.com/spf13/cobra"
 )
@@ -19,7 +21,7 @@ const (
 	maxConcurrentQueries   = 2
 	trafficQueryTimeout    = 5 * time.Minute
 	trafficQueryPollPeriod = 5 * time.Second
-	targetIPListName       = "Any (0.0.0.0/0 and ::/0)"
+	defaultIPListName      = "Any (0.0.0.0/0 and ::/0)"
 )
 
 type trafficDirection string
@@ -31,12 +33,30 @@ const (
 
 // denyRuleInfo holds information needed to create a deny rule
 type denyRuleInfo struct {
-	env       illumioapi.Label   // The environment label
+	scope     scopeInfo          // The scope labels
 	service   illumioapi.Service // The service to deny
-	apps      []illumioapi.Label // The applications with no traffic
+	groups    []illumioapi.Label // The group labels (e.g., apps) with no traffic
 	direction trafficDirection
 }
 
+// scopeInfo is a combination of scope labels (e.g., env) and the group labels (e.g., app) of its workloads
+type scopeInfo struct {
+	labels []illumioapi.Label
+	groups []illumioapi.Label
+}
+
+// name returns the scope label values for logging
+func (s scopeInfo) name() string {
+	if len(s.labels) == 0 {
+		return "all workloads"
+	}
+	values := make([]string, 0, len(s.labels))
+	for _, l := range s.labels {
+		values = append(values, fmt.Sprintf("%s:%s", l.Key, l.Value))
+	}
+	return strings.Join(values, ";")
+}
+
 type labelFilter struct {
 	include map[string]map[string]bool
 	exclude map[string]map[string]bool
@@ -45,7 +65,13 @@ type labelFilter struct {
 var AutoDenyRulesCmd = &cobra.Command{
 	Use:   "auto-deny-rules",
 	Short: "Creates deny rules automatically for workloads, based on traffic query results on ransomware services.",
-	Long:  `Creates deny rules automatically for workloads, based on traffic query results on ransomware services.`,
+	Long: `Creates deny rules automatically for workloads, based on traffic query results on ransomware services.
+
+Workloads are grouped by the --scope-keys labels (default env) and, within each scope, by the --group-key label (default app). For each scope, group, service, and direction, the last 24 hours and then the last 89 days of traffic are queried. Groups with no traffic for a service get a deny rule with the scope labels, the group labels, and the source ip lists (--ip-lists). Use an empty --scope-keys to group all workloads only by the --group-key.
+
+The services are the ransomware services (is_ransomware=true) unless --services or --service-file are used. The service file is a csv with service names in the first column.
+
+With --dry-run, nothing is created and the proposed rules are written to a deny-rule-import csv for review. Import it with workloader deny-rule-import <file> --update-pce. Without --dry-run, the rule set and rules are created, a rule-import csv with the created rules is written, and a rollback csv with the hrefs of the created objects is written. Use workloader delete <rollback file> --header href --provision to remove them.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return RunAutoDenyRules(
 			verboseEnabled,
@@ -68,6 +94,13 @@ var (
 	directionFlag        string
 	includeLabels        []string
 	excludeLabels        []string
+	scopeKeys            []string
+	groupKey             string
+	serviceNames         []string
+	serviceFile          string
+	ipListNames          []string
+	outputFileName       string
+	rollbackFileName     string
 	pce                  illumioapi.PCE
 )
 
@@ -75,10 +108,18 @@ func init() {
 	AutoDenyRulesCmd.Flags().BoolVar(&verboseEnabled, "verbose", false, "enable verbose logging")
 	AutoDenyRulesCmd.Flags().BoolVar(&excludeBroadcastFlag, "exclude-broadcast", false, "exclude broadcast traffic")
 	AutoDenyRulesCmd.Flags().BoolVar(&excludeMulticastFlag, "exclude-multicast", false, "exclude multicast traffic")
-	AutoDenyRulesCmd.Flags().StringSliceVar(&includeLabels, "include-label", nil, "only include env/app labels matching key:value (repeatable, e.g. --include-label env:Dev)")
-	AutoDenyRulesCmd.Flags().StringSliceVar(&excludeLabels, "exclude-label", nil, "exclude env/app labels matching key:value (repeatable, e.g. --exclude-label env:Prod)")
+	AutoDenyRulesCmd.Flags().StringSliceVar(&includeLabels, "include-label", nil, "only include scope/group labels matching key:value (repeatable, e.g. --include-label env:Dev)")
+	AutoDenyRulesCmd.Flags().StringSliceVar(&excludeLabels, "exclude-label", nil, "exclude scope/group labels matching key:value (repeatable, e.g. --exclude-label env:Prod)")
+	AutoDenyRulesCmd.Flags().StringSliceVar(&scopeKeys, "scope-keys", []string{"env"}, "comma-separated label keys that scope the deny rules (e.g. env,loc); use --scope-keys \"\" for no scope")
+	AutoDenyRulesCmd.Flags().StringVar(&groupKey, "group-key", "app", "label key grouped within each scope; each deny rule lists the group labels with no traffic")
+	AutoDenyRulesCmd.Flags().StringSliceVar(&serviceNames, "services", nil, "comma-separated service names to deny (default is the ransomware services)")
+	AutoDenyRulesCmd.Flags().StringVar(&serviceFile, "service-file", "", "csv file with service names to deny in the first column (default is the ransomware services)")
+	AutoDenyRulesCmd.Flags().StringSliceVar(&ipListNames, "ip-lists", []string{defaultIPListName}, "comma-separated ip list names used as the other side of the deny rules")
 	AutoDenyRulesCmd.Flags().BoolVar(&dryRun, "dry-run", false, "show what would be created without creating rule sets or rules")
 	AutoDenyRulesCmd.Flags().StringVar(&directionFlag, "direction", "", "traffic direction to process: 'inbound' or 'outbound'; omit flag to process both")
+	AutoDenyRulesCmd.Flags().StringVar(&outputFileName, "output-file", "", "csv with the deny rules. rule-import format or deny-rule-import format with --dry-run (default is a timestamped filename in the current location)")
+	AutoDenyRulesCmd.Flags().StringVar(&rollbackFileName, "rollback-file", "", "csv with the hrefs of the created rule set and rules (default is a timestamped filename in the current location)")
+	AutoDenyRulesCmd.Flags().SortFlags = false
 }
 
 // ---------- Logging / helpers ----------
@@ -90,15 +131,15 @@ func vlog(format string, v ...interface{}) {
 }
 
 func logQueryProgress(
-	env illumioapi.Label,
-	app illumioapi.Label,
+	scope scopeInfo,
+	group illumioapi.Label,
 	svc illumioapi.Service,
 	direction trafficDirection,
 	done, total int64,
 ) {
 	percent := float64(done) / float64(total) * 100
-	log.Printf("[QUERY:%s] Env:%s  App:%s  Service:%s  →  %.1f%% (%d/%d)",
-		strings.ToUpper(string(direction)), env.Value, app.Value, svc.Name, percent, done, total)
+	log.Printf("[QUERY:%s] Scope:%s  %s:%s  Service:%s  →  %.1f%% (%d/%d)",
+		strings.ToUpper(string(direction)), scope.name(), group.Key, group.Value, svc.Name, percent, done, total)
 }
 
 func ptrString(s string) *string { return &s }
@@ -118,7 +159,7 @@ func parseDirectionFlag(direction string) ([]trafficDirection, error) {
 	}
 }
 
-// chunkApps splits apps into chunks of size n.
+// chunkApps splits group labels (e.g., apps) into chunks of size n.
 func chunkApps(apps []illumioapi.Label, n int) [][]illumioapi.Label {
 	if len(apps) == 0 || n <= 0 {
 		return nil
@@ -185,50 +226,60 @@ func labelAllowed(key, value string, lf *labelFilter) bool {
 
 // ---------- PCE fetchers ----------
 
-// Fetch environments
-func getEnvs() ([]illumioapi.Label, error) {
-	_, err := pce.GetLabels(map[string]string{"key": "env"})
-	if err != nil {
-		return nil, fmt.Errorf("getEnvs GetLabels: %w", err)
-	}
-
-	seen := make(map[string]struct{}, len(pce.LabelsSlice))
-	out := make([]illumioapi.Label, 0, len(pce.LabelsSlice))
-
-	for _, l := range pce.LabelsSlice {
-		if l.Key != "env" || illumioapi.PtrToVal(l.Deleted) || l.Href == "" || l.Value == "" {
-			continue
+// Fetch services by name or, if no names are provided, the ransomware services
+func getServices(names []string, file string) ([]illumioapi.Service, error) {
+	if file != "" {
+		data, err := utils.ParseCSV(file)
+		if err != nil {
+			return nil, fmt.Errorf("getServices ParseCSV: %w", err)
 		}
-		if _, ok := seen[l.Href]; ok {
-			continue
+		for i, row := range data {
+			if len(row) == 0 || strings.TrimSpace(row[0]) == "" {
+				continue
+			}
+			// Skip a header row
+			if i == 0 && (strings.EqualFold(row[0], "name") || strings.EqualFold(row[0], "service") || strings.EqualFold(row[0], "services")) {
+				continue
+			}
+			names = append(names, strings.TrimSpace(row[0]))
 		}
-		seen[l.Href] = struct{}{}
-		out = append(out, l)
-	}
-
-	sort.Slice(out, func(i, j int) bool {
-		return strings.ToLower(out[i].Value) < strings.ToLower(out[j].Value)
-	})
-
-	if len(out) == 0 {
-		return nil, fmt.Errorf("getEnvs: no env labels found")
 	}
-	return out, nil
-}
 
-// Fetch ransomware services
-func getRansomServices() ([]illumioapi.Service, error) {
-	_, err := pce.GetServices(map[string]string{"is_ransomware": "true"}, "draft")
-	if err != nil {
-		return nil, fmt.Errorf("getRansomServices GetServices: %w", err)
+	if len(names) == 0 {
+		_, err := pce.GetServices(map[string]string{"is_ransomware": "true"}, "draft")
+		if err != nil {
+			return nil, fmt.Errorf("getServices GetServices: %w", err)
+		}
+	} else {
+		_, err := pce.GetServices(nil, "draft")
+		if err != nil {
+			return nil, fmt.Errorf("getServices GetServices: %w", err)
+		}
 	}
 
+	byName := make(map[string]illumioapi.Service, len(pce.ServicesSlice))
 	seen := make(map[string]struct{}, len(pce.ServicesSlice))
 	out := make([]illumioapi.Service, 0, len(pce.ServicesSlice))
 	for _, s := range pce.ServicesSlice {
 		if s.Href == "" {
 			continue
 		}
+		byName[s.Name] = s
+		if len(names) > 0 {
+			continue
+		}
+		if _, ok := seen[s.Href]; ok {
+			continue
+		}
+		seen[s.Href] = struct{}{}
+		out = append(out, s)
+	}
+
+	for _, n := range names {
+		s, ok := byName[strings.TrimSpace(n)]
+		if !ok {
+			return nil, fmt.Errorf("getServices: service %q does not exist", n)
+		}
 		if _, ok := seen[s.Href]; ok {
 			continue
 		}
@@ -237,61 +288,90 @@ func getRansomServices() ([]illumioapi.Service, error) {
 	}
 
 	if len(out) == 0 {
-		return nil, fmt.Errorf("getRansomServices: no ransomware services found")
+		return nil, fmt.Errorf("getServices: no services found")
 	}
 	return out, nil
 }
 
-// Fetch workloads and extract unique apps
-func getWorkloadsForEnv(pce illumioapi.PCE, env illumioapi.Label, lf *labelFilter) ([]illumioapi.Label, error) {
-	if env.Href == "" {
-		return nil, fmt.Errorf("environment label href cannot be empty")
-	}
-
-	vlog("Fetching workloads for env %s (href: %s)", env.Value, env.Href)
+// Fetch workloads and group them by the scope label keys and the group label key
+func getScopes(pce illumioapi.PCE, scopeKeys []string, groupKey string, lf *labelFilter) ([]scopeInfo, error) {
+	vlog("Fetching workloads to group by scope keys %v and group key %s", scopeKeys, groupKey)
 
 	queryParameters := map[string]string{
 		"managed":           "true",
 		"online":            "true",
-		"labels":            fmt.Sprintf("[[%q]]", env.Href),
 		"enforcement_modes": "[\"idle\",\"selective\",\"visibility_only\"]",
 	}
 
 	_, err := pce.GetWklds(queryParameters)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch workloads for env %s: %w", env.Value, err)
+		return nil, fmt.Errorf("failed to fetch workloads: %w", err)
 	}
 
-	uniqueApps := make(map[string]illumioapi.Label)
+	scopes := make(map[string]*scopeInfo)
+	scopeGroups := make(map[string]map[string]illumioapi.Label)
 	for _, wkld := range pce.WorkloadsSlice {
 		if wkld.Labels == nil {
 			continue
 		}
+		byKey := make(map[string]illumioapi.Label)
 		for _, label := range *wkld.Labels {
-			if label.Key != "app" || label.Href == "" {
-				continue
+			if label.Href != "" {
+				byKey[label.Key] = label
 			}
-			if !labelAllowed("app", label.Value, lf) {
-				continue
+		}
+
+		// The workload needs every scope key and the group key
+		group, ok := byKey[groupKey]
+		if !ok || !labelAllowed(groupKey, group.Value, lf) {
+			continue
+		}
+		scopeLabels := make([]illumioapi.Label, 0, len(scopeKeys))
+		hrefs := make([]string, 0, len(scopeKeys))
+		for _, k := range scopeKeys {
+			l, ok := byKey[k]
+			if !ok || !labelAllowed(k, l.Value, lf) {
+				break
 			}
-			uniqueApps[label.Href] = label
+			scopeLabels = append(scopeLabels, l)
+			hrefs = append(hrefs, l.Href)
+		}
+		if len(scopeLabels) != len(scopeKeys) {
+			continue
 		}
+
+		id := strings.Join(hrefs, ",")
+		if _, ok := scopes[id]; !ok {
+			scopes[id] = &scopeInfo{labels: scopeLabels}
+			scopeGroups[id] = make(map[string]illumioapi.Label)
+		}
+		scopeGroups[id][group.Href] = group
 	}
 
-	apps := make([]illumioapi.Label, 0, len(uniqueApps))
-	for _, label := range uniqueApps {
-		apps = append(apps, label)
+	out := make([]scopeInfo, 0, len(scopes))
+	for id, si := range scopes {
+		for _, label := range scopeGroups[id] {
+			si.groups = append(si.groups, label)
+		}
+		sort.Slice(si.groups, func(i, j int) bool {
+			return strings.ToLower(si.groups[i].Value) < strings.ToLower(si.groups[j].Value)
+		})
+		vlog("Found %d unique %s labels for scope %s", len(si.groups), groupKey, si.name())
+		out = append(out, *si)
 	}
 
-	vlog("Found %d unique apps for env %s", len(apps), env.Value)
-	return apps, nil
+	sort.Slice(out, func(i, j int) bool {
+		return strings.ToLower(out[i].name()) < strings.ToLower(out[j].name())
+	})
+	return out, nil
 }
 
 // ---------- Traffic query ----------
 
 func submitTrafficQuery(
 	pce illumioapi.PCE,
-	envHref, appHref string,
+	scopeHrefs []string,
+	groupHref string,
 	service illumioapi.Service,
 	excludeBroadcast, excludeMulticast bool,
 	direction trafficDirection,
@@ -317,12 +397,12 @@ func submitTrafficQuery(
 		var sources, destinations map[string]interface{}
 		exclusions := buildDestExclusions(excludeBroadcast, excludeMulticast)
 
-		labelsSelector := [][]map[string]map[string]string{
-			{
-				{"label": {"href": envHref}},
-				{"label": {"href": appHref}},
-			},
+		selector := make([]map[string]map[string]string, 0, len(scopeHrefs)+1)
+		for _, href := range scopeHrefs {
+			selector = append(selector, map[string]map[string]string{"label": {"href": href}})
 		}
+		selector = append(selector, map[string]map[string]string{"label": {"href": groupHref}})
+		labelsSelector := [][]map[string]map[string]string{selector}
 
 		if direction == inbound {
 			sources = map[string]interface{}{
@@ -345,7 +425,7 @@ func submitTrafficQuery(
 		}
 
 		return map[string]interface{}{
-			"query_name":   fmt.Sprintf("Query Env: %s App: %s", envHref, appHref),
+			"query_name":   fmt.Sprintf("Query Scope: %s Group: %s", strings.Join(scopeHrefs, ","), groupHref),
 			"sources":      sources,
 			"destinations": destinations,
 			"services": map[string]interface{}{
@@ -380,7 +460,7 @@ func submitTrafficQuery(
 		return false, nil
 	}
 
-	// No flows found in either time period => unused service for this env/app/direction.
+	// No flows found in either time period => unused service for this scope/group/direction.
 	return true, nil
 }
 
@@ -469,22 +549,26 @@ func createDenyRule(
 	pce illumioapi.PCE,
 	rulesetHref string,
 	serviceHref string,
-	apps []illumioapi.Label,
-	env illumioapi.Label,
-	ipListHref string,
+	groups []illumioapi.Label,
+	scope scopeInfo,
+	ipListHrefs []string,
 	direction trafficDirection,
-) error {
+) (string, error) {
+
+	ipLists := make([]illumioapi.ConsumerOrProvider, 0, len(ipListHrefs))
+	for _, href := range ipListHrefs {
+		ipLists = append(ipLists, illumioapi.ConsumerOrProvider{IPList: &illumioapi.IPList{Href: href}})
+	}
+	labels := append(labelsToCOP(scope.labels), labelsToCOP(groups)...)
 
 	var providers, consumers []illumioapi.ConsumerOrProvider
 
 	if direction == inbound {
-		providers = append(providers, illumioapi.ConsumerOrProvider{Label: &illumioapi.Label{Href: env.Href}})
-		providers = append(providers, labelsToCOP(apps)...)
-		consumers = []illumioapi.ConsumerOrProvider{{IPList: &illumioapi.IPList{Href: ipListHref}}}
+		providers = labels
+		consumers = ipLists
 	} else {
-		providers = []illumioapi.ConsumerOrProvider{{IPList: &illumioapi.IPList{Href: ipListHref}}}
-		consumers = append(consumers, illumioapi.ConsumerOrProvider{Label: &illumioapi.Label{Href: env.Href}})
-		consumers = append(consumers, labelsToCOP(apps)...)
+		providers = ipLists
+		consumers = labels
 	}
 
 	ingressServices := []illumioapi.IngressServices{{Href: serviceHref}}
@@ -498,12 +582,12 @@ func createDenyRule(
 		Description:     ptrString(""),
 	}
 
-	_, api, err := pce.CreateRule(rulesetHref, rule)
+	createdRule, api, err := pce.CreateRule(rulesetHref, rule)
 	if err != nil {
-		return fmt.Errorf("failed to create deny rule: %w", err)
+		return "", fmt.Errorf("failed to create deny rule: %w", err)
 	}
 	vlog("Created deny rule successfully. API response: %s", api.RespBody)
-	return nil
+	return createdRule.Href, nil
 }
 
 func getIPListHref(pce illumioapi.PCE, targetName string) (string, error) {
@@ -522,6 +606,79 @@ func getIPListHref(pce illumioapi.PCE, targetName string) (string, error) {
 	return pce.IPListsSlice[0].Href, nil
 }
 
+// ---------- Output files ----------
+
+// ruleImportRow returns a rule-import csv row for a deny rule
+func ruleImportRow(rulesetName, ruleHref string, dr denyRuleInfo, groups []illumioapi.Label, ipListNames []string) []string {
+	srcLabels, srcIPLists, dstLabels, dstIPLists := csvSides(dr, groups, ipListNames)
+	return []string{rulesetName, "deny", fmt.Sprintf("auto-deny-rules %s %s", dr.direction, dr.scope.name()), "true", srcLabels, srcIPLists, dstLabels, dstIPLists, dr.service.Name, ruleHref}
+}
+
+// denyRuleImportRow returns a deny-rule-import csv row for a proposed deny rule. Part is used in the name when the groups are split into multiple rules.
+func denyRuleImportRow(dr denyRuleInfo, groups []illumioapi.Label, ipListNames []string, part, parts int) []string {
+	srcLabels, srcIPLists, dstLabels, dstIPLists := csvSides(dr, groups, ipListNames)
+	name := fmt.Sprintf("auto-deny-rules %s %s %s", dr.direction, dr.scope.name(), dr.service.Name)
+	if parts > 1 {
+		name = fmt.Sprintf("%s %d of %d", name, part, parts)
+	}
+	return []string{name, "true", "false", srcLabels, srcIPLists, "false", dstLabels, dstIPLists, dr.service.Name}
+}
+
+// csvSides returns the source and destination labels and ip lists of a deny rule in csv format.
+// Inbound rules have the ip lists as the source and outbound rules have them as the destination.
+func csvSides(dr denyRuleInfo, groups []illumioapi.Label, ipListNames []string) (srcLabels, srcIPLists, dstLabels, dstIPLists string) {
+	labels := make([]string, 0, len(dr.scope.labels)+len(groups))
+	for _, l := range append(append([]illumioapi.Label{}, dr.scope.labels...), groups...) {
+		labels = append(labels, fmt.Sprintf("%s:%s", l.Key, l.Value))
+	}
+	if dr.direction == outbound {
+		return strings.Join(labels, ";"), "", "", strings.Join(ipListNames, ";")
+	}
+	return "", strings.Join(ipListNames, ";"), strings.Join(labels, ";"), ""
+}
+
+// denyRuleImportHeaders returns the deny-rule-import csv headers
+func denyRuleImportHeaders() []string {
+	return []string{
+		denyruleexport.HeaderName,
+		denyruleexport.HeaderEnabled,
+		denyruleexport.HeaderSrcAllWorkloads,
+		denyruleexport.HeaderSrcLabels,
+		denyruleexport.HeaderSrcIPLists,
+		denyruleexport.HeaderDstAllWorkloads,
+		denyruleexport.HeaderDstLabels,
+		denyruleexport.HeaderDstIPLists,
+		denyruleexport.HeaderServices,
+	}
+}
+
+// ruleImportHeaders returns the rule-import csv headers
+func ruleImportHeaders() []string {
+	return []string{
+		ruleexport.HeaderRulesetName,
+		ruleexport.HeaderRuleType,
+		ruleexport.HeaderRuleDescription,
+		ruleexport.HeaderRuleEnabled,
+		ruleexport.HeaderSrcLabels,
+		ruleexport.HeaderSrcIplists,
+		ruleexport.HeaderDstLabels,
+		ruleexport.HeaderDstIplists,
+		ruleexport.HeaderServices,
+		ruleexport.HeaderRuleHref,
+	}
+}
+
+// writeRollback writes the hrefs of the created rules and rule set. Rules are listed before the rule set.
+func writeRollback(fileName, rulesetHref, rulesetName string, ruleHrefs []string) {
+	data := [][]string{{"href", "object_type", "name"}}
+	for _, href := range ruleHrefs {
+		data = append(data, []string{href, "rule", rulesetName})
+	}
+	data = append(data, []string{rulesetHref, "rule_set", rulesetName})
+	utils.WriteOutput(data, nil, fileName)
+	log.Printf("Wrote rollback file %s. Run workloader delete %s --header href --provision to remove the created objects.", fileName, fileName)
+}
+
 // ---------- Main runner ----------
 
 func RunAutoDenyRules(
@@ -556,14 +713,22 @@ func RunAutoDenyRules(
 		return err
 	}
 
-	envs, err := getEnvs()
-	if err != nil {
-		return fmt.Errorf("failed to load environments: %w", err)
+	if strings.TrimSpace(groupKey) == "" {
+		return fmt.Errorf("--group-key cannot be empty")
+	}
+	keys := make([]string, 0, len(scopeKeys))
+	for _, k := range scopeKeys {
+		if k = strings.TrimSpace(k); k != "" {
+			if k == groupKey {
+				return fmt.Errorf("--group-key %q cannot also be a scope key", k)
+			}
+			keys = append(keys, k)
+		}
 	}
 
-	services, err := getRansomServices()
+	services, err := getServices(serviceNames, serviceFile)
 	if err != nil {
-		return fmt.Errorf("failed to load ransomware services: %w", err)
+		return fmt.Errorf("failed to load services: %w", err)
 	}
 
 	friendly := time.Now().Format("Jan 02, 2006 15:04:05")
@@ -571,7 +736,7 @@ func RunAutoDenyRules(
 
 	var rulesetHref string
 	if dryRun {
-		log.Printf("[DRY-RUN] Would create rule set %q", rulesetName)
+		log.Printf("[DRY-RUN] No rule set will be created. Proposed deny rules are written to a deny-rule-import csv.")
 	} else {
 		rulesetHref, err = createRuleset(rulesetName)
 		if err != nil {
@@ -580,32 +745,14 @@ func RunAutoDenyRules(
 		log.Printf("Created Auto Deny Rules rule set %s", rulesetHref)
 	}
 
-	type envInfo struct {
-		env  illumioapi.Label
-		apps []illumioapi.Label
-	}
-
-	envInfos := make([]envInfo, 0, len(envs))
-	for _, env := range envs {
-		if !labelAllowed("env", env.Value, labelFilter) {
-			vlog("Skipping env %s due to label filter", env.Value)
-			continue
-		}
-
-		apps, err := getWorkloadsForEnv(pce, env, labelFilter)
-		if err != nil {
-			vlog("Failed to get workloads for env %s: %v", env.Value, err)
-			continue
-		}
-		if len(apps) == 0 {
-			continue
-		}
-		envInfos = append(envInfos, envInfo{env: env, apps: apps})
+	scopes, err := getScopes(pce, keys, groupKey, labelFilter)
+	if err != nil {
+		return fmt.Errorf("failed to load workloads: %w", err)
 	}
 
 	var totalQueries int64
-	for _, ei := range envInfos {
-		totalQueries += int64(len(services) * len(ei.apps) * len(selectedDirs))
+	for _, si := range scopes {
+		totalQueries += int64(len(services) * len(si.groups) * len(selectedDirs))
 	}
 	if totalQueries == 0 {
 		log.Println("No queries to run - exiting.")
@@ -613,11 +760,15 @@ func RunAutoDenyRules(
 	}
 	log.Printf("Total traffic queries to execute: %d", totalQueries)
 
-	ipListHref, err := getIPListHref(pce, targetIPListName)
-	if err != nil {
-		return fmt.Errorf("failed to locate IP-list %q: %w", targetIPListName, err)
+	ipListHrefs := make([]string, 0, len(ipListNames))
+	for _, name := range ipListNames {
+		ipListHref, err := getIPListHref(pce, name)
+		if err != nil {
+			return fmt.Errorf("failed to locate IP-list %q: %w", name, err)
+		}
+		log.Printf("Using the %s IP-list href: %s", name, ipListHref)
+		ipListHrefs = append(ipListHrefs, ipListHref)
 	}
-	log.Printf("Using the Any IP-list href: %s", ipListHref)
 
 	sem := make(chan struct{}, maxConcurrentQueries)
 
@@ -628,8 +779,13 @@ func RunAutoDenyRules(
 		doneQueries int64
 	)
 
-	for _, ei := range envInfos {
-		ei := ei // capture
+	for _, si := range scopes {
+		si := si // capture
+
+		scopeHrefs := make([]string, 0, len(si.labels))
+		for _, l := range si.labels {
+			scopeHrefs = append(scopeHrefs, l.Href)
+		}
 
 		for _, svc := range services {
 			svc := svc // capture
@@ -640,7 +796,7 @@ func RunAutoDenyRules(
 			}
 			var appsMu sync.Mutex
 
-			for _, app := range ei.apps {
+			for _, app := range si.groups {
 				app := app // capture
 
 				for _, dir := range selectedDirs {
@@ -655,7 +811,7 @@ func RunAutoDenyRules(
 
 						ok, err := submitTrafficQuery(
 							pce,
-							ei.env.Href,
+							scopeHrefs,
 							app.Href,
 							svc,
 							excludeBroadcast,
@@ -665,8 +821,8 @@ func RunAutoDenyRules(
 
 						if err != nil {
 							log.Printf(
-								"[QUERY] %s Env:%s App:%s Service:%s → error: %v",
-								dir, ei.env.Value, app.Value, svc.Name, err,
+								"[QUERY] %s Scope:%s %s:%s Service:%s → error: %v",
+								dir, si.name(), app.Key, app.Value, svc.Name, err,
 							)
 						} else if ok {
 							appsMu.Lock()
@@ -675,22 +831,26 @@ func RunAutoDenyRules(
 						}
 
 						atomic.AddInt64(&doneQueries, 1)
-						logQueryProgress(ei.env, app, svc, dir, atomic.LoadInt64(&doneQueries), totalQueries)
+						logQueryProgress(si, app, svc, dir, atomic.LoadInt64(&doneQueries), totalQueries)
 					}()
 				}
 			}
 
 			wg.Wait()
 
-			for dir, apps := range appsNoTraffic {
+			for _, dir := range selectedDirs {
+				apps := appsNoTraffic[dir]
 				if len(apps) == 0 {
 					continue
 				}
+				sort.Slice(apps, func(i, j int) bool {
+					return strings.ToLower(apps[i].Value) < strings.ToLower(apps[j].Value)
+				})
 				denyRulesMu.Lock()
 				denyRules = append(denyRules, denyRuleInfo{
-					env:       ei.env,
+					scope:     si,
 					service:   svc,
-					apps:      apps,
+					groups:    apps,
 					direction: dir,
 				})
 				denyRulesMu.Unlock()
@@ -699,35 +859,59 @@ func RunAutoDenyRules(
 	}
 
 	// Create deny rules
+	ts := time.Now().Format("20060102_150405")
+	if outputFileName == "" {
+		outputFileName = fmt.Sprintf("workloader-auto-deny-rules-%s.csv", ts)
+	}
+	if rollbackFileName == "" {
+		rollbackFileName = fmt.Sprintf("workloader-auto-deny-rules-rollback-%s.csv", ts)
+	}
+	ruleImportData := [][]string{ruleImportHeaders()}
+	if dryRun {
+		ruleImportData = [][]string{denyRuleImportHeaders()}
+	}
+	var ruleHrefs []string
+
 	if len(denyRules) > 0 {
 		log.Printf("Creating %d deny rule(s)...", len(denyRules))
 		var doneDenyRules int64
 
 		for _, dr := range denyRules {
-			appChunks := chunkApps(dr.apps, maxAppsPerRule)
+			appChunks := chunkApps(dr.groups, maxAppsPerRule)
 
 			if len(appChunks) > 1 {
-				log.Printf("Service %s in env %s has %d apps — splitting into %d rules",
-					dr.service.Name, dr.env.Value, len(dr.apps), len(appChunks))
+				log.Printf("Service %s in scope %s has %d %s labels — splitting into %d rules",
+					dr.service.Name, dr.scope.name(), len(dr.groups), groupKey, len(appChunks))
 			}
 
 			for idx, apps := range appChunks {
 				if dryRun {
-					log.Printf("[DRY-RUN] Would create deny rule %d/%d: env=%s service=%s apps=%d",
-						idx+1, len(appChunks), dr.env.Value, dr.service.Name, len(apps))
+					log.Printf("[DRY-RUN] Would create deny rule %d/%d: scope=%s service=%s %s=%d",
+						idx+1, len(appChunks), dr.scope.name(), dr.service.Name, groupKey, len(apps))
+					ruleImportData = append(ruleImportData, denyRuleImportRow(dr, apps, ipListNames, idx+1, len(appChunks)))
 					continue
 				}
 
-				err := createDenyRule(pce, rulesetHref, dr.service.Href, apps, dr.env, ipListHref, dr.direction)
+				ruleHref, err := createDenyRule(pce, rulesetHref, dr.service.Href, apps, dr.scope, ipListHrefs, dr.direction)
 				if err != nil {
-					log.Printf("Failed to create deny rule %d/%d for env %s service %s: %v",
-						idx+1, len(appChunks), dr.env.Value, dr.service.Name, err)
+					log.Printf("Failed to create deny rule %d/%d for scope %s service %s: %v",
+						idx+1, len(appChunks), dr.scope.name(), dr.service.Name, err)
 					continue
 				}
+				ruleHrefs = append(ruleHrefs, ruleHref)
+				ruleImportData = append(ruleImportData, ruleImportRow(rulesetName, ruleHref, dr, apps, ipListNames))
 
 				atomic.AddInt64(&doneDenyRules, 1)
 			}
 		}
+
+		utils.WriteOutput(ruleImportData, nil, outputFileName)
+		if dryRun {
+			log.Printf("[DRY-RUN] Wrote %d proposed deny rule(s) to deny-rule-import file %s. Review and run workloader deny-rule-import %s --update-pce to create them.", len(ruleImportData)-1, outputFileName, outputFileName)
+		} else {
+			log.Printf("Wrote %d deny rule(s) to rule-import file %s", len(ruleImportData)-1, outputFileName)
+			writeRollback(rollbackFileName, rulesetHref, rulesetName, ruleHrefs)
+		}
 	}
 
 	// If no deny rules were created, delete ruleset (unless dry-run).
@@ -1,9 +1,10 @@
 package containmentswitch
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
-	"strconv"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -14,7 +15,7 @@ import (
 	"github.com/spf13/viper"
 )
 
-var start, end, objectName string
+var start, end, objectName, playbookFile, recordFile, rollbackFile string
 var skipAllow, skipModeChange, updatePCE, noPrompt bool
 var pce illumioapi.PCE
 var err error
@@ -24,7 +25,10 @@ func init() {
 	ContainmentSwitchCmd.Flags().StringVarP(&end, "end", "e", time.Now().AddDate(0, 0, -7).In(time.UTC).Format("2006-01-02"), "end date in the format of yyyy-mm-dd.")
 	ContainmentSwitchCmd.Flags().BoolVar(&skipAllow, "skip-allow", false, "do not analyze traffic to see where traffic should be allowed.")
 	ContainmentSwitchCmd.Flags().BoolVar(&skipModeChange, "skip-mode-change", false, "do not move all visibility-only workloads into selective-enforcement.")
-	ContainmentSwitchCmd.Flags().StringVar(&objectName, "object-name", "", "name for created policy objects (virtual services, rules, and deny rules). if none is provided the default is \"workloader-containment-switch-Port-Protocol\"")
+	ContainmentSwitchCmd.Flags().StringVar(&objectName, "object-name", "", "name for created policy objects (virtual services, rules, and deny rules). if none is provided the default is \"workloader-containment-switch-Port-Protocol\" or \"workloader-containment-switch-Playbook\" for a playbook.")
+	ContainmentSwitchCmd.Flags().StringVar(&playbookFile, "playbook", "", "csv file with port and protocol headers and an optional name header to contain several ports in one run instead of the port and protocol arguments.")
+	ContainmentSwitchCmd.Flags().StringVar(&recordFile, "record-file", "", "name of the record file with the created objects and changed workloads. default is current location with a timestamped filename.")
+	ContainmentSwitchCmd.Flags().StringVar(&rollbackFile, "rollback", "", "record file from a previous containment-switch to roll back. restores the enforcement modes and deletes the created objects.")
 
 	ContainmentSwitchCmd.Flags().SortFlags = false
 }
@@ -51,8 +55,20 @@ Steps 1 through 4 can be skipped with the --skip-allow flag to bypass creating a
 
 Step 7 can be skipped with the --skip-mode-change so visibility-only workloads are not put into selective-enforcement.
 
-The --update-pce flag is required for Steps 2 through 7. If the --update-pce flag is not set workloader will run the explorer query and provide information for how many workloads would be bound to the virtual service for the allow rule.
+Use --playbook instead of the port and protocol arguments to contain several ports in one run. The playbook is a csv with port and protocol headers and an optional name header (e.g., smb,445,tcp). Names must be unique. Each port gets a virtual service named object-name-name and a rule in one ruleset. One enforcement boundary covers all the ports. The virtual services are provisioned first so workloads can be bound to them and the ruleset and enforcement boundary are provisioned together.
+
+Every created object and every workload moved to selective enforcement (with its previous enforcement mode) is written to a record file as it happens. The record file must not already exist. Run containment-switch --rollback record-file to restore the enforcement modes of workloads still in selective enforcement and delete and provision the deletion of the created objects.
+
+The --update-pce flag is required for Steps 2 through 7 and for --rollback. If the --update-pce flag is not set workloader will run the explorer query and provide information for how many workloads would be bound to the virtual service for the allow rule.
 `,
+	Example: `# Contain 445 tcp
+workloader containment-switch 445 tcp --update-pce
+
+# Contain the ports in a playbook
+workloader containment-switch --playbook lateral-movement.csv --update-pce
+
+# Roll back a containment-switch
+workloader containment-switch --rollback workloader-containment-switch-record-20240301_120000.csv --update-pce`,
 	Run: func(cmd *cobra.Command, args []string) {
 
 		pce, err = utils.GetTargetPCEV2(true)
@@ -60,25 +76,64 @@ The --update-pce flag is required for Steps 2 through 7. If the --update-pce fla
 			utils.LogError(err.Error())
 		}
 
-		// Get User Input
-		if len(args) != 2 {
-			fmt.Println("Command requires 2 arguments for the port and protocol. The input should be in the format of 445 tcp. See usage help.")
-			os.Exit(0)
-		}
-		targetPort, err := strconv.Atoi(args[0])
-		if err != nil {
-			utils.LogError(fmt.Sprintf("invalid input - %s is not an integer.", args[0]))
-		}
-
 		// Get the debug value from viper
 		updatePCE = viper.GetBool("update_pce")
 		noPrompt = viper.GetBool("no_prompt")
 
-		portLock(targetPort, args[1])
+		// Roll back a previous run
+		if rollbackFile != "" {
+			rollback(rollbackFile)
+			return
+		}
+
+		// Check the record file before making changes
+		if recordFile != "" {
+			if _, err := os.Stat(recordFile); err == nil {
+				utils.LogErrorf("record file %s already exists. use a new --record-file so a rollback only undoes the changes of this run.", recordFile)
+			}
+		}
+
+		// Get User Input
+		var targets []target
+		if playbookFile != "" {
+			if len(args) != 0 {
+				utils.LogError("the port and protocol arguments cannot be used with --playbook")
+			}
+			targets, err = parsePlaybook(playbookFile)
+			if err != nil {
+				utils.LogError(err.Error())
+			}
+			if objectName == "" {
+				objectName = fmt.Sprintf("workloader-containment-switch-%s", strings.TrimSuffix(filepath.Base(playbookFile), filepath.Ext(playbookFile)))
+			}
+		} else {
+			if len(args) != 2 {
+				fmt.Println("Command requires 2 arguments for the port and protocol or the --playbook flag. The input should be in the format of 445 tcp. See usage help.")
+				os.Exit(0)
+			}
+			t, err := newTarget("", args[0], args[1])
+			if err != nil {
+				utils.LogError(err.Error())
+			}
+			targets = []target{t}
+			if objectName == "" {
+				objectName = fmt.Sprintf("workloader-containment-switch-%d-%s", t.port, t.protocol)
+			}
+		}
+
+		portLock(targets)
 	},
 }
 
-func portLock(port int, protocol string) {
+// virtualServiceName returns the name of a target's virtual service. A single target uses the object name.
+func virtualServiceName(targets []target, t target) string {
+	if len(targets) == 1 {
+		return objectName
+	}
+	return fmt.Sprintf("%s-%s", objectName, t.name)
+}
+
+func portLock(targets []target) {
 
 	// Get visibility only workloads
 	api, err := pce.GetWklds(map[string]string{"managed": "true", "enforcement_mode": "visibility_only"})
@@ -86,26 +141,7 @@ func portLock(port int, protocol string) {
 	if err != nil {
 		utils.LogError(err.Error())
 	}
-
-	if port < 0 || port > 65535 {
-		utils.LogError(fmt.Sprintf("invalid input - %d is not a valid port.", port))
-	}
-
-	// Validate the protocol
-	protocol = strings.ToLower(protocol)
-	if protocol != "tcp" && protocol != "udp" {
-		utils.LogError(fmt.Sprintf("invalid input - %s is not a valid protocol", strings.ToLower(protocol)))
-	}
-	// Set to the right protocol
-	protocolNum := 17
-	if protocol == "tcp" {
-		protocolNum = 6
-	}
-
-	// Set the Object Name
-	if objectName == "" {
-		objectName = fmt.Sprintf("workloader-containment-switch-%d-%s", port, protocol)
-	}
+	visibilityWklds := pce.WorkloadsSlice
 
 	// Get the Any IP List for use in the rule and/or enfourcement boundary.
 	// Get it here so it's available in the traffic conditional as well as in the EB
@@ -115,14 +151,18 @@ func portLock(port int, protocol string) {
 		utils.LogError(err.Error())
 	}
 
+	// Get all the workloads with the inbound traffic for each target
+	targetWorkloads := make(map[string]map[string]illumioapi.Workload)
 	if !skipAllow {
 		// Build the explorer query
 		tq := illumioapi.TrafficQuery{
 			MaxFLows:                        100000,
 			PolicyStatuses:                  []string{"potentially_blocked", "unknown"},
-			PortProtoInclude:                [][2]int{{port, protocolNum}},
 			ExcludeWorkloadsFromIPListQuery: true,
 		}
+		for _, t := range targets {
+			tq.PortProtoInclude = append(tq.PortProtoInclude, [2]int{t.port, t.protocolNum})
+		}
 
 		// Get the start date
 		tq.StartTime, err = time.Parse("2006-01-02 MST", fmt.Sprintf("%s %s", start, "UTC"))
@@ -146,106 +186,154 @@ func portLock(port int, protocol string) {
 		}
 		utils.LogInfo(fmt.Sprintf("explorer query returned %d records", len(traffic)), true)
 
-		// Get all the workloads with the inbound traffic
-		targetWorkloads := make(map[string]illumioapi.Workload)
 		for _, t := range traffic {
 			if t.Dst.Workload != nil && t.Dst.Workload.Href != "" && !strings.Contains(t.Dst.Workload.Href, "/container_workloads/") {
-				targetWorkloads[t.Dst.Workload.Href] = *t.Dst.Workload
+				key := fmt.Sprintf("%d-%d", t.ExpSrv.Port, t.ExpSrv.Proto)
+				if targetWorkloads[key] == nil {
+					targetWorkloads[key] = make(map[string]illumioapi.Workload)
+				}
+				targetWorkloads[key][t.Dst.Workload.Href] = *t.Dst.Workload
 			}
 		}
-		utils.LogInfo(fmt.Sprintf("identified %d workloads to bind to the virtual service. See workloader.log for list.", len(targetWorkloads)), true)
-		for _, t := range targetWorkloads {
-			name := t.Hostname
-			if illumioapi.PtrToVal(name) == "" {
-				name = t.Name
+		for _, tgt := range targets {
+			wklds := targetWorkloads[fmt.Sprintf("%d-%d", tgt.port, tgt.protocolNum)]
+			utils.LogInfo(fmt.Sprintf("identified %d workloads to bind to the virtual service for %d %s. See workloader.log for list.", len(wklds), tgt.port, tgt.protocol), true)
+			for _, t := range wklds {
+				name := t.Hostname
+				if illumioapi.PtrToVal(name) == "" {
+					name = t.Name
+				}
+				utils.LogInfo(fmt.Sprintf("%d %s - %s - %s", tgt.port, tgt.protocol, illumioapi.PtrToVal(name), t.Href), false)
 			}
-			utils.LogInfo(fmt.Sprintf("%s - %s", illumioapi.PtrToVal(name), t.Href), false)
 		}
+	}
 
-		// Check that we should make changes to the PCE.
-		if !updatePCE {
-			utils.LogInfo("run with --update-pce and optionally --no-prompt flag to implement containment-switch.", true)
-			return
-		}
+	// Check that we should make changes to the PCE.
+	if !updatePCE {
+		utils.LogInfo("run with --update-pce and optionally --no-prompt flag to implement containment-switch.", true)
+		return
+	}
 
-		if !noPrompt {
-			changes := []string{}
-			if len(targetWorkloads) > 0 {
-				changes = append(changes, fmt.Sprintf("create the %s virtual service and bind %d workloads to it", objectName, len(targetWorkloads)))
-				changes = append(changes, fmt.Sprintf("create the %s ruleset allowing traffic to the created virtual service on %d %s", objectName, port, protocol))
-			}
-			changes = append(changes, fmt.Sprintf("create the %s enforcement boundary for any IP address to all workloads on %d %s", objectName, port, protocol))
-			if !skipModeChange {
-				changes = append(changes, fmt.Sprintf("move %d workloads from visibility-only to selective-enforcement to enforce created boundary", len(pce.WorkloadsSlice)))
+	if !noPrompt {
+		changes := []string{}
+		for _, t := range targets {
+			if wklds := targetWorkloads[fmt.Sprintf("%d-%d", t.port, t.protocolNum)]; len(wklds) > 0 {
+				changes = append(changes, fmt.Sprintf("create the %s virtual service and bind %d workloads to it", virtualServiceName(targets, t), len(wklds)))
+				changes = append(changes, fmt.Sprintf("create a rule in the %s ruleset allowing traffic to the created virtual service on %d %s", objectName, t.port, t.protocol))
 			}
+		}
+		ports := []string{}
+		for _, t := range targets {
+			ports = append(ports, fmt.Sprintf("%d %s", t.port, t.protocol))
+		}
+		changes = append(changes, fmt.Sprintf("create the %s enforcement boundary for any IP address to all workloads on %s", objectName, strings.Join(ports, ", ")))
+		if !skipModeChange {
+			changes = append(changes, fmt.Sprintf("move %d workloads from visibility-only to selective-enforcement to enforce created boundary", len(visibilityWklds)))
+		}
 
-			var prompt string
-			fmt.Printf("\r\n%s[PROMPT] - workloader will do the following in %s (%s):\r\n", time.Now().Format("2006-01-02 15:04:05 "), pce.FriendlyName, viper.GetString(pce.FriendlyName+".fqdn"))
-			for i, c := range changes {
-				fmt.Printf("%s [PROMPT] - %d) %s\r\n", time.Now().Format("2006-01-02 15:04:05"), i+1, c)
-			}
-			fmt.Printf("%s [PROMPT] - Do you want to run the containment-switch (yes/no)? ", time.Now().Format("2006-01-02 15:04:05"))
-			fmt.Scanln(&prompt)
-			if strings.ToLower(prompt) != "yes" {
-				utils.LogInfo("prompt denied", true)
+		var prompt string
+		fmt.Printf("\r\n%s[PROMPT] - workloader will do the following in %s (%s):\r\n", time.Now().Format("2006-01-02 15:04:05 "), pce.FriendlyName, viper.GetString(pce.FriendlyName+".fqdn"))
+		for i, c := range changes {
+			fmt.Printf("%s [PROMPT] - %d) %s\r\n", time.Now().Format("2006-01-02 15:04:05"), i+1, c)
+		}
+		fmt.Printf("%s [PROMPT] - Do you want to run the containment-switch (yes/no)? ", time.Now().Format("2006-01-02 15:04:05"))
+		fmt.Scanln(&prompt)
+		if strings.ToLower(prompt) != "yes" {
+			utils.LogInfo("prompt denied", true)
 
-				return
-			}
-			fmt.Println()
+			return
 		}
+		fmt.Println()
+	}
 
-		// Create the virutal service if we have workloads that need it.
-		if len(targetWorkloads) > 0 {
+	// Start the record of changes
+	rec, err := newRecord(recordFile)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	provisionHrefs := []string{}
 
-			// Create the virtual service
-			vs := illumioapi.VirtualService{
-				Description:  illumioapi.Ptr(fmt.Sprintf("created by workloader containment-switch for %d %s", port, protocol)),
-				Name:         objectName,
-				ServicePorts: &[]illumioapi.ServicePort{{Port: &port, Protocol: protocolNum}}}
+	// Create the virutal services if we have workloads that need them.
+	virtualServices := make(map[string]illumioapi.VirtualService)
+	for _, t := range targets {
+		if len(targetWorkloads[fmt.Sprintf("%d-%d", t.port, t.protocolNum)]) == 0 {
+			continue
+		}
+		port := t.port
+		vs := illumioapi.VirtualService{
+			Description:  illumioapi.Ptr(fmt.Sprintf("created by workloader containment-switch for %d %s", t.port, t.protocol)),
+			Name:         virtualServiceName(targets, t),
+			ServicePorts: &[]illumioapi.ServicePort{{Port: &port, Protocol: t.protocolNum}}}
+
+		vs, api, err = pce.CreateVirtualService(vs)
+		utils.LogAPIRespV2("CreateVirtualService", api)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		rec.add(recordEntry{action: actionCreated, objectType: objectVirtualService, href: vs.Href, name: vs.Name})
+		utils.LogInfo(fmt.Sprintf("created virtual service - %s - %s - status code: %d", vs.Name, vs.Href, api.StatusCode), true)
+		virtualServices[t.name] = vs
+	}
 
-			vs, api, err = pce.CreateVirtualService(vs)
-			utils.LogAPIRespV2("CreateVirtualService", api)
-			if err != nil {
-				utils.LogError(err.Error())
-			}
-			utils.LogInfo(fmt.Sprintf("created virtual service - %s - %s - status code: %d", vs.Name, vs.Href, api.StatusCode), true)
+	if len(virtualServices) > 0 {
 
-			// Provision the virutal service
-			api, err = pce.ProvisionHref([]string{vs.Href}, "provisioned by workloader containment-switch")
-			utils.LogAPIRespV2("ProvisionHref", api)
-			if err != nil {
-				utils.LogError(err.Error())
+		// Provision the virutal services so workloads can be bound to them
+		vsHrefs := []string{}
+		for _, t := range targets {
+			if vs, ok := virtualServices[t.name]; ok {
+				vsHrefs = append(vsHrefs, vs.Href)
 			}
-			utils.LogInfo(fmt.Sprintf("provisioned virtual service - status code: %d", api.StatusCode), true)
+		}
+		api, err = pce.ProvisionHref(vsHrefs, "provisioned by workloader containment-switch")
+		utils.LogAPIRespV2("ProvisionHref", api)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		utils.LogInfo(fmt.Sprintf("provisioned %d virtual services - status code: %d", len(vsHrefs), api.StatusCode), true)
 
-			// Bind the workloads
+		// Bind the workloads
+		for _, t := range targets {
+			vs, ok := virtualServices[t.name]
+			if !ok {
+				continue
+			}
 			serviceBindings := []illumioapi.ServiceBinding{}
-			for _, w := range targetWorkloads {
+			for _, w := range targetWorkloads[fmt.Sprintf("%d-%d", t.port, t.protocolNum)] {
 				wkld := w
 				serviceBindings = append(serviceBindings, illumioapi.ServiceBinding{VirtualService: &vs, Workload: &wkld})
 			}
-			_, api, err = pce.CreateServiceBinding(serviceBindings)
+			bindings, api, err := pce.CreateServiceBinding(serviceBindings)
 			utils.LogAPIRespV2("CreateServiceBinding", api)
 			if err != nil {
 				utils.LogError(err.Error())
 			}
-			utils.LogInfo(fmt.Sprintf("bound %d workloads to %s virtual service - status code: %d", len(targetWorkloads), vs.Name, api.StatusCode), true)
-
-			// Create a new ruleset
-			rs := illumioapi.RuleSet{
-				Description: illumioapi.Ptr("created by workloader containment-switch"),
-				Name:        objectName,
-			}
-			rs.Scopes = &[][]illumioapi.Scopes{}
-			//rs.Scopes = append(rs.Scopes, []*illumioapi.Scopes{})
-			rs, api, err = pce.CreateRuleset(rs)
-			utils.LogAPIRespV2("CreateRuleSet", api)
-			if err != nil {
-				utils.LogError(err.Error())
+			for _, b := range bindings {
+				rec.add(recordEntry{action: actionCreated, objectType: objectServiceBinding, href: b.Href, name: vs.Name})
 			}
-			utils.LogInfo(fmt.Sprintf("created %s ruleset - %s - status code: %d", rs.Name, rs.Href, api.StatusCode), true)
+			utils.LogInfo(fmt.Sprintf("bound %d workloads to %s virtual service - status code: %d", len(serviceBindings), vs.Name, api.StatusCode), true)
+		}
 
-			// Create a new rule
+		// Create a new ruleset
+		rs := illumioapi.RuleSet{
+			Description: illumioapi.Ptr("created by workloader containment-switch"),
+			Name:        objectName,
+		}
+		rs.Scopes = &[][]illumioapi.Scopes{}
+		rs, api, err = pce.CreateRuleset(rs)
+		utils.LogAPIRespV2("CreateRuleSet", api)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		rec.add(recordEntry{action: actionCreated, objectType: objectRuleset, href: rs.Href, name: rs.Name})
+		utils.LogInfo(fmt.Sprintf("created %s ruleset - %s - status code: %d", rs.Name, rs.Href, api.StatusCode), true)
+		provisionHrefs = append(provisionHrefs, rs.Href)
+
+		// Create a rule for each virtual service
+		for _, t := range targets {
+			vs, ok := virtualServices[t.name]
+			if !ok {
+				continue
+			}
 			enabled := true
 			rule := illumioapi.Rule{
 				Providers:       &[]illumioapi.ConsumerOrProvider{{VirtualService: &illumioapi.VirtualService{Href: vs.Href}}},
@@ -259,45 +347,46 @@ func portLock(port int, protocol string) {
 			if err != nil {
 				utils.LogError(err.Error())
 			}
-			utils.LogInfo(fmt.Sprintf("created rule in %s - %s - status code: %d", rs.Name, rule.Href, api.StatusCode), true)
-
-			// Provision the ruleset
-			api, err = pce.ProvisionHref([]string{rs.Href}, "provisioned by workloader containment-switch")
-			utils.LogAPIRespV2("ProvisionHref", api)
-			if err != nil {
-				utils.LogError(err.Error())
-			}
-			utils.LogInfo(fmt.Sprintf("provisioned ruleset - status code: %d", api.StatusCode), true)
-
+			rec.add(recordEntry{action: actionCreated, objectType: objectRule, href: rule.Href, name: vs.Name})
+			utils.LogInfo(fmt.Sprintf("created rule in %s for %s - %s - status code: %d", rs.Name, vs.Name, rule.Href, api.StatusCode), true)
 		}
 	}
 
 	// Create the enforcement boundary
+	ingressServices := []illumioapi.IngressServices{}
+	for _, t := range targets {
+		port, protocolNum := t.port, t.protocolNum
+		ingressServices = append(ingressServices, illumioapi.IngressServices{Port: &port, Protocol: &protocolNum})
+	}
 	eb := illumioapi.EnforcementBoundary{
 		Name:            objectName,
 		Consumers:       &[]illumioapi.ConsumerOrProvider{{IPList: &illumioapi.IPList{Href: anyIPList.Href}}},
 		Providers:       &[]illumioapi.ConsumerOrProvider{{Actors: illumioapi.Ptr("ams")}},
-		IngressServices: &[]illumioapi.IngressServices{{Port: &port, Protocol: &protocolNum}},
+		IngressServices: &ingressServices,
 	}
 	eb, api, err = pce.CreateEnforcementBoundary(eb)
 	utils.LogAPIRespV2("CreateEnforcementBoundary", api)
 	if err != nil {
 		utils.LogError(err.Error())
 	}
+	rec.add(recordEntry{action: actionCreated, objectType: objectEnforcementBoundary, href: eb.Href, name: eb.Name})
 	utils.LogInfo(fmt.Sprintf("created enforcement boundary - %s - %s - status code: %d", eb.Name, eb.Href, api.StatusCode), true)
+	provisionHrefs = append(provisionHrefs, eb.Href)
 
-	// Provision enforcement boundary
-	api, err = pce.ProvisionHref([]string{eb.Href}, "provisioned by workloader containment-switch")
+	// Provision the ruleset and enforcement boundary together
+	api, err = pce.ProvisionHref(provisionHrefs, "provisioned by workloader containment-switch")
 	utils.LogAPIRespV2("ProvisionHref", api)
 	if err != nil {
 		utils.LogError(err.Error())
 	}
-	utils.LogInfo(fmt.Sprintf("provisioned enforcement boundary - status code: %d", api.StatusCode), true)
+	utils.LogInfo(fmt.Sprintf("provisioned %d objects - status code: %d", len(provisionHrefs), api.StatusCode), true)
 
 	// Move all visibility-only workloads into selective enforcement
 	if !skipModeChange {
 		updateWklds := []illumioapi.Workload{}
-		for _, w := range pce.WorkloadsSlice {
+		originals := make(map[string]illumioapi.Workload)
+		for _, w := range visibilityWklds {
+			originals[w.Href] = w
 			w.EnforcementMode = illumioapi.Ptr("selective")
 			updateWklds = append(updateWklds, w)
 		}
@@ -307,11 +396,34 @@ func portLock(port int, protocol string) {
 			for _, a := range apiResps {
 				utils.LogAPIRespV2("BulkWorkload", a)
 			}
+			updated := recordModeChanges(rec, originals, apiResps)
 			if err != nil {
 				utils.LogError(err.Error())
 			}
+			utils.LogInfof(true, "moved %d workloads to selective", updated)
 		}
 	}
+
 	// Log the end of the command
+	utils.LogInfof(true, "run workloader containment-switch --rollback %s --update-pce to undo the changes", rec.fileName)
+}
 
+// recordModeChanges records the workloads the bulk update moved to selective and returns the count.
+// Only updated workloads are recorded so a rollback does not change workloads that were not moved.
+func recordModeChanges(rec *record, originals map[string]illumioapi.Workload, apiResps []illumioapi.APIResponse) int {
+	updated := 0
+	for _, a := range apiResps {
+		var bulkResps []illumioapi.BulkResponse
+		json.Unmarshal([]byte(a.RespBody), &bulkResps)
+		for _, b := range bulkResps {
+			w, ok := originals[b.Href]
+			if !ok || b.Status != "updated" {
+				utils.LogWarningf(true, "%s - not moved to selective - status %s", b.Href, b.Status)
+				continue
+			}
+			rec.add(recordEntry{action: actionChanged, objectType: objectWorkload, href: w.Href, name: illumioapi.PtrToVal(w.Hostname), previousValue: illumioapi.PtrToVal(w.EnforcementMode), newValue: "selective"})
+			updated++
+		}
+	}
+	return updated
 }
@@ -0,0 +1,93 @@
+package containmentswitch
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/brian1917/workloader/utils"
+)
+
+// target is a port and protocol to contain
+type target struct {
+	name        string
+	port        int
+	protocol    string
+	protocolNum int
+}
+
+// newTarget validates the port and protocol. The name defaults to port-protocol.
+func newTarget(name, port, protocol string) (target, error) {
+	p, err := strconv.Atoi(strings.TrimSpace(port))
+	if err != nil {
+		return target{}, fmt.Errorf("invalid input - %s is not an integer", port)
+	}
+	if p < 0 || p > 65535 {
+		return target{}, fmt.Errorf("invalid input - %d is not a valid port", p)
+	}
+	t := target{name: strings.TrimSpace(name), port: p, protocol: strings.ToLower(strings.TrimSpace(protocol))}
+	switch t.protocol {
+	case "tcp":
+		t.protocolNum = 6
+	case "udp":
+		t.protocolNum = 17
+	default:
+		return target{}, fmt.Errorf("invalid input - %s is not a valid protocol", t.protocol)
+	}
+	if t.name == "" {
+		t.name = fmt.Sprintf("%d-%s", t.port, t.protocol)
+	}
+	return t, nil
+}
+
+// parsePlaybook parses a csv with port and protocol columns and an optional name column
+func parsePlaybook(file string) ([]target, error) {
+	data, err := utils.ParseCSV(file)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 2 {
+		return nil, fmt.Errorf("%s has no port and protocol entries", file)
+	}
+
+	name, port, protocol := -1, -1, -1
+	for i, h := range data[0] {
+		switch strings.ToLower(strings.TrimSpace(h)) {
+		case "name":
+			name = i
+		case "port":
+			port = i
+		case "protocol", "proto":
+			protocol = i
+		}
+	}
+	if port == -1 || protocol == -1 {
+		return nil, fmt.Errorf("%s must have port and protocol headers", file)
+	}
+
+	targets := []target{}
+	seen := make(map[string]bool)
+	names := make(map[string]int)
+	for i, row := range data[1:] {
+		n := ""
+		if name != -1 {
+			n = row[name]
+		}
+		t, err := newTarget(n, row[port], row[protocol])
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d - %s", file, i+2, err)
+		}
+		key := fmt.Sprintf("%d-%d", t.port, t.protocolNum)
+		if seen[key] {
+			utils.LogWarningf(true, "%s line %d - %d %s is already in the playbook. skipping.", file, i+2, t.port, t.protocol)
+			continue
+		}
+		if line, ok := names[t.name]; ok {
+			return nil, fmt.Errorf("%s line %d - name %s is already used on line %d. names must be unique since they name the virtual services", file, i+2, t.name, line)
+		}
+		names[t.name] = i + 2
+		seen[key] = true
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
@@ -0,0 +1,74 @@
+package containmentswitch
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/brian1917/workloader/utils"
+)
+
+func TestMain(m *testing.M) {
+	utils.Logger.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// writeCSV writes the csv to a temp file and returns the path
+func writeCSV(t *testing.T, csv string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "input.csv")
+	if err := os.WriteFile(file, []byte(csv), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestParsePlaybook(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		want    []target
+		wantErr string
+	}{
+		{
+			name: "names and defaults",
+			csv:  "name,port,protocol\nsmb,445,TCP\n,3389,tcp\nnetbios,137, udp\n",
+			want: []target{{name: "smb", port: 445, protocol: "tcp", protocolNum: 6}, {name: "3389-tcp", port: 3389, protocol: "tcp", protocolNum: 6}, {name: "netbios", port: 137, protocol: "udp", protocolNum: 17}},
+		},
+		{
+			name: "no name column and proto header",
+			csv:  "Proto,Port\ntcp,22\n",
+			want: []target{{name: "22-tcp", port: 22, protocol: "tcp", protocolNum: 6}},
+		},
+		{
+			name: "duplicate port is skipped",
+			csv:  "port,protocol\n445,tcp\n445,TCP\n",
+			want: []target{{name: "445-tcp", port: 445, protocol: "tcp", protocolNum: 6}},
+		},
+		{name: "duplicate name", csv: "name,port,protocol\nsmb,445,tcp\nsmb,139,tcp\n", wantErr: "name smb is already used on line 2"},
+		{name: "missing protocol header", csv: "name,port\nsmb,445\n", wantErr: "must have port and protocol headers"},
+		{name: "no entries", csv: "port,protocol\n", wantErr: "has no port and protocol entries"},
+		{name: "invalid port", csv: "port,protocol\n70000,tcp\n", wantErr: "line 2 - invalid input - 70000 is not a valid port"},
+		{name: "port is not a number", csv: "port,protocol\nsmb,tcp\n", wantErr: "smb is not an integer"},
+		{name: "invalid protocol", csv: "port,protocol\n445,icmp\n", wantErr: "icmp is not a valid protocol"},
+	}
+	for _, tc := range tests {
+		got, err := parsePlaybook(writeCSV(t, tc.csv))
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("%s - error is %v, want %q", tc.name, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s - %s", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s - targets are %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
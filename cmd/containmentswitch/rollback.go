@@ -0,0 +1,179 @@
+package containmentswitch
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/viper"
+)
+
+// Record actions and object types
+const (
+	actionCreated = "created"
+	actionChanged = "changed"
+
+	objectVirtualService      = "virtual_service"
+	objectServiceBinding      = "service_binding"
+	objectRuleset             = "rule_set"
+	objectRule                = "rule"
+	objectEnforcementBoundary = "enforcement_boundary"
+	objectWorkload            = "workload"
+)
+
+var recordHeaders = []string{"action", "object_type", "href", "name", "previous_value", "new_value"}
+
+// recordEntry is a created object or changed workload in the record file
+type recordEntry struct {
+	action, objectType, href, name, previousValue, newValue string
+}
+
+// record writes each change to the record file as it happens so a partial run can be rolled back
+type record struct {
+	fileName string
+}
+
+// newRecord starts a record file. An existing file is not reused so a rollback only undoes the changes of one run.
+func newRecord(fileName string) (*record, error) {
+	if fileName == "" {
+		fileName = fmt.Sprintf("workloader-containment-switch-record-%s.csv", time.Now().Format("20060102_150405"))
+	}
+	if _, err := os.Stat(fileName); err == nil {
+		return nil, fmt.Errorf("record file %s already exists. use a new --record-file", fileName)
+	}
+	utils.WriteLineOutput(recordHeaders, fileName)
+	return &record{fileName: fileName}, nil
+}
+
+func (r *record) add(e recordEntry) {
+	utils.WriteLineOutput([]string{e.action, e.objectType, e.href, e.name, e.previousValue, e.newValue}, r.fileName)
+}
+
+// parseRecord parses a record file
+func parseRecord(file string) ([]recordEntry, error) {
+	data, err := utils.ParseCSV(file)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%s is empty", file)
+	}
+	index := make(map[string]int)
+	for i, h := range data[0] {
+		index[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	for _, h := range recordHeaders {
+		if _, ok := index[h]; !ok {
+			return nil, fmt.Errorf("%s is not a containment-switch record file - missing %s header", file, h)
+		}
+	}
+	entries := []recordEntry{}
+	for _, row := range data[1:] {
+		entries = append(entries, recordEntry{
+			action:        row[index["action"]],
+			objectType:    row[index["object_type"]],
+			href:          row[index["href"]],
+			name:          row[index["name"]],
+			previousValue: row[index["previous_value"]],
+			newValue:      row[index["new_value"]],
+		})
+	}
+	return entries, nil
+}
+
+// rollback restores the workload enforcement modes and deletes the objects in a record file
+func rollback(file string) {
+	entries, err := parseRecord(file)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
+	// Get the current workload enforcement modes
+	api, err := pce.GetWklds(map[string]string{"managed": "true"})
+	utils.LogAPIRespV2("GetAllWorkloadsQP", api)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	currentModes := make(map[string]string)
+	for _, w := range pce.WorkloadsSlice {
+		currentModes[w.Href] = illumioapi.PtrToVal(w.EnforcementMode)
+	}
+
+	// Restore workloads that are still in the mode containment-switch set
+	restoreWklds := []illumioapi.Workload{}
+	deletes := []recordEntry{}
+	for _, e := range entries {
+		if e.action == actionChanged && e.objectType == objectWorkload {
+			if mode, ok := currentModes[e.href]; !ok {
+				utils.LogWarningf(true, "%s - %s - workload no longer exists. skipping.", e.name, e.href)
+			} else if mode != e.newValue {
+				utils.LogWarningf(true, "%s - %s - enforcement mode changed to %s since the containment-switch. skipping.", e.name, e.href, mode)
+			} else {
+				restoreWklds = append(restoreWklds, illumioapi.Workload{Href: e.href, EnforcementMode: illumioapi.Ptr(e.previousValue)})
+			}
+			continue
+		}
+		// Rules are deleted with the ruleset
+		if e.action == actionCreated && e.objectType != objectRule {
+			deletes = append(deletes, e)
+		}
+	}
+
+	// Check that we should make changes to the PCE.
+	utils.LogInfof(true, "identified %d workloads to restore and %d objects to delete from %s", len(restoreWklds), len(deletes), file)
+	if !updatePCE {
+		utils.LogInfo("run with --update-pce and optionally --no-prompt flag to roll back the containment-switch.", true)
+		return
+	}
+	if !noPrompt {
+		var prompt string
+		fmt.Printf("\r\n%s [PROMPT] - workloader will restore the enforcement mode of %d workloads and delete %d objects in %s (%s). Do you want to roll back the containment-switch (yes/no)? ", time.Now().Format("2006-01-02 15:04:05"), len(restoreWklds), len(deletes), pce.FriendlyName, viper.GetString(pce.FriendlyName+".fqdn"))
+		fmt.Scanln(&prompt)
+		if strings.ToLower(prompt) != "yes" {
+			utils.LogInfo("prompt denied", true)
+			return
+		}
+		fmt.Println()
+	}
+
+	// Restore the workloads first so they are not left in selective enforcement without the allow rules
+	if len(restoreWklds) > 0 {
+		apiResps, err := pce.BulkWorkload(restoreWklds, "update", true)
+		for _, a := range apiResps {
+			utils.LogAPIRespV2("BulkWorkload", a)
+		}
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		utils.LogInfof(true, "restored the enforcement mode of %d workloads", len(restoreWklds))
+	}
+
+	// Delete in the reverse order of creation so bindings are removed before their virtual services
+	provision := []string{}
+	for i := len(deletes) - 1; i >= 0; i-- {
+		e := deletes[i]
+		api, _ := pce.DeleteHref(e.href)
+		utils.LogAPIRespV2("DeleteHref", api)
+		if api.StatusCode != 204 {
+			utils.LogWarningf(true, "%s - %s - %s - not deleted - status code %d", e.objectType, e.name, e.href, api.StatusCode)
+			continue
+		}
+		utils.LogInfof(true, "deleted %s - %s - %s", e.objectType, e.name, e.href)
+		if e.objectType != objectServiceBinding {
+			provision = append(provision, e.href)
+		}
+	}
+
+	// Provision the deletions
+	if len(provision) > 0 {
+		api, err = pce.ProvisionHref(provision, "rolled back by workloader containment-switch")
+		utils.LogAPIRespV2("ProvisionHref", api)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		utils.LogInfof(true, "provisioned deletion of %d objects - status code: %d", len(provision), api.StatusCode)
+	}
+}
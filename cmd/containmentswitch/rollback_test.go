@@ -0,0 +1,92 @@
+package containmentswitch
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/brian1917/illumioapi/v2"
+)
+
+func TestParseRecord(t *testing.T) {
+	// Columns are matched by header so the order and case do not matter
+	file := writeCSV(t, "Name,href,object_type,action,new_value,previous_value\n"+
+		"ransomware,/orgs/1/sec_policy/draft/virtual_services/1,virtual_service,created,,\n"+
+		"web01,/orgs/1/workloads/1,workload,changed,selective,visibility_only\n")
+	got, err := parseRecord(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []recordEntry{
+		{action: actionCreated, objectType: objectVirtualService, href: "/orgs/1/sec_policy/draft/virtual_services/1", name: "ransomware"},
+		{action: actionChanged, objectType: objectWorkload, href: "/orgs/1/workloads/1", name: "web01", previousValue: "visibility_only", newValue: "selective"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("entries are %+v, want %+v", got, want)
+	}
+
+	if _, err := parseRecord(writeCSV(t, "action,object_type,href,name\ncreated,rule_set,/orgs/1/sec_policy/draft/rule_sets/1,x\n")); err == nil || !strings.Contains(err.Error(), "missing previous_value header") {
+		t.Errorf("error for a file without the value headers is %v", err)
+	}
+}
+
+// TestRecordRoundTrip checks the entries written by a record are read back by parseRecord
+func TestRecordRoundTrip(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "record.csv")
+	rec, err := newRecord(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := []recordEntry{
+		{action: actionCreated, objectType: objectRuleset, href: "/orgs/1/sec_policy/draft/rule_sets/1", name: "containment, switch"},
+		{action: actionChanged, objectType: objectWorkload, href: "/orgs/1/workloads/2", name: "db01", previousValue: "visibility_only", newValue: "selective"},
+	}
+	for _, e := range entries {
+		rec.add(e)
+	}
+	got, err := parseRecord(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, entries) {
+		t.Errorf("entries are %+v, want %+v", got, entries)
+	}
+
+	if _, err := newRecord(file); err == nil {
+		t.Error("newRecord reused an existing record file")
+	}
+}
+
+// TestRecordModeChanges checks only workloads the bulk update returned as updated are recorded
+func TestRecordModeChanges(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "record.csv")
+	rec, err := newRecord(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	originals := map[string]illumioapi.Workload{
+		"/orgs/1/workloads/1": {Href: "/orgs/1/workloads/1", Hostname: illumioapi.Ptr("web01"), EnforcementMode: illumioapi.Ptr("visibility_only")},
+		"/orgs/1/workloads/2": {Href: "/orgs/1/workloads/2", Hostname: illumioapi.Ptr("db01"), EnforcementMode: illumioapi.Ptr("visibility_only")},
+		"/orgs/1/workloads/3": {Href: "/orgs/1/workloads/3", Hostname: illumioapi.Ptr("app01"), EnforcementMode: illumioapi.Ptr("visibility_only")},
+	}
+	apiResps := []illumioapi.APIResponse{
+		{RespBody: `[{"href": "/orgs/1/workloads/1", "status": "updated"}, {"href": "/orgs/1/workloads/2", "status": "validation_failure", "errors": [{"token": "not_found"}]}]`},
+		{RespBody: `[{"href": "/orgs/1/workloads/3", "status": "updated"}]`},
+	}
+
+	if n := recordModeChanges(rec, originals, apiResps); n != 2 {
+		t.Errorf("recorded %d workloads, want 2", n)
+	}
+	got, err := parseRecord(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []recordEntry{
+		{action: actionChanged, objectType: objectWorkload, href: "/orgs/1/workloads/1", name: "web01", previousValue: "visibility_only", newValue: "selective"},
+		{action: actionChanged, objectType: objectWorkload, href: "/orgs/1/workloads/3", name: "app01", previousValue: "visibility_only", newValue: "selective"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("entries are %+v, want %+v", got, want)
+	}
+}
@@ -13,18 +13,19 @@ import (
 var pce ia.PCE
 var err error
 
-var csp, ipListUrl, fileName, iplName, iplCsvFile, cspFilter string
+var csp, ipListUrl, fileName, iplName, iplCsvFile, cspFilter, feedDefFile string
 var testIPs, includev6, create, provision bool
 
 //var ignoreCase, updatePCE bool
 
 // init initializes the command line flags for the command
 func init() {
-	CspIplistCmd.Flags().StringVarP(&csp, "csp", "", "", "Enter which csp (aws, azure, gcp,file) you want to get the ip list for.")
-	CspIplistCmd.Flags().StringVarP(&ipListUrl, "url", "u", "", "If you want to override the default url for the csp ip list.")
+	CspIplistCmd.Flags().StringVarP(&csp, "csp", "", "", "Enter which csp or feed (aws, azure, gcp, office365, oci, cloudflare, github, zscaler, atlassian, json, file) you want to get the ip list for.")
+	CspIplistCmd.Flags().StringVarP(&ipListUrl, "url", "u", "", "If you want to override the default url for the csp ip list. A local file path or file:// url reads a saved feed.")
 	CspIplistCmd.Flags().BoolVarP(&testIPs, "test-ips", "t", false, "After consolidating/merging all the IP ranges validate that original subnets are part of some IP range.")
 	CspIplistCmd.Flags().BoolVarP(&includev6, "ipv6", "", false, "Include ipv6 addresses. By default all ipv6 will be ignored.")
 	CspIplistCmd.Flags().StringVarP(&fileName, "filename", "f", "", "Include filename if you enter \"file\" for as csp option.")
+	CspIplistCmd.Flags().StringVarP(&feedDefFile, "feed-def", "", "", "JSON feed definition file used when you enter \"json\" as the csp option.")
 	CspIplistCmd.Flags().StringVarP(&cspFilter, "csp-filter", "", "", "Filter filename used filter IP ranges by service and/or region.")
 	CspIplistCmd.Flags().BoolVarP(&create, "create", "c", false, "create ip list if it does not exist")
 	CspIplistCmd.Flags().BoolVarP(&provision, "provision", "p", false, "provision ip list after replacing contents.")
@@ -43,18 +44,45 @@ the IP ranges by service and/or region. IP ranges will be consolidate by removin
 not include ipv6 addresses. If you want to include ipv6 addresses use the --ipv6 flag.   
 
  		'workloader csp-iplist --csp gcp <ip listname>'  or 'workloader csp-iplist --csp gcp --ipv6 <ip listname>' or 'workloader csp-iplist --csp gcp --csp-filter <filter filename> <ip listname>'
-The following CSPs are supported:
-- AWS
-- Azure
-- GCP
-
-You can use the --url flag to override the default url for the csp ip range web location.  You can also use specify 'file' as the CSP and provide the --filename flag to specify a file that contains a set of IP ranges.  It perform the same 
+The following CSPs and feeds are supported:
+- aws - AWS
+- azure - Azure
+- gcp - GCP
+- office365 - Microsoft 365
+- oci - Oracle Cloud. The region is the OCI region and each tag (OCI, OSN, OBJECT_STORAGE) is a service.
+- cloudflare - Cloudflare. There are no regions or services.
+- github - GitHub meta api. Each list of ranges (hooks, web, api, git, actions, etc.) is a service.
+- zscaler - Zscaler cloud enforcement nodes for zscaler.net. The continent is the region and the city is the service. Use --url for other Zscaler clouds.
+- atlassian - Atlassian. Each region and product of a range is added.
+- json - any JSON feed described by a --feed-def file.
+
+You can use the --url flag to override the default url for the csp ip range web location.  The url can also be a local file (or file:// url) so a saved feed can be used offline.
+You can also use specify 'file' as the CSP and provide the --filename flag to specify a file that contains a set of IP ranges.  It perform the same 
 check for duplicates and consolidate.  
 
+The --feed-def file lets you add a SaaS vendor without code changes.  It is a JSON object with these fields:
+- name: used in the output file name.
+- url: default url of the feed.  --url overrides it.
+- items: path to the entries in the feed.  Blank is the whole feed.
+- cidr: path in each entry to the CIDR or list of CIDRs.  Blank if the entries are the CIDRs.
+- region and service: path in each entry to the region and service for --csp-filter, or "$key" for the object key of the entry.  Blank is "GLOBAL".
+Paths are dot-separated field names.  A "*" segment or a field ending in "[]" steps into every element of a list or every value of an object.
+For example, Okta's {"us_cell_1": {"ip_ranges": ["1.2.3.0/24"]}} feed is {"name": "okta", "url": "https://s3.amazonaws.com/okta-ip-ranges/ip_ranges.json", "items": "*", "cidr": "ip_ranges", "region": "$key"}.
+
+Sample feeds for each parser and a sample feed definition are in cmd/cspiplist/testdata in the workloader repository.
+
 By default no changes will be made to the PCE.  Please use --update-pce if you want to make changes.  If the IP List is not configured on the PCE, use the --create flag to create it.
 
 * Azure leaves services that span many regions with a blank region.  This command will set those regions to "GLOBAL" so use "GLOBAL" in your filter file.
 `,
+	Example: `# Oracle Cloud ranges filtered by region
+workloader csp-iplist --csp oci --csp-filter filter.csv oci-ashburn
+
+# GitHub ranges from a saved feed
+workloader csp-iplist --csp github --url github-meta.json github
+
+# Okta ranges from a feed definition
+workloader csp-iplist --csp json --feed-def okta-feed.json okta`,
 	Run: func(cmd *cobra.Command, args []string) {
 
 		pce, err = utils.GetTargetPCEV2(false)
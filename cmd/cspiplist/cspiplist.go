@@ -58,23 +58,39 @@ func getLastIP(ipNet *net.IPNet) net.IP {
 // removeSubsetIPs removes any IP ranges that are a subset of another IP range
 func removeSubsetIPs(uniqueIPs map[string]bool) []string {
 
-	ipNets := []*net.IPNet{}
 	tmpIP := []string{}
 	for ip := range uniqueIPs {
+		tmpIP = append(tmpIP, ip)
+	}
+	if testIPs {
+		buildCSV(tmpIP, "test-org")
+	}
+
+	filteredIPs := RemoveSubsetIPs(tmpIP)
+	if testIPs {
+		buildCSV(filteredIPs, "removed-subset")
+	}
+	return filteredIPs
+}
+
+// RemoveSubsetIPs removes duplicate CIDRs and CIDRs that are a subset of another CIDR. Invalid CIDRs are logged and skipped.
+func RemoveSubsetIPs(ips []string) []string {
+
+	ipNets := []*net.IPNet{}
+	seen := make(map[string]bool)
+	for _, ip := range ips {
 		_, ipNet, err := net.ParseCIDR(ip)
-		if testIPs {
-			tmpIP = append(tmpIP, ip)
-		}
-		//only save ipv4 addresses
 		if err != nil {
 			utils.LogWarningf(false, "Invalid CIDR: %s", ip)
 			continue
 		}
+		// Normalize so the same network written two ways is only kept once
+		if seen[ipNet.String()] {
+			continue
+		}
+		seen[ipNet.String()] = true
 		ipNets = append(ipNets, ipNet)
 	}
-	if testIPs {
-		buildCSV(tmpIP, "test-org")
-	}
 
 	// Filter out subset IP ranges
 	filteredIPs := []string{}
@@ -97,20 +113,17 @@ func removeSubsetIPs(uniqueIPs map[string]bool) []string {
 			filteredIPs = append(filteredIPs, ipNet1.String())
 		}
 	}
-	if testIPs {
-		buildCSV(filteredIPs, "removed-subset")
-	}
 	return filteredIPs
 }
 
-// mergeConsecutiveRanges merges consecutive IP ranges
+// MergeConsecutiveRanges merges consecutive IP ranges
 // loop thorugh the list of ips and merge the consecutive ranges until no more available consecutive IP ranges
-func mergeConsecutiveRanges(ips []string) []string {
+func MergeConsecutiveRanges(ips []string) []string {
 
 	filteredIPs := ips
 	for {
 		tmpIPs := []string{}
-		fmt.Println("starting consolidation loop", len(tmpIPs))
+		utils.LogInfof(false, "starting consolidation loop with %d ip ranges", len(filteredIPs))
 		ipNets := []*net.IPNet{}
 		for _, ip := range filteredIPs {
 			_, ipNet, err := net.ParseCIDR(ip)
@@ -121,8 +134,11 @@ func mergeConsecutiveRanges(ips []string) []string {
 			ipNets = append(ipNets, ipNet)
 		}
 
-		// Sort IP networks by IP address
+		// Sort IP networks by IP address with ipv4 before ipv6 so the families are not interleaved
 		sort.Slice(ipNets, func(i, j int) bool {
+			if len(ipNets[i].IP) != len(ipNets[j].IP) {
+				return len(ipNets[i].IP) < len(ipNets[j].IP)
+			}
 			return bytes.Compare(ipNets[i].IP, ipNets[j].IP) < 0
 		})
 
@@ -155,7 +171,7 @@ func canMerge(ipNet1, ipNet2 *net.IPNet) bool {
 	ones1, bits1 := ipNet1.Mask.Size()
 	ones2, bits2 := ipNet2.Mask.Size()
 
-	if bits1 != bits2 || ones1 != ones2 {
+	if bits1 != bits2 || ones1 != ones2 || ones1 == 0 {
 		return false
 	}
 
@@ -192,11 +208,11 @@ func addProps(region, service string) IPRangeProperties {
 }
 
 // gcpParse parses the GCP IP ranges JSON file
-func gcpParse(data []byte) map[string][]IPRangeProperties {
+func gcpParse(data []byte) (map[string][]IPRangeProperties, error) {
 	// Unmarshal the JSON data into the Go structure
 	var gcpIPRanges GCPIPRanges
 	if err := json.Unmarshal(data, &gcpIPRanges); err != nil {
-		utils.LogErrorf("%s", err)
+		return nil, err
 	}
 
 	uniqueIPs := make(map[string][]IPRangeProperties)
@@ -216,16 +232,16 @@ func gcpParse(data []byte) map[string][]IPRangeProperties {
 		uniqueIPs[prefix] = append(uniqueIPs[prefix], addProps(gcpIPRange.Scope, gcpIPRange.Service))
 
 	}
-	return uniqueIPs
+	return uniqueIPs, nil
 }
 
 // awsParse parses the AWS IP ranges JSON file
-func awsParse(data []byte) map[string][]IPRangeProperties {
+func awsParse(data []byte) (map[string][]IPRangeProperties, error) {
 
 	// Unmarshal the JSON data into the Go structure
 	var awsIPRanges AWSIPRanges
 	if err := json.Unmarshal(data, &awsIPRanges); err != nil {
-		utils.LogErrorf("%s", err)
+		return nil, err
 	}
 
 	uniqueIPs := make(map[string][]IPRangeProperties)
@@ -240,31 +256,31 @@ func awsParse(data []byte) map[string][]IPRangeProperties {
 			originalIPRanges = append(originalIPRanges, prefix)
 		}
 		uniqueIPs[prefix] = append(uniqueIPs[prefix], addProps(awsIPRange.Region, awsIPRange.Service))
+	}
 
-		if includev6 {
-			for _, awsIPRange := range awsIPRanges.IPv6Prefixes {
-				prefix := ""
-				if awsIPRange.IPv6Prefix != "" {
-					prefix = awsIPRange.IPv6Prefix
-				} else {
-					continue
-				}
-				if _, exists := uniqueIPs[prefix]; !exists && testIPs {
-					originalIPRanges = append(originalIPRanges, prefix)
-				}
-				uniqueIPs[prefix] = append(uniqueIPs[prefix], addProps(awsIPRange.Region, awsIPRange.Service))
-
+	if includev6 {
+		for _, awsIPRange := range awsIPRanges.IPv6Prefixes {
+			prefix := ""
+			if awsIPRange.IPv6Prefix != "" {
+				prefix = awsIPRange.IPv6Prefix
+			} else {
+				continue
 			}
+			if _, exists := uniqueIPs[prefix]; !exists && testIPs {
+				originalIPRanges = append(originalIPRanges, prefix)
+			}
+			uniqueIPs[prefix] = append(uniqueIPs[prefix], addProps(awsIPRange.Region, awsIPRange.Service))
+
 		}
 	}
-	return uniqueIPs
+	return uniqueIPs, nil
 }
 
-func office365Parse(data []byte) map[string][]IPRangeProperties {
+func office365Parse(data []byte) (map[string][]IPRangeProperties, error) {
 	// Unmarshal the JSON data into the Go structure
 	var azure365IPRanges Azure365IPRanges
 	if err := json.Unmarshal(data, &azure365IPRanges); err != nil {
-		utils.LogErrorf("%s", err)
+		return nil, err
 	}
 
 	uniqueIPs := make(map[string][]IPRangeProperties)
@@ -279,16 +295,16 @@ func office365Parse(data []byte) map[string][]IPRangeProperties {
 			uniqueIPs[ip] = append(uniqueIPs[ip], addProps("GLOBAL", officeIPRange.ServiceArea))
 		}
 	}
-	return uniqueIPs
+	return uniqueIPs, nil
 }
 
 // azurParse unmarshalles the Azure IP ranges JSON file into a list of IP unique IP ranges
-func azureParse(data []byte) map[string][]IPRangeProperties {
+func azureParse(data []byte) (map[string][]IPRangeProperties, error) {
 
 	// Unmarshal the JSON data into the Go structure
 	var azserviceTags AzureServiceTags
 	if err := json.Unmarshal(data, &azserviceTags); err != nil {
-		utils.LogErrorf("%s", err)
+		return nil, err
 	}
 	uniqueIPs := make(map[string][]IPRangeProperties)
 	for _, serviceTag := range azserviceTags.Values {
@@ -305,20 +321,14 @@ func azureParse(data []byte) map[string][]IPRangeProperties {
 			uniqueIPs[addressPrefix] = append(uniqueIPs[addressPrefix], addProps(serviceTag.Properties.Region, serviceTag.Name))
 		}
 	}
-	return uniqueIPs
+	return uniqueIPs, nil
 }
 
-func fileIPRangeRead() map[string][]IPRangeProperties {
+// fileParse parses a file with one CIDR per line
+func fileParse(data []byte) (map[string][]IPRangeProperties, error) {
 
 	uniqueIPs := make(map[string][]IPRangeProperties)
-	file, err := os.Open(fileName)
-	if err != nil {
-		fmt.Println("Error opening file:", err)
-		return nil
-	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
 		if line == "" || strings.HasPrefix(line, "#") {
@@ -327,7 +337,7 @@ func fileIPRangeRead() map[string][]IPRangeProperties {
 
 		_, ipNet, err := net.ParseCIDR(line)
 		if err != nil {
-			utils.LogErrorf("invalid CIDR in line: %s: %s", line, err)
+			return nil, fmt.Errorf("invalid CIDR in line: %s: %s", line, err)
 		}
 		if ipv6check(line) {
 			continue
@@ -340,7 +350,7 @@ func fileIPRangeRead() map[string][]IPRangeProperties {
 
 	}
 
-	return uniqueIPs
+	return uniqueIPs, scanner.Err()
 
 }
 
@@ -380,63 +390,43 @@ func fetchAzureDownloadURL(url string) (string, error) {
 	return string(match), nil
 }
 
-// downloadJSON downloads the JSON file from the given URL
-func downloadJSON(url string) []byte {
+// download returns the data at the given URL. A file:// URL or a path without a scheme is read from disk so saved feeds can be used offline.
+func download(url string) ([]byte, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return os.ReadFile(strings.TrimPrefix(url, "file://"))
+	}
+
 	resp, err := http.Get(url)
 	if err != nil {
-		utils.LogErrorf("failed to download JSON: %v", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("failed to download %s: %v", url, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		utils.LogErrorf("unexpected HTTP status: %s", resp.Status)
+		return nil, fmt.Errorf("unexpected HTTP status from %s: %s", url, resp.Status)
 	}
 
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
-		utils.LogErrorf("failed to read JSON data: %v", err)
+		return nil, fmt.Errorf("failed to read data from %s: %v", url, err)
 	}
-	return data
+	return data, nil
 }
 
-// capIPProcessing processes the IP ranges for any of the CSP build today....AWS and Azure today
-func cspIPProcessing(csp, ipListUrl string) []string {
+// cspIPProcessing fetches and parses the feed and returns the filtered and consolidated IP ranges
+func cspIPProcessing(f feed, ipListUrl string) []string {
 
 	var workingIPList []string
-	var uniqueIPs map[string][]IPRangeProperties
-	switch strings.ToLower(csp) {
-	case "aws":
-		data := downloadJSON(ipListUrl)
-		uniqueIPs = awsParse(data)
-
-	case "azure":
-		url := ""
-		if ipListUrl == AZUREURL {
-			tmpurl, err := fetchAzureDownloadURL(AZUREURL)
-			if err != nil {
-				utils.LogErrorf("Error finding download URL: %v\n", err)
-			}
-			url = tmpurl
-		}
-		data := downloadJSON(url)
-		uniqueIPs = azureParse(data)
-
-	case "gcp":
-		data := downloadJSON(ipListUrl)
-		uniqueIPs = gcpParse(data)
-
-	case "office365":
-		data := downloadJSON(ipListUrl)
-		uniqueIPs = office365Parse(data)
-
-	case "file":
-		uniqueIPs = fileIPRangeRead()
-
-	default:
-		fmt.Println("Invalid CSP. Please enter either 'aws' or 'azure'.")
-		return nil
+	data, err := f.fetch(ipListUrl)
+	if err != nil {
+		utils.LogErrorf("getting %s ip ranges - %s", f.name(), err)
 	}
+	uniqueIPs, err := f.parse(data)
+	if err != nil {
+		utils.LogErrorf("parsing %s ip ranges - %s", f.name(), err)
+	}
+	utils.LogInfof(false, "%d unique ip ranges in the %s feed", len(uniqueIPs), f.name())
+
 	filteredIPs := make(map[string]bool)
 	if cspFilter != "" {
 		filteredIPs, err = filterIPsByCSPFilter(uniqueIPs, cspFilter)
@@ -450,7 +440,7 @@ func cspIPProcessing(csp, ipListUrl string) []string {
 	}
 
 	workingIPList = removeSubsetIPs(filteredIPs)
-	workingIPList = mergeConsecutiveRanges(workingIPList)
+	workingIPList = MergeConsecutiveRanges(workingIPList)
 
 	if testIPs {
 		testIPRanges(workingIPList)
@@ -687,47 +677,27 @@ func getCurrentTimeStamp() string {
 // It fetches the IP ranges from the given URL, parses the JSON data, and writes the unique IP ranges to a file
 func cspiplist(pce *ia.PCE, updatePCE, noPrompt bool, csp, ipListUrl, iplName string) {
 
-	var consolidatedIPs []string
-	switch strings.ToLower(csp) {
-	case "aws":
-
-		if ipListUrl == "" {
-			ipListUrl = AWSURL
-		}
-		consolidatedIPs = cspIPProcessing(csp, ipListUrl)
-	case "azure":
-		if ipListUrl == "" {
-			ipListUrl = AZUREURL
-		}
-		consolidatedIPs = cspIPProcessing(csp, ipListUrl)
-	case "gcp":
-		if ipListUrl == "" {
-			ipListUrl = GCPURL
-		}
-		consolidatedIPs = cspIPProcessing(csp, ipListUrl)
-
-	case "office365":
-		if ipListUrl == "" {
-			ipListUrl = OFFICE365URL
-		}
-		consolidatedIPs = cspIPProcessing(csp, ipListUrl)
-
-	case "file":
-		if fileName == "" {
-			fmt.Println("Please provide a file name.")
-			return
-		}
-		consolidatedIPs = cspIPProcessing(csp, "")
-	default:
-		fmt.Println("Invalid CSP. Please enter either 'aws' or 'azure'.")
-		return
+	f, err := getFeed(csp, feedDefFile)
+	if err != nil {
+		utils.LogError(err.Error())
 	}
+	if strings.ToLower(csp) == "file" && fileName == "" {
+		utils.LogError("please provide a file name with --filename.")
+	}
+	if ipListUrl == "" {
+		ipListUrl = f.url()
+	}
+	if ipListUrl == "" && strings.ToLower(csp) != "file" {
+		utils.LogErrorf("the %s feed does not have a url. use --url.", f.name())
+	}
+	consolidatedIPs := cspIPProcessing(f, ipListUrl)
+
 	if compareIPList(*pce, iplName, consolidatedIPs) {
 		utils.LogInfof(true, "IPList %s is the same as the consolidated IP ranges. No changes made.", iplName)
 		return
 	}
 
-	iplCsvFile = buildCSV(consolidatedIPs, csp)
+	iplCsvFile = buildCSV(consolidatedIPs, f.name())
 
 	iplreplace.IplReplace(iplreplace.Input{
 		PCE:         *pce,
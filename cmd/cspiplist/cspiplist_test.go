@@ -0,0 +1,123 @@
+package cspiplist
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/brian1917/workloader/utils"
+)
+
+func TestMain(m *testing.M) {
+	utils.Logger.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestParsers(t *testing.T) {
+	tests := []struct {
+		csp     string
+		fixture string
+		feedDef string
+		want    map[string][]IPRangeProperties
+	}{
+		{
+			csp:     "aws",
+			fixture: "aws.json",
+			want: map[string][]IPRangeProperties{
+				"3.2.34.0/26":   {{Region: "af-south-1", Service: "AMAZON"}},
+				"3.2.34.64/27":  {{Region: "af-south-1", Service: "EC2"}},
+				"52.94.76.0/22": {{Region: "us-west-2", Service: "AMAZON"}},
+			},
+		},
+		{
+			csp:     "azure",
+			fixture: "azure.json",
+			want:    map[string][]IPRangeProperties{"20.20.32.0/19": {{Region: "GLOBAL", Service: "AzureActiveDirectory"}}},
+		},
+		{
+			csp:     "gcp",
+			fixture: "gcp.json",
+			want:    map[string][]IPRangeProperties{"34.80.0.0/15": {{Region: "asia-east1", Service: "Google Cloud"}}},
+		},
+		{
+			csp:     "office365",
+			fixture: "office365.json",
+			want:    map[string][]IPRangeProperties{"13.107.6.152/31": {{Region: "GLOBAL", Service: "Exchange"}}},
+		},
+		{
+			csp:     "oci",
+			fixture: "oci.json",
+			want:    map[string][]IPRangeProperties{"134.70.24.0/21": {{Region: "us-ashburn-1", Service: "OSN"}, {Region: "us-ashburn-1", Service: "OBJECT_STORAGE"}}},
+		},
+		{
+			csp:     "cloudflare",
+			fixture: "cloudflare.json",
+			want:    map[string][]IPRangeProperties{"173.245.48.0/20": {{Region: "GLOBAL", Service: "GLOBAL"}}},
+		},
+		{
+			csp:     "github",
+			fixture: "github.json",
+			want:    map[string][]IPRangeProperties{"140.82.121.3/32": {{Region: "GLOBAL", Service: "web"}}},
+		},
+		{
+			csp:     "zscaler",
+			fixture: "zscaler.json",
+			want:    map[string][]IPRangeProperties{"165.225.240.0/23": {{Region: "EMEA", Service: "Amsterdam II"}}},
+		},
+		{
+			csp:     "atlassian",
+			fixture: "atlassian.json",
+			want:    map[string][]IPRangeProperties{"185.166.140.0/22": {{Region: "eu-west-1", Service: "jira"}, {Region: "eu-west-1", Service: "confluence"}}},
+		},
+		{
+			csp:     "json",
+			fixture: "okta.json",
+			feedDef: "okta-feed.json",
+			want: map[string][]IPRangeProperties{
+				"13.32.55.0/24":    {{Region: "us_cell_1", Service: "GLOBAL"}},
+				"3.121.178.176/32": {{Region: "emea_cell_1", Service: "GLOBAL"}},
+			},
+		},
+		{
+			csp:     "file",
+			fixture: "file.txt",
+			want:    map[string][]IPRangeProperties{"10.0.0.0/25": nil, "192.168.10.0/24": nil},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.csp, func(t *testing.T) {
+			feedDef := ""
+			if tc.feedDef != "" {
+				feedDef = filepath.Join("testdata", tc.feedDef)
+			}
+			f, err := getFeed(tc.csp, feedDef)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(filepath.Join("testdata", tc.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ips, err := f.parse(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for prefix, want := range tc.want {
+				got, ok := ips[prefix]
+				if !ok {
+					t.Errorf("%s is missing", prefix)
+					continue
+				}
+				if len(got) == 0 && len(want) == 0 {
+					continue
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("%s has %+v, want %+v", prefix, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,383 @@
+package cspiplist
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/brian1917/workloader/utils"
+)
+
+const OCIURL = "https://docs.oracle.com/en-us/iaas/tools/public_ip_ranges.json"
+const CLOUDFLAREURL = "https://api.cloudflare.com/client/v4/ips"
+const GITHUBURL = "https://api.github.com/meta"
+const ZSCALERURL = "https://config.zscaler.com/api/zscaler.net/cenr/json"
+const ATLASSIANURL = "https://ip-ranges.atlassian.com/"
+
+// feed is a source of provider IP ranges
+type feed interface {
+	// name is used for the csp option and the output file name
+	name() string
+	// url is the default location of the feed
+	url() string
+	// fetch returns the raw feed from the url
+	fetch(url string) ([]byte, error)
+	// parse returns the unique IP ranges with the region and service of each
+	parse(data []byte) (map[string][]IPRangeProperties, error)
+}
+
+// parserFeed is a feed downloaded from a url and parsed by a parse function
+type parserFeed struct {
+	feedName   string
+	defaultURL string
+	parser     func(data []byte) (map[string][]IPRangeProperties, error)
+}
+
+func (f parserFeed) name() string                     { return f.feedName }
+func (f parserFeed) url() string                      { return f.defaultURL }
+func (f parserFeed) fetch(url string) ([]byte, error) { return download(url) }
+func (f parserFeed) parse(data []byte) (map[string][]IPRangeProperties, error) {
+	return f.parser(data)
+}
+
+// azureFeed finds the current service tags file on the download page before downloading it
+type azureFeed struct {
+	parserFeed
+}
+
+func (f azureFeed) fetch(url string) ([]byte, error) {
+	if url == AZUREURL {
+		downloadURL, err := fetchAzureDownloadURL(AZUREURL)
+		if err != nil {
+			return nil, fmt.Errorf("finding download url - %s", err)
+		}
+		url = downloadURL
+	}
+	return download(url)
+}
+
+// fileFeed reads the --filename file with one CIDR per line
+type fileFeed struct{}
+
+func (f fileFeed) name() string                     { return "file" }
+func (f fileFeed) url() string                      { return "" }
+func (f fileFeed) fetch(url string) ([]byte, error) { return os.ReadFile(fileName) }
+func (f fileFeed) parse(data []byte) (map[string][]IPRangeProperties, error) {
+	return fileParse(data)
+}
+
+// definitionFeed is a JSON feed described by a feed definition file
+type definitionFeed struct {
+	def FeedDefinition
+}
+
+func (f definitionFeed) name() string                     { return f.def.Name }
+func (f definitionFeed) url() string                      { return f.def.URL }
+func (f definitionFeed) fetch(url string) ([]byte, error) { return download(url) }
+func (f definitionFeed) parse(data []byte) (map[string][]IPRangeProperties, error) {
+	return definitionParse(f.def, data)
+}
+
+// feeds are the built-in feeds by csp option
+var feeds = map[string]feed{
+	"aws":        parserFeed{"aws", AWSURL, awsParse},
+	"azure":      azureFeed{parserFeed{"azure", AZUREURL, azureParse}},
+	"gcp":        parserFeed{"gcp", GCPURL, gcpParse},
+	"office365":  parserFeed{"office365", OFFICE365URL, office365Parse},
+	"oci":        parserFeed{"oci", OCIURL, ociParse},
+	"cloudflare": parserFeed{"cloudflare", CLOUDFLAREURL, cloudflareParse},
+	"github":     parserFeed{"github", GITHUBURL, githubParse},
+	"zscaler":    parserFeed{"zscaler", ZSCALERURL, zscalerParse},
+	"atlassian":  parserFeed{"atlassian", ATLASSIANURL, atlassianParse},
+	"file":       fileFeed{},
+}
+
+// feedOptions returns the sorted csp options
+func feedOptions() []string {
+	options := []string{"json"}
+	for name := range feeds {
+		options = append(options, name)
+	}
+	sort.Strings(options)
+	return options
+}
+
+// getFeed returns the feed for the csp option. The json option loads the feed definition file.
+func getFeed(csp, defFile string) (feed, error) {
+	csp = strings.ToLower(csp)
+	if csp != "json" {
+		if f, ok := feeds[csp]; ok {
+			return f, nil
+		}
+		return nil, fmt.Errorf("invalid csp %s. options are %s", csp, strings.Join(feedOptions(), ", "))
+	}
+
+	if defFile == "" {
+		return nil, fmt.Errorf("the json csp requires --feed-def")
+	}
+	data, err := os.ReadFile(defFile)
+	if err != nil {
+		return nil, err
+	}
+	var def FeedDefinition
+	if err := json.Unmarshal(data, &def); err != nil {
+		return nil, fmt.Errorf("%s - %s", defFile, err)
+	}
+	if def.Name == "" {
+		return nil, fmt.Errorf("%s - name is required", defFile)
+	}
+	return definitionFeed{def: def}, nil
+}
+
+// addPrefix adds a CIDR and its properties to the unique IP ranges. An address without a mask is added as a host.
+// Invalid entries are skipped with a warning and ipv6 is skipped unless --ipv6 is set.
+func addPrefix(uniqueIPs map[string][]IPRangeProperties, prefix string, props ...IPRangeProperties) {
+	prefix = strings.TrimSpace(prefix)
+	if prefix == "" {
+		return
+	}
+	if !strings.Contains(prefix, "/") {
+		if strings.Contains(prefix, ":") {
+			prefix += "/128"
+		} else {
+			prefix += "/32"
+		}
+	}
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		utils.LogWarningf(false, "Invalid CIDR: %s", prefix)
+		return
+	}
+	if ipv6check(prefix) {
+		return
+	}
+	if _, exists := uniqueIPs[ipNet.String()]; !exists && testIPs {
+		originalIPRanges = append(originalIPRanges, ipNet.String())
+	}
+	uniqueIPs[ipNet.String()] = append(uniqueIPs[ipNet.String()], props...)
+}
+
+// ociParse parses the Oracle Cloud public IP ranges. Each tag (e.g., OCI, OSN, OBJECT_STORAGE) is a service.
+func ociParse(data []byte) (map[string][]IPRangeProperties, error) {
+	var ociIPRanges OCIIPRanges
+	if err := json.Unmarshal(data, &ociIPRanges); err != nil {
+		return nil, err
+	}
+
+	uniqueIPs := make(map[string][]IPRangeProperties)
+	for _, region := range ociIPRanges.Regions {
+		for _, cidr := range region.CIDRs {
+			props := []IPRangeProperties{}
+			for _, tag := range cidr.Tags {
+				props = append(props, addProps(region.Region, tag))
+			}
+			if len(props) == 0 {
+				props = append(props, addProps(region.Region, ""))
+			}
+			addPrefix(uniqueIPs, cidr.CIDR, props...)
+		}
+	}
+	return uniqueIPs, nil
+}
+
+// cloudflareParse parses the Cloudflare IP ranges. Cloudflare does not publish regions or services.
+func cloudflareParse(data []byte) (map[string][]IPRangeProperties, error) {
+	var cloudflareIPs CloudflareIPs
+	if err := json.Unmarshal(data, &cloudflareIPs); err != nil {
+		return nil, err
+	}
+	if !cloudflareIPs.Success {
+		return nil, fmt.Errorf("cloudflare response is not successful")
+	}
+
+	uniqueIPs := make(map[string][]IPRangeProperties)
+	for _, cidr := range append(cloudflareIPs.Result.IPv4CIDRs, cloudflareIPs.Result.IPv6CIDRs...) {
+		addPrefix(uniqueIPs, cidr, addProps("", ""))
+	}
+	return uniqueIPs, nil
+}
+
+// githubParse parses the GitHub meta API. Each key with a list of CIDRs (e.g., hooks, web, api, git, actions) is a service.
+func githubParse(data []byte) (map[string][]IPRangeProperties, error) {
+	var githubMeta GitHubMeta
+	if err := json.Unmarshal(data, &githubMeta); err != nil {
+		return nil, err
+	}
+
+	uniqueIPs := make(map[string][]IPRangeProperties)
+	for service, raw := range githubMeta {
+		// Skip the keys that are not lists of CIDRs like ssh_keys and domains
+		var cidrs []string
+		if err := json.Unmarshal(raw, &cidrs); err != nil || len(cidrs) == 0 {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(cidrs[0]); err != nil {
+			continue
+		}
+		for _, cidr := range cidrs {
+			addPrefix(uniqueIPs, cidr, addProps("", service))
+		}
+	}
+	return uniqueIPs, nil
+}
+
+// zscalerParse parses the Zscaler cloud enforcement node ranges. The continent is the region and the city is the service.
+func zscalerParse(data []byte) (map[string][]IPRangeProperties, error) {
+	var zscalerCENR ZscalerCENR
+	if err := json.Unmarshal(data, &zscalerCENR); err != nil {
+		return nil, err
+	}
+
+	uniqueIPs := make(map[string][]IPRangeProperties)
+	for _, continents := range zscalerCENR {
+		for continent, cities := range continents {
+			for city, nodes := range cities {
+				for _, node := range nodes {
+					addPrefix(uniqueIPs, node.Range, addProps(strings.TrimSpace(strings.TrimPrefix(continent, "continent :")), strings.TrimSpace(strings.TrimPrefix(city, "city :"))))
+				}
+			}
+		}
+	}
+	return uniqueIPs, nil
+}
+
+// atlassianParse parses the Atlassian IP ranges. Each region and product of a range is added.
+func atlassianParse(data []byte) (map[string][]IPRangeProperties, error) {
+	var atlassianIPRanges AtlassianIPRanges
+	if err := json.Unmarshal(data, &atlassianIPRanges); err != nil {
+		return nil, err
+	}
+
+	uniqueIPs := make(map[string][]IPRangeProperties)
+	for _, item := range atlassianIPRanges.Items {
+		regions, products := item.Region, item.Product
+		if len(regions) == 0 {
+			regions = []string{""}
+		}
+		if len(products) == 0 {
+			products = []string{""}
+		}
+		props := []IPRangeProperties{}
+		for _, region := range regions {
+			for _, product := range products {
+				props = append(props, addProps(region, product))
+			}
+		}
+		addPrefix(uniqueIPs, item.CIDR, props...)
+	}
+	return uniqueIPs, nil
+}
+
+// pathMatch is a value found at a feed definition path and the object key it was found under
+type pathMatch struct {
+	value interface{}
+	key   string
+}
+
+// lookup returns the values at the path. An empty path is the value itself.
+func lookup(value interface{}, path, key string) []pathMatch {
+	matches := []pathMatch{{value: value, key: key}}
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return matches
+	}
+	for _, segment := range strings.Split(path, ".") {
+		expand := segment == "*" || strings.HasSuffix(segment, "[]")
+		field := strings.TrimSuffix(segment, "[]")
+		next := []pathMatch{}
+		for _, m := range matches {
+			v := m.value
+			if field != "" && field != "*" {
+				obj, ok := v.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if v, ok = obj[field]; !ok {
+					continue
+				}
+			}
+			if !expand {
+				next = append(next, pathMatch{value: v, key: m.key})
+				continue
+			}
+			switch t := v.(type) {
+			case []interface{}:
+				for _, e := range t {
+					next = append(next, pathMatch{value: e, key: m.key})
+				}
+			case map[string]interface{}:
+				for k, e := range t {
+					next = append(next, pathMatch{value: e, key: k})
+				}
+			}
+		}
+		matches = next
+	}
+	return matches
+}
+
+// lookupStrings returns the strings at the path. "$key" is the object key the item was found under.
+// Lists of strings are flattened and an empty path or no match returns one empty string.
+func lookupStrings(m pathMatch, path string) []string {
+	if path == "" {
+		return []string{""}
+	}
+	if path == "$key" {
+		return []string{m.key}
+	}
+	values := []string{}
+	for _, match := range lookup(m.value, path, m.key) {
+		switch t := match.value.(type) {
+		case string:
+			values = append(values, t)
+		case float64, bool:
+			values = append(values, fmt.Sprint(t))
+		case []interface{}:
+			for _, e := range t {
+				if s, ok := e.(string); ok {
+					values = append(values, s)
+				}
+			}
+		}
+	}
+	if len(values) == 0 {
+		return []string{""}
+	}
+	return values
+}
+
+// definitionParse parses a JSON feed with a feed definition. Each item at the items path has CIDRs at the cidr path
+// and the region and service at the region and service paths.
+func definitionParse(def FeedDefinition, data []byte) (map[string][]IPRangeProperties, error) {
+	var root interface{}
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+
+	uniqueIPs := make(map[string][]IPRangeProperties)
+	items := lookup(root, def.Items, "")
+	if len(items) == 0 {
+		return nil, fmt.Errorf("no items found at path %q", def.Items)
+	}
+	for _, item := range items {
+		props := []IPRangeProperties{}
+		for _, region := range lookupStrings(item, def.Region) {
+			for _, service := range lookupStrings(item, def.Service) {
+				props = append(props, addProps(region, service))
+			}
+		}
+		if def.CIDR == "" {
+			if s, ok := item.value.(string); ok {
+				addPrefix(uniqueIPs, s, props...)
+			}
+			continue
+		}
+		for _, cidr := range lookupStrings(item, def.CIDR) {
+			addPrefix(uniqueIPs, cidr, props...)
+		}
+	}
+	return uniqueIPs, nil
+}
@@ -1,5 +1,7 @@
 package cspiplist
 
+import "encoding/json"
+
 type AWSIPRanges struct {
 	SyncToken  string `json:"syncToken"`
 	CreateDate string `json:"createDate"`
@@ -64,3 +66,57 @@ type IPRangeProperties struct {
 	Region  string `json:"region"`
 	Service string `json:"service"`
 }
+
+type OCIIPRanges struct {
+	LastUpdatedTimestamp string `json:"last_updated_timestamp"`
+	Regions              []struct {
+		Region string `json:"region"`
+		CIDRs  []struct {
+			CIDR string   `json:"cidr"`
+			Tags []string `json:"tags"`
+		} `json:"cidrs"`
+	} `json:"regions"`
+}
+
+type CloudflareIPs struct {
+	Result struct {
+		IPv4CIDRs []string `json:"ipv4_cidrs"`
+		IPv6CIDRs []string `json:"ipv6_cidrs"`
+		Etag      string   `json:"etag"`
+	} `json:"result"`
+	Success bool `json:"success"`
+}
+
+// GitHubMeta is keyed by service. Only the keys with a list of CIDRs are used.
+type GitHubMeta map[string]json.RawMessage
+
+// ZscalerCENR is keyed by cloud, then "continent : <name>", then "city : <name>"
+type ZscalerCENR map[string]map[string]map[string][]struct {
+	Range    string `json:"range"`
+	VPN      string `json:"vpn"`
+	GRE      string `json:"gre"`
+	Hostname string `json:"hostname"`
+}
+
+type AtlassianIPRanges struct {
+	CreationDate string `json:"creationDate"`
+	Items        []struct {
+		Network   string   `json:"network"`
+		MaskLen   int      `json:"mask_len"`
+		CIDR      string   `json:"cidr"`
+		Region    []string `json:"region"`
+		Product   []string `json:"product"`
+		Direction []string `json:"direction"`
+	} `json:"items"`
+}
+
+// FeedDefinition describes a JSON feed so SaaS vendors can be added without code changes. Paths are dot-separated field names.
+// A "*" segment or a field ending in "[]" steps into every element of an array or every value of an object.
+type FeedDefinition struct {
+	Name    string `json:"name"`
+	URL     string `json:"url"`
+	Items   string `json:"items"`
+	CIDR    string `json:"cidr"`
+	Region  string `json:"region"`
+	Service string `json:"service"`
+}
@@ -0,0 +1,186 @@
+package daemon
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/viper"
+)
+
+// cachedCollections are the PCE object collections kept warm between runs
+var cachedCollections = regexp.MustCompile(`^/api/v2/orgs/\d+/(sec_policy/(draft|active)/)?(labels|label_dimensions|label_groups|ip_lists|services|rule_sets|virtual_services|workloads|vens)$`)
+
+// readOnlyPosts are POST requests that do not change the PCE
+var readOnlyPosts = regexp.MustCompile(`/traffic_flows/(async_queries|traffic_analysis_queries)`)
+
+type cacheEntry struct {
+	statusCode int
+	header     http.Header
+	body       []byte
+	created    time.Time
+}
+
+// pceCache is a shared cache of PCE collection GETs used by all job subprocesses
+type pceCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	entries    map[string]map[string]cacheEntry // host -> key -> entry
+	transports map[string]*http.Transport
+	hits       int
+	misses     int
+}
+
+// cacheStatus is the status endpoint representation of the cache
+type cacheStatus struct {
+	TTLSeconds float64 `json:"ttl_seconds"`
+	Entries    int     `json:"entries"`
+	Hits       int     `json:"hits"`
+	Misses     int     `json:"misses"`
+}
+
+// newPCECache creates a cache with upstream transports for each PCE in pce.yaml
+func newPCECache(ttl time.Duration) *pceCache {
+	c := &pceCache{ttl: ttl, entries: make(map[string]map[string]cacheEntry), transports: make(map[string]*http.Transport)}
+	for name, value := range viper.AllSettings() {
+		if _, ok := value.(map[string]interface{}); !ok || !viper.IsSet(name+".fqdn") {
+			continue
+		}
+		host := net.JoinHostPort(viper.GetString(name+".fqdn"), strconv.Itoa(viper.GetInt(name+".port")))
+		c.transports[host] = utils.PCETransport(viper.GetBool(name+".disableTLSChecking"), viper.GetString(name+".proxy"))
+	}
+	return c
+}
+
+// startProxy starts a proxy for a job. Each job has its own proxy so changes are counted per job.
+func (c *pceCache) startProxy(j *job) (string, error) {
+	return utils.StartInterceptProxy(func(req *http.Request) (*http.Response, error) {
+		return c.roundTrip(req, j)
+	})
+}
+
+func (c *pceCache) transport(host string) http.RoundTripper {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t, ok := c.transports[host]; ok {
+		return t
+	}
+	return http.DefaultTransport
+}
+
+// cacheKey includes the authorization header so different api users do not share entries
+func cacheKey(req *http.Request) string {
+	auth := sha256.Sum256([]byte(req.Header.Get("Authorization")))
+	return req.URL.String() + " " + hex.EncodeToString(auth[:])
+}
+
+// changeCount returns the number of objects in a write request. Bulk requests count each object.
+func changeCount(body []byte) int {
+	var objects []interface{}
+	if err := json.Unmarshal(body, &objects); err == nil {
+		return len(objects)
+	}
+	return 1
+}
+
+func (c *pceCache) roundTrip(req *http.Request, j *job) (*http.Response, error) {
+	host := req.URL.Host
+	key := cacheKey(req)
+	cacheable := c.ttl > 0 && req.Method == http.MethodGet && cachedCollections.MatchString(req.URL.Path)
+
+	// Serve from the cache
+	if cacheable {
+		c.mu.Lock()
+		entry, ok := c.entries[host][key]
+		if ok && time.Since(entry.created) < c.ttl {
+			c.hits++
+			c.mu.Unlock()
+			utils.LogDebug(fmt.Sprintf("daemon cache hit - %s - %s", j.name, req.URL.String()))
+			return &http.Response{
+				Status:        fmt.Sprintf("%d %s", entry.statusCode, http.StatusText(entry.statusCode)),
+				StatusCode:    entry.statusCode,
+				Proto:         "HTTP/1.1",
+				ProtoMajor:    1,
+				ProtoMinor:    1,
+				Header:        entry.header.Clone(),
+				Body:          io.NopCloser(bytes.NewReader(entry.body)),
+				ContentLength: int64(len(entry.body)),
+				Request:       req,
+			}, nil
+		}
+		c.misses++
+		c.mu.Unlock()
+	}
+
+	// Keep the request body to count changes
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		reqBody, err = io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	resp, err := c.transport(host).RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Writes clear the host's cache and are counted as changes
+	if req.Method != http.MethodGet && !readOnlyPosts.MatchString(req.URL.Path) {
+		c.mu.Lock()
+		delete(c.entries, host)
+		c.mu.Unlock()
+		if resp.StatusCode < 300 {
+			j.addChanges(changeCount(reqBody))
+		}
+		return resp, nil
+	}
+
+	if !cacheable || resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	c.mu.Lock()
+	if c.entries[host] == nil {
+		c.entries[host] = make(map[string]cacheEntry)
+	}
+	c.entries[host][key] = cacheEntry{statusCode: resp.StatusCode, header: resp.Header.Clone(), body: body, created: time.Now()}
+	c.mu.Unlock()
+
+	return resp, nil
+}
+
+// status returns the cache's status
+func (c *pceCache) status() cacheStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries := 0
+	for _, hostEntries := range c.entries {
+		for _, e := range hostEntries {
+			if time.Since(e.created) < c.ttl {
+				entries++
+			}
+		}
+	}
+	return cacheStatus{TTLSeconds: c.ttl.Seconds(), Entries: entries, Hits: c.hits, Misses: c.misses}
+}
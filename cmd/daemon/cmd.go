@@ -0,0 +1,143 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+)
+
+var jobsFile, statusAddress string
+var cacheTTL int
+
+func init() {
+	DaemonCmd.Flags().StringVar(&jobsFile, "jobs", "", "yaml file with the jobs to schedule. see description for format.")
+	DaemonCmd.Flags().StringVar(&statusAddress, "status-address", "127.0.0.1:9191", "address for the http status endpoint.")
+	DaemonCmd.Flags().IntVar(&cacheTTL, "cache-ttl", 10, "minutes pce object collections are cached between job runs. set to 0 to disable caching.")
+	DaemonCmd.MarkFlagRequired("jobs")
+
+	DaemonCmd.Flags().SortFlags = false
+}
+
+// DaemonCmd runs the daemon command
+var DaemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Run workloader commands on intervals or cron schedules with a status endpoint.",
+	Long: `
+Run workloader commands on intervals or cron schedules with a status endpoint.
+
+The jobs file is yaml with a list of jobs. Each job has a name, a workloader command, and either an interval (e.g., 15m, 1h) or a 5-field cron expression (minute hour day-of-month month day-of-week). The @hourly, @daily, @weekly, and @monthly aliases are also supported. An optional timeout stops a run that takes too long.
+
+jobs:
+  - name: dag-sync
+    command: dag-sync --url https://pan.example.com --update-panos
+    interval: 5m
+  - name: csp-iplist
+    command: csp-iplist --csp aws --update-pce
+    cron: "0 2 * * *"
+    timeout: 30m
+
+Jobs inherit the daemon's environment. Provide credentials with environment variables (e.g., PANOS_KEY for dag-sync or F5_PASSWORD for f5-sync) or the workloader config instead of flags in the jobs file. Values of secret flags (--key, --password, --pwd, --token, and similar) are redacted in the log and status endpoint.
+
+Interval jobs run when the daemon starts and then on the interval. Cron jobs wait for the first matching time. Each run is a separate workloader process so an error in one run does not stop the daemon. --no-prompt is added to every job since the daemon is unattended.
+
+A job never overlaps with itself. If a run is still in progress at the next scheduled time, that run is skipped and counted in the status.
+
+PCE object collections (labels, label dimensions, label groups, IP lists, services, rulesets, virtual services, workloads, and VENs) are cached in the daemon and shared across jobs so each run does not reload the whole PCE. Jobs reach the PCE through a local proxy in the daemon. Any change to a PCE clears that PCE's cache. Use --cache-ttl to control how long entries are used.
+
+Status is available as json at http://<status-address>/status with each job's last run time, duration, result, exit code, number of PCE objects changed, and the last lines of output. PCE changes count each object in create, update, and delete requests. Changes to third-party systems such as PAN or vCenter are not counted.
+
+The update-pce and --no-prompt flags are ignored for this command. Set them in each job's command.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		daemon()
+	},
+}
+
+// daemonStatus is the response of the status endpoint
+type daemonStatus struct {
+	Started       string      `json:"started"`
+	UptimeSeconds float64     `json:"uptime_seconds"`
+	Jobs          []jobStatus `json:"jobs"`
+	Cache         cacheStatus `json:"cache"`
+}
+
+// schedule runs a job at its scheduled times until the daemon stops
+func schedule(j *job, executable string) {
+	next := time.Now()
+	if j.cron != nil {
+		next = j.cron.next(next)
+	}
+	for {
+		if next.IsZero() {
+			utils.LogWarningf(true, "%s - schedule does not have a next run time. job will not run again.", j.name)
+			return
+		}
+		j.mu.Lock()
+		j.nextRun = next
+		j.mu.Unlock()
+
+		time.Sleep(time.Until(next))
+
+		// Run in the background so an overrun is detected at the next scheduled time
+		go j.run(executable)
+		next = j.nextAfter(next)
+		for !next.IsZero() && next.Before(time.Now()) {
+			next = j.nextAfter(next)
+		}
+	}
+}
+
+func daemon() {
+
+	jobs, err := loadJobs(jobsFile)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
+	// Jobs are run with the same workloader binary
+	executable, err := os.Executable()
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
+	// Each job gets its own proxy to the shared cache
+	cache := newPCECache(time.Duration(cacheTTL) * time.Minute)
+	for _, j := range jobs {
+		j.proxyURL, err = cache.startProxy(j)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+	}
+
+	for _, j := range jobs {
+		utils.LogInfof(true, "%s - scheduled %s - workloader %s", j.name, j.schedule, strings.Join(j.args, " "))
+		go schedule(j, executable)
+	}
+
+	// Status endpoint
+	started := time.Now()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		status := daemonStatus{Started: started.Format(time.RFC3339), UptimeSeconds: time.Since(started).Seconds(), Cache: cache.status()}
+		for _, j := range jobs {
+			status.Jobs = append(status.Jobs, j.status())
+		}
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(status); err != nil {
+			utils.LogWarningf(false, "status endpoint - %s", err)
+		}
+	})
+
+	utils.LogInfof(true, "daemon running %d jobs. status available at http://%s/status", len(jobs), statusAddress)
+	if err := http.ListenAndServe(statusAddress, mux); err != nil {
+		utils.LogError(fmt.Sprintf("status endpoint - %s", err))
+	}
+}
@@ -0,0 +1,149 @@
+package daemon
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed 5-field cron expression (minute hour day-of-month month day-of-week)
+type cronSchedule struct {
+	minute, hour, dom, month, dow map[int]bool
+	domAny, dowAny                bool
+}
+
+var cronAliases = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+// parseCronField parses a single cron field with support for *, lists, ranges, and steps
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	values := make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if strings.Contains(part, "/") {
+			s := strings.SplitN(part, "/", 2)
+			var err error
+			step, err = strconv.Atoi(s[1])
+			if err != nil || step < 1 {
+				return nil, fmt.Errorf("invalid step in %s", part)
+			}
+			part = s[0]
+		}
+
+		start, end := min, max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			r := strings.SplitN(part, "-", 2)
+			var err1, err2 error
+			start, err1 = strconv.Atoi(r[0])
+			end, err2 = strconv.Atoi(r[1])
+			if err1 != nil || err2 != nil {
+				return nil, fmt.Errorf("invalid range %s", part)
+			}
+		default:
+			v, err := strconv.Atoi(part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %s", part)
+			}
+			start = v
+			// A single value with a step runs from the value to the max
+			if step == 1 {
+				end = v
+			}
+		}
+		if start < min || end > max || start > end {
+			return nil, fmt.Errorf("%s is out of range %d-%d", part, min, max)
+		}
+		for i := start; i <= end; i += step {
+			values[i] = true
+		}
+	}
+	return values, nil
+}
+
+// parseCron parses a 5-field cron expression or one of the @hourly, @daily, @weekly, @monthly aliases
+func parseCron(expr string) (cronSchedule, error) {
+	if alias, ok := cronAliases[strings.TrimSpace(expr)]; ok {
+		expr = alias
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return cronSchedule{}, fmt.Errorf("cron expression %s must have 5 fields", expr)
+	}
+
+	var c cronSchedule
+	var err error
+	if c.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return c, fmt.Errorf("cron minute - %s", err)
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return c, fmt.Errorf("cron hour - %s", err)
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return c, fmt.Errorf("cron day of month - %s", err)
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return c, fmt.Errorf("cron month - %s", err)
+	}
+	if c.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return c, fmt.Errorf("cron day of week - %s", err)
+	}
+	// Sunday is 0 or 7
+	if c.dow[7] {
+		c.dow[0] = true
+	}
+	c.domAny = fields[2] == "*"
+	c.dowAny = fields[4] == "*"
+
+	return c, nil
+}
+
+// next returns the first time after t that matches the schedule
+func (c cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// Search up to 5 years to cover schedules like Feb 29
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if !c.month[int(t.Month())] {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.hour[t.Hour()] {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.minute[t.Minute()] {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// dayMatches follows cron behavior where a restricted day of month and day of week match if either matches
+func (c cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := c.dom[t.Day()]
+	dowMatch := c.dow[int(t.Weekday())]
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dowMatch
+	case c.dowAny:
+		return domMatch
+	default:
+		return domMatch || dowMatch
+	}
+}
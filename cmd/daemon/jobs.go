@@ -0,0 +1,339 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/viper"
+)
+
+// jobConfig is a job entry in the jobs yaml file
+type jobConfig struct {
+	Name     string `mapstructure:"name"`
+	Command  string `mapstructure:"command"`
+	Interval string `mapstructure:"interval"`
+	Cron     string `mapstructure:"cron"`
+	Timeout  string `mapstructure:"timeout"`
+}
+
+// job is a scheduled workloader command and the status of its runs
+type job struct {
+	mu       sync.Mutex
+	name     string
+	args     []string
+	command  string // args with secret flag values redacted for the log and status
+	schedule string
+	interval time.Duration
+	cron     *cronSchedule
+	timeout  time.Duration
+	proxyURL string
+
+	running      bool
+	runs         int
+	failures     int
+	skipped      int
+	nextRun      time.Time
+	lastStart    time.Time
+	lastDuration time.Duration
+	lastExitCode int
+	lastResult   string
+	lastChanges  int
+	lastOutput   []string
+	changes      int
+}
+
+// jobStatus is the status endpoint representation of a job
+type jobStatus struct {
+	Name                string   `json:"name"`
+	Command             string   `json:"command"`
+	Schedule            string   `json:"schedule"`
+	Running             bool     `json:"running"`
+	Runs                int      `json:"runs"`
+	Failures            int      `json:"failures"`
+	SkippedOverlaps     int      `json:"skipped_overlaps"`
+	NextRun             string   `json:"next_run,omitempty"`
+	LastStart           string   `json:"last_start,omitempty"`
+	LastDurationSeconds float64  `json:"last_duration_seconds"`
+	LastResult          string   `json:"last_result,omitempty"`
+	LastExitCode        int      `json:"last_exit_code"`
+	LastChanges         int      `json:"last_changes"`
+	LastOutput          []string `json:"last_output,omitempty"`
+}
+
+// secretFlags are flags with credential values. Their values are redacted from the log and status endpoint.
+var secretFlags = []string{"--key", "-k", "--password", "--pwd", "-p", "--token", "--api-key", "--api-secret", "--client-secret", "--secret", "--f5-pwd", "--netscaler-pwd"}
+
+// secretFlagValues matches a secret flag and its value in a line of output
+var secretFlagValues = regexp.MustCompile(`(^|\s)(` + strings.Join(secretFlags, "|") + `)(=|\s+)("[^"]*"|'[^']*'|\S+)`)
+
+// redactArgs replaces the values of secret flags
+func redactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	copy(redacted, args)
+	for i, a := range redacted {
+		for _, f := range secretFlags {
+			if a == f && i+1 < len(redacted) {
+				redacted[i+1] = "<redacted>"
+			}
+			if strings.HasPrefix(a, f+"=") {
+				redacted[i] = f + "=<redacted>"
+			}
+		}
+	}
+	return redacted
+}
+
+// redactOutput replaces the values of secret flags in lines of output
+func redactOutput(lines []string) []string {
+	redacted := []string{}
+	for _, l := range lines {
+		redacted = append(redacted, secretFlagValues.ReplaceAllString(l, "${1}${2}${3}<redacted>"))
+	}
+	return redacted
+}
+
+// splitArgs splits a command string on spaces while keeping single and double quoted values together
+func splitArgs(command string) ([]string, error) {
+	args := []string{}
+	var current strings.Builder
+	var quote rune
+	inArg := false
+	for _, r := range command {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unclosed quote in %s", command)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// loadJobs parses the jobs yaml file
+func loadJobs(jobsFile string) ([]*job, error) {
+	v := viper.New()
+	v.SetConfigFile(jobsFile)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	var configs []jobConfig
+	if err := v.UnmarshalKey("jobs", &configs); err != nil {
+		return nil, err
+	}
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("%s does not have any jobs", jobsFile)
+	}
+
+	jobs := []*job{}
+	names := make(map[string]bool)
+	for i, c := range configs {
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("job-%d", i+1)
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("%s - duplicate job name", c.Name)
+		}
+		names[c.Name] = true
+
+		args, err := splitArgs(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(c.Command), "workloader ")))
+		if err != nil {
+			return nil, fmt.Errorf("%s - %s", c.Name, err)
+		}
+		if len(args) == 0 {
+			return nil, fmt.Errorf("%s - command is required", c.Name)
+		}
+		if args[0] == "daemon" {
+			return nil, fmt.Errorf("%s - daemon cannot be run as a job", c.Name)
+		}
+
+		// Jobs are unattended so never prompt
+		hasNoPrompt := false
+		for _, a := range args {
+			if a == "--no-prompt" {
+				hasNoPrompt = true
+			}
+		}
+		if !hasNoPrompt {
+			args = append(args, "--no-prompt")
+		}
+
+		j := &job{name: c.Name, args: args, command: "workloader " + strings.Join(redactArgs(args), " ")}
+		switch {
+		case c.Interval != "" && c.Cron != "":
+			return nil, fmt.Errorf("%s - set interval or cron, not both", c.Name)
+		case c.Interval != "":
+			j.interval, err = time.ParseDuration(c.Interval)
+			if err != nil || j.interval < time.Minute {
+				return nil, fmt.Errorf("%s - interval must be a duration of at least 1m such as 15m or 1h", c.Name)
+			}
+			j.schedule = "every " + c.Interval
+		case c.Cron != "":
+			cs, err := parseCron(c.Cron)
+			if err != nil {
+				return nil, fmt.Errorf("%s - %s", c.Name, err)
+			}
+			j.cron = &cs
+			j.schedule = "cron " + c.Cron
+		default:
+			return nil, fmt.Errorf("%s - interval or cron is required", c.Name)
+		}
+		if c.Timeout != "" {
+			j.timeout, err = time.ParseDuration(c.Timeout)
+			if err != nil {
+				return nil, fmt.Errorf("%s - invalid timeout %s", c.Name, c.Timeout)
+			}
+		}
+		jobs = append(jobs, j)
+	}
+
+	return jobs, nil
+}
+
+// nextAfter returns the next scheduled run after t
+func (j *job) nextAfter(t time.Time) time.Time {
+	if j.cron != nil {
+		return j.cron.next(t)
+	}
+	return t.Add(j.interval)
+}
+
+// tailWriter keeps the last lines written to it
+type tailWriter struct {
+	mu      sync.Mutex
+	lines   []string
+	partial string
+	max     int
+}
+
+func (t *tailWriter) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	text := t.partial + strings.ReplaceAll(string(p), "\r", "")
+	lines := strings.Split(text, "\n")
+	t.partial = lines[len(lines)-1]
+	for _, l := range lines[:len(lines)-1] {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		t.lines = append(t.lines, l)
+		if len(t.lines) > t.max {
+			t.lines = t.lines[1:]
+		}
+	}
+	return len(p), nil
+}
+
+// run executes the job as a workloader subprocess so a fatal error or exit code does not stop the daemon
+func (j *job) run(executable string) {
+	j.mu.Lock()
+	if j.running {
+		j.skipped++
+		j.mu.Unlock()
+		utils.LogWarningf(true, "%s - previous run still in progress. skipping.", j.name)
+		return
+	}
+	j.running = true
+	j.lastStart = time.Now()
+	j.changes = 0
+	j.mu.Unlock()
+
+	utils.LogInfof(true, "%s - starting %s", j.name, j.command)
+
+	ctx := context.Background()
+	cancel := func() {}
+	if j.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, j.timeout)
+	}
+	defer cancel()
+
+	tail := &tailWriter{max: 20}
+	cmd := exec.CommandContext(ctx, executable, j.args...)
+	cmd.Stdout = io.MultiWriter(os.Stdout, tail)
+	cmd.Stderr = io.MultiWriter(os.Stderr, tail)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%s", utils.PCECacheEnv, j.proxyURL))
+	err := cmd.Run()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.running = false
+	j.runs++
+	j.lastDuration = time.Since(j.lastStart)
+	j.lastChanges = j.changes
+	j.lastOutput = redactOutput(tail.lines)
+	j.lastExitCode = 0
+	j.lastResult = "success"
+	if err != nil {
+		j.failures++
+		j.lastResult = "failed"
+		j.lastExitCode = -1
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			j.lastExitCode = exitErr.ExitCode()
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			j.lastResult = "timed out"
+		}
+		utils.LogWarningf(true, "%s - %s after %s - exit code %d - %d pce changes", j.name, j.lastResult, j.lastDuration.Round(time.Second), j.lastExitCode, j.lastChanges)
+		return
+	}
+	utils.LogInfof(true, "%s - completed in %s - %d pce changes", j.name, j.lastDuration.Round(time.Second), j.lastChanges)
+}
+
+// addChanges counts pce objects changed by the running job
+func (j *job) addChanges(count int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.changes += count
+}
+
+// status returns the job's status
+func (j *job) status() jobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	s := jobStatus{
+		Name:                j.name,
+		Command:             j.command,
+		Schedule:            j.schedule,
+		Running:             j.running,
+		Runs:                j.runs,
+		Failures:            j.failures,
+		SkippedOverlaps:     j.skipped,
+		LastDurationSeconds: j.lastDuration.Seconds(),
+		LastResult:          j.lastResult,
+		LastExitCode:        j.lastExitCode,
+		LastChanges:         j.lastChanges,
+		LastOutput:          j.lastOutput,
+	}
+	if !j.nextRun.IsZero() {
+		s.NextRun = j.nextRun.Format(time.RFC3339)
+	}
+	if !j.lastStart.IsZero() {
+		s.LastStart = j.lastStart.Format(time.RFC3339)
+	}
+	return s
+}
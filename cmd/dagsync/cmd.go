@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -72,6 +73,8 @@ type Result struct {
 	Enabled   string    `xml:"enabled,omitempty"`
 	LocalInfo LocalInfo `xml:"local-info,omitempty"`
 	Group     Group     `xml:"group,omitempty"`
+	// Panorama device groups
+	DeviceGroups DeviceGroups `xml:"devicegroups,omitempty"`
 }
 
 // Entry - Declare Entry container of PAN API call
@@ -107,6 +110,9 @@ type Member struct {
 type PAN struct {
 	Key          string
 	URL          string
+	Vsys         string
+	Target       string // Panorama managed device serial. Blank when the URL is the firewall.
+	Name         string // Name used in logs and the reconciliation report
 	FoundCounter int
 	RegIPs       map[string]IPTags
 }
@@ -121,18 +127,25 @@ type IPTags struct {
 // Declare local global variables
 var pce illumioapi.PCE
 var err error
-var noPrompt, addIPv6, update, insecure, clean, removeOld, changePersistent, noHref bool
-var panURL, panKey, panVsys, filterFile, timeout string
+var noPrompt, addIPv6, update, insecure, clean, removeOld, changePersistent, noHref, includeUnlabeled bool
+var panURL, panKey, panVsys, filterFile, timeout, deviceGroups, tagTemplate, outputFileName string
+var batchSize, retries int
 
 func init() {
 	DAGSyncCmd.Flags().StringVarP(&panURL, "url", "u", "", "URL required to reach Panorama or PAN FW(requires https://).")
 	DAGSyncCmd.Flags().StringVarP(&panKey, "key", "k", "", "Key used to authenticate with Panorama or PAN FW.")
 	DAGSyncCmd.Flags().StringVarP(&panVsys, "vsys", "v", "vsys1", "Vsys used to progam registered IPs and tags.")
+	DAGSyncCmd.Flags().StringVar(&deviceGroups, "device-group", "", "Comma-separated list of Panorama device groups. Registered IPs are programmed on each connected firewall in the device groups through Panorama. Requires --url to be Panorama.")
+	DAGSyncCmd.Flags().StringVar(&tagTemplate, "tag-template", "{value}", "Template for tags built from workload labels. {key} is replaced with the label dimension and {value} with the label value (e.g., illumio.{key}.{value}).")
+	DAGSyncCmd.Flags().IntVar(&batchSize, "batch-size", 500, "Maximum registered IP entries in each register or unregister call.")
+	DAGSyncCmd.Flags().IntVar(&retries, "retries", 3, "Number of retries for a failed register or unregister call.")
+	DAGSyncCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the reconciliation report output file location. default is current location with a timestamped filename.")
 	DAGSyncCmd.Flags().BoolVarP(&addIPv6, "ipv6", "6", false, "Include IPv6 addresses in the syncing of PCE IP and labels/tags with PAN DAGs")
 	DAGSyncCmd.Flags().BoolVarP(&insecure, "insecure", "i", false, "Ignore SSL certificate validation when communicating with PAN.")
 	DAGSyncCmd.Flags().BoolVarP(&update, "update-panos", "", false, "Implement identified changes on PanOS (versus just logging by default).")
-	DAGSyncCmd.Flags().StringVarP(&filterFile, "file", "f", "", "Optional CSV file with labels to filter PCE workloads. CSV requires role, app, env, and loc headers on row. Each subsequent row is a unique combination of labels to filter on. Blank values = all.")
+	DAGSyncCmd.Flags().StringVarP(&filterFile, "file", "f", "", "Optional CSV file with labels to filter PCE workloads. Headers are label dimensions (e.g., role, app, env, loc). Each subsequent row is a unique combination of labels to filter on. Blank values = all.")
 	DAGSyncCmd.Flags().StringVarP(&timeout, "timeout", "t", "0", "Timeout value")
+	DAGSyncCmd.Flags().BoolVar(&includeUnlabeled, "include-unlabeled", false, "Register IPs of workloads without labels with only the workload href tag. Ignored with --no-href.")
 	DAGSyncCmd.Flags().BoolVarP(&removeOld, "remove-stale", "r", false, "Remove all Registered IPs that don't have IP on the PCE.")
 	DAGSyncCmd.Flags().BoolVar(&changePersistent, "non-persistent", false, "RegisterIPs are persistent by default.")
 	DAGSyncCmd.Flags().BoolVarP(&clean, "clean", "c", false, "Remove all Registered IPs from PanOS")
@@ -151,6 +164,17 @@ Syncs IPs and labels from PCE workloads to Dynamic Address Groups on Palo Alto D
 
 The PANOS_URL, PANOS_KEY, and PANOS_VSYS environment variables can be used instead of the --url (-u), --key (-k), and --vsys (-v) flags, respectively.
 
+Targets:
+- A single firewall with --url https://fw.example.com
+- Multiple firewalls sharing the same key and vsys with a comma-separated --url
+- Firewalls managed by Panorama with --url https://panorama.example.com --device-group dg1,dg2. Each connected firewall in the device groups is programmed through Panorama. Firewalls with multiple vsys in the device group are programmed per vsys.
+
+Tags are built from every label on a workload using --tag-template. The default {value} uses the label value. A template like illumio.{key}.{value} avoids collisions between label dimensions with the same value. The workload href is also added as a tag unless --no-href is used. Workloads without labels are skipped unless --include-unlabeled is used to register them with only the href tag. Changing the template replaces the previous tags on the next sync.
+
+Register and unregister calls are split into batches of --batch-size entries. Failed calls are retried with a backoff. A reconciliation report CSV lists each device with the registered IPs found, the changes identified, and the result of each batch.
+
+Use workloader mock-pan to run a local stub PAN XML API for testing.
+
 All ipv4 or ipv6 link local addresses will always be ignored (169.254.0.0/16 or FE80::/10).
 
 The --update-pce flag is ignored for this command. The --update-panos flag is used instead.`,
@@ -189,6 +213,7 @@ func httpSetUp(httpAction, apiURL string, body []byte, disableTLSChecking bool,
 	if disableTLSChecking {
 		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
 	}
+	client.Transport = utils.WrapTransport(client.Transport)
 
 	req, err := http.NewRequest(httpAction, apiURL, httpBody)
 	if err != nil {
@@ -228,8 +253,8 @@ func httpSetUp(httpAction, apiURL string, body []byte, disableTLSChecking bool,
 	return response, nil
 }
 
-// panHTTP - Function to setup HTTP POST with necessary headers and other requirements
-func (pan *PAN) callHTTP(cmdType string, cmd string) DagResponse {
+// callHTTP - Function to setup HTTP POST with necessary headers and other requirements.  Returns an error if the call fails or the response has an error.
+func (pan *PAN) callHTTP(cmdType string, cmd string) (DagResponse, error) {
 
 	var dagResp DagResponse
 	apiURL := fmt.Sprintf("%s/api", pan.URL)
@@ -237,28 +262,52 @@ func (pan *PAN) callHTTP(cmdType string, cmd string) DagResponse {
 	urlInfo.Set("key", pan.Key)
 	urlInfo.Set("type", cmdType)
 	urlInfo.Set("cmd", cmd)
-	urlInfo.Set("vsys", panVsys)
+	urlInfo.Set("vsys", pan.Vsys)
+	//Panorama redirects the call to the managed firewall with this serial.
+	if pan.Target != "" {
+		urlInfo.Set("target", pan.Target)
+	}
 
 	url, err := url.ParseRequestURI(apiURL)
 	if err != nil {
-		utils.LogError(fmt.Sprintf("Get Registered IP URL Parse failed - %s", err))
+		return dagResp, fmt.Errorf("URL Parse failed - %s", err)
 	}
 
 	resp, err := httpSetUp(http.MethodPost, url.String(), []byte(urlInfo.Encode()), insecure, [][2]string{{"Content-Type", "application/x-www-form-urlencoded"}, {"Content-Length", strconv.Itoa(len(urlInfo.Encode()))}})
 	if err != nil {
-		utils.LogError(fmt.Sprintf("PanHTTP Call failed - %s", err))
+		return dagResp, fmt.Errorf("PanHTTP Call failed - %s", err)
 	}
 
 	//Unmarshal the HTTP call and place in DagResponse.
 	if err := xml.Unmarshal([]byte(resp.RespBody), &dagResp); err != nil {
-		utils.LogError(fmt.Sprintf("Unmarshall HTTPSetUp response - %s - Body - %s", err, resp.ReqBody))
+		return dagResp, fmt.Errorf("Unmarshall HTTPSetUp response - %s - Body - %s", err, resp.RespBody)
 	}
 	//check to see that the results do not have an error.
 	if dagResp.Result.Error != "" {
-		utils.LogError(fmt.Sprintf("API request has Error - %s", dagResp.Result.Error))
+		return dagResp, fmt.Errorf("API request has Error - %s", dagResp.Result.Error)
+	}
+	//op commands that fail only return an error status.
+	if cmdType == "op" && dagResp.Status == "error" {
+		return dagResp, fmt.Errorf("API request returned error status - %s", resp.RespBody)
 	}
 
-	return dagResp
+	return dagResp, nil
+}
+
+// callHTTPRetry - Calls callHTTP and retries failed calls with a backoff.
+func (pan *PAN) callHTTPRetry(cmdType string, cmd string) (DagResponse, error) {
+	var dagResp DagResponse
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			utils.LogWarningf(false, "%s - retry %d of %d - %s", pan.Name, attempt, retries, err)
+			time.Sleep(time.Duration(attempt*2) * time.Second)
+		}
+		if dagResp, err = pan.callHTTP(cmdType, cmd); err == nil {
+			return dagResp, nil
+		}
+	}
+	return dagResp, err
 }
 
 // ipv6Check - Function that checks IP string for valid IP.  Also checks to see if Ipv6 and if IPv6 should be included
@@ -271,20 +320,33 @@ func ipCheck(ip, href string) string {
 	}
 
 	//skip all link local addresses
-	_, ipv4LL, _ := net.ParseCIDR("169.254.0.0/16")
-	_, ipv6LL, _ := net.ParseCIDR("fe80::/10")
+	if IsLinkLocal(net.ParseIP(ip)) {
+		return ""
+	}
 
 	//Check if the IP is v4 or v6.  For v6 only add if command option enabled.
-	if strings.Contains(ip, ".") && !ipv4LL.Contains(net.ParseIP(ip)) {
+	if strings.Contains(ip, ".") {
 		return ip
 	}
-	if strings.Contains(ip, ":") && addIPv6 && !ipv6LL.Contains(net.ParseIP(ip)) {
+	if strings.Contains(ip, ":") && addIPv6 {
 		return ip
 	}
 
 	return ""
 }
 
+// IsLinkLocal - Returns true for ipv4 or ipv6 link local addresses (169.254.0.0/16 or FE80::/10).
+func IsLinkLocal(ip net.IP) bool {
+	_, ipv4LL, _ := net.ParseCIDR("169.254.0.0/16")
+	_, ipv6LL, _ := net.ParseCIDR("fe80::/10")
+	return ipv4LL.Contains(ip) || ipv6LL.Contains(ip)
+}
+
+// labelTag - Builds the tag for a label using the tag template.
+func labelTag(key, value string) string {
+	return strings.NewReplacer("{key}", key, "{value}", value).Replace(tagTemplate)
+}
+
 // workloadIPMap - Build a map of all workloads IPs and their corresponding labels.
 func workloadIPMap(filterList []map[string]string) map[string]IPTags {
 	var pceIpMap = make(map[string]IPTags)
@@ -298,37 +360,35 @@ func workloadIPMap(filterList []map[string]string) map[string]IPTags {
 	for _, w := range wklds {
 		var labels []string
 
-		//Make sure there is a Tag to add.
-		if len(*w.Labels) == 0 {
+		//Make sure there is a Tag to add. Unlabeled workloads only get the href tag.
+		if (w.Labels == nil || len(*w.Labels) == 0) && (!includeUnlabeled || noHref) {
 			continue
 		}
 
-		//Cycle through labels getting the Value from the HrefLabelMap as well as build a label map to use for filtering
+		//Cycle through labels building tags from the template as well as build a label map to use for filtering
 		wkldLabels := make(map[string]string)
-		for _, l := range *w.Labels {
-			labels = append(labels, pce.Labels[l.Href].Value)
-			wkldLabels[pce.Labels[l.Href].Key] = pce.Labels[l.Href].Value
+		if w.Labels != nil {
+			for _, l := range *w.Labels {
+				labels = append(labels, labelTag(pce.Labels[l.Href].Key, pce.Labels[l.Href].Value))
+				wkldLabels[pce.Labels[l.Href].Key] = pce.Labels[l.Href].Value
+			}
 		}
 
 		//Use the filterFile to skip workloads that dont match labels in the file.
 		match := false
-		for i := 1; i < len(filterList); i++ {
+		for _, filter := range filterList {
 			numMatch := 0
-			for k, v := range filterList[i] {
+			for k, v := range filter {
 				if v == "" {
 					numMatch++
 					continue
 				}
-				if _, ok := wkldLabels[k]; !ok {
-					//				numMatch++
-					continue
-				}
 				if wkldLabels[k] == v {
 					numMatch++
 				}
 			}
 			//found match
-			if numMatch == 4 {
+			if numMatch == len(filter) {
 				match = true
 				break
 			}
@@ -349,18 +409,23 @@ func workloadIPMap(filterList []map[string]string) map[string]IPTags {
 	return pceIpMap
 }
 
-// getPanRegisteredIPs - Get all currently loaded Registered IPs from PAN.  Uses to compare against PCE workload IPs to sync.
-func (pan *PAN) LoadRegisteredIPs() {
-
-	var dagResp DagResponse
+// LoadRegisteredIPs - Get all currently loaded Registered IPs from PAN.  Uses to compare against PCE workload IPs to sync.
+func (pan *PAN) LoadRegisteredIPs() error {
 
-	//var tmpDagEntries = make(map[string][]string)
+	//Send Set VSYS API request.
+	setVsysCMD := fmt.Sprintf("<set><system><setting><target-vsys>%s</target-vsys></setting></system></set>", pan.Vsys)
+	if _, err := pan.callHTTPRetry("op", setVsysCMD); err != nil {
+		return err
+	}
 
-	//Send Set VSYS API request.  panHttp check for success within the response message.  Fails if not successful.
-	setVsysCMD := fmt.Sprintf("<set><system><setting><target-vsys>%s</target-vsys></setting></system></set>", panVsys)
-	dagResp = pan.callHTTP("op", setVsysCMD)
+	//Send Set VSYS back to "none" when done.
+	defer func() {
+		setVsysCMD = "<set><system><setting><target-vsys>none</target-vsys></setting></system></set>"
+		if _, err := pan.callHTTPRetry("op", setVsysCMD); err != nil {
+			utils.LogWarningf(true, "%s - setting target-vsys to none - %s", pan.Name, err)
+		}
+	}()
 
-	//remove parameter so we can readd
 	entryLimit := 500
 	startPoint := 1
 	//limit calls to 500.  and Cycle through if you find more.
@@ -369,18 +434,20 @@ func (pan *PAN) LoadRegisteredIPs() {
 	totalCount := 0
 	illumioCount := 0
 	for {
-		//Send GET Registered IP API request.  panHttp check for success within the response message.  Fails if not successful.
-		dagResp = pan.callHTTP("op", getRegIPCMD)
+		//Send GET Registered IP API request.
+		dagResp, err := pan.callHTTPRetry("op", getRegIPCMD)
+		if err != nil {
+			return err
+		}
 
-		//Add the discovered registered IPs and Tags to global variable used for syncing.  Make sure ILLUMIOSTR is present in list and remove.
+		//Add the discovered registered IPs and Tags used for syncing.  The workload href tag marks IPs added by workloader.
 		for _, e := range dagResp.Result.Entry {
 
 			if net.ParseIP(e.IP) == nil {
-				utils.LogError(fmt.Sprintf("Invalid IP addres from PanOS - %s", e.IP))
+				utils.LogWarningf(false, "%s - Invalid IP address from PanOS - %s", pan.Name, e.IP)
 				continue
 			}
 
-			//Must Create a Member struct for each label.  Needed to add timeout option.
 			found := false
 			cleanTags := []string{}
 			href := ""
@@ -392,55 +459,91 @@ func (pan *PAN) LoadRegisteredIPs() {
 				}
 				cleanTags = append(cleanTags, m.Member)
 			}
-			//Mark all the entries if mark is selected.
+			//Mark all the entries if not using the href tag.
 			if noHref {
 				found = true
-				illumioCount++
 			}
-			if found && !noHref {
-				pan.RegIPs[net.ParseIP(e.IP).String()] = IPTags{Found: found, Labels: cleanTags, HrefLabel: href}
+			if found {
 				illumioCount++
 			}
 
 			pan.RegIPs[net.ParseIP(e.IP).String()] = IPTags{Found: found, Labels: cleanTags, HrefLabel: href}
-			//Cover how to count when we dont care about IllumioTag..
-
-			//tmpDagEntries[net.ParseIP(e.IP).String()] = e.Tag.Members
-
 		}
 		pan.FoundCounter = illumioCount
 		totalCount += len(dagResp.Result.Entry)
 		//If number of entries less than per call limit no more request to call. Otherwise move start point + entryLimits and request again.
 		if dagResp.Result.Count < entryLimit {
 			break
-
-		} else {
-			startPoint += entryLimit
-			getRegIPCMD = fmt.Sprintf("<show><object><registered-ip><limit>%d</limit><start-point>%d</start-point></registered-ip></object></show>", entryLimit, startPoint)
 		}
+		startPoint += entryLimit
+		getRegIPCMD = fmt.Sprintf("<show><object><registered-ip><limit>%d</limit><start-point>%d</start-point></registered-ip></object></show>", entryLimit, startPoint)
+	}
+	//print out total and how many RegisterIPs are available to work with.
+	utils.LogInfo(fmt.Sprintf("%s - %d Total RegisteredIPs on PanOS. Of those RegisteredIPs %d previously added by PCE ", pan.Name, totalCount, illumioCount), true)
 
+	return nil
+}
+
+// sortedIPs - Returns the IPs in a map sorted so batches are consistent between runs.
+func sortedIPs(listRegisterIP map[string]IPTags) []string {
+	ips := []string{}
+	for ip := range listRegisterIP {
+		ips = append(ips, ip)
 	}
-	//print out total and how many RegisterIPs are available to work with. *note using -t "" counts all registerIPs.
-	utils.LogInfo(fmt.Sprintf("%d Total RegisteredIPs on PanOS. Of those RegisteredIPs %d previously added by PCE ", totalCount, illumioCount), true)
+	sort.Strings(ips)
+	return ips
+}
 
-	//Send Set VSYS back to "none" API request.  panHttp check for success within the response message.  Fails if not successful.
-	setVsysCMD = "<set><system><setting><target-vsys>none</target-vsys></setting></system></set>"
-	dagResp = pan.callHTTP("op", setVsysCMD)
+// sendBatches - Sends register or unregister entries to PAN in batches of batchSize.  Returns the number of batches and failed batches.
+func (pan *PAN) sendBatches(action string, entries []Entry) (batches, failed int) {
+	for start := 0; start < len(entries); start += batchSize {
+		end := start + batchSize
+		if end > len(entries) {
+			end = len(entries)
+		}
+		batches++
 
+		payload := Payload{}
+		if action == "register" {
+			payload.Register = RegIPs{Entry: entries[start:end]}
+		} else {
+			payload.Unregister = RegIPs{Entry: entries[start:end]}
+		}
+		xmlData, _ := xml.MarshalIndent(DagRequest{Type: "update", Version: "2.0", Payload: payload}, "", "")
+
+		dagResp, err := pan.callHTTPRetry("user-id", string(xmlData))
+		if err != nil {
+			utils.LogWarningf(true, "%s - %s batch %d of %d entries failed - %s", pan.Name, action, batches, end-start, err)
+			failed++
+			continue
+		}
+		if dagResp.Status != "success" {
+			utils.LogWarningf(true, "%s - %s batch %d API response received error. Check logs", pan.Name, action, batches)
+			respEntries := dagResp.MSG.Line.UIDResponse.Payload.Register.Entry
+			if action == "unregister" {
+				respEntries = dagResp.MSG.Line.UIDResponse.Payload.Unregister.Entry
+			}
+			for _, entry := range respEntries {
+				utils.LogInfo(fmt.Sprintf("%s - %s received error - %v", pan.Name, action, entry), false)
+			}
+			failed++
+		}
+	}
+	return batches, failed
 }
 
-// UnRegister - Call PAN to remove IPs or Labels.
-func (pan *PAN) UnRegister(listRegisterIP map[string]IPTags) {
-	var request DagRequest
+// UnRegister - Call PAN to remove IPs or Labels.  Returns the number of batches and failed batches.
+func (pan *PAN) UnRegister(listRegisterIP map[string]IPTags) (int, int) {
 	var entries []Entry
 
 	//If the label list=0 then its is just an IP then it should be removed.  Remove no matter if there are labels if flush is selected.
 	removeCounter := 0
 	updateCounter := 0
-	for ip, ipTags := range listRegisterIP {
+	for _, ip := range sortedIPs(listRegisterIP) {
+		ipTags := listRegisterIP[ip]
 		if len(ipTags.Labels) == 0 || (clean && ipTags.Found) {
-			entries = append(entries, Entry{IP: ip}) //, Tag: Tag{Members: labels}
-			utils.LogInfo(fmt.Sprintf("Unregister %s", ip), false)
+			entries = append(entries, Entry{IP: ip})
+			utils.LogInfo(fmt.Sprintf("%s - Unregister %s", pan.Name, ip), false)
 			removeCounter++
 		} else if ipTags.Found {
 			//Must Create a Member struct for each label.  Needed to add timeout option.
@@ -449,36 +552,30 @@ func (pan *PAN) UnRegister(listRegisterIP map[string]IPTags) {
 				allMembers = append(allMembers, Member{Member: l, Timeout: timeout})
 			}
 			entries = append(entries, Entry{IP: ip, Tag: Tag{Members: allMembers}})
-			utils.LogInfo(fmt.Sprintf("Unregistering Labels %s - labels %s", ip, ipTags.Labels), false)
+			utils.LogInfo(fmt.Sprintf("%s - Unregistering Labels %s - labels %s", pan.Name, ip, ipTags.Labels), false)
 			updateCounter++
 		}
 	}
-	request = DagRequest{Type: "update", Version: "2.0", Payload: Payload{Unregister: RegIPs{Entry: entries}}}
 
-	//Create and Send API call to PAN to unregister
-	xmlData, _ := xml.MarshalIndent(request, "", "")
-	dagResp := pan.callHTTP("user-id", string(xmlData))
-	if dagResp.Status != "success" {
-		utils.LogInfo("UnRegister API response received error. Check logs", true)
-		for _, entry := range dagResp.MSG.Line.UIDResponse.Payload.Unregister.Entry {
-			utils.LogInfo(fmt.Sprintf("Unregister received error - %s", entry), false)
-		}
-	}
-	utils.LogInfo(fmt.Sprintf("%d IP(s) removed + %d Tag(s) deleted from RegisteredIPs on PanOS", removeCounter, updateCounter), true)
+	batches, failed := pan.sendBatches("unregister", entries)
+	utils.LogInfo(fmt.Sprintf("%s - %d IP(s) removed + %d Tag(s) deleted from RegisteredIPs on PanOS in %d batch(es). %d batch(es) failed.", pan.Name, removeCounter, updateCounter, batches, failed), true)
+
+	return batches, failed
 }
 
-// Register - Call PAN to add IPs and labels to Registered IPs
-func (pan *PAN) Register(listRegisterIP map[string]IPTags) {
-	var request DagRequest
+// Register - Call PAN to add IPs and labels to Registered IPs.  Returns the number of batches and failed batches.
+func (pan *PAN) Register(listRegisterIP map[string]IPTags) (int, int) {
 	var entries []Entry
 
-	for ip, ipTags := range listRegisterIP {
+	for _, ip := range sortedIPs(listRegisterIP) {
+		ipTags := listRegisterIP[ip]
+		labels := append([]string{}, ipTags.Labels...)
 		if !noHref && !ipTags.Found {
-			ipTags.Labels = append(ipTags.Labels, ipTags.HrefLabel)
+			labels = append(labels, ipTags.HrefLabel)
 		}
 		//Must Create a Member struct for each label.  Needed to add timeout option.
 		allMembers := []Member{}
-		for _, i := range ipTags.Labels {
+		for _, i := range labels {
 			allMembers = append(allMembers, Member{Member: i, Timeout: timeout})
 		}
 		p := "1"
@@ -486,42 +583,35 @@ func (pan *PAN) Register(listRegisterIP map[string]IPTags) {
 			p = "0"
 		}
 		entries = append(entries, Entry{IP: ip, FromAgent: "0", Persistent: p, Tag: Tag{Members: allMembers}})
-		utils.LogInfo(fmt.Sprintf("Register %s with the following labels %s", ip, ipTags.Labels), false)
+		utils.LogInfo(fmt.Sprintf("%s - Register %s with the following labels %s", pan.Name, ip, labels), false)
 	}
-	request = DagRequest{Type: "update", Version: "2.0", Payload: Payload{Register: RegIPs{Entry: entries}}}
-
-	//If update set send api to PAN
-
-	xmlData, _ := xml.MarshalIndent(request, "", "")
-	dagResp := pan.callHTTP("user-id", string(xmlData))
-	if dagResp.Status != "success" {
-		utils.LogInfo("Register API response received error. Check logs", true)
-		for _, entry := range dagResp.MSG.Line.UIDResponse.Payload.Register.Entry {
-			utils.LogInfo(fmt.Sprintf("Register received error - %s", entry), false)
-		}
 
-	}
+	batches, failed := pan.sendBatches("register", entries)
+	utils.LogInfo(fmt.Sprintf("%s - %d Registered changes made in %d batch(es). %d batch(es) failed. For specifics check workloader.log", pan.Name, len(listRegisterIP), batches, failed), true)
 
-	utils.LogInfo(fmt.Sprintf("%d Registered changes will be made. For specifics check workloader.log", len(listRegisterIP)), true)
+	return batches, failed
 }
 
-// checkHAPrimary - make sure we are adding Registered IPs to primary PAN in a HA
-func (pan *PAN) checkHA() bool {
+// checkHA - make sure we are adding Registered IPs to primary PAN in a HA
+func (pan *PAN) checkHA() (bool, error) {
 
-	//Send show HA API request.  panHttp check for success within the response message.  Fails if not successful.
-	setVsysCMD := "<show><high-availability><state></state></high-availability></show>"
-	dagResp := pan.callHTTP("op", setVsysCMD)
+	//Send show HA API request.
+	haCMD := "<show><high-availability><state></state></high-availability></show>"
+	dagResp, err := pan.callHTTPRetry("op", haCMD)
+	if err != nil {
+		return false, err
+	}
 
 	if strings.ToLower(dagResp.Result.Enabled) == "no" {
-		return true
+		return true, nil
 	}
 	if strings.ToLower(dagResp.Result.LocalInfo.State) == "active" || strings.ToLower(dagResp.Result.LocalInfo.State) == "primary-active" {
-		return true
+		return true, nil
 	}
 	if strings.ToLower(dagResp.Result.Group.LocalInfo.State) == "active" || strings.ToLower(dagResp.Result.Group.LocalInfo.State) == "primary-active" {
-		return true
+		return true, nil
 	}
-	return false
+	return false, nil
 
 }
 
@@ -539,7 +629,6 @@ func isEqual(a1 []string, a2 []string) (bool, []string, []string) {
 
 	var addLabels []string
 	for _, v := range a1 {
-		//if _, ok := add[v]; !ok && v != illumioTag {
 		if _, ok := add[v]; !ok {
 			equal = false
 			remove = append(remove, v)
@@ -557,7 +646,105 @@ func isEqual(a1 []string, a2 []string) (bool, []string, []string) {
 	return equal, remove, addLabels
 }
 
-// dagSync - Compares IPs already registered on PAN with those on the PCE also compare the labels/tags currently configured.  If different labels/tags
+// plan - Compares IPs already registered on a device with those on the PCE and builds the register and unregister entries.
+func (d *deviceSync) plan(workloadsMap map[string]IPTags) {
+	pan := d.pan
+
+	//Check to see if URL is for non-HA or active/active-primary PAN.  Need to only push IPs to active.
+	active, err := pan.checkHA()
+	if err != nil {
+		d.fail(fmt.Sprintf("checking high-availability state - %s", err))
+		return
+	}
+	if !active {
+		d.fail("device is the backup in an HA pair")
+		return
+	}
+
+	//Get PAN registered IPs
+	utils.LogInfo(fmt.Sprintf("Calling PanOS get All Registered-IP - %s", pan.Name), true)
+	if err := pan.LoadRegisteredIPs(); err != nil {
+		d.fail(fmt.Sprintf("getting registered IPs - %s", err))
+		return
+	}
+
+	//Clear RegisterIPs.
+	if clean {
+		for ip, ipTags := range pan.RegIPs {
+			d.unregEntries[ip] = ipTags
+		}
+		return
+	}
+
+	//Cycle through Workload list as long as there are labels/tags continue.  Build arrays of IPs/Tags to Add/Remove.
+	for ip, ipTags := range workloadsMap {
+		if len(ipTags.Labels) == 0 && (!includeUnlabeled || noHref) {
+			continue
+		}
+		//If there isnt an entry for that IP on the PAN add the workload and labels/tags
+		if _, ok := pan.RegIPs[ip]; !ok {
+			d.regEntries[ip] = IPTags{Labels: ipTags.Labels, Found: false, HrefLabel: ipTags.HrefLabel}
+			continue
+		}
+
+		//IP found on both.  Check if both label sets are equal.  If not return the labels to add or remove or both
+		if ok, removeLabels, addLabels := isEqual(pan.RegIPs[ip].Labels, ipTags.Labels); !ok {
+
+			//skip adding these entries if list of labels is empty
+			if len(addLabels) != 0 {
+				d.regEntries[ip] = IPTags{Labels: addLabels, Found: true, HrefLabel: pan.RegIPs[ip].HrefLabel}
+			}
+			if len(removeLabels) != 0 {
+				d.unregEntries[ip] = IPTags{Labels: removeLabels, Found: true, HrefLabel: pan.RegIPs[ip].HrefLabel}
+			}
+			//If labels are equal but we didnt find a workload tag then add it.
+		} else if !pan.RegIPs[ip].Found {
+			d.regEntries[ip] = IPTags{Labels: addLabels, Found: false, HrefLabel: ipTags.HrefLabel}
+		}
+
+	}
+
+	//Find all the register-ips that are on the PAN but not the PCE and if you set option to unregister.  Add to unregister list.
+	countNotFoundStaleIP := 0
+	for ip, ipTags := range pan.RegIPs {
+		if _, ok := workloadsMap[ip]; !ok {
+			if ipTags.Found || noHref {
+				d.staleIPs++
+				if removeOld {
+					d.unregEntries[ip] = IPTags{}
+				}
+			} else {
+				utils.LogInfo(fmt.Sprintf("%s - RegisterIPs %s was not added by workloader.  It will not be removed.", pan.Name, ip), false)
+				countNotFoundStaleIP++
+			}
+		}
+	}
+
+	if d.staleIPs+countNotFoundStaleIP > 0 && !removeOld {
+		utils.LogInfo(fmt.Sprintf("%s - %d RegisteredIPs added by Workloader but stale.  %d RegisteredIPs not added by Workloader.  To remove please set \"-r\" or \"--remove-stale\"", pan.Name, d.staleIPs, countNotFoundStaleIP), true)
+	} else if d.staleIPs+countNotFoundStaleIP > 0 {
+		utils.LogInfo(fmt.Sprintf("%s - Skipping %d RegisteredIPs. %d Stale RegisteredIPs added by Workloader being removed.", pan.Name, countNotFoundStaleIP, d.staleIPs), true)
+	}
+}
+
+// apply - Makes the register and unregister changes on the device.
+func (d *deviceSync) apply() {
+	if len(d.regEntries) != 0 {
+		d.regBatches, d.regFailed = d.pan.Register(d.regEntries)
+	}
+	//make sure there is some unregister updates need
+	if len(d.unregEntries) != 0 {
+		d.unregBatches, d.unregFailed = d.pan.UnRegister(d.unregEntries)
+	}
+	if d.regFailed+d.unregFailed > 0 {
+		d.status = "failed"
+		d.failed = true
+		return
+	}
+	d.status = "updated"
+}
+
+// dagSync - Compares IPs already registered on each PAN with those on the PCE also compare the labels/tags currently configured.  If different labels/tags
 func dagSync() {
 
 	//Check for valid panURL, panKey, and panVsys values from OS environment vars or via CLI
@@ -580,12 +767,14 @@ func dagSync() {
 		utils.LogError("Default PanOS vsys=\"vsys1\".  To override must either use environment variable \"PANOS_VSYS\" or \"--vsys\" or \"-v\" with vsys value.")
 	}
 
-	//default pan struct created.
-	pan := PAN{Key: panKey, URL: panURL, RegIPs: map[string]IPTags{}, FoundCounter: 0}
-
-	//Check to see if URL is for non-HA or active/active-primary PAN.  Need to only push IPs to active.
-	if !pan.checkHA() {
-		utils.LogError(fmt.Sprintf("URL entered is trying to use backup HA device. URL - %s", panURL))
+	if batchSize < 1 {
+		utils.LogError("--batch-size must be at least 1")
+	}
+	if retries < 0 {
+		utils.LogError("--retries cannot be negative")
+	}
+	if !strings.Contains(tagTemplate, "{value}") {
+		utils.LogError("--tag-template must include {value}")
 	}
 
 	// Parse the CSV File if there is one.
@@ -598,27 +787,29 @@ func dagSync() {
 		}
 	}
 
-	//build filter structure and check for empty row.
+	//build filter structure using the header row as label keys and check for empty row.
 	var filter []map[string]string
-	//check that row has entries if not tell end user.
 	for i, row := range fileData {
+		if i == 0 {
+			continue
+		}
 		totLen := 0
-		for _, c := range row {
-			if len(c) != 0 {
-				totLen += len(c)
+		rowFilter := make(map[string]string)
+		for c, header := range fileData[0] {
+			if c < len(row) {
+				rowFilter[strings.TrimSpace(header)] = row[c]
+				totLen += len(row[c])
 			}
 		}
 
 		if totLen == 0 {
-			utils.LogInfo(fmt.Sprintf("Workload filter file : row %d does not have ANY entries..This will cause everything to match", i), true)
+			utils.LogInfo(fmt.Sprintf("Workload filter file : row %d does not have ANY entries..This will cause everything to match", i+1), true)
 		}
-		//Build filter structure to be used when getting PCE workloads.
-		filter = append(filter, map[string]string{"role": row[0], "app": row[1], "env": row[2], "loc": row[3]})
+		filter = append(filter, rowFilter)
 	}
 
-	//Get PAN registered IPs and Workload IPs from PAN/PCE
-	utils.LogInfo(fmt.Sprintf("Calling PanOS get All Registered-IP - %s", panURL), true)
-	pan.LoadRegisteredIPs()
+	//Get the devices to sync.
+	devices := resolveTargets()
 
 	//Get all Workloads from PCE.  Dont do if you are cleanup RegisteredIPs.
 	workloadsMap := make(map[string]IPTags)
@@ -628,127 +819,67 @@ func dagSync() {
 		utils.LogInfo(fmt.Sprintf("%d Workloads IPs on PCE.", len(workloadsMap)), true)
 	}
 
-	//clear RegisterIPs and exit.  Make sure user adds --update-panos. Prompt user to make sure they want to do this..
-	if clean && len(pan.RegIPs) != 0 {
-		if !noPrompt && update {
-			var prompt string
-			fmt.Printf("\r\n%s [PROMPT] - %d Total RegisteredIPs %d Registered changes will be made . Do you want to continue (yes/no)? ", time.Now().Format("2006-01-02 15:04:05 "), pan.FoundCounter, len(pan.RegIPs))
-			fmt.Scanln(&prompt)
-			if strings.ToLower(prompt) != "yes" {
-				utils.LogInfo(fmt.Sprintf("prompt denied flushing %d of total %d RegisteredIP.", pan.FoundCounter, len(pan.RegIPs)), true)
-
-				return
-			}
+	//Build the changes for each device.
+	totalReg, totalUnreg, changedDevices := 0, 0, 0
+	for _, d := range devices {
+		if d.failed || d.skipped {
+			continue
 		}
-		if !update {
-			utils.LogInfo(fmt.Sprintf("%d Register changes will NOT be made - must enter \"--update-panos\" to make changes to PAN!!!", len(pan.RegIPs)), true)
-
-			return
-		} else {
-			utils.LogInfo(fmt.Sprintf("Flushing %d Register-IPs", len(pan.RegIPs)), true)
-			pan.UnRegister(pan.RegIPs)
-
-			return
+		d.pceIPs = len(workloadsMap)
+		d.plan(workloadsMap)
+		if d.failed {
+			continue
+		}
+		totalReg += len(d.regEntries)
+		totalUnreg += len(d.unregEntries)
+		if len(d.regEntries)+len(d.unregEntries) == 0 {
+			d.status = "no changes"
+			continue
 		}
+		changedDevices++
+		d.status = "changes not applied - use --update-panos"
 	}
 
-	//If there are no entries from PAN to match against just add all the workloads.
-	if len(pan.RegIPs) == 0 && len(workloadsMap) != 0 {
-		if !noPrompt && update {
+	switch {
+	case changedDevices == 0:
+		utils.LogInfo("No Change. No Add/Update/Removals needed on PanOS.", true)
+	case !update:
+		utils.LogInfo(fmt.Sprintf("%d Register and %d Unregister changes on %d device(s) will NOT be made - must enter \"--update-panos\" to make changes to PanOS!!!", totalReg, totalUnreg, changedDevices), true)
+	default:
+		// If update is set, but not noPrompt, we will prompt the user.
+		proceed := true
+		if !noPrompt {
 			var prompt string
-			fmt.Printf("\r\n%s [PROMPT] - %d Registers changes will be made. Do you want to make these changes (yes/no)? ", time.Now().Format("2006-01-02 15:04:05 "), len(workloadsMap))
+			fmt.Printf("\r\n%s [PROMPT] - %d Register and %d Unregister changes will be made on %d device(s). Do you want to make these changes (yes/no)? ", time.Now().Format("2006-01-02 15:04:05 "), totalReg, totalUnreg, changedDevices)
 			fmt.Scanln(&prompt)
 			if strings.ToLower(prompt) != "yes" {
-				utils.LogInfo(fmt.Sprintf("prompt denied to registered %d IPs/Tags.", len(workloadsMap)), true)
-
-				return
-			}
-		}
-		if !update {
-			utils.LogInfo(fmt.Sprintf("%d Register changes will NOT be made - must enter \"--update-panos\" to make changes to PanOS!!!", len(workloadsMap)), true)
-
-			return
-		} else {
-			pan.Register(workloadsMap)
-
-			return
-		}
-	}
-
-	//Cycle through Workload list as long as there are labels/tags continue.  Build arrays of IPs/Tags to Add/Remove.
-	regEntries := make(map[string]IPTags)
-	unregEntries := make(map[string]IPTags)
-	for ip, ipTags := range workloadsMap {
-		if len(ipTags.Labels) == 0 {
-			continue
-		}
-		//If there isnt an entry for that IP on the PAN add the workload and labels/tags
-		if _, ok := pan.RegIPs[ip]; !ok {
-			regEntries[ip] = IPTags{Labels: ipTags.Labels, Found: false, HrefLabel: ipTags.HrefLabel}
-			continue
-		}
-
-		//IP found on both.  Check if both label sets are equal.  If not return the labels to add or remove or both
-		if ok, removeLabels, addLabels := isEqual(pan.RegIPs[ip].Labels, ipTags.Labels); !ok {
-
-			//skip adding these entries if list of labels is empty
-			if len(addLabels) != 0 {
-				regEntries[ip] = IPTags{Labels: addLabels, Found: true, HrefLabel: pan.RegIPs[ip].HrefLabel}
-			}
-			if len(removeLabels) != 0 {
-				unregEntries[ip] = IPTags{Labels: removeLabels, Found: true, HrefLabel: pan.RegIPs[ip].HrefLabel}
+				utils.LogInfo(fmt.Sprintf("prompt denied to registered %d and unregistered %d IPs/Tags.", totalReg, totalUnreg), true)
+				proceed = false
+				for _, d := range devices {
+					if !d.failed && !d.skipped && len(d.regEntries)+len(d.unregEntries) > 0 {
+						d.status = "changes not applied - prompt denied"
+					}
+				}
 			}
-			//If labels are equal but we didnt find a workload tag then add it.
-		} else if !pan.RegIPs[ip].Found {
-			regEntries[ip] = IPTags{Labels: addLabels, Found: false, HrefLabel: ipTags.HrefLabel}
 		}
-
-	}
-
-	//Find all the register-ips that are on the PAN but not the PCE and if you set option to unregister.  Add to unregister list.
-	countStaleIPs := 0
-	countNotFoundStaleIP := 0
-	for ip, ipTags := range pan.RegIPs {
-		if _, ok := workloadsMap[ip]; !ok {
-			if removeOld && (ipTags.Found || noHref) {
-				unregEntries[ip] = IPTags{}
-				countStaleIPs++
-			} else {
-				utils.LogInfo(fmt.Sprintf("RegisterIPs %s was not added by workloader.  It will not be removed.", ip), false)
-				countNotFoundStaleIP++
+		if proceed {
+			for _, d := range devices {
+				if !d.failed && !d.skipped && len(d.regEntries)+len(d.unregEntries) > 0 {
+					d.apply()
+				}
 			}
 		}
 	}
 
-	if countStaleIPs+countNotFoundStaleIP > 0 && !removeOld {
-		utils.LogInfo(fmt.Sprintf("%d RegisteredIPs added by Workloader but stale.  %d RegisteredIPs not added by Workloader.  To remove please set \"-r\" or \"--remove-stale\"", countStaleIPs, countNotFoundStaleIP), true)
-	} else if countStaleIPs+countNotFoundStaleIP > 0 {
-		utils.LogInfo(fmt.Sprintf("Skipping %d RegisteredIPs. %d Stale RegisteredIPs added by Workloader being removed.", countNotFoundStaleIP, countStaleIPs), true)
-	}
-
-	if len(regEntries) == 0 && len(unregEntries) == 0 {
-		utils.LogInfo("No Change. No Add/Update/Removals needed on PanOS.", true)
+	writeReport(devices)
 
-		return
-	}
-
-	// If updatePCE is set, but not noPrompt, we will prompt the user.
-	if update && !noPrompt {
-		var prompt string
-		fmt.Printf("\r\n%s [PROMPT] - %d Register and %d Unregister changes will be made. Do you want to make these changes (yes/no)? ", time.Now().Format("2006-01-02 15:04:05 "), len(regEntries), len(unregEntries))
-		fmt.Scanln(&prompt)
-		if strings.ToLower(prompt) != "yes" {
-			utils.LogInfo(fmt.Sprintf("prompt denied to registered %d and unregistered %d IPs/Tags.", len(regEntries), len(unregEntries)), true)
-
-			return
+	failedDevices := 0
+	for _, d := range devices {
+		if d.failed {
+			failedDevices++
 		}
 	}
-	if len(regEntries) != 0 {
-		pan.Register(regEntries)
+	if failedDevices > 0 {
+		utils.LogErrorf("%d of %d device(s) failed. see the reconciliation report and workloader.log for details.", failedDevices, len(devices))
 	}
-	//make sure there is some unregister updates need
-	if len(unregEntries) != 0 {
-		pan.UnRegister(unregEntries)
-	}
-
 }
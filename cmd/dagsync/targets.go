@@ -0,0 +1,201 @@
+package dagsync
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brian1917/workloader/utils"
+)
+
+// DeviceGroups - Declare device group container of Panorama show devicegroups API call
+type DeviceGroups struct {
+	Entry []DeviceGroup `xml:"entry,omitempty"`
+}
+
+// DeviceGroup - Declare device group entry of Panorama show devicegroups API call
+type DeviceGroup struct {
+	Name    string  `xml:"name,attr"`
+	Devices Devices `xml:"devices,omitempty"`
+}
+
+// Devices - Declare devices container of a Panorama device group
+type Devices struct {
+	Entry []Device `xml:"entry,omitempty"`
+}
+
+// Device - Declare managed firewall in a Panorama device group
+type Device struct {
+	Name      string     `xml:"name,attr"`
+	Serial    string     `xml:"serial,omitempty"`
+	Hostname  string     `xml:"hostname,omitempty"`
+	Connected string     `xml:"connected,omitempty"`
+	Vsys      DeviceVsys `xml:"vsys,omitempty"`
+}
+
+// DeviceVsys - Declare vsys container of a managed firewall in a device group
+type DeviceVsys struct {
+	Entry []VsysEntry `xml:"entry,omitempty"`
+}
+
+// VsysEntry - Declare vsys of a managed firewall in a device group
+type VsysEntry struct {
+	Name string `xml:"name,attr"`
+}
+
+// deviceSync - the reconciliation of a single device used for the report
+type deviceSync struct {
+	pan          *PAN
+	deviceGroup  string
+	regEntries   map[string]IPTags
+	unregEntries map[string]IPTags
+	pceIPs       int
+	staleIPs     int
+	regBatches   int
+	regFailed    int
+	unregBatches int
+	unregFailed  int
+	skipped      bool
+	failed       bool
+	status       string
+}
+
+func newDeviceSync(pan *PAN, deviceGroup string) *deviceSync {
+	return &deviceSync{pan: pan, deviceGroup: deviceGroup, regEntries: make(map[string]IPTags), unregEntries: make(map[string]IPTags)}
+}
+
+// fail - marks the device as failed and logs the reason. Other devices continue.
+func (d *deviceSync) fail(reason string) {
+	d.failed = true
+	d.status = "failed - " + reason
+	utils.LogWarningf(true, "%s - %s", d.pan.Name, reason)
+}
+
+// xmlText - escapes a value used in an XML API command
+func xmlText(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// resolveTargets - Builds the devices to sync from the comma-separated URLs or the Panorama device groups.
+func resolveTargets() []*deviceSync {
+	devices := []*deviceSync{}
+
+	urls := []string{}
+	for _, u := range strings.Split(panURL, ",") {
+		if strings.TrimSpace(u) != "" {
+			urls = append(urls, strings.TrimSuffix(strings.TrimSpace(u), "/"))
+		}
+	}
+
+	// Each URL is a firewall
+	if deviceGroups == "" {
+		for _, u := range urls {
+			devices = append(devices, newDeviceSync(&PAN{Key: panKey, URL: u, Vsys: panVsys, Name: u, RegIPs: map[string]IPTags{}}, ""))
+		}
+		return devices
+	}
+
+	// The URL is Panorama. Get the connected firewalls in each device group.
+	if len(urls) != 1 {
+		utils.LogError("--device-group requires a single Panorama --url")
+	}
+	panorama := PAN{Key: panKey, URL: urls[0], Vsys: panVsys, Name: urls[0]}
+	targeted := make(map[string]bool)
+	for _, dg := range strings.Split(deviceGroups, ",") {
+		dg = strings.TrimSpace(dg)
+		if dg == "" {
+			continue
+		}
+		dagResp, err := panorama.callHTTPRetry("op", fmt.Sprintf("<show><devicegroups><name>%s</name></devicegroups></show>", xmlText(dg)))
+		if err != nil {
+			utils.LogError(fmt.Sprintf("getting device group %s from Panorama - %s", dg, err))
+		}
+
+		found := false
+		for _, g := range dagResp.Result.DeviceGroups.Entry {
+			if g.Name != dg {
+				continue
+			}
+			found = true
+			for _, device := range g.Devices.Entry {
+				serial := device.Serial
+				if serial == "" {
+					serial = device.Name
+				}
+				name := device.Hostname
+				if name == "" {
+					name = serial
+				}
+
+				// Multi-vsys firewalls are synced for each vsys in the device group
+				vsysList := []string{}
+				for _, v := range device.Vsys.Entry {
+					vsysList = append(vsysList, v.Name)
+				}
+				if len(vsysList) == 0 {
+					vsysList = append(vsysList, panVsys)
+				}
+
+				for _, vsys := range vsysList {
+					if targeted[serial+"/"+vsys] {
+						utils.LogInfo(fmt.Sprintf("%s %s is in more than one device group. skipping duplicate in %s.", name, vsys, dg), false)
+						continue
+					}
+					targeted[serial+"/"+vsys] = true
+					d := newDeviceSync(&PAN{Key: panKey, URL: urls[0], Vsys: vsys, Target: serial, Name: fmt.Sprintf("%s (%s)", name, vsys), RegIPs: map[string]IPTags{}}, dg)
+					if strings.ToLower(device.Connected) != "yes" {
+						d.skipped = true
+						d.status = "skipped - not connected to Panorama"
+						utils.LogWarningf(true, "%s - not connected to Panorama. skipping.", d.pan.Name)
+					}
+					devices = append(devices, d)
+				}
+			}
+		}
+		if !found {
+			utils.LogWarningf(true, "device group %s not found on Panorama", dg)
+		}
+	}
+
+	if len(devices) == 0 {
+		utils.LogError(fmt.Sprintf("no devices found in device groups %s", deviceGroups))
+	}
+	utils.LogInfo(fmt.Sprintf("%d device(s) found in device groups %s", len(devices), deviceGroups), true)
+
+	return devices
+}
+
+// writeReport - Writes the per-device reconciliation report
+func writeReport(devices []*deviceSync) {
+	data := [][]string{{"device", "device_group", "url", "serial", "vsys", "registered_ips", "workloader_registered_ips", "pce_ips", "register_changes", "unregister_changes", "stale_ips", "register_batches", "register_failed_batches", "unregister_batches", "unregister_failed_batches", "status"}}
+	for _, d := range devices {
+		data = append(data, []string{
+			d.pan.Name,
+			d.deviceGroup,
+			d.pan.URL,
+			d.pan.Target,
+			d.pan.Vsys,
+			strconv.Itoa(len(d.pan.RegIPs)),
+			strconv.Itoa(d.pan.FoundCounter),
+			strconv.Itoa(d.pceIPs),
+			strconv.Itoa(len(d.regEntries)),
+			strconv.Itoa(len(d.unregEntries)),
+			strconv.Itoa(d.staleIPs),
+			strconv.Itoa(d.regBatches),
+			strconv.Itoa(d.regFailed),
+			strconv.Itoa(d.unregBatches),
+			strconv.Itoa(d.unregFailed),
+			d.status,
+		})
+	}
+
+	if outputFileName == "" {
+		outputFileName = fmt.Sprintf("workloader-dag-sync-%s.csv", time.Now().Format("20060102_150405"))
+	}
+	utils.WriteOutput(data, data, outputFileName)
+}
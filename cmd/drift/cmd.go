@@ -0,0 +1,219 @@
+package drift
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/brian1917/workloader/cmd/iplexport"
+	"github.com/brian1917/workloader/cmd/labelgroupexport"
+	"github.com/brian1917/workloader/cmd/ruleexport"
+	"github.com/brian1917/workloader/cmd/rulesetexport"
+	"github.com/brian1917/workloader/cmd/svcexport"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var objects, matchBy, outputFileName string
+
+func init() {
+	DriftCmd.Flags().StringVar(&objects, "objects", "label_groups,services,ip_lists,rulesets,rules", "comma-separated list of object types to compare. options are label_groups, services, ip_lists, rulesets, and rules.")
+	DriftCmd.Flags().StringVar(&matchBy, "match-by", "name", "how objects are matched between sources. options are name or external_data_reference. objects without an external data reference fall back to name.")
+	DriftCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the output file location. default is current location with a timestamped filename.")
+
+	DriftCmd.Flags().SortFlags = false
+}
+
+// DriftCmd runs the drift command
+var DriftCmd = &cobra.Command{
+	Use:   "drift [source pce or directory] [target pce or directory]",
+	Short: "Compare policy objects between two PCEs or a PCE and a directory of export CSVs.",
+	Long: `
+Compare policy objects between two PCEs or a PCE and a directory of export CSVs.
+
+Each source is either a PCE name (see workloader pce-list) or a directory containing the output of labelgroup-export, svc-export, ipl-export, ruleset-export, and rule-export. The CSVs are identified by their headers so the file names do not matter. If a directory has multiple exports for the same object type, the most recently modified file is used.
+
+Label groups, services, IP lists, and rulesets are matched by name. Rules do not have a name and are matched by ruleset name, sources, destinations, and services, so a rule with a changed source appears as one removed and one added rule. Use --match-by external_data_reference to match every object type by its external data reference instead so renamed objects are reported as modified. Objects without an external data reference are matched by name. Exports from older workloader versions without external data reference columns are matched by name.
+
+The output CSV lists every added, removed, and modified field. The exit code is 2 when drift is found so the command can gate pipelines.
+
+The update-pce and --no-prompt flags are ignored for this command.`,
+	Example: `# Compare a primary and DR pce
+workloader drift primary-pce dr-pce
+
+# Compare a pce to exports committed to git
+workloader drift prod-pce ./policy-exports`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		if len(args) != 2 {
+			fmt.Println("command requires 2 arguments for the source and target. see usage help.")
+			os.Exit(0)
+		}
+
+		// Disable stdout for the exports
+		viper.Set("output_format", "csv")
+		if err := viper.WriteConfig(); err != nil {
+			utils.LogError(err.Error())
+		}
+
+		matchBy = strings.ToLower(matchBy)
+		if matchBy != "name" && matchBy != "external_data_reference" {
+			utils.LogError("match-by must be name or external_data_reference")
+		}
+
+		drift(args[0], args[1])
+	},
+}
+
+// loadSource gets a snapshot from a directory or a pce name
+func loadSource(source string, targetTypes map[string]bool, matchByExtRef bool) snapshot {
+
+	// Directories are read directly
+	if info, err := os.Stat(source); err == nil && info.IsDir() {
+		utils.LogInfof(true, "reading export csvs from %s", source)
+		return loadDirectory(source, targetTypes, matchByExtRef)
+	}
+
+	// Otherwise it must be a pce
+	if !viper.IsSet(source + ".fqdn") {
+		utils.LogErrorf("%s is not a directory or a pce name", source)
+	}
+
+	// Export the pce objects to a temporary directory
+	tempDir, err := os.MkdirTemp("", "workloader-drift-")
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	defer os.RemoveAll(tempDir)
+
+	utils.LogInfof(true, "exporting objects from %s", source)
+	pce, err := utils.GetPCEbyNameV2(source, true)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	if targetTypes["label_groups"] {
+		pceV1, err := utils.GetPCEbyName(source, true)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		labelgroupexport.ExportLabelGroups(pceV1, false, true, filepath.Join(tempDir, "label-groups.csv"))
+	}
+	if targetTypes["services"] {
+		svcexport.ExportServices(pce, true, filepath.Join(tempDir, "services.csv"), []string{})
+	}
+	if targetTypes["ip_lists"] {
+		iplexport.ExportIPL(pce, "", filepath.Join(tempDir, "iplists.csv"))
+	}
+	if targetTypes["rulesets"] {
+		rulesetexport.ExportRuleSets(pce, filepath.Join(tempDir, "rulesets.csv"), true, []string{})
+	}
+	if targetTypes["rules"] {
+		re := ruleexport.RuleExport{PCE: &pce, PolicyVersion: "draft", NoHref: true, SkipWkldDetailCheck: true, OutputFileName: filepath.Join(tempDir, "rules.csv")}
+		re.ExportToCsv()
+	}
+
+	return loadDirectory(tempDir, targetTypes, matchByExtRef)
+}
+
+func drift(source, target string) {
+
+	// Validate the object types
+	targetTypes := make(map[string]bool)
+	validTypes := make(map[string]bool)
+	for _, ot := range objectTypes {
+		validTypes[ot.name] = true
+	}
+	for _, o := range strings.Split(strings.Replace(objects, " ", "", -1), ",") {
+		if !validTypes[o] {
+			utils.LogErrorf("%s is not a valid object type", o)
+		}
+		targetTypes[o] = true
+	}
+
+	matchByExtRef := matchBy == "external_data_reference"
+	sourceSnap := loadSource(source, targetTypes, matchByExtRef)
+	targetSnap := loadSource(target, targetTypes, matchByExtRef)
+
+	// Compare each object type
+	csvData := [][]string{{"object_type", "key", "change", "field", fmt.Sprintf("source_value (%s)", source), fmt.Sprintf("target_value (%s)", target)}}
+	for _, ot := range objectTypes {
+		if !targetTypes[ot.name] {
+			continue
+		}
+		sourceObjects, sourceOk := sourceSnap[ot.name]
+		targetObjects, targetOk := targetSnap[ot.name]
+		if !sourceOk || !targetOk {
+			utils.LogWarningf(true, "%s - not present in both sources. skipping comparison.", ot.name)
+			continue
+		}
+
+		var added, removed, modified int
+
+		// Sort keys for consistent output
+		keys := []string{}
+		for k := range sourceObjects {
+			keys = append(keys, k)
+		}
+		for k := range targetObjects {
+			if _, ok := sourceObjects[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			s, inSource := sourceObjects[k]
+			t, inTarget := targetObjects[k]
+			if inSource && !inTarget {
+				csvData = append(csvData, []string{ot.name, k, "removed", "", "", ""})
+				removed++
+				continue
+			}
+			if !inSource && inTarget {
+				csvData = append(csvData, []string{ot.name, k, "added", "", "", ""})
+				added++
+				continue
+			}
+
+			// Compare fields present in either object
+			fields := []string{}
+			for f := range s {
+				fields = append(fields, f)
+			}
+			for f := range t {
+				if _, ok := s[f]; !ok {
+					fields = append(fields, f)
+				}
+			}
+			sort.Strings(fields)
+			changed := false
+			for _, f := range fields {
+				if s[f] != t[f] {
+					csvData = append(csvData, []string{ot.name, k, "modified", f, s[f], t[f]})
+					changed = true
+				}
+			}
+			if changed {
+				modified++
+			}
+		}
+		utils.LogInfof(true, "%s - %d added, %d removed, %d modified", ot.name, added, removed, modified)
+	}
+
+	if len(csvData) == 1 {
+		utils.LogInfo("no drift found.", true)
+		return
+	}
+
+	if outputFileName == "" {
+		outputFileName = fmt.Sprintf("workloader-drift-%s.csv", time.Now().Format("20060102_150405"))
+	}
+	utils.WriteOutput(csvData, csvData, outputFileName)
+	utils.LogInfof(true, "%d drift entries found. exit code set to 2.", len(csvData)-1)
+	utils.LogEndCommand("drift")
+	os.Exit(2)
+}
@@ -0,0 +1,229 @@
+package drift
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/brian1917/workloader/cmd/iplimport"
+	"github.com/brian1917/workloader/cmd/labelgroupexport"
+	"github.com/brian1917/workloader/cmd/ruleexport"
+	"github.com/brian1917/workloader/cmd/svcexport"
+	"github.com/brian1917/workloader/utils"
+)
+
+// objectType describes how an export CSV is identified and compared
+type objectType struct {
+	name        string
+	detect      []string        // headers that must exist to identify the csv
+	nameHeaders []string        // headers that build the name key
+	extRef      string          // header used to match by external data reference
+	listFields  map[string]bool // fields whose entries are unordered
+	ignore      map[string]bool // fields never compared
+	multiRow    bool            // objects span multiple rows (services)
+}
+
+var objectTypes = []objectType{
+	{
+		name:        "label_groups",
+		detect:      []string{labelgroupexport.HeaderName, labelgroupexport.HeaderKey, labelgroupexport.HeaderMemberLabels},
+		nameHeaders: []string{labelgroupexport.HeaderKey, labelgroupexport.HeaderName},
+		extRef:      labelgroupexport.HeaderExternalDataRef,
+		listFields:  map[string]bool{labelgroupexport.HeaderMemberLabels: true, labelgroupexport.HeaderMemberLabelGroups: true},
+		ignore:      map[string]bool{labelgroupexport.HeaderHref: true, labelgroupexport.HeaderFullyExpandedMembers: true},
+	},
+	{
+		name:        "services",
+		detect:      []string{svcexport.HeaderName, svcexport.HeaderWinService, svcexport.HeaderPort, svcexport.HeaderProto},
+		nameHeaders: []string{svcexport.HeaderName},
+		extRef:      svcexport.HeaderExternalDataReference,
+		ignore:      map[string]bool{svcexport.HeaderHref: true},
+		multiRow:    true,
+	},
+	{
+		name:        "ip_lists",
+		detect:      []string{iplimport.HeaderName, iplimport.HeaderInclude, iplimport.HeaderExclude},
+		nameHeaders: []string{iplimport.HeaderName},
+		extRef:      iplimport.HeaderExternalDataRef,
+		listFields:  map[string]bool{iplimport.HeaderInclude: true, iplimport.HeaderExclude: true, iplimport.HeaderFqdns: true},
+		ignore:      map[string]bool{iplimport.HeaderHref: true},
+	},
+	{
+		name:        "rulesets",
+		detect:      []string{"ruleset_name", "scope", "contains_custom_iptables_rules"},
+		nameHeaders: []string{"ruleset_name"},
+		extRef:      "external_data_reference",
+		listFields:  map[string]bool{"scope": true},
+		ignore:      map[string]bool{"href": true},
+	},
+	{
+		name:        "rules",
+		detect:      []string{ruleexport.HeaderRulesetName, ruleexport.HeaderRuleEnabled, ruleexport.HeaderServices},
+		nameHeaders: []string{ruleexport.HeaderRulesetName, ruleexport.HeaderSrcAllWorkloads, ruleexport.HeaderSrcLabels, ruleexport.HeaderSrcLabelGroup, ruleexport.HeaderSrcIplists, ruleexport.HeaderDstAllWorkloads, ruleexport.HeaderDstLabels, ruleexport.HeaderDstLabelGroups, ruleexport.HeaderDstIplists, ruleexport.HeaderServices},
+		extRef:      ruleexport.HeaderExternalDataReference,
+		listFields: map[string]bool{
+			ruleexport.HeaderRuleSetScope: true, ruleexport.HeaderSrcLabels: true, ruleexport.HeaderSrcLabelsExclusions: true, ruleexport.HeaderSrcLabelGroup: true,
+			ruleexport.HeaderSrcLabelGroupExclusions: true, ruleexport.HeaderSrcIplists: true, ruleexport.HeaderSrcUserGroups: true, ruleexport.HeaderSrcWorkloads: true,
+			ruleexport.HeaderSrcVirtualServices: true, ruleexport.HeaderDstLabels: true, ruleexport.HeaderDstLabelsExclusions: true, ruleexport.HeaderDstLabelGroups: true,
+			ruleexport.HeaderDstLabelGroupsExclusions: true, ruleexport.HeaderDstIplists: true, ruleexport.HeaderDstWorkloads: true, ruleexport.HeaderDstVirtualServices: true,
+			ruleexport.HeaderDstVirtualServers: true, ruleexport.HeaderServices: true,
+		},
+		ignore: map[string]bool{ruleexport.HeaderRulesetHref: true, ruleexport.HeaderRuleHref: true, ruleexport.HeaderUpdateType: true, ruleexport.HeaderPolicyVersionNumber: true},
+	},
+}
+
+// snapshot holds the objects of a source: object type -> match key -> field -> value
+type snapshot map[string]map[string]map[string]string
+
+// normalizeList sorts entries separated by semi-colons (and pipes for scopes) so ordering does not register as drift
+func normalizeList(value string) string {
+	groups := []string{}
+	for _, g := range strings.Split(value, "|") {
+		entries := []string{}
+		for _, e := range strings.Split(g, ";") {
+			if strings.TrimSpace(e) != "" {
+				entries = append(entries, strings.TrimSpace(e))
+			}
+		}
+		sort.Strings(entries)
+		groups = append(groups, strings.Join(entries, ";"))
+	}
+	sort.Strings(groups)
+	return strings.Join(groups, "|")
+}
+
+// detectType returns the object type for a csv header row
+func detectType(headers []string) (objectType, bool) {
+	headerMap := make(map[string]bool)
+	for _, h := range headers {
+		headerMap[h] = true
+	}
+	// Check rules before rulesets since rule exports include a ruleset_name column
+	for i := len(objectTypes) - 1; i >= 0; i-- {
+		match := true
+		for _, d := range objectTypes[i].detect {
+			if !headerMap[d] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return objectTypes[i], true
+		}
+	}
+	return objectType{}, false
+}
+
+// parseObjects converts export csv data into keyed objects
+func parseObjects(ot objectType, csvData [][]string, matchByExtRef bool) map[string]map[string]string {
+	objects := make(map[string]map[string]string)
+	if len(csvData) == 0 {
+		return objects
+	}
+	headers := csvData[0]
+
+	for rowIndex, row := range csvData {
+		if rowIndex == 0 {
+			continue
+		}
+		values := make(map[string]string)
+		for i, h := range headers {
+			if ot.ignore[h] || i >= len(row) {
+				continue
+			}
+			values[h] = row[i]
+			if ot.listFields[h] {
+				values[h] = normalizeList(row[i])
+			}
+		}
+
+		// Build the key
+		keyParts := []string{}
+		for _, h := range ot.nameHeaders {
+			keyParts = append(keyParts, values[h])
+		}
+		key := strings.Join(keyParts, " | ")
+		if matchByExtRef && ot.extRef != "" && values[ot.extRef] != "" {
+			key = values[ot.extRef]
+			if ot.name == "rules" {
+				key = values[ruleexport.HeaderRulesetName] + " | " + values[ot.extRef]
+			}
+		}
+
+		// Services have one row per port so combine them into a single object
+		if ot.multiRow {
+			entry := strings.Join([]string{values[svcexport.HeaderPort], values[svcexport.HeaderProto], values[svcexport.HeaderProcess], values[svcexport.HeaderService], values[svcexport.HeaderICMPCode], values[svcexport.HeaderICMPType]}, " ")
+			if existing, ok := objects[key]; ok {
+				existing["service_ports"] = normalizeList(existing["service_ports"] + ";" + entry)
+				continue
+			}
+			for _, h := range []string{svcexport.HeaderPort, svcexport.HeaderProto, svcexport.HeaderProcess, svcexport.HeaderService, svcexport.HeaderICMPCode, svcexport.HeaderICMPType} {
+				delete(values, h)
+			}
+			values["service_ports"] = entry
+		}
+
+		if _, exists := objects[key]; exists && !ot.multiRow {
+			utils.LogWarningf(false, "%s - duplicate key %s on csv row %d. last entry is used.", ot.name, key, rowIndex+1)
+		}
+		objects[key] = values
+	}
+
+	return objects
+}
+
+// loadDirectory reads export CSVs in a directory. The most recently modified file is used when a type has multiple files.
+func loadDirectory(dir string, targetTypes map[string]bool, matchByExtRef bool) snapshot {
+	snap := make(snapshot)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
+	// Find the file for each type
+	typeFiles := make(map[string]string)
+	typeModTimes := make(map[string]int64)
+	typeDefs := make(map[string]objectType)
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(strings.ToLower(e.Name()), ".csv") {
+			continue
+		}
+		fullPath := filepath.Join(dir, e.Name())
+		csvData, err := utils.ParseCSV(fullPath)
+		if err != nil || len(csvData) == 0 {
+			utils.LogWarningf(false, "skipping %s - not a parsable csv", fullPath)
+			continue
+		}
+		ot, ok := detectType(csvData[0])
+		if !ok || !targetTypes[ot.name] {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		if existing, ok := typeFiles[ot.name]; ok {
+			if info.ModTime().UnixNano() < typeModTimes[ot.name] {
+				utils.LogWarningf(true, "%s has multiple %s exports. using %s over %s.", dir, ot.name, existing, fullPath)
+				continue
+			}
+			utils.LogWarningf(true, "%s has multiple %s exports. using %s over %s.", dir, ot.name, fullPath, existing)
+		}
+		typeFiles[ot.name] = fullPath
+		typeModTimes[ot.name] = info.ModTime().UnixNano()
+		typeDefs[ot.name] = ot
+	}
+
+	for name, file := range typeFiles {
+		csvData, err := utils.ParseCSV(file)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		utils.LogInfof(false, "%s - using %s for %s", dir, file, name)
+		snap[name] = parseObjects(typeDefs[name], csvData, matchByExtRef)
+	}
+
+	return snap
+}
@@ -0,0 +1,187 @@
+package edlserve
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+)
+
+var address, token, certFile, keyFile string
+var refreshMinutes int
+var selfSigned, ipv6 bool
+
+func init() {
+	EDLServeCmd.Flags().StringVar(&address, "address", "127.0.0.1:9193", "address for the feed endpoint.")
+	EDLServeCmd.Flags().IntVar(&refreshMinutes, "refresh", 5, "minutes between refreshing feeds from the pce.")
+	EDLServeCmd.Flags().StringVar(&token, "token", "", "optional token required to get feeds. the WORKLOADER_EDL_TOKEN environment variable can be used instead.")
+	EDLServeCmd.Flags().StringVar(&certFile, "cert", "", "certificate file to serve feeds over https. requires --cert-key.")
+	EDLServeCmd.Flags().StringVar(&keyFile, "cert-key", "", "private key file for --cert.")
+	EDLServeCmd.Flags().BoolVar(&selfSigned, "self-signed", false, "serve feeds over https with a generated self-signed certificate.")
+	EDLServeCmd.Flags().BoolVar(&ipv6, "ipv6", false, "include ipv6 addresses in feeds.")
+
+	EDLServeCmd.Flags().SortFlags = false
+}
+
+// EDLServeCmd runs the edl-serve command
+var EDLServeCmd = &cobra.Command{
+	Use:   "edl-serve",
+	Short: "Serve IP feeds built from PCE labels and IP lists for firewalls that poll external dynamic lists.",
+	Long: `
+Serve IP feeds built from PCE labels and IP lists for firewalls that poll external dynamic lists.
+
+Firewalls that cannot accept dag-sync pushes can poll a plain-text list of IPs (e.g., Palo Alto external dynamic lists, Fortinet threat feeds, and Check Point generic data center objects). Each feed is at /edl/<expression> and returns one entry per line.
+
+The expression is a comma-separated list of key=value terms:
+- Label terms (e.g., app=erp) match workload labels. Values for the same key are or'd and different keys are and'd. /edl/app=erp,env=prod,env=dr is workloads with the erp app label and either the prod or dr env label.
+- iplist=<name> adds the entries of an active IP list. IP list exclusions cannot be expressed in a feed so they are subtracted from the entries. For example, 10.0.0.0/24 with an exclusion of 10.0.0.128/25 is served as 10.0.0.0/25.
+Values with commas or other special characters must be url encoded.
+
+Workload feeds include the IP of every interface on managed and unmanaged workloads. Link local addresses (169.254.0.0/16 or FE80::/10) are always excluded. IPv6 addresses are excluded unless --ipv6 is used.
+
+Feeds are built from a cache of the PCE that is refreshed every --refresh minutes. A failed refresh keeps serving the previous data. The time of the last successful refresh is in the Last-Modified header.
+
+If a token is set with --token or the WORKLOADER_EDL_TOKEN environment variable, every request must include it as a bearer token, as the password in basic authentication (any username), or in a token query parameter.
+
+The update-pce and --no-prompt flags are ignored for this command.`,
+	Example: `# Serve feeds over https with a self-signed certificate and a token
+workloader edl-serve --address 0.0.0.0:9193 --self-signed --token <token>
+
+# Feed URLs
+https://workloader.example.com:9193/edl/app=erp,env=prod
+https://workloader.example.com:9193/edl/role=db,iplist=partner-networks`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		if refreshMinutes < 1 {
+			utils.LogError("refresh must be at least 1 minute")
+		}
+		if (certFile == "") != (keyFile == "") {
+			utils.LogError("--cert and --cert-key must be used together")
+		}
+		if certFile != "" && selfSigned {
+			utils.LogError("--self-signed cannot be used with --cert")
+		}
+		if token == "" {
+			token = os.Getenv("WORKLOADER_EDL_TOKEN")
+		}
+
+		serve()
+	},
+}
+
+type server struct {
+	mu       sync.Mutex
+	snapshot *snapshot
+}
+
+// refresh loads a new snapshot from the pce. A failed refresh keeps the previous snapshot.
+func (s *server) refresh() {
+	start := time.Now()
+	snap, err := loadSnapshot()
+	if err != nil {
+		utils.LogWarningf(true, "feed refresh failed - %s", err)
+		return
+	}
+	s.mu.Lock()
+	s.snapshot = snap
+	s.mu.Unlock()
+	utils.LogInfof(false, "feeds refreshed in %s - %d workloads with ips and %d ip lists", time.Since(start).Round(time.Millisecond), len(snap.wklds), len(snap.ipLists))
+}
+
+// authorized checks the token as a bearer token, basic auth password, or query parameter
+func authorized(r *http.Request) bool {
+	if token == "" {
+		return true
+	}
+	provided := r.URL.Query().Get("token")
+	if _, password, ok := r.BasicAuth(); ok {
+		provided = password
+	}
+	if bearer := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); bearer != r.Header.Get("Authorization") {
+		provided = bearer
+	}
+	return subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1
+}
+
+func (s *server) handleFeed(w http.ResponseWriter, r *http.Request) {
+	if !authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="workloader edl"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	exp, key, err := parseExpression(strings.TrimPrefix(r.URL.EscapedPath(), "/edl/"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	snap := s.snapshot
+	if snap == nil {
+		s.mu.Unlock()
+		http.Error(w, "feeds are not loaded from the pce yet", http.StatusServiceUnavailable)
+		return
+	}
+	feed, cached := snap.feeds[key]
+	if !cached {
+		feed, err = snap.feed(exp)
+		if err == nil {
+			snap.feeds[key] = feed
+		}
+	}
+	s.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	utils.LogInfof(false, "feed %s requested by %s - %d entries", key, r.RemoteAddr, strings.Count(feed, "\n"))
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Last-Modified", snap.refreshed.UTC().Format(http.TimeFormat))
+	fmt.Fprint(w, feed)
+}
+
+func serve() {
+	s := &server{}
+
+	// Refresh on the interval in the background
+	s.refresh()
+	go func() {
+		for range time.Tick(time.Duration(refreshMinutes) * time.Minute) {
+			s.refresh()
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/edl/", s.handleFeed)
+	server := &http.Server{Addr: address, Handler: mux}
+
+	var err error
+	switch {
+	case certFile != "":
+		utils.LogInfof(true, "serving feeds at https://%s/edl/<expression>. refreshing every %d minutes.", address, refreshMinutes)
+		err = server.ListenAndServeTLS(certFile, keyFile)
+	case selfSigned:
+		cert, certErr := utils.SelfSignedCert()
+		if certErr != nil {
+			utils.LogError(certErr.Error())
+		}
+		server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		utils.LogInfof(true, "serving feeds at https://%s/edl/<expression> with a self-signed certificate. refreshing every %d minutes.", address, refreshMinutes)
+		err = server.ListenAndServeTLS("", "")
+	default:
+		utils.LogInfof(true, "serving feeds at http://%s/edl/<expression>. refreshing every %d minutes.", address, refreshMinutes)
+		err = server.ListenAndServe()
+	}
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+}
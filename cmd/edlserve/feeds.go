@@ -0,0 +1,209 @@
+package edlserve
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	ia "github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/cmd/dagsync"
+	"github.com/brian1917/workloader/utils"
+)
+
+// wkld is a workload's feed ips and labels
+type wkld struct {
+	ips    []string
+	labels map[string]string // key -> value
+}
+
+// snapshot is the pce data used to build feeds. feeds are cached until the next refresh.
+type snapshot struct {
+	refreshed time.Time
+	wklds     []wkld
+	ipLists   map[string][]string // name -> entries
+	feeds     map[string]string   // normalized expression -> feed
+}
+
+// expression is a parsed feed expression. Values for the same label key are or'd and different keys are and'd.
+type expression struct {
+	labels  map[string][]string
+	ipLists []string
+}
+
+// feedIP returns the ip in canonical form or blank if it should not be in a feed
+func feedIP(address string) string {
+	ip := net.ParseIP(address)
+	if ip == nil || dagsync.IsLinkLocal(ip) {
+		return ""
+	}
+	if ip.To4() == nil && !ipv6 {
+		return ""
+	}
+	return ip.String()
+}
+
+// loadSnapshot gets the workloads, labels, and active ip lists from the pce
+func loadSnapshot() (*snapshot, error) {
+	pce, err := utils.GetTargetPCEV2(false)
+	if err != nil {
+		return nil, err
+	}
+	apiResps, err := pce.Load(ia.LoadInput{Workloads: true, Labels: true}, utils.UseMulti())
+	utils.LogMultiAPIRespV2(apiResps)
+	if err != nil {
+		return nil, err
+	}
+	api, err := pce.GetIPLists(nil, "active")
+	utils.LogAPIRespV2("GetIPLists", api)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &snapshot{refreshed: time.Now(), ipLists: make(map[string][]string), feeds: make(map[string]string)}
+
+	for _, w := range pce.WorkloadsSlice {
+		if ia.PtrToVal(w.Deleted) {
+			continue
+		}
+		entry := wkld{labels: make(map[string]string)}
+		for _, l := range ia.PtrToVal(w.Labels) {
+			entry.labels[pce.Labels[l.Href].Key] = pce.Labels[l.Href].Value
+		}
+		for _, i := range ia.PtrToVal(w.Interfaces) {
+			if ip := feedIP(i.Address); ip != "" {
+				entry.ips = append(entry.ips, ip)
+			}
+		}
+		if len(entry.ips) > 0 {
+			s.wklds = append(s.wklds, entry)
+		}
+	}
+
+	for _, ipl := range pce.IPListsSlice {
+		entries := []string{}
+		ranges, exclusions := []ipRange{}, []ipRange{}
+		for _, r := range ia.PtrToVal(ipl.IPRanges) {
+			ipr, err := parseRange(r.FromIP, r.ToIP)
+			if err != nil {
+				utils.LogWarningf(false, "%s - skipping entry - %s", ipl.Name, err)
+				continue
+			}
+			if r.Exclusion {
+				exclusions = append(exclusions, ipr)
+				continue
+			}
+			if ip := net.IP(ipr.from.AsSlice()); dagsync.IsLinkLocal(ip) || (ipr.from.Is6() && !ipv6) {
+				continue
+			}
+			ranges = append(ranges, ipr)
+			entry := r.FromIP
+			if r.ToIP != "" {
+				entry = fmt.Sprintf("%s-%s", r.FromIP, r.ToIP)
+			}
+			entries = append(entries, entry)
+		}
+
+		// An EDL cannot express exclusions so they are subtracted from the entries
+		if len(exclusions) > 0 {
+			entries = []string{}
+			for _, r := range subtract(ranges, exclusions) {
+				entries = append(entries, r.String())
+			}
+			utils.LogInfof(false, "%s - %d exclusions subtracted from %d entries", ipl.Name, len(exclusions), len(ranges))
+		}
+		s.ipLists[ipl.Name] = entries
+	}
+
+	return s, nil
+}
+
+// parseExpression parses a feed path like app=erp,env=prod,iplist=partners. Values are url decoded.
+func parseExpression(raw string) (expression, string, error) {
+	exp := expression{labels: make(map[string][]string)}
+	terms := []string{}
+	for _, term := range strings.Split(raw, ",") {
+		if strings.TrimSpace(term) == "" {
+			continue
+		}
+		kv := strings.SplitN(term, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return exp, "", fmt.Errorf("invalid term %s. terms must be key=value", term)
+		}
+		key, err := url.PathUnescape(kv[0])
+		if err != nil {
+			return exp, "", err
+		}
+		value, err := url.PathUnescape(kv[1])
+		if err != nil {
+			return exp, "", err
+		}
+		if key == "iplist" {
+			exp.ipLists = append(exp.ipLists, value)
+		} else {
+			exp.labels[key] = append(exp.labels[key], value)
+		}
+		terms = append(terms, key+"="+value)
+	}
+	if len(terms) == 0 {
+		return exp, "", fmt.Errorf("feed expression is required (e.g., /edl/app=erp,env=prod)")
+	}
+
+	// Normalize so the same feed in a different order uses the same cache entry
+	sort.Strings(terms)
+	return exp, strings.Join(terms, ","), nil
+}
+
+// matches returns true if the workload has one of the values for every label key in the expression
+func (e expression) matches(w wkld) bool {
+	for key, values := range e.labels {
+		found := false
+		for _, v := range values {
+			if w.labels[key] == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// feed builds the feed for an expression with one entry per line
+func (s *snapshot) feed(exp expression) (string, error) {
+	entries := make(map[string]bool)
+
+	if len(exp.labels) > 0 {
+		for _, w := range s.wklds {
+			if exp.matches(w) {
+				for _, ip := range w.ips {
+					entries[ip] = true
+				}
+			}
+		}
+	}
+
+	for _, name := range exp.ipLists {
+		iplEntries, ok := s.ipLists[name]
+		if !ok {
+			return "", fmt.Errorf("%s is not an active ip list", name)
+		}
+		for _, e := range iplEntries {
+			entries[e] = true
+		}
+	}
+
+	lines := []string{}
+	for e := range entries {
+		lines = append(lines, e)
+	}
+	sort.Strings(lines)
+	if len(lines) == 0 {
+		return "", nil
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
@@ -0,0 +1,100 @@
+package edlserve
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// ipRange is an inclusive range of addresses in one address family
+type ipRange struct {
+	from, to netip.Addr
+}
+
+// parseRange parses an ip list entry. The from value can be an address or a CIDR and the optional to value is the end of a range.
+func parseRange(from, to string) (ipRange, error) {
+	var r ipRange
+	if strings.Contains(from, "/") {
+		p, err := netip.ParsePrefix(from)
+		if err != nil {
+			return r, fmt.Errorf("invalid cidr %s", from)
+		}
+		p = p.Masked()
+		r = ipRange{from: p.Addr(), to: lastAddr(p)}
+	} else {
+		a, err := netip.ParseAddr(from)
+		if err != nil {
+			return r, fmt.Errorf("invalid ip address %s", from)
+		}
+		r = ipRange{from: a.Unmap(), to: a.Unmap()}
+	}
+	if to != "" {
+		a, err := netip.ParseAddr(to)
+		if err != nil {
+			return r, fmt.Errorf("invalid ip address %s", to)
+		}
+		r.to = a.Unmap()
+	}
+	if r.from.Is4() != r.to.Is4() || r.to.Less(r.from) {
+		return r, fmt.Errorf("invalid range %s-%s", from, to)
+	}
+	return r, nil
+}
+
+// lastAddr returns the last address of a prefix
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Addr().AsSlice()
+	for i := range b {
+		if bits := p.Bits() - i*8; bits <= 0 {
+			b[i] = 0xff
+		} else if bits < 8 {
+			b[i] |= 0xff >> bits
+		}
+	}
+	a, _ := netip.AddrFromSlice(b)
+	return a
+}
+
+func (r ipRange) overlaps(o ipRange) bool {
+	return r.from.Is4() == o.from.Is4() && !r.to.Less(o.from) && !o.to.Less(r.from)
+}
+
+// String returns the range as an address, a CIDR, or a from-to range
+func (r ipRange) String() string {
+	if r.from == r.to {
+		return r.from.String()
+	}
+	for bits := 0; bits <= r.from.BitLen(); bits++ {
+		p := netip.PrefixFrom(r.from, bits)
+		if p.Masked().Addr() == r.from && lastAddr(p) == r.to {
+			return p.String()
+		}
+	}
+	return fmt.Sprintf("%s-%s", r.from, r.to)
+}
+
+// subtract returns the addresses in each range that are not in the exclusions
+func subtract(ranges, exclusions []ipRange) []ipRange {
+	out := []ipRange{}
+	for _, r := range ranges {
+		pieces := []ipRange{r}
+		for _, e := range exclusions {
+			next := []ipRange{}
+			for _, p := range pieces {
+				if !p.overlaps(e) {
+					next = append(next, p)
+					continue
+				}
+				if p.from.Less(e.from) {
+					next = append(next, ipRange{from: p.from, to: e.from.Prev()})
+				}
+				if e.to.Less(p.to) {
+					next = append(next, ipRange{from: e.to.Next(), to: p.to})
+				}
+			}
+			pieces = next
+		}
+		out = append(out, pieces...)
+	}
+	return out
+}
@@ -0,0 +1,276 @@
+package enforcementreadiness
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	ia "github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/cmd/wkldexport"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+)
+
+// Declare local global variables
+var appGroups []string
+var appGroupKeys, start, end, targetMode, outputFileName string
+var includeInsufficientData bool
+var minCoverage float64
+var maxUncovered, maxResults int
+
+func init() {
+	EnforcementReadinessCmd.Flags().StringVarP(&appGroupKeys, "app-group-keys", "g", "app,env", "comma-separated label keys that make an app group.")
+	EnforcementReadinessCmd.Flags().StringArrayVarP(&appGroups, "app-group", "a", nil, "app group as semicolon separated key:value labels (e.g., app:erp;env:prod). repeat the flag for more app groups. default is all app groups with managed workloads.")
+	EnforcementReadinessCmd.Flags().StringVarP(&start, "start", "s", time.Now().AddDate(0, 0, -30).In(time.UTC).Format("2006-01-02"), "start date in the format of yyyy-mm-dd.")
+	EnforcementReadinessCmd.Flags().StringVarP(&end, "end", "e", time.Now().Add(time.Hour*24).Format("2006-01-02"), "end date in the format of yyyy-mm-dd.")
+	EnforcementReadinessCmd.Flags().Float64Var(&minCoverage, "min-coverage", 1, "minimum share (0 to 1) of inbound flows allowed by draft policy for an app group to be ready.")
+	EnforcementReadinessCmd.Flags().IntVar(&maxUncovered, "max-uncovered", 0, "maximum uncovered port and peer combinations for an app group to be ready.")
+	EnforcementReadinessCmd.Flags().IntVarP(&maxResults, "max-results", "m", 100000, "max results in explorer for each app group query. maximum value is 200000.")
+	EnforcementReadinessCmd.Flags().StringVar(&targetMode, "target-mode", "", "create a wkld-import csv to move the managed workloads in ready app groups to this enforcement mode. options are selective or full.")
+	EnforcementReadinessCmd.Flags().BoolVar(&includeInsufficientData, "include-insufficient-data", false, "include app groups without inbound traffic that are otherwise ready in the --target-mode csv.")
+	EnforcementReadinessCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the report output file location. default is current location with a timestamped filename. the wkld-import file uses the same name with a -wkld-import suffix.")
+	EnforcementReadinessCmd.Flags().SortFlags = false
+}
+
+// EnforcementReadinessCmd scores app groups for enforcement
+var EnforcementReadinessCmd = &cobra.Command{
+	Use:   "enforcement-readiness",
+	Short: "Score the readiness of app groups to move to selective or full enforcement.",
+	Long: `
+Score the readiness of app groups to move to selective or full enforcement.
+
+For each app group, explorer is queried for inbound traffic in the time window with draft policy decisions. The report has:
+- the share of inbound flows allowed by draft policy.
+- the number of distinct uncovered port and peer combinations and the top combinations. The peer is the source hostname or ip address.
+- the managed workloads that are offline, do not have an active policy sync state, or have agent health errors.
+- the managed workloads that are idle and the managed workloads already in selective or full enforcement.
+
+The score (0 to 100) is the draft coverage multiplied by the share of healthy vens and the share of managed workloads that are not idle. App groups are ranked by score and then by the number of uncovered combinations.
+
+An app group is ready when the draft coverage is at least --min-coverage, the uncovered combinations are at most --max-uncovered, and there are no unhealthy vens or idle workloads. App groups with all managed workloads in selective or full enforcement are enforced. App groups without inbound traffic in the time window have a status of insufficient_data since the draft policy cannot be checked against traffic. They are not ready and have no draft coverage.
+
+Use --target-mode to create a wkld-import csv that moves the managed workloads in ready app groups to selective or full enforcement. App groups with insufficient data are only included with --include-insufficient-data. Review the csv and import it with wkld-import --allow-enforcement-changes.
+
+The update-pce and --no-prompt flags are ignored for this command.`,
+	Example: `# Score all app groups
+workloader enforcement-readiness
+
+# Score two app groups and create a wkld-import csv to move the ready ones to selective
+workloader enforcement-readiness -a "app:erp;env:prod" -a "app:crm;env:prod" --target-mode selective`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// Get the PCE
+		pce, err := utils.GetTargetPCEV2(true)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+
+		enforcementReadiness(pce)
+	},
+}
+
+func enforcementReadiness(pce ia.PCE) {
+
+	// Validate the flags
+	if minCoverage < 0 || minCoverage > 1 {
+		utils.LogError("min coverage must be between 0 and 1")
+	}
+	if maxResults < 1 || maxResults > 200000 {
+		utils.LogError("max-results must be between 1 and 200000")
+	}
+	targetMode = strings.ToLower(targetMode)
+	if targetMode != "" && targetMode != "selective" && targetMode != "full" {
+		utils.LogErrorf("%s is not a valid target mode. options are selective or full.", targetMode)
+	}
+	keys := []string{}
+	for _, k := range strings.Split(appGroupKeys, ",") {
+		if strings.TrimSpace(k) != "" {
+			keys = append(keys, strings.TrimSpace(k))
+		}
+	}
+	if len(keys) == 0 {
+		utils.LogError("at least one app group key is required")
+	}
+
+	// Get the PCE objects
+	apiResps, err := pce.Load(ia.LoadInput{Labels: true, Workloads: true}, utils.UseMulti())
+	utils.LogMultiAPIRespV2(apiResps)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
+	// Parse the app groups to include
+	include := make(map[string]bool)
+	for _, ag := range appGroups {
+		labels := make(map[string]string)
+		for _, kv := range strings.Split(ag, ";") {
+			key, value, found := strings.Cut(strings.TrimSpace(kv), ":")
+			if !found {
+				utils.LogErrorf("%s is not in the format of key:value", kv)
+			}
+			if _, ok := pce.Labels[key+value]; !ok {
+				utils.LogErrorf("%s does not exist as a %s label", value, key)
+			}
+			labels[key] = value
+		}
+		values := []string{}
+		for _, k := range keys {
+			if labels[k] == "" {
+				utils.LogErrorf("%s does not have a %s label. app groups are made of the %s labels.", ag, k, appGroupKeys)
+			}
+			values = append(values, labels[k])
+		}
+		include[strings.Join(values, " | ")] = true
+	}
+
+	// Build the app groups from the workloads. Workloads without all the app group keys are skipped.
+	groups := make(map[string]*appGroup)
+	for _, w := range pce.WorkloadsSlice {
+		values, hrefs := []string{}, []string{}
+		for _, k := range keys {
+			l := w.GetLabelByKey(k, pce.Labels)
+			if l.Href == "" {
+				break
+			}
+			values = append(values, l.Value)
+			hrefs = append(hrefs, l.Href)
+		}
+		if len(values) != len(keys) {
+			continue
+		}
+		value := strings.Join(values, " | ")
+		if len(include) > 0 && !include[value] {
+			continue
+		}
+		if _, ok := groups[value]; !ok {
+			groups[value] = &appGroup{value: value, hrefs: hrefs}
+		}
+		groups[value].addWorkload(w)
+	}
+	scored := []*appGroup{}
+	for _, g := range groups {
+		if g.managed > 0 {
+			scored = append(scored, g)
+		}
+	}
+	sort.Slice(scored, func(i, j int) bool { return scored[i].value < scored[j].value })
+	for ag := range include {
+		if _, ok := groups[ag]; !ok {
+			utils.LogWarningf(true, "%s - no workloads in the app group", ag)
+		}
+	}
+	if len(scored) == 0 {
+		utils.LogInfo("no app groups with managed workloads", true)
+		return
+	}
+
+	// Build the traffic query
+	tq := ia.TrafficQuery{
+		PolicyStatuses:                  []string{"allowed", "potentially_blocked", "blocked"},
+		MaxFLows:                        maxResults,
+		ExcludeWorkloadsFromIPListQuery: true,
+		TransmissionExcludes:            []string{"broadcast", "multicast"},
+		SourcesInclude:                  [][]string{make([]string, 0)},
+	}
+	tq.StartTime, err = time.Parse("2006-01-02 MST", fmt.Sprintf("%s %s", start, "UTC"))
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	tq.StartTime = tq.StartTime.In(time.UTC)
+	tq.EndTime, err = time.Parse("2006-01-02 15:04:05 MST", fmt.Sprintf("%s 23:59:59 %s", end, "UTC"))
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	tq.EndTime = tq.EndTime.In(time.UTC)
+
+	// Query the inbound traffic of each app group with draft policy decisions
+	for i, g := range scored {
+		q := tq
+		q.DestinationsInclude = [][]string{g.hrefs}
+		traffic, a, err := pce.GetTrafficAnalysisCsv(q, true)
+		utils.LogAPIRespV2("GetTrafficAnalysisCsv", a)
+		utils.LogInfof(false, "explorer query body: %s", a.ReqBody)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		if err := g.addTraffic(traffic); err != nil {
+			utils.LogErrorf("%s - %s", g.value, err)
+		}
+		if len(traffic)-1 >= q.MaxFLows {
+			utils.LogWarningf(true, "%s - the query returned the max results. use a smaller time window.", g.value)
+		}
+		utils.LogInfof(true, "%d of %d - %s - %d inbound flows with %.1f%% draft coverage", i+1, len(scored), g.value, g.flows, g.coverage()*100)
+	}
+
+	// Build the report
+	rank(scored)
+	data := [][]string{{"rank", "app_group", "status", "score", "draft_coverage_pct", "inbound_flows", "uncovered_flows", "uncovered_combinations", "top_uncovered", "workloads", "managed", "enforced", "idle", "offline", "policy_sync_not_active", "agent_health_errors", "reasons"}}
+	ready := []*appGroup{}
+	readyCount, insufficientData := 0, 0
+	for i, g := range scored {
+		status, reasons := g.status(minCoverage, maxUncovered)
+		switch status {
+		case statusReady:
+			readyCount++
+		case statusInsufficientData:
+			insufficientData++
+		}
+		if status == statusReady || (status == statusInsufficientData && includeInsufficientData) {
+			ready = append(ready, g)
+		}
+		coverage := strconv.FormatFloat(g.coverage()*100, 'f', 1, 64)
+		if g.flows == 0 {
+			coverage = ""
+		}
+		data = append(data, []string{
+			strconv.Itoa(i + 1),
+			g.value,
+			status,
+			strconv.FormatFloat(g.score(), 'f', 1, 64),
+			coverage,
+			strconv.Itoa(g.flows),
+			strconv.Itoa(g.flows - g.coveredFlows),
+			strconv.Itoa(len(g.uncovered)),
+			g.topUncovered(5),
+			strconv.Itoa(len(g.workloads)),
+			strconv.Itoa(g.managed),
+			strconv.Itoa(g.enforced),
+			strconv.Itoa(g.idle),
+			strconv.Itoa(g.offline),
+			strconv.Itoa(g.syncNotActive),
+			strconv.Itoa(g.healthErrors),
+			strings.Join(reasons, "; "),
+		})
+	}
+
+	// Write the report
+	if outputFileName == "" {
+		outputFileName = fmt.Sprintf("workloader-enforcement-readiness-%s.csv", time.Now().Format("20060102_150405"))
+	}
+	utils.WriteOutput(data, data, outputFileName)
+	utils.LogInfof(true, "%d of %d app groups are ready and %d have insufficient data", readyCount, len(scored), insufficientData)
+
+	// Create the wkld-import file for the ready app groups
+	if targetMode == "" || len(ready) == 0 {
+		return
+	}
+	importData := [][]string{{wkldexport.HeaderHref, wkldexport.HeaderHostname, wkldexport.HeaderEnforcement}}
+	for _, g := range ready {
+		for _, w := range g.workloads {
+			if w.Agent == nil || w.Agent.Href == "" || ia.PtrToVal(w.EnforcementMode) == targetMode {
+				continue
+			}
+			importData = append(importData, []string{w.Href, ia.PtrToVal(w.Hostname), targetMode})
+		}
+	}
+	if len(importData) == 1 {
+		utils.LogInfof(true, "all managed workloads in the ready app groups are already in %s enforcement", targetMode)
+		return
+	}
+	importFileName := fmt.Sprintf("%s-wkld-import.csv", strings.TrimSuffix(outputFileName, ".csv"))
+	utils.WriteOutput(importData, nil, importFileName)
+	utils.LogInfof(true, "%d workloads to move to %s enforcement in %s", len(importData)-1, targetMode, importFileName)
+	utils.LogInfof(true, "review the file and run: workloader wkld-import %s --allow-enforcement-changes", importFileName)
+}
@@ -0,0 +1,227 @@
+package enforcementreadiness
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	ia "github.com/brian1917/illumioapi/v2"
+)
+
+// errorSeverities are the agent health severities counted as unhealthy
+var errorSeverities = map[string]bool{"emerg": true, "alert": true, "crit": true, "err": true, "error": true}
+
+// appGroup is the readiness data of an app group
+type appGroup struct {
+	value     string
+	hrefs     []string
+	workloads []ia.Workload
+
+	// Workload counts
+	managed, enforced, idle, offline, syncNotActive, healthErrors, unhealthy int
+
+	// Inbound traffic
+	flows, coveredFlows int
+	uncovered           map[string]int
+}
+
+// addWorkload adds a workload and its ven state to the counts
+func (g *appGroup) addWorkload(w ia.Workload) {
+	g.workloads = append(g.workloads, w)
+	if w.Agent == nil || w.Agent.Href == "" {
+		return
+	}
+	g.managed++
+	mode := ia.PtrToVal(w.EnforcementMode)
+	if mode == "full" || mode == "selective" {
+		g.enforced++
+	}
+	if mode == "idle" {
+		g.idle++
+	}
+	unhealthy := false
+	if !ia.PtrToVal(w.Online) {
+		g.offline++
+		unhealthy = true
+	}
+	if w.Agent.Status != nil && w.Agent.Status.SecurityPolicySyncState != "active" {
+		g.syncNotActive++
+		unhealthy = true
+	}
+	if w.Agent.Status != nil {
+		for _, h := range ia.PtrToVal(w.Agent.Status.AgentHealth) {
+			if errorSeverities[strings.ToLower(h.Severity)] {
+				g.healthErrors++
+				unhealthy = true
+				break
+			}
+		}
+	}
+	if unhealthy {
+		g.unhealthy++
+	}
+}
+
+// addTraffic adds the inbound flows from an explorer csv with draft policy decisions
+func (g *appGroup) addTraffic(data [][]string) error {
+	if g.uncovered == nil {
+		g.uncovered = make(map[string]int)
+	}
+	if len(data) < 2 {
+		return nil
+	}
+	index := make(map[string]int)
+	draft := -1
+	for i, h := range data[0] {
+		h = strings.ToLower(strings.TrimSpace(h))
+		index[h] = i
+		if strings.Contains(h, "draft") && strings.Contains(h, "decision") {
+			draft = i
+		}
+	}
+	find := func(names ...string) int {
+		for _, n := range names {
+			if i, ok := index[n]; ok {
+				return i
+			}
+		}
+		return -1
+	}
+	srcIP, srcName := find("source ip", "src_ip"), find("source hostname", "source name", "src_hostname")
+	port, proto := find("port", "destination port", "dst_port"), find("protocol", "proto")
+	flows := find("num flows", "flows", "connections", "num_connections")
+	if draft == -1 {
+		return fmt.Errorf("the explorer results do not have a draft policy decision column")
+	}
+	if srcIP == -1 || port == -1 || proto == -1 {
+		return fmt.Errorf("the explorer results do not have source ip, port, and protocol columns")
+	}
+	protocols := make(map[string]string)
+	for num, name := range ia.ProtocolList() {
+		protocols[strconv.Itoa(num)] = name
+	}
+
+	for _, row := range data[1:] {
+		if len(row) != len(data[0]) {
+			continue
+		}
+		n := 1
+		if flows != -1 {
+			if v, err := strconv.Atoi(strings.TrimSpace(row[flows])); err == nil {
+				n = v
+			}
+		}
+		g.flows += n
+		if strings.HasPrefix(strings.ReplaceAll(strings.ToLower(strings.TrimSpace(row[draft])), " ", "_"), "allowed") {
+			g.coveredFlows += n
+			continue
+		}
+		peer := row[srcIP]
+		if srcName != -1 && row[srcName] != "" {
+			peer = row[srcName]
+		}
+		p := strings.ToLower(row[proto])
+		if name, ok := protocols[row[proto]]; ok {
+			p = strings.ToLower(name)
+		}
+		g.uncovered[fmt.Sprintf("%s %s %s", peer, row[port], p)] += n
+	}
+	return nil
+}
+
+// coverage returns the share of inbound flows allowed by draft policy. App groups without traffic have no coverage.
+func (g *appGroup) coverage() float64 {
+	if g.flows == 0 {
+		return 0
+	}
+	return float64(g.coveredFlows) / float64(g.flows)
+}
+
+// score returns the readiness score from 0 to 100. It is the draft coverage multiplied by the share of healthy vens and the share of managed workloads that are not idle.
+func (g *appGroup) score() float64 {
+	if g.managed == 0 {
+		return 0
+	}
+	healthy := float64(g.managed-g.unhealthy) / float64(g.managed)
+	notIdle := float64(g.managed-g.idle) / float64(g.managed)
+	return math.Round(100*g.coverage()*healthy*notIdle*10) / 10
+}
+
+// Readiness statuses
+const (
+	statusReady            = "ready"
+	statusNotReady         = "not ready"
+	statusEnforced         = "enforced"
+	statusInsufficientData = "insufficient_data"
+)
+
+// status returns the readiness status and the reasons an app group is not ready. App groups without inbound traffic
+// have insufficient data since the draft policy cannot be checked.
+func (g *appGroup) status(minCoverage float64, maxUncovered int) (string, []string) {
+	if g.managed > 0 && g.enforced == g.managed {
+		return statusEnforced, nil
+	}
+	reasons := []string{}
+	if g.managed == 0 {
+		reasons = append(reasons, "no managed workloads")
+	}
+	if g.flows > 0 && g.coverage() < minCoverage {
+		reasons = append(reasons, fmt.Sprintf("draft coverage %.1f%% is below %.1f%%", g.coverage()*100, minCoverage*100))
+	}
+	if len(g.uncovered) > maxUncovered {
+		reasons = append(reasons, fmt.Sprintf("%d uncovered port and peer combinations", len(g.uncovered)))
+	}
+	if g.unhealthy > 0 {
+		reasons = append(reasons, fmt.Sprintf("%d unhealthy vens", g.unhealthy))
+	}
+	if g.idle > 0 {
+		reasons = append(reasons, fmt.Sprintf("%d idle workloads", g.idle))
+	}
+	if g.flows == 0 {
+		if len(reasons) == 0 {
+			return statusInsufficientData, []string{"no inbound traffic in the time window"}
+		}
+		reasons = append(reasons, "no inbound traffic in the time window")
+	}
+	if len(reasons) > 0 {
+		return statusNotReady, reasons
+	}
+	return statusReady, nil
+}
+
+// topUncovered returns the uncovered port and peer combinations with the most flows
+func (g *appGroup) topUncovered(n int) string {
+	combos := []string{}
+	for c := range g.uncovered {
+		combos = append(combos, c)
+	}
+	sort.Slice(combos, func(i, j int) bool {
+		if g.uncovered[combos[i]] != g.uncovered[combos[j]] {
+			return g.uncovered[combos[i]] > g.uncovered[combos[j]]
+		}
+		return combos[i] < combos[j]
+	})
+	top := []string{}
+	for i, c := range combos {
+		if i == n {
+			break
+		}
+		top = append(top, fmt.Sprintf("%s (%d flows)", c, g.uncovered[c]))
+	}
+	return strings.Join(top, "; ")
+}
+
+// rank sorts the app groups by score and then by the number of uncovered combinations
+func rank(groups []*appGroup) {
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].score() != groups[j].score() {
+			return groups[i].score() > groups[j].score()
+		}
+		if len(groups[i].uncovered) != len(groups[j].uncovered) {
+			return len(groups[i].uncovered) < len(groups[j].uncovered)
+		}
+		return groups[i].value < groups[j].value
+	})
+}
@@ -0,0 +1,266 @@
+package eventexport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	ia "github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+)
+
+// Declare local global variables
+var eventTypes, severities, createdByFilter, start, end, format, outputFileName, checkpointFile string
+var syslogServer, syslogProtocol, syslogFormat, tlsCA string
+var hours, maxResults, interval int
+var follow, insecure bool
+
+func init() {
+	EventExportCmd.Flags().StringVarP(&eventTypes, "event-types", "t", "", "comma-separated list of event types. end a type with * to match a prefix (e.g., user.*,agent.*). default is all event types.")
+	EventExportCmd.Flags().StringVar(&severities, "severity", "", "comma-separated list of severities (emerg, alert, crit, err, warning, notice, info, debug). default is all severities.")
+	EventExportCmd.Flags().StringVar(&createdByFilter, "created-by", "", "only include events where the username, hostname, or name of the creator contains the value. not case sensitive.")
+	EventExportCmd.Flags().StringVar(&start, "start", "", "start time in RFC 3339 format. default is --hours before now.")
+	EventExportCmd.Flags().StringVar(&end, "end", "", "end time in RFC 3339 format. default is now. ignored with --follow.")
+	EventExportCmd.Flags().IntVar(&hours, "hours", 24, "hours of events to export when --start is not set.")
+	EventExportCmd.Flags().IntVar(&maxResults, "max-results", 10000, "maximum results per query. max is 10,000.")
+	EventExportCmd.Flags().StringVarP(&format, "format", "f", "csv", "output file format. options are csv or json.")
+	EventExportCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the output file location. default is current location with a timestamped filename.")
+	EventExportCmd.Flags().BoolVar(&follow, "follow", false, "poll for new events and forward them to the syslog server. requires --syslog-server.")
+	EventExportCmd.Flags().IntVar(&interval, "interval", 60, "seconds between polls with --follow.")
+	EventExportCmd.Flags().StringVar(&checkpointFile, "checkpoint", "workloader-event-export-checkpoint.json", "file with the last forwarded event timestamp for --follow.")
+	EventExportCmd.Flags().StringVar(&syslogServer, "syslog-server", "", "syslog server as host:port. events are forwarded instead of written to a file.")
+	EventExportCmd.Flags().StringVar(&syslogProtocol, "syslog-protocol", "udp", "syslog protocol. options are udp, tcp, or tls.")
+	EventExportCmd.Flags().StringVar(&syslogFormat, "syslog-format", "rfc5424", "syslog message format. options are rfc5424 (event json message) or cef.")
+	EventExportCmd.Flags().StringVar(&tlsCA, "tls-ca", "", "pem file with the ca certificate of the syslog server. default is the system certificates.")
+	EventExportCmd.Flags().BoolVarP(&insecure, "insecure", "i", false, "ignore ssl certificate validation when communicating with the syslog server.")
+	EventExportCmd.Flags().SortFlags = false
+}
+
+// EventExportCmd exports and forwards pce events
+var EventExportCmd = &cobra.Command{
+	Use:   "event-export",
+	Short: "Export PCE events to a CSV or JSON file or forward them to a syslog server.",
+	Long: `
+Export PCE events to a CSV or JSON file or forward them to a syslog server.
+
+All event types are exported by default (e.g., user.sign_in, sec_policy.create, workload.update, agent.tampering). Use --event-types, --severity, and --created-by to filter the events. Use --start and --end or --hours for the time window.
+
+The CSV has the main fields of each event. The JSON file has the full events.
+
+The PCE returns the newest events first. When a query returns --max-results events, older events are queried until the window is filled. If --max-results events have the same second, the command stops with an error to increase --max-results.
+
+Syslog:
+Use --syslog-server to forward the events to a syslog server over udp, tcp, or tls. TCP and TLS use octet counting framing. Messages are RFC 5424 with the local0 facility, the pce fqdn as the hostname, illumio_pce as the app name, and the event type as the message id. The message is the event json or, with --syslog-format cef, a CEF record.
+
+Follow:
+With --follow, workloader polls the PCE every --interval seconds and forwards new events. The timestamp of the last forwarded event is saved in the --checkpoint file so a restart continues where it stopped. The first run without a checkpoint starts at --start or now. Stop with ctrl+c.
+
+The update-pce and --no-prompt flags are ignored for this command.`,
+	Example: `# Export the last 24 hours of events to a csv
+workloader event-export
+
+# Export user events from the last week to json
+workloader event-export --event-types "user.*" --hours 168 --format json
+
+# Forward new events as CEF over TLS
+workloader event-export --follow --syslog-server siem.example.com:6514 --syslog-protocol tls --syslog-format cef`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// Get the PCE
+		pce, err := utils.GetTargetPCEV2(false)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+
+		eventExport(pce)
+	},
+}
+
+func eventExport(pce ia.PCE) {
+
+	// Validate the flags
+	format = strings.ToLower(format)
+	if format != "csv" && format != "json" {
+		utils.LogErrorf("%s is not a valid format. options are csv or json.", format)
+	}
+	if maxResults < 1 || maxResults > 10000 {
+		utils.LogError("max results must be between 1 and 10,000")
+	}
+	if follow && syslogServer == "" {
+		utils.LogError("--follow requires --syslog-server")
+	}
+	if follow && interval < 1 {
+		utils.LogError("interval must be at least 1 second")
+	}
+
+	// Build the filter
+	f := filter{severities: make(map[string]bool), createdBy: createdByFilter}
+	for _, t := range strings.Split(eventTypes, ",") {
+		if strings.TrimSpace(t) != "" {
+			f.types = append(f.types, strings.TrimSpace(t))
+		}
+	}
+	for _, s := range strings.Split(severities, ",") {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if s == "" {
+			continue
+		}
+		if _, ok := syslogSeverity[s]; !ok {
+			utils.LogErrorf("%s is not a valid severity. options are emerg, alert, crit, err, warning, notice, info, or debug.", s)
+		}
+		f.severities[s] = true
+	}
+
+	// Time window
+	startTime := time.Now().Add(-time.Duration(hours) * time.Hour)
+	if start != "" {
+		startTime = parseTime(start)
+	}
+	qp := map[string]string{"max_results": strconv.Itoa(maxResults), "timestamp[gte]": startTime.Format(time.RFC3339)}
+	if end != "" && !follow {
+		qp["timestamp[lte]"] = parseTime(end).Format(time.RFC3339)
+	}
+
+	// Forwarder
+	var fwd *forwarder
+	if syslogServer != "" {
+		var err error
+		fwd, err = newForwarder(syslogProtocol, syslogServer, syslogFormat, tlsCA, insecure, pce.FQDN, fmt.Sprintf("%d.%d", pce.Version.Major, pce.Version.Minor))
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		defer fwd.close()
+	}
+
+	if follow {
+		followEvents(pce, qp, f, fwd, start != "")
+		return
+	}
+
+	records, err := getEvents(pce, qp, f)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	utils.LogInfof(true, "%d events from %s", len(records), qp["timestamp[gte]"])
+	if len(records) == 0 {
+		return
+	}
+
+	// Forward the events or write the file
+	if fwd != nil {
+		for i, r := range records {
+			if err := fwd.send(r); err != nil {
+				utils.LogErrorf("forwarding event %d of %d - %s", i+1, len(records), err)
+			}
+		}
+		utils.LogInfof(true, "forwarded %d events to %s", len(records), syslogServer)
+		return
+	}
+	if outputFileName == "" {
+		outputFileName = fmt.Sprintf("workloader-event-export-%s.%s", time.Now().Format("20060102_150405"), format)
+	}
+	if format == "csv" {
+		utils.WriteOutput(csvData(records), csvData(records), outputFileName)
+	} else {
+		events := []map[string]any{}
+		for _, r := range records {
+			events = append(events, r.raw)
+		}
+		data, err := json.MarshalIndent(events, "", "  ")
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		if err := os.WriteFile(outputFileName, data, 0644); err != nil {
+			utils.LogError(err.Error())
+		}
+	}
+	utils.LogInfof(true, "created %s", outputFileName)
+}
+
+func parseTime(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		utils.LogErrorf("%s is not in RFC 3339 format (e.g., 2024-01-02T15:04:05Z)", s)
+	}
+	return t
+}
+
+// checkpoint is the timestamp of the last forwarded event and the hrefs forwarded at that timestamp
+type checkpoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Hrefs     []string  `json:"hrefs"`
+}
+
+func (c checkpoint) save() {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	if err := os.WriteFile(checkpointFile, data, 0644); err != nil {
+		utils.LogErrorf("writing checkpoint - %s", err)
+	}
+}
+
+// followEvents polls for new events and forwards them until the process is stopped
+func followEvents(pce ia.PCE, qp map[string]string, f filter, fwd *forwarder, startSet bool) {
+
+	// Load the checkpoint
+	cp := checkpoint{}
+	if data, err := os.ReadFile(checkpointFile); err == nil {
+		if err := json.Unmarshal(data, &cp); err != nil {
+			utils.LogErrorf("parsing %s - %s", checkpointFile, err)
+		}
+		utils.LogInfof(true, "continuing from %s checkpoint at %s", checkpointFile, cp.Timestamp.Format(time.RFC3339Nano))
+	} else if !os.IsNotExist(err) {
+		utils.LogError(err.Error())
+	}
+	if cp.Timestamp.IsZero() {
+		cp.Timestamp = time.Now().UTC()
+		if startSet {
+			cp.Timestamp, _ = time.Parse(time.RFC3339, qp["timestamp[gte]"])
+		}
+		utils.LogInfof(true, "no checkpoint. starting at %s", cp.Timestamp.Format(time.RFC3339))
+	}
+
+	for {
+		// The query is by second so events at the checkpoint second are filtered by timestamp and href
+		qp["timestamp[gte]"] = cp.Timestamp.UTC().Format(time.RFC3339)
+		records, err := getEvents(pce, qp, f)
+		if errors.Is(err, errMaxResults) {
+			utils.LogError(err.Error())
+		}
+		if err != nil {
+			utils.LogWarningf(true, "%s. retrying in %d seconds.", err, interval)
+		}
+		sent := make(map[string]bool)
+		for _, h := range cp.Hrefs {
+			sent[h] = true
+		}
+		forwarded := 0
+		for _, r := range records {
+			if r.timestamp.Before(cp.Timestamp) || (r.timestamp.Equal(cp.Timestamp) && sent[r.href]) {
+				continue
+			}
+			if err := fwd.send(r); err != nil {
+				utils.LogWarningf(true, "forwarding event - %s. retrying in %d seconds.", err, interval)
+				break
+			}
+			if r.timestamp.After(cp.Timestamp) {
+				cp.Timestamp = r.timestamp
+				cp.Hrefs = nil
+			}
+			cp.Hrefs = append(cp.Hrefs, r.href)
+			forwarded++
+		}
+		if forwarded > 0 {
+			cp.save()
+			utils.LogInfof(true, "forwarded %d events. checkpoint is %s", forwarded, cp.Timestamp.Format(time.RFC3339Nano))
+		}
+		time.Sleep(time.Duration(interval) * time.Second)
+	}
+}
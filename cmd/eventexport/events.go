@@ -0,0 +1,209 @@
+package eventexport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	ia "github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/utils"
+)
+
+// record is an event with the fields used for filtering and output. raw has every field returned by the pce.
+type record struct {
+	raw       map[string]any
+	href      string
+	eventType string
+	severity  string
+	status    string
+	pceFQDN   string
+	createdBy string
+	timestamp time.Time
+}
+
+func newRecord(raw map[string]any) (record, error) {
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return record{}, err
+	}
+	var e ia.Event
+	if err := json.Unmarshal(b, &e); err != nil {
+		return record{}, err
+	}
+	r := record{raw: raw, eventType: e.EventType, timestamp: e.Timestamp}
+	r.href, _ = raw["href"].(string)
+	r.severity, _ = raw["severity"].(string)
+	r.status, _ = raw["status"].(string)
+	r.pceFQDN, _ = raw["pce_fqdn"].(string)
+	r.createdBy = createdBy(raw, e)
+	return r, nil
+}
+
+// createdBy returns the username, name, or hostname of the event creator
+func createdBy(raw map[string]any, e ia.Event) string {
+	cb, _ := raw["created_by"].(map[string]any)
+	keys := []string{}
+	for k := range cb {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		obj, ok := cb[k].(map[string]any)
+		if !ok {
+			continue
+		}
+		for _, field := range []string{"username", "name", "hostname", "href"} {
+			if v, _ := obj[field].(string); v != "" {
+				return v
+			}
+		}
+		return k
+	}
+	if e.EventCreatedBy == nil {
+		return ""
+	}
+	if e.EventCreatedBy.VEN != nil && ia.PtrToVal(e.EventCreatedBy.VEN.Hostname) != "" {
+		return ia.PtrToVal(e.EventCreatedBy.VEN.Hostname)
+	}
+	if e.EventCreatedBy.Agent != nil && e.EventCreatedBy.Agent.Hostname != "" {
+		return e.EventCreatedBy.Agent.Hostname
+	}
+	if e.EventCreatedBy.Name != "" {
+		return e.EventCreatedBy.Name
+	}
+	return e.EventCreatedBy.Href
+}
+
+// action returns a field of the api action that created the event
+func (r record) action(field string) string {
+	a, _ := r.raw["action"].(map[string]any)
+	if a == nil || a[field] == nil {
+		return ""
+	}
+	return fmt.Sprint(a[field])
+}
+
+// filter has the event filters that are applied after the api query
+type filter struct {
+	types      []string
+	severities map[string]bool
+	createdBy  string
+}
+
+// exactTypes returns the event types when none have a wildcard so each type can be queried
+func (f filter) exactTypes() []string {
+	for _, t := range f.types {
+		if strings.HasSuffix(t, "*") {
+			return nil
+		}
+	}
+	return f.types
+}
+
+func (f filter) match(r record) bool {
+	if len(f.types) > 0 {
+		match := false
+		for _, t := range f.types {
+			if r.eventType == t || (strings.HasSuffix(t, "*") && strings.HasPrefix(r.eventType, strings.TrimSuffix(t, "*"))) {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return false
+		}
+	}
+	if len(f.severities) > 0 && !f.severities[strings.ToLower(r.severity)] {
+		return false
+	}
+	if f.createdBy != "" && !strings.Contains(strings.ToLower(r.createdBy), strings.ToLower(f.createdBy)) {
+		return false
+	}
+	return true
+}
+
+// errMaxResults is returned when the events in one second exceed the max results and the query cannot be paged
+var errMaxResults = errors.New("events exceed max results")
+
+// getEvents queries the events and returns the matching events sorted oldest first.
+// Queries that return the max results are repeated with older windows until all events are returned.
+func getEvents(pce ia.PCE, qp map[string]string, f filter) ([]record, error) {
+	queries := []map[string]string{}
+	types := f.exactTypes()
+	if len(types) == 0 {
+		types = []string{""}
+	}
+	for _, t := range types {
+		q := map[string]string{}
+		if t != "" {
+			q["event_type"] = t
+		}
+		for k, v := range qp {
+			q[k] = v
+		}
+		queries = append(queries, q)
+	}
+
+	records := []record{}
+	seen := make(map[string]bool)
+	for _, q := range queries {
+		for {
+			// The events are read as maps to keep every field. pce.GetEvents also panics on events not created by an agent.
+			events := []map[string]any{}
+			a, err := pce.GetCollection("events", false, q, &events)
+			if len(events) >= 500 {
+				events = nil
+				a, err = pce.GetCollection("events", true, q, &events)
+			}
+			utils.LogAPIRespV2("GetEvents", a)
+			if err != nil {
+				return nil, fmt.Errorf("getting events - %s", err)
+			}
+			var oldest time.Time
+			for _, e := range events {
+				r, err := newRecord(e)
+				if err != nil {
+					return nil, fmt.Errorf("processing event - %s", err)
+				}
+				if oldest.IsZero() || r.timestamp.Before(oldest) {
+					oldest = r.timestamp
+				}
+				if (r.href != "" && seen[r.href]) || !f.match(r) {
+					continue
+				}
+				seen[r.href] = true
+				records = append(records, r)
+			}
+			if fmt.Sprint(len(events)) != q["max_results"] {
+				break
+			}
+
+			// The pce returns the newest events so page backwards until the window is filled.
+			// The query is by second so the oldest second is queried again and duplicates are skipped by href.
+			lte := oldest.UTC().Truncate(time.Second)
+			if lte.Before(oldest) {
+				lte = lte.Add(time.Second)
+			}
+			if lte.Format(time.RFC3339) == q["timestamp[lte]"] {
+				return nil, fmt.Errorf("%w - at least %s events at %s. increase --max-results", errMaxResults, q["max_results"], q["timestamp[lte]"])
+			}
+			utils.LogInfof(false, "the query returned the max results of %s events. getting events from %s to %s.", q["max_results"], q["timestamp[gte]"], lte.Format(time.RFC3339))
+			q["timestamp[lte]"] = lte.Format(time.RFC3339)
+		}
+	}
+
+	sort.SliceStable(records, func(i, j int) bool { return records[i].timestamp.Before(records[j].timestamp) })
+	return records, nil
+}
+
+// csvData returns the events as csv rows
+func csvData(records []record) [][]string {
+	data := [][]string{{"timestamp", "event_type", "severity", "status", "created_by", "api_method", "api_endpoint", "src_ip", "pce_fqdn", "href"}}
+	for _, r := range records {
+		data = append(data, []string{r.timestamp.Format(time.RFC3339Nano), r.eventType, r.severity, r.status, r.createdBy, r.action("api_method"), r.action("api_endpoint"), r.action("src_ip"), r.pceFQDN, r.href})
+	}
+	return data
+}
@@ -0,0 +1,73 @@
+package eventexport
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+
+	ia "github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/cmd/mockpce"
+	"github.com/brian1917/workloader/utils"
+)
+
+func TestMain(m *testing.M) {
+	utils.Logger.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// newTestPCE starts the mock pce with the testdata events and returns a pce pointed at it
+func newTestPCE(t *testing.T) ia.PCE {
+	t.Helper()
+	s, err := mockpce.NewServer("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewTLSServer(s)
+	t.Cleanup(ts.Close)
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ia.PCE{FQDN: u.Hostname(), Port: port, Org: 1, User: "mock", Key: "mock", DisableTLSChecking: true}
+}
+
+// TestGetEventsPagesBackwards checks events older than the max results are queried instead of skipped
+func TestGetEventsPagesBackwards(t *testing.T) {
+	pce := newTestPCE(t)
+	qp := map[string]string{"max_results": "3", "timestamp[gte]": "2026-10-16T00:00:00Z"}
+
+	records, err := getEvents(pce, qp, filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hrefs := []string{}
+	for _, r := range records {
+		hrefs = append(hrefs, r.href)
+	}
+	if want := []string{"/orgs/1/events/1", "/orgs/1/events/2", "/orgs/1/events/3", "/orgs/1/events/4", "/orgs/1/events/5"}; !reflect.DeepEqual(hrefs, want) {
+		t.Errorf("events are %v, want %v", hrefs, want)
+	}
+	if _, ok := qp["timestamp[lte]"]; ok {
+		t.Error("paging changed the query parameters used by the next poll")
+	}
+}
+
+// TestGetEventsMaxResultsInOneSecond checks an error is returned when the events in one second fill the max results
+func TestGetEventsMaxResultsInOneSecond(t *testing.T) {
+	pce := newTestPCE(t)
+	qp := map[string]string{"max_results": "2", "timestamp[gte]": "2026-10-16T00:00:00Z"}
+
+	if _, err := getEvents(pce, qp, filter{}); !errors.Is(err, errMaxResults) {
+		t.Errorf("error is %v, want %v", err, errMaxResults)
+	}
+}
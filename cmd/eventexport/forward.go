@@ -0,0 +1,171 @@
+package eventexport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// facility is local0
+const facility = 16
+
+// syslogSeverity maps pce event severities to syslog severities
+var syslogSeverity = map[string]int{"emerg": 0, "alert": 1, "crit": 2, "err": 3, "warning": 4, "notice": 5, "info": 6, "debug": 7}
+
+// cefSeverity maps pce event severities to the cef 0-10 scale
+var cefSeverity = map[string]int{"emerg": 10, "alert": 9, "crit": 8, "err": 7, "warning": 5, "notice": 3, "info": 1, "debug": 0}
+
+// forwarder sends events to a syslog server
+type forwarder struct {
+	protocol   string
+	address    string
+	format     string
+	tlsConfig  *tls.Config
+	hostname   string
+	pceVersion string
+	conn       net.Conn
+}
+
+func newForwarder(protocol, address, format, caFile string, insecure bool, hostname, pceVersion string) (*forwarder, error) {
+	f := &forwarder{protocol: strings.ToLower(protocol), address: address, format: strings.ToLower(format), hostname: hostname, pceVersion: pceVersion}
+	if f.protocol != "udp" && f.protocol != "tcp" && f.protocol != "tls" {
+		return nil, fmt.Errorf("%s is not a valid syslog protocol. options are udp, tcp, or tls", protocol)
+	}
+	if f.format != "rfc5424" && f.format != "cef" {
+		return nil, fmt.Errorf("%s is not a valid syslog format. options are rfc5424 or cef", format)
+	}
+	if f.protocol == "tls" {
+		f.tlsConfig = &tls.Config{InsecureSkipVerify: insecure}
+		if caFile != "" {
+			pem, err := os.ReadFile(caFile)
+			if err != nil {
+				return nil, err
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates in %s", caFile)
+			}
+			f.tlsConfig.RootCAs = pool
+		}
+	}
+	return f, f.connect()
+}
+
+func (f *forwarder) connect() error {
+	if f.conn != nil {
+		f.conn.Close()
+		f.conn = nil
+	}
+	var err error
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if f.protocol == "tls" {
+		f.conn, err = tls.DialWithDialer(dialer, "tcp", f.address, f.tlsConfig)
+	} else {
+		f.conn, err = dialer.Dial(f.protocol, f.address)
+	}
+	if err != nil {
+		return fmt.Errorf("connecting to %s over %s - %s", f.address, f.protocol, err)
+	}
+	return nil
+}
+
+// send writes the event and reconnects once if the write fails
+func (f *forwarder) send(r record) error {
+	msg, err := f.message(r)
+	if err != nil {
+		return err
+	}
+
+	// TCP and TLS use octet counting framing (RFC 6587)
+	frame := []byte(msg)
+	if f.protocol != "udp" {
+		frame = []byte(strconv.Itoa(len(msg)) + " " + msg)
+	}
+	for attempt := 1; attempt <= 2; attempt++ {
+		if f.conn == nil {
+			if err = f.connect(); err != nil {
+				continue
+			}
+		}
+		f.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if _, err = f.conn.Write(frame); err == nil {
+			return nil
+		}
+		f.conn.Close()
+		f.conn = nil
+	}
+	return err
+}
+
+func (f *forwarder) close() {
+	if f.conn != nil {
+		f.conn.Close()
+	}
+}
+
+// message returns the RFC 5424 syslog message. The msg is the event json or a cef record.
+func (f *forwarder) message(r record) (string, error) {
+	sev, ok := syslogSeverity[strings.ToLower(r.severity)]
+	if !ok {
+		sev = syslogSeverity["info"]
+	}
+	host := r.pceFQDN
+	if host == "" {
+		host = f.hostname
+	}
+	msgID := r.eventType
+	if len(msgID) > 32 {
+		msgID = msgID[:32]
+	}
+	var msg string
+	if f.format == "cef" {
+		msg = cef(r, f.pceVersion)
+	} else {
+		b, err := json.Marshal(r.raw)
+		if err != nil {
+			return "", err
+		}
+		msg = string(b)
+	}
+	return fmt.Sprintf("<%d>1 %s %s illumio_pce - %s - %s", facility*8+sev, r.timestamp.UTC().Format("2006-01-02T15:04:05.000000Z"), nilValue(host), nilValue(msgID), msg), nil
+}
+
+// nilValue returns the syslog nil value for empty header fields
+func nilValue(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.ReplaceAll(s, " ", "_")
+}
+
+// cef returns the event as an ArcSight common event format record
+func cef(r record, pceVersion string) string {
+	header := strings.NewReplacer(`\`, `\\`, `|`, `\|`)
+	sev, ok := cefSeverity[strings.ToLower(r.severity)]
+	if !ok {
+		sev = cefSeverity["info"]
+	}
+	ext := []string{}
+	add := func(key, value string) {
+		if value == "" {
+			return
+		}
+		ext = append(ext, key+"="+strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`).Replace(value))
+	}
+	add("rt", strconv.FormatInt(r.timestamp.UnixMilli(), 10))
+	add("dvchost", r.pceFQDN)
+	add("cat", strings.SplitN(r.eventType, ".", 2)[0])
+	add("outcome", r.status)
+	add("suser", r.createdBy)
+	add("src", r.action("src_ip"))
+	add("requestMethod", r.action("api_method"))
+	add("request", r.action("api_endpoint"))
+	add("externalId", r.href)
+	return fmt.Sprintf("CEF:0|Illumio|PCE|%s|%s|%s|%d|%s", header.Replace(pceVersion), header.Replace(r.eventType), header.Replace(r.eventType), sev, strings.Join(ext, " "))
+}
@@ -0,0 +1,221 @@
+package exporter
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/cmd/venhealth"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+)
+
+var address, labelKeys string
+var refreshMinutes, eventHours, heartbeatHours int
+
+func init() {
+	ExporterCmd.Flags().StringVar(&address, "address", "127.0.0.1:9192", "address for the /metrics endpoint.")
+	ExporterCmd.Flags().IntVar(&refreshMinutes, "refresh", 5, "minutes between refreshing metrics from the pce.")
+	ExporterCmd.Flags().StringVar(&labelKeys, "label-keys", "app,env", "comma-separated label keys added as prometheus labels on workload metrics. each key multiplies the number of series so keep the list short.")
+	ExporterCmd.Flags().IntVar(&eventHours, "event-hours", 24, "hours of ven health events counted in each refresh.")
+	ExporterCmd.Flags().IntVar(&heartbeatHours, "heartbeat-hours", 1, "hours since last heartbeat for a ven to be counted as stale.")
+
+	ExporterCmd.Flags().SortFlags = false
+}
+
+// ExporterCmd runs the exporter command
+var ExporterCmd = &cobra.Command{
+	Use:   "exporter",
+	Short: "Serve PCE and VEN health metrics on a Prometheus /metrics endpoint.",
+	Long: `
+Serve PCE and VEN health metrics on a Prometheus /metrics endpoint.
+
+Metrics are refreshed from the PCE on an interval and the last refresh is served to every scrape. All metrics are gauges:
+- illumio_workloads - workloads by managed state, enforcement mode, and the label keys in --label-keys
+- illumio_vens_offline - managed workloads that are offline
+- illumio_vens_stale_heartbeat - managed workloads without a heartbeat for --heartbeat-hours
+- illumio_vens_policy_sync_state - managed workloads by security policy sync state
+- illumio_vens_agent_health - managed workloads by agent health type and severity
+- illumio_pending_provision - draft objects pending provisioning by object type
+- illumio_ven_health_events - ven health events by type over the last --event-hours. the event types are the same as ven-health.
+- illumio_exporter_refresh_success, illumio_exporter_refresh_duration_seconds, and illumio_exporter_last_refresh_timestamp_seconds
+
+Prometheus labels for label keys are prefixed with label_ (e.g., label_app). Workloads without a label for a key have an empty value.
+
+The update-pce and --no-prompt flags are ignored for this command.`,
+	Example: `# Serve metrics for the default pce
+workloader exporter
+
+# Prometheus scrape config
+scrape_configs:
+  - job_name: illumio
+    static_configs:
+      - targets: ["127.0.0.1:9192"]`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		if refreshMinutes < 1 {
+			utils.LogError("refresh must be at least 1 minute")
+		}
+
+		// Validate the pce before starting
+		if _, err := utils.GetTargetPCEV2(false); err != nil {
+			utils.LogError(err.Error())
+		}
+
+		serve()
+	},
+}
+
+type exporter struct {
+	mu         sync.Mutex
+	pceMetrics *metrics
+	output     string
+}
+
+func serve() {
+	e := &exporter{}
+
+	// Refresh on the interval in the background
+	e.refresh()
+	go func() {
+		for range time.Tick(time.Duration(refreshMinutes) * time.Minute) {
+			e.refresh()
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		e.mu.Lock()
+		output := e.output
+		e.mu.Unlock()
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprint(w, output)
+	})
+
+	utils.LogInfof(true, "serving metrics at http://%s/metrics. refreshing every %d minutes.", address, refreshMinutes)
+	if err := http.ListenAndServe(address, mux); err != nil {
+		utils.LogError(err.Error())
+	}
+}
+
+// refresh collects the metrics. A failed refresh keeps the previous pce metrics and sets refresh_success to 0.
+func (e *exporter) refresh() {
+	start := time.Now()
+	m, err := collect()
+	if err != nil {
+		utils.LogWarningf(true, "metrics refresh failed - %s", err)
+	}
+
+	status := newMetrics()
+	status.describe("illumio_exporter_refresh_success", "1 if the last refresh from the pce succeeded.")
+	status.describe("illumio_exporter_refresh_duration_seconds", "duration of the last refresh from the pce.")
+	status.describe("illumio_exporter_last_refresh_timestamp_seconds", "unix time of the last refresh attempt.")
+	status.set("illumio_exporter_refresh_success", 0)
+	status.set("illumio_exporter_refresh_duration_seconds", time.Since(start).Seconds())
+	status.set("illumio_exporter_last_refresh_timestamp_seconds", float64(start.Unix()))
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err == nil {
+		e.pceMetrics = m
+		status.set("illumio_exporter_refresh_success", 1)
+		utils.LogInfof(false, "metrics refreshed in %s", time.Since(start).Round(time.Millisecond))
+	}
+	e.output = status.render()
+	if e.pceMetrics != nil {
+		e.output = e.pceMetrics.render() + e.output
+	}
+}
+
+// collect gets the current metrics from the pce
+func collect() (*metrics, error) {
+	m := newMetrics()
+
+	// Get a fresh pce each refresh so objects are not carried over
+	pce, err := utils.GetTargetPCEV2(false)
+	if err != nil {
+		return nil, err
+	}
+	apiResps, err := pce.Load(illumioapi.LoadInput{Workloads: true, Labels: true}, utils.UseMulti())
+	utils.LogMultiAPIRespV2(apiResps)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	for _, k := range strings.Split(labelKeys, ",") {
+		if strings.TrimSpace(k) != "" {
+			keys = append(keys, strings.TrimSpace(k))
+		}
+	}
+
+	m.describe("illumio_workloads", "workloads by managed state, enforcement mode, and labels.")
+	m.describe("illumio_vens_offline", "managed workloads that are offline.")
+	m.describe("illumio_vens_stale_heartbeat", "managed workloads without a heartbeat within the threshold.")
+	m.describe("illumio_vens_policy_sync_state", "managed workloads by security policy sync state.")
+	m.describe("illumio_vens_agent_health", "managed workloads by agent health type and severity.")
+	m.set("illumio_vens_offline", 0)
+	m.set("illumio_vens_stale_heartbeat", 0, "threshold_hours", fmt.Sprintf("%d", heartbeatHours))
+
+	for _, w := range pce.WorkloadsSlice {
+		if illumioapi.PtrToVal(w.Deleted) {
+			continue
+		}
+		managed := w.Agent != nil && w.Agent.Href != ""
+
+		labels := []string{"managed", fmt.Sprintf("%t", managed), "enforcement_mode", w.GetMode()}
+		for _, k := range keys {
+			labels = append(labels, labelName(k), w.GetLabelByKey(k, pce.Labels).Value)
+		}
+		m.add("illumio_workloads", 1, labels...)
+
+		if !managed {
+			continue
+		}
+		if !illumioapi.PtrToVal(w.Online) {
+			m.add("illumio_vens_offline", 1)
+		}
+		if hours := w.HoursSinceLastHeartBeat(); hours == -9999 || hours > float64(heartbeatHours) {
+			m.add("illumio_vens_stale_heartbeat", 1, "threshold_hours", fmt.Sprintf("%d", heartbeatHours))
+		}
+		m.add("illumio_vens_policy_sync_state", 1, "state", w.Agent.Status.SecurityPolicySyncState)
+		for _, a := range illumioapi.PtrToVal(w.Agent.Status.AgentHealth) {
+			m.add("illumio_vens_agent_health", 1, "type", a.Type, "severity", a.Severity)
+		}
+	}
+
+	// Pending provisioning
+	m.describe("illumio_pending_provision", "draft objects pending provisioning by object type.")
+	var pending map[string]interface{}
+	api, err := pce.GetHref(fmt.Sprintf("/orgs/%d/sec_policy/pending", pce.Org), &pending)
+	utils.LogAPIRespV2("GetPending", api)
+	if err != nil {
+		return nil, err
+	}
+	for objectType, objects := range pending {
+		if list, ok := objects.([]interface{}); ok {
+			m.set("illumio_pending_provision", float64(len(list)), "object_type", objectType)
+		}
+	}
+
+	// VEN health events
+	m.describe("illumio_ven_health_events", "ven health events by type over the event window.")
+	qp := map[string]string{
+		"max_results":    "10000",
+		"timestamp[gte]": time.Now().Add(-time.Duration(eventHours) * time.Hour).Format(time.RFC3339),
+	}
+	for _, eventType := range venhealth.VenHealthEvents {
+		qp["event_type"] = eventType
+		events, api, err := pce.GetEvents(qp)
+		utils.LogAPIRespV2("GetEvents", api)
+		if err != nil {
+			return nil, fmt.Errorf("getting %s events - %s", eventType, err)
+		}
+		m.set("illumio_ven_health_events", float64(len(events)), "event_type", eventType, "window_hours", fmt.Sprintf("%d", eventHours))
+	}
+
+	return m, nil
+}
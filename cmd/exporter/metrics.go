@@ -0,0 +1,87 @@
+package exporter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// metric is a prometheus gauge with a value for each label set
+type metric struct {
+	name   string
+	help   string
+	values map[string]float64 // rendered label set -> value
+}
+
+// metrics is a set of gauges rendered in the prometheus text format
+type metrics struct {
+	order  []string
+	byName map[string]*metric
+}
+
+var invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// labelName converts a PCE label key to a valid prometheus label name
+func labelName(key string) string {
+	return "label_" + invalidLabelChars.ReplaceAllString(key, "_")
+}
+
+// escapeLabelValue escapes backslashes, quotes, and new lines per the text format
+func escapeLabelValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return strings.ReplaceAll(value, "\n", `\n`)
+}
+
+func newMetrics() *metrics {
+	return &metrics{byName: make(map[string]*metric)}
+}
+
+// describe registers a gauge so it is rendered with help text even when it has no values
+func (m *metrics) describe(name, help string) {
+	if _, ok := m.byName[name]; ok {
+		return
+	}
+	m.order = append(m.order, name)
+	m.byName[name] = &metric{name: name, help: help, values: make(map[string]float64)}
+}
+
+// set sets a gauge value. labels are key value pairs.
+func (m *metrics) set(name string, value float64, labels ...string) {
+	m.byName[name].values[renderLabels(labels)] = value
+}
+
+// add adds to a gauge value. labels are key value pairs.
+func (m *metrics) add(name string, value float64, labels ...string) {
+	m.byName[name].values[renderLabels(labels)] += value
+}
+
+func renderLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := []string{}
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], escapeLabelValue(labels[i+1])))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// render returns the metrics in the prometheus text exposition format
+func (m *metrics) render() string {
+	var b strings.Builder
+	for _, name := range m.order {
+		g := m.byName[name]
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+		labelSets := []string{}
+		for l := range g.values {
+			labelSets = append(labelSets, l)
+		}
+		sort.Strings(labelSets)
+		for _, l := range labelSets {
+			fmt.Fprintf(&b, "%s%s %g\n", g.name, l, g.values[l])
+		}
+	}
+	return b.String()
+}
@@ -323,7 +323,7 @@ func extract() {
 	traffic()
 
 	// Zip the extract folder
-	zipit(outDir, "pce-extract.zip")
+	utils.ZipDir(outDir, "pce-extract.zip")
 	utils.LogInfo(fmt.Sprintf("%s%spce-extract.zip created", fullPathOutDir, string(os.PathSeparator)), true)
 
 	// Remove the created directory
@@ -0,0 +1,84 @@
+package f5sync
+
+import (
+	"os"
+
+	"github.com/brian1917/illumioapi"
+	ia "github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Global variables
+var pce illumioapi.PCE
+var pceV2 ia.PCE
+var f5 F5
+var externalDataSet, partitions string
+var cleanup, noBindings, updatePCE, noPrompt bool
+var err error
+
+func init() {
+
+	F5SyncCmd.Flags().StringVarP(&f5.Server, "f5-server", "n", "", "f5 big-ip management address in format bigip.com or bigip.com:8443")
+	F5SyncCmd.Flags().StringVarP(&f5.User, "f5-user", "u", "", "f5 user")
+	F5SyncCmd.Flags().StringVarP(&f5.Password, "f5-pwd", "p", "", "f5 password. the F5_PASSWORD environment variable can be used instead.")
+	F5SyncCmd.Flags().BoolVarP(&f5.Insecure, "insecure", "i", false, "ignore ssl certificate validation when communicating with the f5.")
+	F5SyncCmd.Flags().StringVar(&partitions, "partitions", "", "comma-separated list of f5 partitions to sync. default is all partitions.")
+	F5SyncCmd.Flags().StringVarP(&externalDataSet, "externalDataSet", "e", "workloader-f5-sync", "external data set")
+	F5SyncCmd.Flags().BoolVarP(&cleanup, "cleanup", "c", true, "clean up virtual services (VIPs) and unmanaged workloads (SNAT IPs) in external data set that are no longer in the f5.")
+	F5SyncCmd.Flags().BoolVar(&noBindings, "no-bindings", false, "do not bind pool members to virtual services.")
+	F5SyncCmd.Flags().SortFlags = false
+
+}
+
+// F5SyncCmd runs the f5-sync command
+var F5SyncCmd = &cobra.Command{
+	Use:   "f5-sync",
+	Short: "Create an Illumio Virtual Service for each F5 virtual server, bind pool members, and create an unmanaged workload for each SNAT IP.",
+	Long: `
+Create an Illumio Virtual Service for each F5 virtual server, bind pool members, and create an unmanaged workload for each SNAT IP.
+
+Virtual servers, pools, SNAT pools, and self IPs are read from the BIG-IP iControl REST API. All created objects are in the external data set (default workloader-f5-sync) and only objects in that data set are updated or removed:
+- Virtual services are named by the virtual server's path without the /Common/ prefix (e.g., vs_web or tenant1/app/vs_web) and use the virtual server's IP and port. Virtual servers on any port use the All Services service. Virtual servers with an ip protocol of any use TCP and UDP.
+- Pool members that match a single PCE workload IP are bound to the virtual service. When the member port differs from the virtual server port, the binding includes a port override. Members that do not match a workload are logged and skipped.
+- Unmanaged workloads are created for each SNAT pool address used by a virtual server (hostname <address>-snat) and each self IP when a virtual server uses automap (hostname <self-ip-name>-self).
+
+The external data reference of each object is its f5 path (e.g., /Common/vs_web) so --partitions only updates and removes objects in the listed partitions. Unmanaged workloads created by earlier versions without a path reference are only removed by a sync without --partitions.
+
+Virtual services must be active to bind workloads so changes to virtual services are provisioned before bindings are created. Bindings for removed virtual services are deleted first.
+
+This version only supports single IP VIPs. Use workloader mock-f5 to run a local stub of the iControl REST API for testing.
+
+Recommended to run without --update-pce first to log of what will change.`,
+
+	Run: func(cmd *cobra.Command, args []string) {
+
+		pce, err = utils.GetTargetPCE(true)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		// Service bindings use the v2 api
+		pceV2, err = utils.GetTargetPCEV2(false)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+
+		if f5.Server == "" || f5.User == "" {
+			utils.LogError("--f5-server and --f5-user are required")
+		}
+		if f5.Password == "" {
+			f5.Password = os.Getenv("F5_PASSWORD")
+		}
+
+		// Login in to the f5
+		if err := f5.Login(); err != nil {
+			utils.LogError(err.Error())
+		}
+
+		updatePCE = viper.GetBool("update_pce")
+		noPrompt = viper.GetBool("no_prompt")
+
+		f5Sync()
+	},
+}
@@ -0,0 +1,258 @@
+package f5sync
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/brian1917/workloader/utils"
+)
+
+// F5 is a BIG-IP reached over iControl REST
+type F5 struct {
+	Server   string
+	User     string
+	Password string
+	Insecure bool
+	token    string
+	client   *http.Client
+}
+
+// Virtual is an ltm virtual server
+type Virtual struct {
+	Name                     string                   `json:"name"`
+	Partition                string                   `json:"partition"`
+	FullPath                 string                   `json:"fullPath"`
+	Destination              string                   `json:"destination"`
+	IPProtocol               string                   `json:"ipProtocol"`
+	Pool                     string                   `json:"pool,omitempty"`
+	SourceAddressTranslation SourceAddressTranslation `json:"sourceAddressTranslation,omitempty"`
+}
+
+// SourceAddressTranslation is the snat setting of a virtual server. Type is automap, snat, or none.
+type SourceAddressTranslation struct {
+	Type string `json:"type,omitempty"`
+	Pool string `json:"pool,omitempty"`
+}
+
+// Pool is an ltm pool with its members
+type Pool struct {
+	Name             string           `json:"name"`
+	FullPath         string           `json:"fullPath"`
+	MembersReference MembersReference `json:"membersReference,omitempty"`
+}
+
+// MembersReference is the expanded members subcollection of a pool
+type MembersReference struct {
+	Items []PoolMember `json:"items,omitempty"`
+}
+
+// PoolMember is a pool member. The name is address:port (address.port for ipv6).
+type PoolMember struct {
+	Name     string `json:"name"`
+	FullPath string `json:"fullPath"`
+	Address  string `json:"address"`
+}
+
+// SnatPool is an ltm snatpool. Members are the full paths of snat translation addresses.
+type SnatPool struct {
+	Name     string   `json:"name"`
+	FullPath string   `json:"fullPath"`
+	Members  []string `json:"members,omitempty"`
+}
+
+// SelfIP is a net self ip used by automap snat. The address includes the mask (e.g., 10.0.0.5/24).
+type SelfIP struct {
+	Name     string `json:"name"`
+	FullPath string `json:"fullPath"`
+	Address  string `json:"address"`
+	Floating string `json:"floating"`
+}
+
+// collection is the iControl REST list response
+type collection struct {
+	Items json.RawMessage `json:"items"`
+}
+
+// portNames are the service names BIG-IP can use in destinations and member names
+var portNames = map[string]int{"any": 0, "ftp": 21, "ssh": 22, "telnet": 23, "smtp": 25, "domain": 53, "http": 80, "pop3": 110, "ntp": 123, "imap": 143, "snmp": 161, "ldap": 389, "https": 443, "ldaps": 636, "mysql": 3306, "rdp": 3389}
+
+// baseURL adds https:// if the server does not include a scheme
+func (f *F5) baseURL() string {
+	if strings.HasPrefix(f.Server, "http://") || strings.HasPrefix(f.Server, "https://") {
+		return strings.TrimSuffix(f.Server, "/")
+	}
+	return "https://" + strings.TrimSuffix(f.Server, "/")
+}
+
+func (f *F5) do(method, path string, body interface{}, data interface{}) error {
+	if f.client == nil {
+		f.client = &http.Client{}
+		if f.Insecure {
+			f.client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+		}
+		f.client.Transport = utils.WrapTransport(f.client.Transport)
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, f.baseURL()+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if f.token != "" {
+		req.Header.Set("X-F5-Auth-Token", f.token)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	utils.LogDebug(fmt.Sprintf("f5 %s %s - %d", method, path, resp.StatusCode))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s - http status code of %d - %s", method, path, resp.StatusCode, respBody)
+	}
+	return json.Unmarshal(respBody, data)
+}
+
+// Login gets an auth token used for the other calls
+func (f *F5) Login() error {
+	var resp struct {
+		Token struct {
+			Token string `json:"token"`
+		} `json:"token"`
+	}
+	if err := f.do(http.MethodPost, "/mgmt/shared/authn/login", map[string]string{"username": f.User, "password": f.Password, "loginProviderName": "tmos"}, &resp); err != nil {
+		return fmt.Errorf("f5 login - %s", err)
+	}
+	if resp.Token.Token == "" {
+		return fmt.Errorf("f5 login did not return a token")
+	}
+	f.token = resp.Token.Token
+	return nil
+}
+
+// getCollection gets an iControl REST collection into items
+func (f *F5) getCollection(path string, items interface{}) error {
+	var c collection
+	if err := f.do(http.MethodGet, path, nil, &c); err != nil {
+		return err
+	}
+	if len(c.Items) == 0 {
+		return nil
+	}
+	return json.Unmarshal(c.Items, items)
+}
+
+// GetVirtualServers gets the ltm virtual servers
+func (f *F5) GetVirtualServers() ([]Virtual, error) {
+	virtuals := []Virtual{}
+	return virtuals, f.getCollection("/mgmt/tm/ltm/virtual", &virtuals)
+}
+
+// GetPools gets the ltm pools with members keyed by full path
+func (f *F5) GetPools() (map[string]Pool, error) {
+	pools := []Pool{}
+	if err := f.getCollection("/mgmt/tm/ltm/pool?expandSubcollections=true", &pools); err != nil {
+		return nil, err
+	}
+	poolMap := make(map[string]Pool)
+	for _, p := range pools {
+		poolMap[p.FullPath] = p
+	}
+	return poolMap, nil
+}
+
+// GetSnatPools gets the ltm snatpools keyed by full path
+func (f *F5) GetSnatPools() (map[string]SnatPool, error) {
+	snatPools := []SnatPool{}
+	if err := f.getCollection("/mgmt/tm/ltm/snatpool", &snatPools); err != nil {
+		return nil, err
+	}
+	snatPoolMap := make(map[string]SnatPool)
+	for _, s := range snatPools {
+		snatPoolMap[s.FullPath] = s
+	}
+	return snatPoolMap, nil
+}
+
+// GetSelfIPs gets the net self ips
+func (f *F5) GetSelfIPs() ([]SelfIP, error) {
+	selfIPs := []SelfIP{}
+	return selfIPs, f.getCollection("/mgmt/tm/net/self", &selfIPs)
+}
+
+// stripPath removes the partition and folder from a full path
+func stripPath(fullPath string) string {
+	return fullPath[strings.LastIndex(fullPath, "/")+1:]
+}
+
+// cleanAddress removes the route domain (e.g., 10.0.0.1%2) and mask from an address
+func cleanAddress(address string) string {
+	address = strings.Split(address, "/")[0]
+	return strings.Split(address, "%")[0]
+}
+
+// parseAddressPort parses a destination or member name in the form address:port for ipv4 or address.port for ipv6.
+// A port of 0 is any port.
+func parseAddressPort(value string) (string, int, error) {
+	value = stripPath(value)
+	sep := ":"
+	if strings.Count(value, ":") > 1 {
+		sep = "."
+	}
+	i := strings.LastIndex(value, sep)
+	if i < 0 {
+		return "", 0, fmt.Errorf("%s does not include a port", value)
+	}
+	address, portStr := cleanAddress(value[:i]), value[i+1:]
+	if net.ParseIP(address) == nil {
+		return "", 0, fmt.Errorf("%s is not a valid ip address", address)
+	}
+	if port, ok := portNames[portStr]; ok {
+		return address, port, nil
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 0 || port > 65535 {
+		return "", 0, fmt.Errorf("%s is not a valid port", portStr)
+	}
+	return address, port, nil
+}
+
+// SnatTranslation is an ltm snat translation address used in snatpools
+type SnatTranslation struct {
+	Name     string `json:"name"`
+	FullPath string `json:"fullPath"`
+	Address  string `json:"address"`
+}
+
+// GetSnatTranslations gets the ltm snat translation addresses keyed by full path
+func (f *F5) GetSnatTranslations() (map[string]SnatTranslation, error) {
+	translations := []SnatTranslation{}
+	if err := f.getCollection("/mgmt/tm/ltm/snat-translation", &translations); err != nil {
+		return nil, err
+	}
+	translationMap := make(map[string]SnatTranslation)
+	for _, t := range translations {
+		translationMap[t.FullPath] = t
+	}
+	return translationMap, nil
+}
@@ -0,0 +1,569 @@
+package f5sync
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/brian1917/illumioapi"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/viper"
+)
+
+// hrefObject is an object reference in a service binding
+type hrefObject struct {
+	Href string `json:"href"`
+}
+
+// portOverride maps a virtual service port to the port on the bound workload
+type portOverride struct {
+	Port     int `json:"port"`
+	Protocol int `json:"proto"`
+	NewPort  int `json:"new_port"`
+}
+
+// serviceBinding binds a workload to a virtual service
+type serviceBinding struct {
+	Href           string         `json:"href,omitempty"`
+	VirtualService hrefObject     `json:"virtual_service"`
+	Workload       *hrefObject    `json:"workload,omitempty"`
+	PortOverrides  []portOverride `json:"port_overrides,omitempty"`
+}
+
+// key identifies a binding by workload and port overrides
+func (b serviceBinding) key() string {
+	overrides := []string{}
+	for _, o := range b.PortOverrides {
+		overrides = append(overrides, fmt.Sprintf("%d/%d/%d", o.Port, o.Protocol, o.NewPort))
+	}
+	sort.Strings(overrides)
+	href := ""
+	if b.Workload != nil {
+		href = b.Workload.Href
+	}
+	return href + "|" + strings.Join(overrides, ";")
+}
+
+// vsName is the virtual service name for a virtual server. /Common/ is removed.
+func vsName(v Virtual) string {
+	return strings.TrimPrefix(strings.TrimPrefix(v.FullPath, "/"), "Common/")
+}
+
+// vsPartition is the f5 partition of a virtual service. The external data reference is the virtual server's full path.
+// Virtual services created before the reference was the path use the name. Names without a path are in /Common/.
+func vsPartition(vs illumioapi.VirtualService) string {
+	if p := pathPartition(vs.ExternalDataReference); p != "" {
+		return p
+	}
+	if !strings.Contains(vs.Name, "/") {
+		return "Common"
+	}
+	return strings.Split(vs.Name, "/")[0]
+}
+
+// pathPartition is the f5 partition of a full path (e.g., /Tenant1/10.0.0.1). Paths without a partition return a blank string.
+func pathPartition(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		return ""
+	}
+	return strings.Split(strings.TrimPrefix(path, "/"), "/")[0]
+}
+
+// activeHref is the active version of a virtual service href. Bindings reference active virtual services.
+func activeHref(href string) string {
+	return strings.Replace(href, "/sec_policy/draft/", "/sec_policy/active/", 1)
+}
+
+// inPartition checks the partitions flag
+func inPartition(partition string) bool {
+	if partitions == "" {
+		return true
+	}
+	for _, p := range strings.Split(partitions, ",") {
+		if strings.TrimSpace(p) == partition {
+			return true
+		}
+	}
+	return false
+}
+
+func f5Sync() {
+
+	// Get all the Virtual Services in Illumio
+	pceVirtualServices, api, err := pce.GetVirtualServices(nil, "draft")
+	utils.LogAPIResp("GetVirtualServices", api)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	pceVSMap := make(map[string]illumioapi.VirtualService)
+	for _, vs := range pceVirtualServices {
+		pceVSMap[vs.Name] = vs
+	}
+	utils.LogInfo(fmt.Sprintf("get illumio virtual services - %d", api.StatusCode), true)
+
+	// Get all workloads. Unmanaged workloads in the external data set are the SNAT IPs. Others are used to match pool members.
+	pceWklds, api, err := pce.GetWklds(nil)
+	utils.LogAPIResp("GetWklds", api)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	pceUMWLMap := make(map[string]illumioapi.Workload)
+	wkldsByIP := make(map[string][]illumioapi.Workload)
+	for _, w := range pceWklds {
+		if utils.PtrToStr(w.ExternalDataSet) == externalDataSet {
+			pceUMWLMap[w.Hostname] = w
+			continue
+		}
+		for _, i := range w.Interfaces {
+			wkldsByIP[i.Address] = append(wkldsByIP[i.Address], w)
+		}
+	}
+	utils.LogInfo(fmt.Sprintf("get illumio workloads - %d", api.StatusCode), true)
+
+	// Get the F5 objects
+	f5Virtuals, err := f5.GetVirtualServers()
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	utils.LogInfo(fmt.Sprintf("get f5 virtual servers - %d", len(f5Virtuals)), true)
+	f5Pools, err := f5.GetPools()
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	utils.LogInfo(fmt.Sprintf("get f5 pools - %d", len(f5Pools)), true)
+	f5SnatPools, err := f5.GetSnatPools()
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	f5SnatTranslations, err := f5.GetSnatTranslations()
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	utils.LogInfo(fmt.Sprintf("get f5 snat pools - %d", len(f5SnatPools)), true)
+
+	// Create slices for create and updates
+	var createVirtualServices, updateVirtualServices, removeVirtualServices []illumioapi.VirtualService
+	var createUMWLs, updateUMWLs, removeUMWLs []illumioapi.Workload
+	f5VirtualMap := make(map[string]Virtual)
+	snatIPs := make(map[string]string)   // hostname -> ip
+	snatPaths := make(map[string]string) // hostname -> f5 full path. used as the external data reference to know the partition.
+	automap := false
+	desiredBindings := make(map[string][]serviceBinding) // virtual service name -> bindings
+
+	// Iterate through each f5 virtual server
+	fmt.Println()
+	utils.LogInfo("processing f5 virtual servers...", true)
+	for _, v := range f5Virtuals {
+		if !inPartition(v.Partition) {
+			continue
+		}
+		name := vsName(v)
+		ip, port, err := parseAddressPort(v.Destination)
+		if err != nil {
+			utils.LogWarning(fmt.Sprintf("%s - destination %s - %s. skipping", name, v.Destination, err), true)
+			continue
+		}
+		f5VirtualMap[name] = v
+		servicePorts := getServicePorts(port, v.IPProtocol)
+
+		// SNAT addresses used by the virtual server
+		switch strings.ToLower(v.SourceAddressTranslation.Type) {
+		case "automap":
+			automap = true
+		case "snat":
+			for _, member := range f5SnatPools[v.SourceAddressTranslation.Pool].Members {
+				address := cleanAddress(stripPath(member))
+				if t, ok := f5SnatTranslations[member]; ok {
+					address = cleanAddress(t.Address)
+				}
+				snatIPs[fmt.Sprintf("%s-snat", stripPath(member))] = address
+				snatPaths[fmt.Sprintf("%s-snat", stripPath(member))] = member
+			}
+		}
+
+		// Pool members that map to workloads
+		if v.Pool != "" && !noBindings {
+			for _, member := range f5Pools[v.Pool].MembersReference.Items {
+				memberIP, memberPort, err := parseAddressPort(member.Name)
+				if err != nil {
+					utils.LogWarning(fmt.Sprintf("%s - pool member %s - %s. skipping", name, member.Name, err), false)
+					continue
+				}
+				if member.Address != "" {
+					memberIP = cleanAddress(member.Address)
+				}
+				wklds := wkldsByIP[memberIP]
+				if len(wklds) != 1 {
+					utils.LogInfo(fmt.Sprintf("%s - pool member %s matches %d workloads. it will not be bound.", name, member.Name, len(wklds)), false)
+					continue
+				}
+				b := serviceBinding{Workload: &hrefObject{Href: wklds[0].Href}}
+				for _, sp := range servicePorts {
+					if memberPort != 0 && memberPort != sp.Port {
+						b.PortOverrides = append(b.PortOverrides, portOverride{Port: sp.Port, Protocol: sp.Protocol, NewPort: memberPort})
+					}
+				}
+				desiredBindings[name] = append(desiredBindings[name], b)
+			}
+		}
+
+		if virtualService, exists := pceVSMap[name]; exists {
+			// If it exists, first check if it's managed by workloader
+			if virtualService.ExternalDataSet != externalDataSet {
+				utils.LogWarning(fmt.Sprintf("%s exists in the pce with an external datast of %s. workloader is managing %s. skipping.", virtualService.Name, virtualService.ExternalDataSet, externalDataSet), true)
+				delete(desiredBindings, name)
+				continue
+			}
+			// Check to see if we have to update it.
+			update := false
+			msgSlice := []string{}
+			// Check IP address
+			if len(virtualService.IPOverrides) == 0 || ip != virtualService.IPOverrides[0] {
+				update = true
+				msgSlice = append(msgSlice, fmt.Sprintf("ip address to be updated from %s to %s", strings.Join(virtualService.IPOverrides, ";"), ip))
+			}
+			// Check ports
+			if servicePortsString(virtualService.ServicePorts) != servicePortsString(servicePorts) || (virtualService.Service != nil) != (port == 0) {
+				update = true
+				msgSlice = append(msgSlice, fmt.Sprintf("ports to be updated from %s to %s", servicePortsString(virtualService.ServicePorts), servicePortsString(servicePorts)))
+			}
+			// Log the pending update, edit the virtual service, and append to the update list
+			if update {
+				utils.LogInfo(fmt.Sprintf("%s exists but requires updates - %s", name, strings.Join(msgSlice, ". ")), true)
+				virtualService.Service = getService(port)
+				virtualService.ServicePorts = servicePorts
+				virtualService.IPOverrides = []string{ip}
+				updateVirtualServices = append(updateVirtualServices, virtualService)
+			} else {
+				utils.LogInfo(fmt.Sprintf("%s already exists and requires no changes", virtualService.Name), true)
+			}
+		} else {
+			// Log the pending create and append
+			utils.LogInfo(fmt.Sprintf("%s to be created - port: %d - ip: %s", name, port, ip), true)
+			createVirtualServices = append(createVirtualServices, illumioapi.VirtualService{Name: name, IPOverrides: []string{ip}, Service: getService(port), ServicePorts: servicePorts, ExternalDataSet: externalDataSet, ExternalDataReference: v.FullPath})
+		}
+	}
+
+	// Self IPs are the SNAT addresses when automap is used
+	if automap {
+		selfIPs, err := f5.GetSelfIPs()
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		for _, s := range selfIPs {
+			if inPartition(pathPartition(s.FullPath)) {
+				snatIPs[fmt.Sprintf("%s-self", stripPath(s.FullPath))] = cleanAddress(s.Address)
+				snatPaths[fmt.Sprintf("%s-self", stripPath(s.FullPath))] = s.FullPath
+			}
+		}
+	}
+
+	// Iterate through each snat IP
+	fmt.Println()
+	utils.LogInfo("processing f5 SNAT IPs...", true)
+	hostnames := []string{}
+	for hostname := range snatIPs {
+		hostnames = append(hostnames, hostname)
+	}
+	sort.Strings(hostnames)
+	for _, hostname := range hostnames {
+		snatIP := snatIPs[hostname]
+		if wkld, exists := pceUMWLMap[hostname]; exists {
+			// If it exists, check if it needs to be updated. Workloads created before partitions were tracked get the f5 path as the reference.
+			if len(wkld.Interfaces) == 0 || wkld.Interfaces[0].Address != snatIP || utils.PtrToStr(wkld.ExternalDataReference) != snatPaths[hostname] {
+				utils.LogInfo(fmt.Sprintf("%s exists but requires updates - ip to be %s and external data reference to be %s", hostname, snatIP, snatPaths[hostname]), true)
+				wkld.Interfaces = []*illumioapi.Interface{{Address: snatIP, Name: "umwl0"}}
+				wkld.ExternalDataReference = utils.StrToPtr(snatPaths[hostname])
+				updateUMWLs = append(updateUMWLs, wkld)
+			}
+		} else {
+			// If it does not exist, create the workload
+			utils.LogInfo(fmt.Sprintf("%s to be created - ip: %s", hostname, snatIP), true)
+			createUMWLs = append(createUMWLs, illumioapi.Workload{Hostname: hostname, Interfaces: []*illumioapi.Interface{{Address: snatIP, Name: "umwl0"}}, ExternalDataSet: utils.StrToPtr(externalDataSet), ExternalDataReference: utils.StrToPtr(snatPaths[hostname])})
+		}
+	}
+
+	// Check the PCE virtual services that should be removed. Objects outside the partitions are not removed.
+	if cleanup {
+		fmt.Println()
+		utils.LogInfo("processing pce virtual services that should be removed because virtual server no longer exists...", true)
+		for _, pceVS := range pceVirtualServices {
+			// Only process if it's in the external dataset
+			if pceVS.ExternalDataSet != externalDataSet || !inPartition(vsPartition(pceVS)) {
+				continue
+			}
+			if _, exists := f5VirtualMap[pceVS.Name]; !exists {
+				utils.LogInfo(fmt.Sprintf("%s - %s - to be deleted", pceVS.Name, pceVS.Href), true)
+				removeVirtualServices = append(removeVirtualServices, pceVS)
+			}
+		}
+
+		// Check for UMWLs that should be removed
+		fmt.Println()
+		utils.LogInfo("processing pce unmanaged workloads that should be removed because SNAT IP no longer exists...", true)
+		for _, pceUMWL := range pceUMWLMap {
+			if _, exists := snatIPs[pceUMWL.Hostname]; exists {
+				continue
+			}
+			partition := pathPartition(utils.PtrToStr(pceUMWL.ExternalDataReference))
+			if partitions != "" && partition == "" {
+				utils.LogInfo(fmt.Sprintf("%s - %s - partition unknown from external data reference %s. skipping removal with --partitions.", pceUMWL.Hostname, pceUMWL.Href, utils.PtrToStr(pceUMWL.ExternalDataReference)), true)
+				continue
+			}
+			if inPartition(partition) {
+				utils.LogInfo(fmt.Sprintf("%s - %s - to be deleted", pceUMWL.Hostname, pceUMWL.Href), true)
+				removeUMWLs = append(removeUMWLs, pceUMWL)
+			}
+		}
+	}
+
+	// Compare bindings on existing virtual services. Virtual services being removed have all bindings removed.
+	fmt.Println()
+	utils.LogInfo("processing virtual service bindings...", true)
+	createBindings := make(map[string][]serviceBinding) // virtual service name -> bindings
+	var removeBindings []serviceBinding
+	createBindingCount := 0
+	removeVSNames := make(map[string]bool)
+	for _, vs := range removeVirtualServices {
+		removeVSNames[vs.Name] = true
+	}
+	for _, vs := range pceVirtualServices {
+		if vs.ExternalDataSet != externalDataSet || !inPartition(vsPartition(vs)) || (noBindings && !removeVSNames[vs.Name]) {
+			continue
+		}
+		existing, err := getBindings(vs.Href)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		desired := make(map[string]bool)
+		for _, b := range desiredBindings[vs.Name] {
+			desired[b.key()] = true
+		}
+		found := make(map[string]bool)
+		for _, b := range existing {
+			found[b.key()] = true
+			if !desired[b.key()] || removeVSNames[vs.Name] {
+				utils.LogInfo(fmt.Sprintf("%s - binding %s - to be deleted", vs.Name, b.Href), false)
+				removeBindings = append(removeBindings, b)
+			}
+		}
+		for _, b := range desiredBindings[vs.Name] {
+			if !found[b.key()] {
+				utils.LogInfo(fmt.Sprintf("%s - binding for %s - to be created", vs.Name, b.Workload.Href), false)
+				createBindings[vs.Name] = append(createBindings[vs.Name], b)
+				createBindingCount++
+			}
+		}
+	}
+	// All bindings for virtual services to be created
+	for _, vs := range createVirtualServices {
+		for _, b := range desiredBindings[vs.Name] {
+			utils.LogInfo(fmt.Sprintf("%s - binding for %s - to be created", vs.Name, b.Workload.Href), false)
+		}
+		createBindings[vs.Name] = desiredBindings[vs.Name]
+		createBindingCount += len(desiredBindings[vs.Name])
+	}
+	utils.LogInfo(fmt.Sprintf("%d bindings to be created and %d bindings to be deleted. see workloader.log for details.", createBindingCount, len(removeBindings)), true)
+	fmt.Println()
+
+	// If updatePCE is disabled, we are just going to alert the user what will happen and log
+	if !updatePCE {
+		utils.LogInfo("See workloader.log for more details. To do the import, run again using --update-pce flag.", true)
+
+		return
+	}
+
+	// If updatePCE is set, but not noPrompt, we will prompt the user.
+	if updatePCE && !noPrompt {
+		var prompt string
+		fmt.Printf("\r\n%s [PROMPT] - workloader will create %d virtual services (vips), create %d unmanaged workloads (snats), update %d virtual services (vips), update %d unmanaged workloads (snats), remove %d virtual services (vips), remove %d unmanaged workloads (snats), create %d bindings, and remove %d bindings in %s (%s). do you want to run the import (yes/no)? ", time.Now().Format("2006-01-02 15:04:05 "), len(createVirtualServices), len(createUMWLs), len(updateVirtualServices), len(updateUMWLs), len(removeVirtualServices), len(removeUMWLs), createBindingCount, len(removeBindings), pce.FriendlyName, viper.GetString(pce.FriendlyName+".fqdn"))
+		fmt.Scanln(&prompt)
+		if strings.ToLower(prompt) != "yes" {
+			utils.LogInfo("prompt denied.", true)
+
+			return
+		}
+	}
+
+	// Delete bindings first so removed virtual services do not have bound workloads
+	for _, b := range removeBindings {
+		api, err := pceV2.DeleteHref(b.Href)
+		utils.LogAPIRespV2("DeleteHref", api)
+		if err != nil {
+			utils.LogWarning(fmt.Sprintf("error deleting binding %s - %d status code - %s", b.Href, api.StatusCode, api.RespBody), true)
+			continue
+		}
+		utils.LogInfo(fmt.Sprintf("delete binding %s", b.Href), true)
+	}
+
+	provisionHrefs := []string{}
+	vsHrefs := make(map[string]string)
+	for _, vs := range pceVirtualServices {
+		vsHrefs[vs.Name] = vs.Href
+	}
+
+	// Create the virtual services
+	for _, vs := range createVirtualServices {
+		newVS, api, _ := pce.CreateVirtualService(vs)
+		utils.LogAPIResp("CreateVirutalService", api)
+		if api.StatusCode > 200 && api.StatusCode < 300 {
+			utils.LogInfo(fmt.Sprintf("created %s - %s", newVS.Name, newVS.Href), true)
+			provisionHrefs = append(provisionHrefs, newVS.Href)
+			vsHrefs[vs.Name] = newVS.Href
+		} else {
+			utils.LogWarning(fmt.Sprintf("error creating %s - %d status code - %s", vs.Name, api.StatusCode, api.RespBody), true)
+		}
+	}
+
+	// Create the unmanaged workloads
+	for _, wkld := range createUMWLs {
+		newWkld, api, _ := pce.CreateWkld(wkld)
+		utils.LogAPIResp("CreateWkld", api)
+		if api.StatusCode > 200 && api.StatusCode < 300 {
+			utils.LogInfo(fmt.Sprintf("created %s - %s", newWkld.Hostname, newWkld.Href), true)
+		} else {
+			utils.LogWarning(fmt.Sprintf("error creating %s - %d status code - %s", wkld.Hostname, api.StatusCode, api.RespBody), true)
+		}
+	}
+
+	// Update the virtual services
+	for _, vs := range updateVirtualServices {
+		api, _ := pce.UpdateVirtualService(vs)
+		utils.LogAPIResp("UpdateVirtualService", api)
+		if api.StatusCode > 199 && api.StatusCode < 300 {
+			utils.LogInfo(fmt.Sprintf("update %s - %s", vs.Name, vs.Href), true)
+			provisionHrefs = append(provisionHrefs, vs.Href)
+		} else {
+			utils.LogWarning(fmt.Sprintf("error updating %s - %d status code - %s", vs.Name, api.StatusCode, api.RespBody), true)
+		}
+	}
+
+	// Update the workloads
+	for _, wkld := range updateUMWLs {
+		api, _ := pce.UpdateWkld(wkld)
+		utils.LogAPIResp("UpdateWkld", api)
+		if api.StatusCode > 199 && api.StatusCode < 300 {
+			utils.LogInfo(fmt.Sprintf("update %s - %s", wkld.Hostname, wkld.Href), true)
+		} else {
+			utils.LogWarning(fmt.Sprintf("error updating %s - %d status code - %s", wkld.Hostname, api.StatusCode, api.RespBody), true)
+		}
+	}
+
+	// Delete virtual services
+	for _, vs := range removeVirtualServices {
+		api, _ := pce.DeleteHref(vs.Href)
+		utils.LogAPIResp("DeleteHref", api)
+		if api.StatusCode > 199 && api.StatusCode < 300 {
+			utils.LogInfo(fmt.Sprintf("delete %s - %s", vs.Name, vs.Href), true)
+			provisionHrefs = append(provisionHrefs, vs.Href)
+		} else {
+			utils.LogWarning(fmt.Sprintf("error deleting %s - %d status code - %s", vs.Name, api.StatusCode, api.RespBody), true)
+		}
+	}
+
+	// Delete unmanaged workloads
+	for _, wkld := range removeUMWLs {
+		api, _ := pce.DeleteHref(wkld.Href)
+		utils.LogAPIResp("DeleteHref", api)
+		if api.StatusCode > 199 && api.StatusCode < 300 {
+			utils.LogInfo(fmt.Sprintf("delete %s - %s", wkld.Hostname, wkld.Href), true)
+		} else {
+			utils.LogWarning(fmt.Sprintf("error deleting %s - %d status code - %s", wkld.Hostname, api.StatusCode, api.RespBody), true)
+		}
+	}
+
+	// Provision changes to Virtual Services
+	if len(provisionHrefs) > 0 {
+		api, err = pce.ProvisionHref(provisionHrefs, "workloader f5-sync")
+		utils.LogAPIResp("ProvisionHref", api)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		utils.LogInfo(fmt.Sprintf("provisioning virtual service changes - %d", api.StatusCode), true)
+	}
+
+	// Create the bindings now that the virtual services are active
+	names := []string{}
+	for name := range createBindings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		bindings := createBindings[name]
+		if len(bindings) == 0 {
+			continue
+		}
+		if vsHrefs[name] == "" {
+			utils.LogWarning(fmt.Sprintf("%s was not created. skipping %d bindings.", name, len(bindings)), true)
+			continue
+		}
+		for i := range bindings {
+			bindings[i].VirtualService = hrefObject{Href: activeHref(vsHrefs[name])}
+		}
+		var created []serviceBinding
+		api, err := pceV2.Post("service_bindings", bindings, &created)
+		utils.LogAPIRespV2("CreateServiceBinding", api)
+		if err != nil {
+			utils.LogWarning(fmt.Sprintf("error binding %d workloads to %s - %d status code - %s", len(bindings), name, api.StatusCode, api.RespBody), true)
+			continue
+		}
+		utils.LogInfo(fmt.Sprintf("bound %d workloads to %s", len(bindings), name), true)
+	}
+}
+
+// getBindings gets the service bindings of a virtual service
+func getBindings(vsHref string) ([]serviceBinding, error) {
+	bindings := []serviceBinding{}
+	api, err := pceV2.GetHref(fmt.Sprintf("/orgs/%d/service_bindings?virtual_service=%s", pceV2.Org, url.QueryEscape(activeHref(vsHref))), &bindings)
+	utils.LogAPIRespV2("GetServiceBindings", api)
+	if err != nil {
+		return nil, fmt.Errorf("getting bindings for %s - %s", vsHref, err)
+	}
+	return bindings, nil
+}
+
+// getService returns the All Services service for virtual servers on any port
+func getService(port int) *illumioapi.Service {
+	if port != 0 {
+		return nil
+	}
+	services, api, err := pce.GetServices(map[string]string{"name": "All Services"}, "draft")
+	utils.LogAPIResp("GetServices", api)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	if len(services) == 0 {
+		utils.LogErrorf("the All Services service does not exist in the pce. it is required for virtual servers on any port.")
+	}
+	return &illumioapi.Service{Href: services[0].Href}
+}
+
+// getServicePorts returns the ServicePorts for the virtual server's port and ip protocol.
+// Any port uses All Services so there are no service ports.
+func getServicePorts(port int, ipProtocol string) []*illumioapi.ServicePort {
+	if port == 0 {
+		return nil
+	}
+	switch strings.ToLower(ipProtocol) {
+	case "udp":
+		return []*illumioapi.ServicePort{{Port: port, Protocol: 17}}
+	case "sctp":
+		return []*illumioapi.ServicePort{{Port: port, Protocol: 132}}
+	case "any":
+		return []*illumioapi.ServicePort{{Port: port, Protocol: 6}, {Port: port, Protocol: 17}}
+	default:
+		return []*illumioapi.ServicePort{{Port: port, Protocol: 6}}
+	}
+}
+
+// servicePortsString is used to compare service ports
+func servicePortsString(servicePorts []*illumioapi.ServicePort) string {
+	ports := []string{}
+	for _, sp := range servicePorts {
+		ports = append(ports, fmt.Sprintf("%d/%d", sp.Port, sp.Protocol))
+	}
+	sort.Strings(ports)
+	return strings.Join(ports, ";")
+}
@@ -19,12 +19,23 @@ import (
 // Global variables
 var pce illumioapi.PCE
 var err error
-var csvFile string
-var noHeader bool
+var csvFile, format, start, end string
+var noHeader, keepDuplicates, dedupeCSV, excludeDenied bool
+
+func init() {
+	FlowImportCmd.Flags().StringVarP(&format, "format", "f", "csv", "format of the input files. options are csv, zeek, netflow, aws-vpc, azure-nsg, and pan.")
+	FlowImportCmd.Flags().StringVarP(&start, "start", "s", "", "only import flows that started at or after this time. RFC 3339, yyyy-mm-dd hh:mm:ss (UTC), or yyyy-mm-dd (UTC) format. not used with csv format.")
+	FlowImportCmd.Flags().StringVarP(&end, "end", "e", "", "only import flows that started before this time. same formats as start. not used with csv format.")
+	FlowImportCmd.Flags().BoolVar(&keepDuplicates, "keep-duplicates", false, "upload every record instead of one flow per unique source, destination, port, and protocol. not used with csv format.")
+	FlowImportCmd.Flags().BoolVar(&dedupeCSV, "dedupe", false, "upload one flow per unique source, destination, port, and protocol for the csv format. other formats are always de-duplicated unless --keep-duplicates is used.")
+	FlowImportCmd.Flags().BoolVar(&excludeDenied, "exclude-denied", false, "skip flows the source logged as denied or rejected (aws-vpc, azure-nsg, and pan formats).")
+
+	FlowImportCmd.Flags().SortFlags = false
+}
 
 // FlowImportCmd runs the upload command
 var FlowImportCmd = &cobra.Command{
-	Use:   "flow-import [csv file with flows]",
+	Use:   "flow-import [files with flows]",
 	Short: "Upload flows from CSV file to the PCE.",
 	Long: `
 Upload flows from CSV file to the PCE.
@@ -49,6 +60,15 @@ Example input:
 | asset-mgt-web2 |  ntp-1          |   123 |  17    |
 +----------------+-----------------+-------+--------+
 
+Network telemetry can be imported with the --format flag instead of a CSV. More than one file can be provided and gzipped files are decompressed. Each record is normalized to source IP, destination IP, destination port, and protocol:
+- zeek: Zeek conn.log in the default tab-separated format or json lines. The originator is the source.
+- netflow: pcap capture of NetFlow v9 or IPFIX export packets or an IPFIX file (RFC 5655). Templates must be in the capture. pcapng files must be saved as pcap.
+- aws-vpc: AWS VPC flow logs. A header row is used for custom log formats. Without a header the default version 2 format is expected. NODATA and SKIPDATA records are skipped. The response direction of a connection is logged as a separate flow.
+- azure-nsg: Azure NSG flow logs (version 1 or 2) and VNet flow logs as written to the storage account.
+- pan: traffic log CSV exported from the PAN-OS or Panorama web interface. Times are read in the local time zone.
+
+Protocols without ports (e.g., ICMP) use port 0. Use --start and --end to only import flows that started in a time window. Flows from these formats are de-duplicated on source, destination, port, and protocol unless --keep-duplicates is used. Rows in the csv format are uploaded as is unless --dedupe is used.
+
 The update-pce and --no-prompt flags are ignored for this command.`,
 
 	Run: func(cmd *cobra.Command, args []string) {
@@ -59,27 +79,27 @@ The update-pce and --no-prompt flags are ignored for this command.`,
 		}
 
 		// Get csv file
-		if len(args) != 1 {
-			fmt.Println("Command requires 1 argument for the csv file. See usage help.")
+		if len(args) < 1 {
+			fmt.Println("Command requires at least 1 argument for the file with flows. See usage help.")
 			os.Exit(0)
 		}
-		csvFile = args[0]
 
-		uploadFlows()
+		// Validate the format and time window
+		if _, ok := formats[format]; !ok && format != "csv" {
+			utils.LogError(fmt.Sprintf("%s is not a valid format. options are csv, zeek, netflow, aws-vpc, azure-nsg, and pan.", format))
+		}
+		if format == "csv" && (start != "" || end != "") {
+			utils.LogError("--start and --end cannot be used with the csv format because it does not have timestamps.")
+		}
+
+		uploadFlows(args)
 	},
 }
 
-func uploadFlows() {
+// csvRecords reads the 4 column csv and resolves hostnames to ip addresses
+func csvRecords(csvFile string) []flowRecord {
 
-	// Get all workloads in a map by hostname
-	_, a, err := pce.GetWklds(nil)
-	utils.LogAPIResp("GetWkldHostMap", a)
-	if err != nil {
-		utils.LogError(err.Error())
-	}
-
-	// Set the header for the new csv file
-	newCSVData := [][]string{{"src", "dst", "port", "protocol"}}
+	records := []flowRecord{}
 
 	// Open CSV File
 	file, err := os.Open(csvFile)
@@ -158,8 +178,89 @@ func uploadFlows() {
 			proto = "17"
 		}
 
-		// Add to CSV array
-		newCSVData = append(newCSVData, []string{src, dst, line[2], proto})
+		// Add to records
+		records = append(records, flowRecord{Src: src, Dst: dst, Port: line[2], Proto: proto})
+	}
+
+	return records
+}
+
+func uploadFlows(files []string) {
+
+	// Parse the time window
+	var startTime, endTime time.Time
+	if start != "" {
+		if startTime, err = parseTimeFlag(start); err != nil {
+			utils.LogError(err.Error())
+		}
+	}
+	if end != "" {
+		if endTime, err = parseTimeFlag(end); err != nil {
+			utils.LogError(err.Error())
+		}
+	}
+
+	// Get all workloads in a map by hostname for the csv format
+	if format == "csv" {
+		_, a, err := pce.GetWklds(nil)
+		utils.LogAPIResp("GetWkldHostMap", a)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+	}
+
+	// Parse each file
+	records := []flowRecord{}
+	for _, f := range files {
+		if format == "csv" {
+			records = append(records, csvRecords(f)...)
+			continue
+		}
+		r, closeFile, err := openInput(f)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		fileRecords, err := formats[format](r, f)
+		closeFile()
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		utils.LogInfo(fmt.Sprintf("%s - %d %s records parsed", f, len(fileRecords), format), true)
+		records = append(records, fileRecords...)
+	}
+
+	// Apply the time window, denied filter, and de-duplication
+	outsideWindow, denied, duplicates := 0, 0, 0
+	seen := make(map[string]bool)
+	dedupe := !keepDuplicates
+	if format == "csv" {
+		dedupe = dedupeCSV
+	}
+
+	// Set the header for the new csv file
+	newCSVData := [][]string{{"src", "dst", "port", "protocol"}}
+	for _, r := range records {
+		if (!startTime.IsZero() && r.Time.Before(startTime)) || (!endTime.IsZero() && !r.Time.Before(endTime)) {
+			outsideWindow++
+			continue
+		}
+		if excludeDenied && r.Denied {
+			denied++
+			continue
+		}
+		if dedupe {
+			if seen[r.key()] {
+				duplicates++
+				continue
+			}
+			seen[r.key()] = true
+		}
+		newCSVData = append(newCSVData, []string{r.Src, r.Dst, r.Port, r.Proto})
+	}
+	utils.LogInfo(fmt.Sprintf("%d records - %d outside the time window, %d denied, and %d duplicates skipped - %d flows to upload", len(records), outsideWindow, denied, duplicates, len(newCSVData)-1), true)
+	if len(newCSVData) == 1 {
+		utils.LogInfo("no flows to upload.", true)
+		return
 	}
 
 	// Write the new CSV File
@@ -194,7 +295,7 @@ func uploadFlows() {
 
 	// Log response
 	utils.LogInfo(fmt.Sprintf("%d flows in CSV file.", f.TotalFlowsInCSV), false)
-	i = 1
+	i := 1
 	for _, flowResp := range f.FlowResps {
 		fmt.Printf("API Call %d of %d...\r\n", i, len(f.APIResps))
 		utils.LogInfo(fmt.Sprintf("%d flows received", flowResp.NumFlowsReceived), true)
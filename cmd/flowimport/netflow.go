@@ -0,0 +1,417 @@
+package flowimport
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/brian1917/workloader/utils"
+)
+
+// Information elements used from NetFlow v9 and IPFIX records. Flows are placed in the time window by their start time.
+const (
+	ieProtocol            = 4
+	ieSrcPort             = 7
+	ieSrcIPv4             = 8
+	ieDstPort             = 11
+	ieDstIPv4             = 12
+	ieFirstSwitched       = 22
+	ieSrcIPv6             = 27
+	ieDstIPv6             = 28
+	ieFlowStartSeconds    = 150
+	ieFlowStartMillisecs  = 152
+	ipfixVariableLength   = 65535
+	pcapMagicMicroseconds = 0xa1b2c3d4
+	pcapMagicNanoseconds  = 0xa1b23c4d
+	pcapngMagic           = 0x0a0d0d0a
+)
+
+// templateField is a field of a NetFlow v9 or IPFIX template
+type templateField struct {
+	ID     uint16
+	Length uint16
+}
+
+// flowDecoder decodes NetFlow v9 and IPFIX messages. Templates are scoped to the exporter and observation domain.
+type flowDecoder struct {
+	templates       map[string][]templateField
+	records         []flowRecord
+	missingTemplate map[string]int
+}
+
+// parseNetFlow parses a pcap of NetFlow v9 or IPFIX export packets or an IPFIX file (RFC 5655)
+func parseNetFlow(r io.Reader, fileName string) ([]flowRecord, error) {
+	data, err := readAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 4 {
+		return nil, fmt.Errorf("%s is not a pcap or ipfix file", fileName)
+	}
+
+	d := flowDecoder{templates: make(map[string][]templateField), missingTemplate: make(map[string]int)}
+	switch {
+	case binary.BigEndian.Uint32(data) == pcapngMagic:
+		return nil, fmt.Errorf("%s is a pcapng file. save the capture in pcap format", fileName)
+	case binary.BigEndian.Uint16(data) == 10:
+		err = d.ipfixFile(data)
+	default:
+		err = d.pcap(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s - %s", fileName, err)
+	}
+	for key, count := range d.missingTemplate {
+		utils.LogWarningf(true, "%s - skipped %d data sets for %s because the template was not in the capture", fileName, count, key)
+	}
+	return d.records, nil
+}
+
+// ipfixFile decodes a file of IPFIX messages
+func (d *flowDecoder) ipfixFile(data []byte) error {
+	for len(data) >= 16 {
+		length := int(binary.BigEndian.Uint16(data[2:4]))
+		if binary.BigEndian.Uint16(data) != 10 || length < 16 || length > len(data) {
+			return fmt.Errorf("invalid ipfix message header")
+		}
+		if err := d.message("file", data[:length]); err != nil {
+			return err
+		}
+		data = data[length:]
+	}
+	return nil
+}
+
+// pcap decodes the udp payloads of a pcap file
+func (d *flowDecoder) pcap(data []byte) error {
+	if len(data) < 24 {
+		return fmt.Errorf("file is not a pcap or ipfix file")
+	}
+	var order binary.ByteOrder
+	switch {
+	case binary.LittleEndian.Uint32(data) == pcapMagicMicroseconds || binary.LittleEndian.Uint32(data) == pcapMagicNanoseconds:
+		order = binary.LittleEndian
+	case binary.BigEndian.Uint32(data) == pcapMagicMicroseconds || binary.BigEndian.Uint32(data) == pcapMagicNanoseconds:
+		order = binary.BigEndian
+	default:
+		return fmt.Errorf("file is not a pcap or ipfix file")
+	}
+	linkType := order.Uint32(data[20:24])
+	data = data[24:]
+
+	fragments := 0
+	for len(data) >= 16 {
+		length := int(order.Uint32(data[8:12]))
+		if 16+length > len(data) {
+			return fmt.Errorf("truncated packet in pcap")
+		}
+		packet := data[16 : 16+length]
+		data = data[16+length:]
+
+		// Link layer
+		var etherType uint16
+		switch linkType {
+		case 0: // BSD loopback
+			if len(packet) < 4 {
+				continue
+			}
+			etherType = 0x0800
+			if family := binary.LittleEndian.Uint32(packet); family != 2 {
+				etherType = 0x86dd
+			}
+			packet = packet[4:]
+		case 1: // Ethernet
+			if len(packet) < 14 {
+				continue
+			}
+			etherType = binary.BigEndian.Uint16(packet[12:14])
+			packet = packet[14:]
+			for (etherType == 0x8100 || etherType == 0x88a8) && len(packet) >= 4 {
+				etherType = binary.BigEndian.Uint16(packet[2:4])
+				packet = packet[4:]
+			}
+		case 101: // Raw IP
+			if len(packet) < 1 {
+				continue
+			}
+			etherType = 0x0800
+			if packet[0]>>4 == 6 {
+				etherType = 0x86dd
+			}
+		case 113: // Linux cooked capture
+			if len(packet) < 16 {
+				continue
+			}
+			etherType = binary.BigEndian.Uint16(packet[14:16])
+			packet = packet[16:]
+		case 276: // Linux cooked capture v2
+			if len(packet) < 20 {
+				continue
+			}
+			etherType = binary.BigEndian.Uint16(packet[0:2])
+			packet = packet[20:]
+		default:
+			return fmt.Errorf("pcap link type %d is not supported", linkType)
+		}
+
+		// IP layer
+		var exporter string
+		switch etherType {
+		case 0x0800:
+			if len(packet) < 20 || packet[9] != 17 {
+				continue
+			}
+			if flags := binary.BigEndian.Uint16(packet[6:8]); flags&0x3fff != 0 {
+				fragments++
+				continue
+			}
+			exporter = net.IP(packet[12:16]).String()
+			headerLen := int(packet[0]&0x0f) * 4
+			if headerLen < 20 || headerLen > len(packet) {
+				utils.LogWarningf(false, "skipping packet from %s - invalid ipv4 header length %d", exporter, headerLen)
+				continue
+			}
+			packet = packet[headerLen:]
+		case 0x86dd:
+			if len(packet) < 40 || packet[6] != 17 {
+				continue
+			}
+			exporter = net.IP(packet[8:24]).String()
+			packet = packet[40:]
+		default:
+			continue
+		}
+
+		// UDP payload
+		if len(packet) < 8 {
+			continue
+		}
+		payload := packet[8:]
+		if len(payload) < 2 {
+			continue
+		}
+		if version := binary.BigEndian.Uint16(payload); version != 9 && version != 10 {
+			continue
+		}
+		if err := d.message(exporter, payload); err != nil {
+			utils.LogWarningf(false, "skipping packet from %s - %s", exporter, err)
+		}
+	}
+	if fragments > 0 {
+		utils.LogWarningf(true, "skipped %d fragmented udp packets. fragmented export packets are not reassembled.", fragments)
+	}
+	return nil
+}
+
+// message decodes a NetFlow v9 or IPFIX message
+func (d *flowDecoder) message(exporter string, msg []byte) error {
+	version := binary.BigEndian.Uint16(msg)
+	var headerLen, sysUptime int
+	var exportTime time.Time
+	var domain uint32
+	switch version {
+	case 9:
+		headerLen = 20
+		if len(msg) < headerLen {
+			return fmt.Errorf("netflow v9 header is truncated")
+		}
+		sysUptime = int(binary.BigEndian.Uint32(msg[4:8]))
+		exportTime = time.Unix(int64(binary.BigEndian.Uint32(msg[8:12])), 0).UTC()
+		domain = binary.BigEndian.Uint32(msg[16:20])
+	case 10:
+		headerLen = 16
+		if len(msg) < headerLen {
+			return fmt.Errorf("ipfix header is truncated")
+		}
+		l := int(binary.BigEndian.Uint16(msg[2:4]))
+		if l < headerLen {
+			return fmt.Errorf("invalid ipfix message length %d", l)
+		}
+		if l <= len(msg) {
+			msg = msg[:l]
+		}
+		exportTime = time.Unix(int64(binary.BigEndian.Uint32(msg[4:8])), 0).UTC()
+		domain = binary.BigEndian.Uint32(msg[12:16])
+	default:
+		return fmt.Errorf("version %d is not netflow v9 or ipfix", version)
+	}
+
+	sets := msg[headerLen:]
+	for len(sets) >= 4 {
+		setID := binary.BigEndian.Uint16(sets)
+		setLen := int(binary.BigEndian.Uint16(sets[2:4]))
+		if setLen < 4 || setLen > len(sets) {
+			return fmt.Errorf("invalid set length %d", setLen)
+		}
+		body := sets[4:setLen]
+		sets = sets[setLen:]
+		prefix := fmt.Sprintf("%s/%d/%d/", exporter, version, domain)
+
+		switch {
+		case (version == 9 && setID == 0) || (version == 10 && setID == 2):
+			d.templateSet(prefix, body, version, false)
+		case (version == 9 && setID == 1) || (version == 10 && setID == 3):
+			d.templateSet(prefix, body, version, true)
+		case setID >= 256:
+			template, ok := d.templates[prefix+strconv.Itoa(int(setID))]
+			if !ok {
+				d.missingTemplate[fmt.Sprintf("exporter %s domain %d template %d", exporter, domain, setID)]++
+				continue
+			}
+			d.dataSet(template, body, exportTime, sysUptime, version)
+		}
+	}
+	return nil
+}
+
+// templateSet stores the templates in a template or options template set
+func (d *flowDecoder) templateSet(prefix string, body []byte, version uint16, options bool) {
+	for len(body) >= 4 {
+		templateID := binary.BigEndian.Uint16(body)
+		var fieldCount int
+		switch {
+		case version == 9 && options:
+			// v9 options templates give the scope and option lengths in bytes
+			if len(body) < 6 {
+				return
+			}
+			fieldCount = (int(binary.BigEndian.Uint16(body[2:4])) + int(binary.BigEndian.Uint16(body[4:6]))) / 4
+			body = body[6:]
+		case version == 10 && options:
+			if len(body) < 6 {
+				return
+			}
+			fieldCount = int(binary.BigEndian.Uint16(body[2:4]))
+			body = body[6:]
+		default:
+			fieldCount = int(binary.BigEndian.Uint16(body[2:4]))
+			body = body[4:]
+		}
+		if templateID < 256 {
+			// Padding at the end of the set
+			return
+		}
+
+		// A template with no fields withdraws it
+		if fieldCount == 0 {
+			delete(d.templates, prefix+strconv.Itoa(int(templateID)))
+			continue
+		}
+
+		fields := []templateField{}
+		for i := 0; i < fieldCount && len(body) >= 4; i++ {
+			field := templateField{ID: binary.BigEndian.Uint16(body), Length: binary.BigEndian.Uint16(body[2:4])}
+			body = body[4:]
+			// IPFIX enterprise fields have a 4 byte enterprise number. They are kept for their length but never match a used element.
+			if version == 10 && field.ID&0x8000 != 0 {
+				if len(body) < 4 {
+					return
+				}
+				body = body[4:]
+				field.ID = 0
+			}
+			fields = append(fields, field)
+		}
+		d.templates[prefix+strconv.Itoa(int(templateID))] = fields
+	}
+}
+
+// dataSet decodes the records in a data set with its template
+func (d *flowDecoder) dataSet(template []templateField, body []byte, exportTime time.Time, sysUptime int, version uint16) {
+	minLen := 0
+	for _, f := range template {
+		if f.Length == ipfixVariableLength {
+			minLen++
+		} else {
+			minLen += int(f.Length)
+		}
+	}
+	if minLen == 0 {
+		return
+	}
+
+	for len(body) >= minLen {
+		var src, dst net.IP
+		var port, proto int
+		var start time.Time
+		var firstSwitched = -1
+		ok := true
+		for _, f := range template {
+			length := int(f.Length)
+			if f.Length == ipfixVariableLength {
+				if len(body) < 1 {
+					ok = false
+					break
+				}
+				length = int(body[0])
+				body = body[1:]
+				if length == 255 {
+					if len(body) < 2 {
+						ok = false
+						break
+					}
+					length = int(binary.BigEndian.Uint16(body))
+					body = body[2:]
+				}
+			}
+			if len(body) < length {
+				ok = false
+				break
+			}
+			value := body[:length]
+			body = body[length:]
+
+			switch f.ID {
+			case ieSrcIPv4, ieSrcIPv6:
+				src = net.IP(append([]byte{}, value...))
+			case ieDstIPv4, ieDstIPv6:
+				dst = net.IP(append([]byte{}, value...))
+			case ieDstPort:
+				port = int(uintValue(value))
+			case ieProtocol:
+				proto = int(uintValue(value))
+			case ieFirstSwitched:
+				firstSwitched = int(uintValue(value))
+			case ieFlowStartSeconds:
+				start = time.Unix(int64(uintValue(value)), 0).UTC()
+			case ieFlowStartMillisecs:
+				start = time.UnixMilli(int64(uintValue(value))).UTC()
+			}
+		}
+		if !ok {
+			return
+		}
+
+		// Options records and records without addresses are not flows
+		if src == nil || dst == nil || src.To16() == nil || dst.To16() == nil {
+			continue
+		}
+
+		// NetFlow v9 start times are the system uptime in milliseconds when the flow started
+		if start.IsZero() && version == 9 && firstSwitched >= 0 {
+			start = exportTime.Add(-time.Duration(sysUptime-firstSwitched) * time.Millisecond)
+		}
+		if start.IsZero() {
+			start = exportTime
+		}
+
+		record, err := newRecord(src.String(), dst.String(), strconv.Itoa(port), strconv.Itoa(proto), start, false)
+		if err != nil {
+			utils.LogWarningf(false, "skipping flow record - %s", err)
+			continue
+		}
+		d.records = append(d.records, record)
+	}
+}
+
+// uintValue reads a big endian unsigned integer of 1 to 8 bytes. Reduced size encoding is allowed by IPFIX.
+func uintValue(value []byte) uint64 {
+	var v uint64
+	for _, b := range value {
+		v = v<<8 | uint64(b)
+	}
+	return v
+}
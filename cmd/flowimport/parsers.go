@@ -0,0 +1,423 @@
+package flowimport
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brian1917/workloader/utils"
+)
+
+// flowRecord is a flow normalized from any input format. Time is zero if the format does not have a timestamp.
+type flowRecord struct {
+	Src    string
+	Dst    string
+	Port   string
+	Proto  string
+	Time   time.Time
+	Denied bool
+}
+
+// key is used to de-duplicate flows
+func (f flowRecord) key() string {
+	return strings.Join([]string{f.Src, f.Dst, f.Port, f.Proto}, ",")
+}
+
+// formats are the supported input formats and their parser
+var formats = map[string]func(r io.Reader, fileName string) ([]flowRecord, error){
+	"zeek":      parseZeek,
+	"netflow":   parseNetFlow,
+	"aws-vpc":   parseAWSVPC,
+	"azure-nsg": parseAzureNSG,
+	"pan":       parsePAN,
+}
+
+// openInput opens a file and transparently decompresses it if it is gzipped
+func openInput(fileName string) (io.Reader, func(), error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, nil, err
+	}
+	reader := bufio.NewReader(file)
+	if magic, err := reader.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		return gz, func() { gz.Close(); file.Close() }, nil
+	}
+	return reader, func() { file.Close() }, nil
+}
+
+// protoNumber converts a protocol name to its IANA number
+func protoNumber(proto string) (string, error) {
+	switch strings.ToLower(proto) {
+	case "tcp", "t", "6":
+		return "6", nil
+	case "udp", "u", "17":
+		return "17", nil
+	case "icmp", "1":
+		return "1", nil
+	case "ipv6-icmp", "icmp6", "icmpv6", "58":
+		return "58", nil
+	case "sctp", "132":
+		return "132", nil
+	}
+	if n, err := strconv.Atoi(proto); err == nil && n >= 0 && n <= 255 {
+		return proto, nil
+	}
+	return "", fmt.Errorf("%s is not a valid protocol", proto)
+}
+
+// newRecord validates and normalizes the values of a flow. Protocols without ports use port 0.
+func newRecord(src, dst, port, proto string, t time.Time, denied bool) (flowRecord, error) {
+	if net.ParseIP(src) == nil {
+		return flowRecord{}, fmt.Errorf("%s is not a valid source ip", src)
+	}
+	if net.ParseIP(dst) == nil {
+		return flowRecord{}, fmt.Errorf("%s is not a valid destination ip", dst)
+	}
+	proto, err := protoNumber(proto)
+	if err != nil {
+		return flowRecord{}, err
+	}
+	if proto != "6" && proto != "17" && proto != "132" {
+		port = "0"
+	} else if p, err := strconv.Atoi(port); err != nil || p < 0 || p > 65535 {
+		return flowRecord{}, fmt.Errorf("%s is not a valid port", port)
+	}
+	return flowRecord{Src: src, Dst: dst, Port: port, Proto: proto, Time: t, Denied: denied}, nil
+}
+
+// epochTime converts epoch seconds with an optional fraction to a time
+func epochTime(value string) (time.Time, error) {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s is not a valid epoch timestamp", value)
+	}
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+}
+
+// parseZeek parses a Zeek conn.log in the default tab-separated format or in json lines
+func parseZeek(r io.Reader, fileName string) ([]flowRecord, error) {
+	records := []flowRecord{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1024*1024), 10*1024*1024)
+	separator := "\t"
+	fields := map[string]int{}
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		// Json lines
+		if strings.HasPrefix(text, "{") {
+			var entry map[string]interface{}
+			if err := json.Unmarshal([]byte(text), &entry); err != nil {
+				return nil, fmt.Errorf("%s line %d - %s", fileName, line, err)
+			}
+			var ts time.Time
+			var err error
+			switch v := entry["ts"].(type) {
+			case float64:
+				ts, err = epochTime(strconv.FormatFloat(v, 'f', -1, 64))
+			case string:
+				ts, err = time.Parse(time.RFC3339Nano, v)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s line %d - %s", fileName, line, err)
+			}
+			record, err := newRecord(fmt.Sprint(entry["id.orig_h"]), fmt.Sprint(entry["id.resp_h"]), fmt.Sprint(entry["id.resp_p"]), fmt.Sprint(entry["proto"]), ts, false)
+			if err != nil {
+				utils.LogWarningf(false, "%s line %d - skipping - %s", fileName, line, err)
+				continue
+			}
+			records = append(records, record)
+			continue
+		}
+
+		// Tab-separated headers
+		if strings.HasPrefix(text, "#separator") {
+			sep := strings.TrimSpace(strings.TrimPrefix(text, "#separator"))
+			if unquoted, err := strconv.Unquote(`"` + sep + `"`); err == nil {
+				separator = unquoted
+			}
+			continue
+		}
+		if strings.HasPrefix(text, "#fields") {
+			for i, f := range strings.Split(text, separator)[1:] {
+				fields[f] = i
+			}
+			continue
+		}
+		if strings.HasPrefix(text, "#") {
+			continue
+		}
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("%s line %d - conn.log does not have a #fields header", fileName, line)
+		}
+		for _, f := range []string{"ts", "id.orig_h", "id.resp_h", "id.resp_p", "proto"} {
+			if _, ok := fields[f]; !ok {
+				return nil, fmt.Errorf("%s - conn.log #fields header does not include %s", fileName, f)
+			}
+		}
+		values := strings.Split(text, separator)
+		if len(values) < len(fields) {
+			utils.LogWarningf(false, "%s line %d - skipping - expected %d fields and found %d", fileName, line, len(fields), len(values))
+			continue
+		}
+		ts, err := epochTime(values[fields["ts"]])
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d - %s", fileName, line, err)
+		}
+		record, err := newRecord(values[fields["id.orig_h"]], values[fields["id.resp_h"]], values[fields["id.resp_p"]], values[fields["proto"]], ts, false)
+		if err != nil {
+			utils.LogWarningf(false, "%s line %d - skipping - %s", fileName, line, err)
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// awsDefaultFields is the version 2 default format of AWS VPC flow logs
+var awsDefaultFields = []string{"version", "account-id", "interface-id", "srcaddr", "dstaddr", "srcport", "dstport", "protocol", "packets", "bytes", "start", "end", "action", "log-status"}
+
+// parseAWSVPC parses AWS VPC flow logs. A header row with field names is used for custom formats. Without a header the default format is expected.
+func parseAWSVPC(r io.Reader, fileName string) ([]flowRecord, error) {
+	records := []flowRecord{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1024*1024), 10*1024*1024)
+	fields := map[string]int{}
+	for i, f := range awsDefaultFields {
+		fields[f] = i
+	}
+	line := 0
+	for scanner.Scan() {
+		line++
+		values := strings.Fields(scanner.Text())
+		if len(values) == 0 {
+			continue
+		}
+
+		// Header row
+		if line == 1 && strings.Contains(scanner.Text(), "srcaddr") {
+			fields = map[string]int{}
+			for i, f := range values {
+				fields[strings.ReplaceAll(f, "_", "-")] = i
+			}
+			for _, f := range []string{"srcaddr", "dstaddr", "dstport", "protocol", "start"} {
+				if _, ok := fields[f]; !ok {
+					return nil, fmt.Errorf("%s - header does not include %s", fileName, f)
+				}
+			}
+			continue
+		}
+		if len(values) < len(fields) {
+			utils.LogWarningf(false, "%s line %d - skipping - expected %d fields and found %d", fileName, line, len(fields), len(values))
+			continue
+		}
+
+		// NODATA and SKIPDATA records do not have flow information
+		if values[fields["srcaddr"]] == "-" {
+			continue
+		}
+		ts, err := epochTime(values[fields["start"]])
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d - %s", fileName, line, err)
+		}
+		denied := false
+		if i, ok := fields["action"]; ok {
+			denied = values[i] == "REJECT"
+		}
+		record, err := newRecord(values[fields["srcaddr"]], values[fields["dstaddr"]], values[fields["dstport"]], values[fields["protocol"]], ts, denied)
+		if err != nil {
+			utils.LogWarningf(false, "%s line %d - skipping - %s", fileName, line, err)
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// azureFlowLog is an Azure NSG flow log (version 1 and 2) or VNet flow log file
+type azureFlowLog struct {
+	Records []struct {
+		Time       string `json:"time"`
+		Properties struct {
+			Flows []struct {
+				Rule  string      `json:"rule"`
+				Flows []azureMACs `json:"flows"`
+			} `json:"flows"`
+		} `json:"properties"`
+		FlowRecords struct {
+			Flows []struct {
+				FlowGroups []struct {
+					Rule       string   `json:"rule"`
+					FlowTuples []string `json:"flowTuples"`
+				} `json:"flowGroups"`
+			} `json:"flows"`
+		} `json:"flowRecords"`
+	} `json:"records"`
+}
+
+type azureMACs struct {
+	MAC        string   `json:"mac"`
+	FlowTuples []string `json:"flowTuples"`
+}
+
+// parseAzureTuple parses a flow tuple. NSG tuples are timestamp,src,dst,srcport,dstport,T|U,I|O,A|D,...
+// VNet tuples are timestamp(ms),src,dst,srcport,dstport,protocol number,I|O,B|C|E|D,...
+func parseAzureTuple(tuple string, vnet bool) (flowRecord, error) {
+	values := strings.Split(tuple, ",")
+	if len(values) < 8 {
+		return flowRecord{}, fmt.Errorf("flow tuple %s has %d fields", tuple, len(values))
+	}
+	ts, err := strconv.ParseInt(values[0], 10, 64)
+	if err != nil {
+		return flowRecord{}, fmt.Errorf("%s is not a valid timestamp", values[0])
+	}
+	t := time.Unix(ts, 0).UTC()
+	denied := values[7] == "D"
+	if vnet {
+		t = time.UnixMilli(ts).UTC()
+	}
+	return newRecord(values[1], values[2], values[4], values[5], t, denied)
+}
+
+// parseAzureNSG parses Azure NSG flow logs and VNet flow logs in the json format written to the storage account
+func parseAzureNSG(r io.Reader, fileName string) ([]flowRecord, error) {
+	var flowLog azureFlowLog
+	if err := json.NewDecoder(r).Decode(&flowLog); err != nil {
+		return nil, fmt.Errorf("%s - %s", fileName, err)
+	}
+	records := []flowRecord{}
+	add := func(tuples []string, vnet bool) {
+		for _, tuple := range tuples {
+			record, err := parseAzureTuple(tuple, vnet)
+			if err != nil {
+				utils.LogWarningf(false, "%s - skipping - %s", fileName, err)
+				continue
+			}
+			records = append(records, record)
+		}
+	}
+	for _, rec := range flowLog.Records {
+		for _, rule := range rec.Properties.Flows {
+			for _, mac := range rule.Flows {
+				add(mac.FlowTuples, false)
+			}
+		}
+		for _, flow := range rec.FlowRecords.Flows {
+			for _, group := range flow.FlowGroups {
+				add(group.FlowTuples, true)
+			}
+		}
+	}
+	return records, nil
+}
+
+// panColumns are the accepted headers for each value in a PAN traffic log csv export
+var panColumns = map[string][]string{
+	"src":    {"source address", "source", "src"},
+	"dst":    {"destination address", "destination", "dst"},
+	"port":   {"destination port", "dport", "to port"},
+	"proto":  {"ip protocol", "protocol", "proto"},
+	"time":   {"receive time", "generate time", "time logged", "start time"},
+	"action": {"action"},
+}
+
+// parsePAN parses a traffic log csv exported from the PAN-OS or Panorama web interface. Times are in the local time zone.
+func parsePAN(r io.Reader, fileName string) ([]flowRecord, error) {
+	reader := csv.NewReader(utils.ClearBOM(r))
+	reader.FieldsPerRecord = -1
+	records := []flowRecord{}
+	columns := map[string]int{}
+	maxColumn := 0
+	line := 0
+	for {
+		line++
+		values, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d - %s", fileName, line, err)
+		}
+
+		// Header row
+		if line == 1 {
+			headers := map[string]int{}
+			for i, h := range values {
+				headers[strings.ToLower(strings.TrimSpace(h))] = i
+			}
+			for value, names := range panColumns {
+				for _, name := range names {
+					if i, ok := headers[name]; ok {
+						columns[value] = i
+						break
+					}
+				}
+				if _, ok := columns[value]; !ok && value != "action" {
+					return nil, fmt.Errorf("%s - header does not include a %s column (%s)", fileName, value, strings.Join(names, ", "))
+				}
+				if columns[value] > maxColumn {
+					maxColumn = columns[value]
+				}
+			}
+			continue
+		}
+		if len(values) <= maxColumn {
+			utils.LogWarningf(false, "%s line %d - skipping - expected at least %d fields and found %d", fileName, line, maxColumn+1, len(values))
+			continue
+		}
+
+		t, err := time.ParseInLocation("2006/01/02 15:04:05", values[columns["time"]], time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d - %s", fileName, line, err)
+		}
+		denied := false
+		if i, ok := columns["action"]; ok {
+			denied = values[i] != "allow"
+		}
+		record, err := newRecord(values[columns["src"]], values[columns["dst"]], values[columns["port"]], values[columns["proto"]], t, denied)
+		if err != nil {
+			utils.LogWarningf(false, "%s line %d - skipping - %s", fileName, line, err)
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// parseTimeFlag parses a start or end flag in RFC 3339, yyyy-mm-dd hh:mm:ss (UTC), or yyyy-mm-dd (UTC) format.
+func parseTimeFlag(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%s is not in RFC 3339, yyyy-mm-dd hh:mm:ss, or yyyy-mm-dd format", value)
+}
+
+// readAll reads a file into memory for formats that need random access
+func readAll(r io.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := io.Copy(&buf, r)
+	return buf.Bytes(), err
+}
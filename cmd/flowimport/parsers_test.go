@@ -0,0 +1,164 @@
+package flowimport
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brian1917/workloader/utils"
+)
+
+func TestMain(m *testing.M) {
+	utils.Logger.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// ipfixMessage is an IPFIX message with a template and one flow from 10.0.0.1 to 10.0.0.2 on 443/tcp
+func ipfixMessage() []byte {
+	msg := []byte{0, 10, 0, 63, 0x65, 0x53, 0xf1, 0x00, 0, 0, 0, 1, 0, 0, 0, 0}
+	// Template set 256: src ipv4, dst ipv4, dst port, protocol, flow start seconds
+	msg = append(msg, 0, 2, 0, 28, 1, 0, 0, 5, 0, 8, 0, 4, 0, 12, 0, 4, 0, 11, 0, 2, 0, 4, 0, 1, 0, 150, 0, 4)
+	// Data set
+	msg = append(msg, 1, 0, 0, 19, 10, 0, 0, 1, 10, 0, 0, 2, 0x01, 0xbb, 6, 0x65, 0x53, 0xf1, 0x00)
+	return msg
+}
+
+// ipv4UDP wraps a payload in ipv4 and udp headers. The ipv4 header length is in 32-bit words.
+func ipv4UDP(headerWords byte, payload []byte) []byte {
+	packet := []byte{0x40 | headerWords, 0, 0, 0, 0, 0, 0, 0, 64, 17, 0, 0, 192, 0, 2, 1, 192, 0, 2, 2}
+	if payload == nil {
+		return packet
+	}
+	packet = append(packet, 0x08, 0x07, 0x08, 0x07, 0, 0, 0, 0)
+	return append(packet, payload...)
+}
+
+// pcapFile builds a little endian raw ip pcap
+func pcapFile(packets ...[]byte) []byte {
+	data := make([]byte, 24)
+	binary.LittleEndian.PutUint32(data[0:], pcapMagicMicroseconds)
+	binary.LittleEndian.PutUint16(data[4:], 2)
+	binary.LittleEndian.PutUint16(data[6:], 4)
+	binary.LittleEndian.PutUint32(data[16:], 65535)
+	binary.LittleEndian.PutUint32(data[20:], 101)
+	for _, p := range packets {
+		header := make([]byte, 16)
+		binary.LittleEndian.PutUint32(header[8:], uint32(len(p)))
+		binary.LittleEndian.PutUint32(header[12:], uint32(len(p)))
+		data = append(data, header...)
+		data = append(data, p...)
+	}
+	return data
+}
+
+func TestParsers(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		input  string
+		want   []flowRecord
+	}{
+		{
+			name:   "zeek tab-separated with a short row",
+			format: "zeek",
+			input: "#separator \\x09\n" +
+				"#fields\tts\tuid\tid.orig_h\tid.orig_p\tid.resp_h\tid.resp_p\tproto\n" +
+				"1700000000.5\tC1\t10.0.0.1\t51000\t10.0.0.2\t443\ttcp\n" +
+				"1700000001\tC2\t10.0.0.1\t51001\t10.0.0.3\t53\tudp\n" +
+				"1700000002\tC3\t10.0.0.1\n",
+			want: []flowRecord{{Src: "10.0.0.1", Dst: "10.0.0.2", Port: "443", Proto: "6"}, {Src: "10.0.0.1", Dst: "10.0.0.3", Port: "53", Proto: "17"}},
+		},
+		{
+			name:   "zeek json lines",
+			format: "zeek",
+			input:  `{"ts":1700000000.5,"id.orig_h":"10.0.0.1","id.resp_h":"10.0.0.2","id.resp_p":443,"proto":"tcp"}` + "\n" + `{"ts":1700000001,"id.orig_h":"10.0.0.1","id.resp_h":"10.0.0.2","id.resp_p":0,"proto":"icmp"}`,
+			want:   []flowRecord{{Src: "10.0.0.1", Dst: "10.0.0.2", Port: "443", Proto: "6"}, {Src: "10.0.0.1", Dst: "10.0.0.2", Port: "0", Proto: "1"}},
+		},
+		{
+			name:   "aws-vpc default format with nodata and short rows",
+			format: "aws-vpc",
+			input: "2 123456789012 eni-1 10.0.0.1 10.0.0.2 51000 443 6 10 840 1700000000 1700000060 ACCEPT OK\n" +
+				"2 123456789012 eni-1 10.0.0.1 10.0.0.2 51000 22 6 10 840 1700000000 1700000060 REJECT OK\n" +
+				"2 123456789012 eni-1 - - - - - - - 1700000000 1700000060 - NODATA\n" +
+				"2 123456789012 eni-1\n",
+			want: []flowRecord{{Src: "10.0.0.1", Dst: "10.0.0.2", Port: "443", Proto: "6"}, {Src: "10.0.0.1", Dst: "10.0.0.2", Port: "22", Proto: "6", Denied: true}},
+		},
+		{
+			name:   "aws-vpc custom format",
+			format: "aws-vpc",
+			input:  "start srcaddr dstaddr dstport protocol\n1700000000 10.0.0.1 10.0.0.2 5432 6\n",
+			want:   []flowRecord{{Src: "10.0.0.1", Dst: "10.0.0.2", Port: "5432", Proto: "6"}},
+		},
+		{
+			name:   "azure-nsg version 2 with a bad tuple",
+			format: "azure-nsg",
+			input:  `{"records":[{"properties":{"flows":[{"rule":"r1","flows":[{"mac":"000D3AF87856","flowTuples":["1700000000,10.0.0.1,10.0.0.2,51000,443,T,O,A,B,,,,","1700000000,10.0.0.1,10.0.0.2,51000,3389,T,O,D,B,,,,","bad"]}]}]}}]}`,
+			want:   []flowRecord{{Src: "10.0.0.1", Dst: "10.0.0.2", Port: "443", Proto: "6"}, {Src: "10.0.0.1", Dst: "10.0.0.2", Port: "3389", Proto: "6", Denied: true}},
+		},
+		{
+			name:   "azure vnet flow log",
+			format: "azure-nsg",
+			input:  `{"records":[{"flowRecords":{"flows":[{"flowGroups":[{"rule":"r1","flowTuples":["1700000000000,10.0.0.1,10.0.0.4,51000,53,17,O,B,NX,0,0,0,0"]}]}]}}]}`,
+			want:   []flowRecord{{Src: "10.0.0.1", Dst: "10.0.0.4", Port: "53", Proto: "17"}},
+		},
+		{
+			name:   "pan with a short row",
+			format: "pan",
+			input: "Receive Time,Source address,Destination address,Destination Port,IP Protocol,Action\n" +
+				"2024/01/02 03:04:05,10.0.0.1,10.0.0.2,443,tcp,allow\n" +
+				"2024/01/02 03:04:06,10.0.0.1,10.0.0.2,22,tcp,deny\n" +
+				"2024/01/02 03:04:07,10.0.0.1\n",
+			want: []flowRecord{{Src: "10.0.0.1", Dst: "10.0.0.2", Port: "443", Proto: "6"}, {Src: "10.0.0.1", Dst: "10.0.0.2", Port: "22", Proto: "6", Denied: true}},
+		},
+		{
+			name:   "ipfix file",
+			format: "netflow",
+			input:  string(ipfixMessage()),
+			want:   []flowRecord{{Src: "10.0.0.1", Dst: "10.0.0.2", Port: "443", Proto: "6"}},
+		},
+		{
+			name:   "netflow pcap with an invalid ipv4 header length",
+			format: "netflow",
+			input:  string(pcapFile(ipv4UDP(15, nil), ipv4UDP(5, ipfixMessage()))),
+			want:   []flowRecord{{Src: "10.0.0.1", Dst: "10.0.0.2", Port: "443", Proto: "6"}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			records, err := formats[tc.format](strings.NewReader(tc.input), tc.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Times are checked separately
+			for i := range records {
+				records[i].Time = time.Time{}
+			}
+			if !reflect.DeepEqual(records, tc.want) {
+				t.Errorf("got %+v, want %+v", records, tc.want)
+			}
+		})
+	}
+}
+
+func TestParserTimes(t *testing.T) {
+	records, err := parseZeek(strings.NewReader(`{"ts":1700000000.5,"id.orig_h":"10.0.0.1","id.resp_h":"10.0.0.2","id.resp_p":443,"proto":"tcp"}`), "conn.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Unix(1700000000, 5e8).UTC(); len(records) != 1 || !records[0].Time.Equal(want) {
+		t.Errorf("got %+v, want a flow at %s", records, want)
+	}
+
+	records, err = parseNetFlow(strings.NewReader(string(ipfixMessage())), "flows.ipfix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Unix(0x6553f100, 0).UTC(); len(records) != 1 || !records[0].Time.Equal(want) {
+		t.Errorf("got %+v, want a flow at %s", records, want)
+	}
+}
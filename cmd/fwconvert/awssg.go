@@ -0,0 +1,182 @@
+package fwconvert
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/brian1917/workloader/utils"
+)
+
+// securityGroup is a security group from aws ec2 describe-security-groups
+type securityGroup struct {
+	GroupName           string         `json:"GroupName"`
+	GroupID             string         `json:"GroupId"`
+	Description         string         `json:"Description"`
+	VpcID               string         `json:"VpcId"`
+	IPPermissions       []ipPermission `json:"IpPermissions"`
+	IPPermissionsEgress []ipPermission `json:"IpPermissionsEgress"`
+}
+
+type ipPermission struct {
+	IPProtocol string `json:"IpProtocol"`
+	FromPort   *int   `json:"FromPort"`
+	ToPort     *int   `json:"ToPort"`
+	IPRanges   []struct {
+		CidrIP      string `json:"CidrIp"`
+		Description string `json:"Description"`
+	} `json:"IpRanges"`
+	IPv6Ranges []struct {
+		CidrIPv6    string `json:"CidrIpv6"`
+		Description string `json:"Description"`
+	} `json:"Ipv6Ranges"`
+	PrefixListIDs []struct {
+		PrefixListID string `json:"PrefixListId"`
+	} `json:"PrefixListIds"`
+	UserIDGroupPairs []struct {
+		GroupID   string `json:"GroupId"`
+		GroupName string `json:"GroupName"`
+	} `json:"UserIdGroupPairs"`
+}
+
+// parseAWSSG parses the json output of aws ec2 describe-security-groups or a json array of security groups
+func parseAWSSG(r io.Reader) ([]fwRule, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var groups []securityGroup
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+		err = json.Unmarshal(data, &groups)
+	} else {
+		var output struct {
+			SecurityGroups []securityGroup `json:"SecurityGroups"`
+		}
+		err = json.Unmarshal(data, &output)
+		groups = output.SecurityGroups
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing security group json - %s", err)
+	}
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("no security groups in the input. input must be aws ec2 describe-security-groups output")
+	}
+
+	// Group names are used for references between groups
+	groupNames := make(map[string]string)
+	for _, g := range groups {
+		groupNames[g.GroupID] = g.GroupName
+	}
+
+	rules := []fwRule{}
+	for _, g := range groups {
+		self := fwAddr{Self: true, Group: g.GroupName}
+		for _, egress := range []bool{false, true} {
+			permissions := g.IPPermissions
+			if egress {
+				permissions = g.IPPermissionsEgress
+			}
+			for i, p := range permissions {
+				direction := "ingress"
+				if egress {
+					direction = "egress"
+				}
+				rule := fwRule{Origin: fmt.Sprintf("%s (%s) %s %d", g.GroupName, g.GroupID, direction, i+1), Comment: g.Description, Action: "allow", Enabled: true}
+
+				// Addresses
+				peers := []fwAddr{}
+				cidrs := fwAddr{}
+				for _, ipr := range p.IPRanges {
+					cidrs.Entries = append(cidrs.Entries, ipr.CidrIP)
+				}
+				for _, ipr := range p.IPv6Ranges {
+					cidrs.Entries = append(cidrs.Entries, ipr.CidrIPv6)
+				}
+				valid := true
+				for j, e := range cidrs.Entries {
+					entry, err := normalizeEntry(e)
+					if err != nil {
+						utils.LogWarningf(true, "%s - skipping - %s", rule.Origin, err)
+						valid = false
+						break
+					}
+					cidrs.Entries[j] = entry
+				}
+				if !valid {
+					continue
+				}
+				anyPeer := false
+				for _, e := range cidrs.Entries {
+					if isAnyEntry(e) {
+						anyPeer = true
+					}
+				}
+				switch {
+				case anyPeer:
+					peers = append(peers, anyAddr)
+				case len(cidrs.Entries) > 0:
+					peers = append(peers, cidrs)
+				}
+				for _, pair := range p.UserIDGroupPairs {
+					name := groupNames[pair.GroupID]
+					if name == "" {
+						name = pair.GroupName
+					}
+					if name == "" {
+						name = pair.GroupID
+					}
+					peers = append(peers, fwAddr{Group: name})
+				}
+				for _, pl := range p.PrefixListIDs {
+					utils.LogWarningf(true, "%s - prefix list %s cannot be converted. create an ip list for it and add it to the rule.", rule.Origin, pl.PrefixListID)
+				}
+				if len(peers) == 0 {
+					continue
+				}
+
+				// Default egress rule allowing everything
+				if egress && anyPeer && len(peers) == 1 && p.IPProtocol == "-1" {
+					utils.LogInfo(fmt.Sprintf("%s - skipping the default allow all egress rule", rule.Origin), false)
+					continue
+				}
+
+				// Services
+				proto, err := protocolNumber(p.IPProtocol)
+				if err != nil {
+					utils.LogWarningf(true, "%s - skipping - %s", rule.Origin, err)
+					continue
+				}
+				port := fwPort{Proto: proto, Port: -1, ToPort: -1}
+				if p.FromPort != nil {
+					port.Port = *p.FromPort
+				}
+				if p.ToPort != nil {
+					port.ToPort = *p.ToPort
+				}
+				switch {
+				case proto == -1:
+					rule.Svcs = []fwService{{Any: true}}
+				case proto == 1 || proto == 58:
+					// For icmp the from port is the type and the to port is the code
+					rule.Svcs = []fwService{{Ports: []fwPort{port}}}
+				default:
+					if port.Port == 0 && port.ToPort == 65535 || port.Port == -1 {
+						port.Port, port.ToPort = -1, -1
+					} else if port.ToPort == port.Port {
+						port.ToPort = -1
+					}
+					rule.Svcs = []fwService{{Ports: []fwPort{port}}}
+				}
+
+				if egress {
+					rule.Src, rule.Dst = []fwAddr{self}, peers
+				} else {
+					rule.Src, rule.Dst = peers, []fwAddr{self}
+				}
+				rules = append(rules, rule)
+			}
+		}
+	}
+	return rules, nil
+}
@@ -0,0 +1,193 @@
+package fwconvert
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	ia "github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+)
+
+// Declare local global variables
+var format, rulesetName, scope, host, sgLabelKey, labelKeysStr, iplPrefix, svcPrefix, outputFileName string
+var labelKeys []string
+var includeDeny bool
+
+func init() {
+	FWConvertCmd.Flags().StringVarP(&format, "format", "f", "", "format of the input. options are iptables, aws-sg, and pan.")
+	FWConvertCmd.Flags().StringVarP(&rulesetName, "ruleset", "r", "", "name of the ruleset for the rules. default is fw-convert-<input file name>.")
+	FWConvertCmd.Flags().StringVarP(&scope, "scope", "s", "", "scope for the ruleset if it does not exist in the PCE. semicolon separated key:value labels (e.g., app:erp;env:prod). used for the ruleset-import csv.")
+	FWConvertCmd.Flags().StringVar(&host, "host", "", "hostname of the PCE workload the iptables rules or security group protect. without it, the protected side is all workloads in the ruleset scope.")
+	FWConvertCmd.Flags().StringVar(&sgLabelKey, "sg-label-key", "", "label key used for security groups. references to other security groups become labels of this key with the group name as the value.")
+	FWConvertCmd.Flags().StringVar(&labelKeysStr, "label-keys", "", "comma-separated label keys (e.g., app,env). addresses covering workloads that all share the same values for these keys are converted to labels instead of ip lists.")
+	FWConvertCmd.Flags().StringVar(&iplPrefix, "ipl-prefix", "fw-convert-", "prefix for the names of ip lists that need to be created.")
+	FWConvertCmd.Flags().StringVar(&svcPrefix, "svc-prefix", "fw-convert-", "prefix for the names of services that need to be created.")
+	FWConvertCmd.Flags().BoolVar(&includeDeny, "include-deny", false, "convert deny rules that are not catch-all denies. review the warnings for denies that overlap earlier allows before importing.")
+	FWConvertCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the rules output file location. default is current location with a timestamped filename. the other files use the same name with -iplists, -services, and -rulesets suffixes.")
+	FWConvertCmd.MarkFlagRequired("format")
+	FWConvertCmd.Flags().SortFlags = false
+}
+
+// FWConvertCmd converts firewall rulebases to import files
+var FWConvertCmd = &cobra.Command{
+	Use:   "fw-convert [firewall export]",
+	Short: "Convert an iptables, AWS security group, or Palo Alto rulebase to rule-import, ipl-import, and svc-import files.",
+	Long: `
+Convert an iptables, AWS security group, or Palo Alto rulebase to rule-import, ipl-import, and svc-import files.
+
+The following input formats are supported with the --format flag:
+- iptables: iptables-save or ip6tables-save output. The filter table's INPUT, FORWARD, and OUTPUT chains are converted, including jumps to custom chains. Processing of a chain stops at a RETURN and the rest of the chain is skipped with a warning when the RETURN has matches. Rules on the loopback interface, for established connections only, or matching ipsets or source ports are skipped.
+- aws-sg: the json output of aws ec2 describe-security-groups. Ingress and egress permissions are converted. The default allow all egress rule is skipped.
+- pan: a PAN-OS or Panorama configuration xml export. Security rules are converted with address and service objects and groups resolved in the device group or vsys of the rule and then in shared. Zones are not converted and only the services of rules with applications are used.
+
+Addresses are mapped in the following order:
+1. The protected side (the local side of INPUT and OUTPUT chains or the security group itself) is the --host workload, the security group label if --sg-label-key is set, or all workloads.
+2. 0.0.0.0/0 and ::/0 are the Any (0.0.0.0/0 and ::/0) ip list. Destinations also include all workloads.
+3. Individual ip addresses that are all on PCE workloads are the workloads.
+4. Addresses with the same entries as an existing ip list use that ip list.
+5. If --label-keys is set, addresses covering workloads that all share the same values for the label keys are those labels.
+6. Everything else is an ip list that is created with ipl-import.
+
+Deny rules are skipped by default. Catch-all denies (e.g., a final drop all) are always skipped since the PCE default deny covers them. With --include-deny, the other deny rules are converted and a warning is logged for each deny that overlaps an earlier allow. The firewall evaluates rules in order but the PCE evaluates deny rules before allow rules, so an overlapping deny blocks traffic the firewall allowed.
+
+Ports are mapped to an existing service with the same ports and protocols, inline port and protocol for tcp and udp, or a service that is created with svc-import.
+
+The output files are:
+- workloader-fw-convert-rules-<timestamp>.csv for rule-import.
+- workloader-fw-convert-iplists-<timestamp>.csv for ipl-import if ip lists need to be created.
+- workloader-fw-convert-services-<timestamp>.csv for svc-import if services need to be created.
+- workloader-fw-convert-rulesets-<timestamp>.csv for ruleset-import if the ruleset does not exist.
+
+Import the files in the order of ruleset-import, ipl-import, svc-import, and rule-import. Rules use the external data set workloader-fw-convert and the external data reference is the source rule so they can be identified after import.
+
+The update-pce and --no-prompt flags are ignored for this command.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// Get the input file
+		if len(args) != 1 {
+			fmt.Println("command requires 1 argument for the firewall export. See usage help.")
+			os.Exit(0)
+		}
+
+		// Get the PCE
+		pce, err := utils.GetTargetPCEV2(true)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+
+		fwConvert(pce, args[0])
+	},
+}
+
+func fwConvert(pce ia.PCE, inputFile string) {
+
+	// Parse the input
+	file, err := os.Open(inputFile)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	defer file.Close()
+	var rules []fwRule
+	switch strings.ToLower(format) {
+	case "iptables":
+		rules, err = parseIPTables(file)
+	case "aws-sg":
+		rules, err = parseAWSSG(file)
+	case "pan":
+		rules, err = parsePANXML(file)
+	default:
+		utils.LogErrorf("%s is not a valid format. options are iptables, aws-sg, and pan.", format)
+	}
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	utils.LogInfof(true, "parsed %d rules from %s", len(rules), inputFile)
+	rules = filterDenies(rules)
+
+	// Process the flags
+	if rulesetName == "" {
+		rulesetName = "fw-convert-" + strings.TrimSuffix(filepath.Base(inputFile), filepath.Ext(inputFile))
+	}
+	for _, k := range strings.Split(labelKeysStr, ",") {
+		if strings.TrimSpace(k) != "" {
+			labelKeys = append(labelKeys, strings.TrimSpace(k))
+		}
+	}
+
+	// Get the PCE objects used for mapping
+	apiResps, err := pce.Load(ia.LoadInput{Workloads: true, Labels: true, IPLists: true, Services: true, RuleSets: true, ProvisionStatus: "draft"}, utils.UseMulti())
+	utils.LogMultiAPIRespV2(apiResps)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	if host != "" {
+		if _, ok := pce.Workloads[host]; !ok {
+			utils.LogErrorf("%s does not exist as a workload", host)
+		}
+	}
+	c := newConverter(pce)
+
+	// Convert the rules
+	ruleData := [][]string{ruleHeaders}
+	for _, r := range rules {
+		row, err := c.ruleRow(r)
+		if err != nil {
+			utils.LogWarningf(true, "%s - skipping - %s", r.Origin, err)
+			continue
+		}
+		ruleData = append(ruleData, row)
+	}
+	if len(ruleData) == 1 {
+		utils.LogInfo("no rules to convert", true)
+		return
+	}
+
+	// Write the output files. The other files are named after the rules file.
+	ts := time.Now().Format("20060102_150405")
+	fileName := func(kind string) string {
+		if outputFileName == "" {
+			return fmt.Sprintf("workloader-fw-convert-%s-%s.csv", kind, ts)
+		}
+		if kind == "rules" {
+			return outputFileName
+		}
+		return fmt.Sprintf("%s-%s.csv", strings.TrimSuffix(outputFileName, ".csv"), kind)
+	}
+	steps := []string{}
+
+	rulesetExists := false
+	for _, rs := range pce.RuleSetsSlice {
+		if rs.Name == rulesetName {
+			rulesetExists = true
+		}
+	}
+	if !rulesetExists {
+		if scope == "" {
+			utils.LogWarningf(true, "%s does not exist and --scope is not set. the ruleset will have no scope.", rulesetName)
+		}
+		rulesetFile := fileName("rulesets")
+		utils.WriteOutput([][]string{{"name", "enabled", "description", "scope"}, {rulesetName, "true", fmt.Sprintf("created by fw-convert from %s", filepath.Base(inputFile)), scope}}, nil, rulesetFile)
+		steps = append(steps, fmt.Sprintf("workloader ruleset-import %s", rulesetFile))
+	}
+	if len(c.genIPLs) > 0 {
+		iplFile := fileName("iplists")
+		utils.WriteOutput(c.ipListRows(), nil, iplFile)
+		steps = append(steps, fmt.Sprintf("workloader ipl-import %s", iplFile))
+	}
+	if len(c.genSvcs) > 0 {
+		svcFile := fileName("services")
+		utils.WriteOutput(c.serviceRows(), nil, svcFile)
+		steps = append(steps, fmt.Sprintf("workloader svc-import %s", svcFile))
+	}
+	utils.WriteOutput(ruleData, nil, fileName("rules"))
+	steps = append(steps, fmt.Sprintf("workloader rule-import %s --create-labels", fileName("rules")))
+
+	utils.LogInfof(true, "converted %d of %d rules with %d ip lists and %d services to create", len(ruleData)-1, len(rules), len(c.genIPLs), len(c.genSvcs))
+	for i, s := range steps {
+		utils.LogInfof(true, "import step %d: %s", i+1, s)
+	}
+}
@@ -0,0 +1,482 @@
+package fwconvert
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	ia "github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/cmd/iplimport"
+	"github.com/brian1917/workloader/cmd/ruleexport"
+	"github.com/brian1917/workloader/cmd/svcexport"
+	"github.com/brian1917/workloader/utils"
+)
+
+// defaultAnyIPList is the name of the ip list the PCE creates for 0.0.0.0/0 and ::/0
+const defaultAnyIPList = "Any (0.0.0.0/0 and ::/0)"
+
+// generatedIPList is an ip list that needs to be created with ipl-import
+type generatedIPList struct {
+	name    string
+	entries []string
+	fqdns   []string
+	origins []string
+}
+
+// generatedService is a service that needs to be created with svc-import
+type generatedService struct {
+	name    string
+	ports   []fwPort
+	origins []string
+}
+
+// ruleSide is the rule-import columns for the source or destination
+type ruleSide struct {
+	allWorkloads bool
+	labels       []string
+	iplists      []string
+	workloads    []string
+}
+
+// converter maps firewall objects to PCE objects
+type converter struct {
+	pce          ia.PCE
+	wkldIPs      map[string]string
+	wklds        []ia.Workload
+	iplByEntries map[string]string
+	iplNames     map[string]bool
+	anyIPList    string
+	svcByPorts   map[string]string
+	genIPLs      map[string]*generatedIPList
+	genIPLNames  map[string]bool
+	genSvcs      map[string]*generatedService
+	genSvcNames  map[string]bool
+}
+
+// entriesKey is the sorted key of ip list entries and fqdns
+func entriesKey(entries, fqdns []string) string {
+	keys := append(append([]string{}, entries...), fqdns...)
+	sort.Strings(keys)
+	return strings.Join(keys, ";")
+}
+
+// newConverter loads the PCE objects used for mapping
+func newConverter(pce ia.PCE) *converter {
+	c := &converter{pce: pce, wkldIPs: make(map[string]string), iplByEntries: make(map[string]string), iplNames: make(map[string]bool), svcByPorts: make(map[string]string), genIPLs: make(map[string]*generatedIPList), genIPLNames: make(map[string]bool), genSvcs: make(map[string]*generatedService), genSvcNames: make(map[string]bool)}
+
+	// Workloads by ip
+	for _, w := range pce.WorkloadsSlice {
+		name := ia.PtrToVal(w.Hostname)
+		if name == "" {
+			name = ia.PtrToVal(w.Name)
+		}
+		for _, i := range ia.PtrToVal(w.Interfaces) {
+			ip := net.ParseIP(i.Address)
+			if ip == nil {
+				continue
+			}
+			if existing, ok := c.wkldIPs[ip.String()]; ok && existing != name {
+				utils.LogWarningf(false, "%s is on workloads %s and %s. using %s.", ip, existing, name, existing)
+				continue
+			}
+			c.wkldIPs[ip.String()] = name
+		}
+		c.wklds = append(c.wklds, w)
+	}
+
+	// IP lists by entries
+	c.anyIPList = defaultAnyIPList
+	for _, ipl := range pce.IPListsSlice {
+		entries := []string{}
+		for _, r := range ia.PtrToVal(ipl.IPRanges) {
+			if r.Exclusion {
+				entries = nil
+				break
+			}
+			entry := r.FromIP
+			if r.ToIP != "" {
+				entry = fmt.Sprintf("%s-%s", r.FromIP, r.ToIP)
+			}
+			if normalized, err := normalizeEntry(entry); err == nil {
+				entry = normalized
+			}
+			entries = append(entries, entry)
+		}
+		fqdns := []string{}
+		for _, f := range ia.PtrToVal(ipl.FQDNs) {
+			fqdns = append(fqdns, f.FQDN)
+		}
+		c.iplNames[ipl.Name] = true
+		if entries == nil || len(entries)+len(fqdns) == 0 {
+			continue
+		}
+		c.iplByEntries[entriesKey(entries, fqdns)] = ipl.Name
+	}
+
+	// The default any ip list is used unless it was renamed
+	if !c.iplNames[defaultAnyIPList] {
+		for _, key := range []string{"0.0.0.0/0", "0.0.0.0/0;::/0"} {
+			if name, ok := c.iplByEntries[key]; ok {
+				c.anyIPList = name
+			}
+		}
+	}
+
+	// Services with port and protocol entries by ports
+	for _, s := range pce.ServicesSlice {
+		if len(ia.PtrToVal(s.WindowsServices)) > 0 || len(ia.PtrToVal(s.ServicePorts)) == 0 {
+			continue
+		}
+		ports := []fwPort{}
+		for _, sp := range ia.PtrToVal(s.ServicePorts) {
+			p := fwPort{Proto: sp.Protocol, Port: ia.PtrToVal(sp.Port), ToPort: sp.ToPort}
+			if sp.Protocol == 1 || sp.Protocol == 58 {
+				p.Port, p.ToPort = sp.IcmpType, sp.IcmpCode
+				if p.Port == 0 && p.ToPort == 0 {
+					p.Port = -1
+				}
+			} else if sp.Port == nil || p.Port == 0 {
+				p.Port = -1
+			}
+			if p.ToPort == 0 {
+				p.ToPort = -1
+			}
+			ports = append(ports, p)
+		}
+		if _, ok := c.svcByPorts[portsKey(ports)]; !ok {
+			c.svcByPorts[portsKey(ports)] = s.Name
+		}
+	}
+
+	return c
+}
+
+// uniqueName returns the name or the name with a number suffix if it is already used
+func uniqueName(name string, used ...map[string]bool) string {
+	candidate := name
+	for i := 2; ; i++ {
+		taken := false
+		for _, u := range used {
+			if u[candidate] {
+				taken = true
+			}
+		}
+		if !taken {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s-%d", name, i)
+	}
+}
+
+// ipListFor returns an existing ip list with the same entries or a generated ip list
+func (c *converter) ipListFor(addr fwAddr, origin string) string {
+	key := entriesKey(addr.Entries, addr.FQDNs)
+	if name, ok := c.iplByEntries[key]; ok {
+		return name
+	}
+	if g, ok := c.genIPLs[key]; ok {
+		g.origins = append(g.origins, origin)
+		return g.name
+	}
+	name := addr.Name
+	if name == "" {
+		all := append(append([]string{}, addr.Entries...), addr.FQDNs...)
+		name = all[0]
+		if len(all) > 1 {
+			name = fmt.Sprintf("%s-and-%d-more", all[0], len(all)-1)
+		}
+	}
+	name = uniqueName(iplPrefix+name, c.iplNames, c.genIPLNames)
+	c.genIPLNames[name] = true
+	c.genIPLs[key] = &generatedIPList{name: name, entries: addr.Entries, fqdns: addr.FQDNs, origins: []string{origin}}
+	return name
+}
+
+// labelsFor returns the labels shared by every workload with an ip in the entries for the label keys.
+// The workloads must all have the same value for every key.
+func (c *converter) labelsFor(entries []string) []string {
+	if len(labelKeys) == 0 || len(entries) == 0 {
+		return nil
+	}
+	values := map[string]string{}
+	matched := 0
+	for _, w := range c.wklds {
+		inEntries := false
+		for _, i := range ia.PtrToVal(w.Interfaces) {
+			ip := net.ParseIP(i.Address)
+			for _, e := range entries {
+				if ip != nil && entryContains(e, ip) {
+					inEntries = true
+				}
+			}
+		}
+		if !inEntries {
+			continue
+		}
+		matched++
+		wkldValues := map[string]string{}
+		for _, l := range ia.PtrToVal(w.Labels) {
+			wkldValues[c.pce.Labels[l.Href].Key] = c.pce.Labels[l.Href].Value
+		}
+		for _, k := range labelKeys {
+			if wkldValues[k] == "" {
+				return nil
+			}
+			if v, ok := values[k]; ok && v != wkldValues[k] {
+				return nil
+			}
+			values[k] = wkldValues[k]
+		}
+	}
+	if matched == 0 {
+		return nil
+	}
+	labels := []string{}
+	for _, k := range labelKeys {
+		labels = append(labels, fmt.Sprintf("%s:%s", k, values[k]))
+	}
+	return labels
+}
+
+// mapAddrs maps the addresses of one side of a rule to rule-import columns. Provider is true for the destination.
+func (c *converter) mapAddrs(addrs []fwAddr, provider bool, origin string) (ruleSide, error) {
+	side := ruleSide{}
+	for _, a := range addrs {
+		switch {
+		case a.Self && host != "":
+			if _, ok := c.pce.Workloads[host]; !ok {
+				return side, fmt.Errorf("%s does not exist as a workload", host)
+			}
+			side.workloads = append(side.workloads, host)
+		case a.Group != "" && sgLabelKey != "":
+			side.labels = append(side.labels, fmt.Sprintf("%s:%s", sgLabelKey, a.Group))
+		case a.Self:
+			side.allWorkloads = true
+		case a.Group != "":
+			return side, fmt.Errorf("security group %s is referenced. use --sg-label-key to map security groups to labels", a.Group)
+		case a.Any:
+			// Destinations of any are workloads and anything outside of the PCE
+			side.iplists = append(side.iplists, c.anyIPList)
+			if provider {
+				side.allWorkloads = true
+			}
+		default:
+			// Individual ips of workloads map to the workloads
+			wklds := []string{}
+			for _, e := range a.Entries {
+				if ip := net.ParseIP(e); ip != nil && c.wkldIPs[ip.String()] != "" {
+					wklds = append(wklds, c.wkldIPs[ip.String()])
+				}
+			}
+			if len(wklds) == len(a.Entries) && len(a.FQDNs) == 0 {
+				side.workloads = append(side.workloads, wklds...)
+				continue
+			}
+
+			// Existing ip lists are used before labels
+			if name, ok := c.iplByEntries[entriesKey(a.Entries, a.FQDNs)]; ok {
+				side.iplists = append(side.iplists, name)
+				continue
+			}
+			if labels := c.labelsFor(a.Entries); labels != nil && len(a.FQDNs) == 0 {
+				utils.LogInfo(fmt.Sprintf("%s - %s mapped to labels %s", origin, strings.Join(a.Entries, ";"), strings.Join(labels, ";")), false)
+				side.labels = append(side.labels, labels...)
+				continue
+			}
+			side.iplists = append(side.iplists, c.ipListFor(a, origin))
+		}
+	}
+	return side, nil
+}
+
+// inlinePort returns the rule-import value for a tcp or udp port or an empty string if it needs a service
+func inlinePort(p fwPort) string {
+	if (p.Proto != 6 && p.Proto != 17) || p.Port < 0 {
+		return ""
+	}
+	proto := "tcp"
+	if p.Proto == 17 {
+		proto = "udp"
+	}
+	if p.ToPort > 0 && p.ToPort != p.Port {
+		return fmt.Sprintf("%d-%d %s", p.Port, p.ToPort, proto)
+	}
+	return fmt.Sprintf("%d %s", p.Port, proto)
+}
+
+// portName is used to name generated services for ports without an object name
+func portName(p fwPort) string {
+	proto := strconv.Itoa(p.Proto)
+	for name, n := range protocolNumbers {
+		if n == p.Proto && !strings.Contains(name, "-") {
+			proto = name
+		}
+	}
+	switch {
+	case p.Port < 0:
+		return proto + "-all"
+	case p.ToPort >= 0:
+		return fmt.Sprintf("%s-%d-%d", proto, p.Port, p.ToPort)
+	default:
+		return fmt.Sprintf("%s-%d", proto, p.Port)
+	}
+}
+
+// serviceFor returns an existing service with the same ports or a generated service
+func (c *converter) serviceFor(name string, ports []fwPort, origin string) string {
+	key := portsKey(ports)
+	if existing, ok := c.svcByPorts[key]; ok {
+		return existing
+	}
+	if g, ok := c.genSvcs[key]; ok {
+		g.origins = append(g.origins, origin)
+		return g.name
+	}
+	if name == "" {
+		name = portName(ports[0])
+	}
+	name = uniqueName(svcPrefix+name, c.genSvcNames, c.existingServiceNames())
+	c.genSvcNames[name] = true
+	c.genSvcs[key] = &generatedService{name: name, ports: ports, origins: []string{origin}}
+	return name
+}
+
+// existingServiceNames is the set of service names in the PCE
+func (c *converter) existingServiceNames() map[string]bool {
+	names := make(map[string]bool)
+	for _, s := range c.pce.ServicesSlice {
+		names[s.Name] = true
+	}
+	return names
+}
+
+// mapServices maps the services of a rule to rule-import values. Named objects that match an existing service use it.
+// Otherwise tcp and udp ports are inline and other protocols are generated services.
+func (c *converter) mapServices(svcs []fwService, origin string) []string {
+	values := []string{}
+	seen := make(map[string]bool)
+	add := func(v string) {
+		if !seen[v] {
+			seen[v] = true
+			values = append(values, v)
+		}
+	}
+	for _, s := range svcs {
+		if s.Any {
+			return []string{"All Services"}
+		}
+		if s.Name != "" {
+			if existing, ok := c.svcByPorts[portsKey(s.Ports)]; ok {
+				add(existing)
+				continue
+			}
+		}
+		needService := []fwPort{}
+		for _, p := range s.Ports {
+			if existing, ok := c.svcByPorts[portsKey([]fwPort{p})]; ok {
+				add(existing)
+			} else if inline := inlinePort(p); inline != "" {
+				add(inline)
+			} else {
+				needService = append(needService, p)
+			}
+		}
+		if len(needService) > 0 {
+			add(c.serviceFor(s.Name, needService, origin))
+		}
+	}
+	return values
+}
+
+// ruleRow builds the rule-import row for a rule
+func (c *converter) ruleRow(r fwRule) ([]string, error) {
+	src, err := c.mapAddrs(r.Src, false, r.Origin)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := c.mapAddrs(r.Dst, true, r.Origin)
+	if err != nil {
+		return nil, err
+	}
+	services := c.mapServices(r.Svcs, r.Origin)
+
+	// Consumers that are not the protected side are outside of the ruleset scope
+	unscoped := true
+	for _, a := range r.Src {
+		if a.Self {
+			unscoped = false
+		}
+	}
+
+	description := r.Origin
+	if r.Comment != "" {
+		description = fmt.Sprintf("%s - %s", r.Origin, r.Comment)
+	}
+
+	values := map[string]string{
+		ruleexport.HeaderRulesetName:           rulesetName,
+		ruleexport.HeaderRuleType:              r.Action,
+		ruleexport.HeaderRuleDescription:       description,
+		ruleexport.HeaderRuleEnabled:           strconv.FormatBool(r.Enabled),
+		ruleexport.HeaderUnscopedConsumers:     strconv.FormatBool(unscoped),
+		ruleexport.HeaderSrcAllWorkloads:       strconv.FormatBool(src.allWorkloads),
+		ruleexport.HeaderSrcLabels:             strings.Join(src.labels, ";"),
+		ruleexport.HeaderSrcIplists:            strings.Join(src.iplists, ";"),
+		ruleexport.HeaderSrcWorkloads:          strings.Join(src.workloads, ";"),
+		ruleexport.HeaderDstAllWorkloads:       strconv.FormatBool(dst.allWorkloads),
+		ruleexport.HeaderDstLabels:             strings.Join(dst.labels, ";"),
+		ruleexport.HeaderDstIplists:            strings.Join(dst.iplists, ";"),
+		ruleexport.HeaderDstWorkloads:          strings.Join(dst.workloads, ";"),
+		ruleexport.HeaderServices:              strings.Join(services, ";"),
+		ruleexport.HeaderSrcResolveLabelsAs:    "workloads",
+		ruleexport.HeaderDstResolveLabelsAs:    "workloads",
+		ruleexport.HeaderExternalDataSet:       "workloader-fw-convert",
+		ruleexport.HeaderExternalDataReference: r.Origin,
+	}
+	row := []string{}
+	for _, h := range ruleHeaders {
+		row = append(row, values[h])
+	}
+	return row, nil
+}
+
+// ruleHeaders are the rule-import columns written by fw-convert
+var ruleHeaders = []string{ruleexport.HeaderRulesetName, ruleexport.HeaderRuleType, ruleexport.HeaderRuleDescription, ruleexport.HeaderRuleEnabled, ruleexport.HeaderUnscopedConsumers, ruleexport.HeaderSrcAllWorkloads, ruleexport.HeaderSrcLabels, ruleexport.HeaderSrcIplists, ruleexport.HeaderSrcWorkloads, ruleexport.HeaderDstAllWorkloads, ruleexport.HeaderDstLabels, ruleexport.HeaderDstIplists, ruleexport.HeaderDstWorkloads, ruleexport.HeaderServices, ruleexport.HeaderSrcResolveLabelsAs, ruleexport.HeaderDstResolveLabelsAs, ruleexport.HeaderExternalDataSet, ruleexport.HeaderExternalDataReference}
+
+// ipListRows builds the ipl-import rows for generated ip lists
+func (c *converter) ipListRows() [][]string {
+	data := [][]string{{iplimport.HeaderName, iplimport.HeaderDescription, iplimport.HeaderInclude, iplimport.HeaderFqdns, iplimport.HeaderExternalDataSet, iplimport.HeaderExternalDataRef}}
+	for _, g := range c.genIPLs {
+		data = append(data, []string{g.name, fmt.Sprintf("created by fw-convert from %s", strings.Join(g.origins, ", ")), strings.Join(g.entries, ";"), strings.Join(g.fqdns, ";"), "workloader-fw-convert", g.name})
+	}
+	sort.Slice(data[1:], func(i, j int) bool { return data[i+1][0] < data[j+1][0] })
+	return data
+}
+
+// serviceRows builds the svc-import rows for generated services. Each port is a row with the same name.
+func (c *converter) serviceRows() [][]string {
+	data := [][]string{{svcexport.HeaderName, svcexport.HeaderDescription, svcexport.HeaderPort, svcexport.HeaderProto, svcexport.HeaderICMPType, svcexport.HeaderICMPCode, svcexport.HeaderExternalDataSet, svcexport.HeaderExternalDataReference}}
+	for _, g := range c.genSvcs {
+		for _, p := range g.ports {
+			row := []string{g.name, fmt.Sprintf("created by fw-convert from %s", strings.Join(g.origins, ", ")), "", strconv.Itoa(p.Proto), "", "", "workloader-fw-convert", g.name}
+			switch {
+			case p.Proto == 1 || p.Proto == 58:
+				if p.Port >= 0 {
+					row[4] = strconv.Itoa(p.Port)
+				}
+				if p.ToPort >= 0 {
+					row[5] = strconv.Itoa(p.ToPort)
+				}
+			case p.Port >= 0 && p.ToPort > 0 && p.ToPort != p.Port:
+				row[2] = fmt.Sprintf("%d-%d", p.Port, p.ToPort)
+			case p.Port >= 0:
+				row[2] = strconv.Itoa(p.Port)
+			}
+			data = append(data, row)
+		}
+	}
+	sort.SliceStable(data[1:], func(i, j int) bool { return data[i+1][0] < data[j+1][0] })
+	return data
+}
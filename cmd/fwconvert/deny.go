@@ -0,0 +1,174 @@
+package fwconvert
+
+import (
+	"bytes"
+	"net"
+	"strings"
+
+	"github.com/brian1917/workloader/utils"
+)
+
+// filterDenies removes the deny rules that should not be converted. Catch-all denies are always removed since the PCE
+// default deny covers them. Other denies are only kept with --include-deny and a warning is logged for denies that overlap an
+// earlier allow since PCE deny rules take precedence over allow rules regardless of order.
+func filterDenies(rules []fwRule) []fwRule {
+	filtered := []fwRule{}
+	allows := []fwRule{}
+	skipped := 0
+	for _, r := range rules {
+		if r.Action != "deny" {
+			if r.Enabled {
+				allows = append(allows, r)
+			}
+			filtered = append(filtered, r)
+			continue
+		}
+		if r.catchAll() {
+			utils.LogInfof(false, "%s - skipping - catch-all deny is covered by the default deny", r.Origin)
+			continue
+		}
+		if !includeDeny {
+			skipped++
+			utils.LogInfof(false, "%s - skipping - deny rules require --include-deny", r.Origin)
+			continue
+		}
+		for _, a := range allows {
+			if r.overlaps(a) {
+				utils.LogWarningf(true, "%s - deny overlaps the earlier allow %s. the pce evaluates deny rules before allow rules so traffic the firewall allowed will be blocked. review before importing.", r.Origin, a.Origin)
+			}
+		}
+		filtered = append(filtered, r)
+	}
+	if skipped > 0 {
+		utils.LogInfof(true, "skipped %d deny rules. use --include-deny to convert them.", skipped)
+	}
+	return filtered
+}
+
+// catchAll returns true if the rule matches all traffic to or from the protected side
+func (r fwRule) catchAll() bool {
+	for _, side := range [][]fwAddr{r.Src, r.Dst} {
+		for _, a := range side {
+			if !a.Any && !a.Self {
+				return false
+			}
+		}
+	}
+	for _, s := range r.Svcs {
+		if !s.Any {
+			return false
+		}
+	}
+	return true
+}
+
+// overlaps returns true if some traffic can match both rules
+func (r fwRule) overlaps(o fwRule) bool {
+	return addrsOverlap(r.Src, o.Src) && addrsOverlap(r.Dst, o.Dst) && svcsOverlap(r.Svcs, o.Svcs)
+}
+
+// addrsOverlap returns true if the addresses of two rule sides can match the same traffic
+func addrsOverlap(a, b []fwAddr) bool {
+	for _, x := range a {
+		for _, y := range b {
+			switch {
+			case x.Any || y.Any:
+				return true
+			case x.Self && y.Self:
+				return true
+			case x.Group != "" && x.Group == y.Group:
+				return true
+			}
+			for _, f := range x.FQDNs {
+				for _, g := range y.FQDNs {
+					if strings.EqualFold(f, g) {
+						return true
+					}
+				}
+			}
+			for _, e := range x.Entries {
+				for _, f := range y.Entries {
+					if entriesOverlap(e, f) {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// entryRange returns the first and last ip of an ip, cidr, or range entry
+func entryRange(entry string) (net.IP, net.IP) {
+	switch {
+	case strings.Contains(entry, "-"):
+		r := strings.Split(entry, "-")
+		return net.ParseIP(r[0]).To16(), net.ParseIP(r[1]).To16()
+	case strings.Contains(entry, "/"):
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, nil
+		}
+		last := make(net.IP, len(ipNet.IP))
+		for i := range ipNet.IP {
+			last[i] = ipNet.IP[i] | ^ipNet.Mask[i]
+		}
+		return ipNet.IP.To16(), last.To16()
+	default:
+		ip := net.ParseIP(entry).To16()
+		return ip, ip
+	}
+}
+
+// entriesOverlap returns true if two ip, cidr, or range entries share an address
+func entriesOverlap(a, b string) bool {
+	aFrom, aTo := entryRange(a)
+	bFrom, bTo := entryRange(b)
+	if aFrom == nil || aTo == nil || bFrom == nil || bTo == nil {
+		return false
+	}
+	return bytes.Compare(aFrom, bTo) <= 0 && bytes.Compare(bFrom, aTo) <= 0
+}
+
+// svcsOverlap returns true if two sets of services share a port
+func svcsOverlap(a, b []fwService) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x.Any || y.Any {
+				return true
+			}
+			for _, p := range x.Ports {
+				for _, q := range y.Ports {
+					if portsOverlap(p, q) {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// portsOverlap returns true if two ports share a protocol and port. ICMP ports are types and the codes are not compared.
+func portsOverlap(p, q fwPort) bool {
+	if p.Proto == -1 || q.Proto == -1 {
+		return true
+	}
+	if p.Proto != q.Proto {
+		return false
+	}
+	if p.Port == -1 || q.Port == -1 {
+		return true
+	}
+	if p.Proto == 1 || p.Proto == 58 {
+		return p.Port == q.Port
+	}
+	pTo, qTo := p.ToPort, q.ToPort
+	if pTo == -1 {
+		pTo = p.Port
+	}
+	if qTo == -1 {
+		qTo = q.Port
+	}
+	return p.Port <= qTo && q.Port <= pTo
+}
@@ -0,0 +1,107 @@
+package fwconvert
+
+import (
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/brian1917/workloader/utils"
+)
+
+func TestMain(m *testing.M) {
+	utils.Logger.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestParsePANXMLScopes(t *testing.T) {
+	config := `<config>
+<shared><address><entry name="web"><ip-netmask>10.0.0.10</ip-netmask></entry><entry name="db"><ip-netmask>10.0.0.20</ip-netmask></entry></address></shared>
+<devices><entry name="localhost.localdomain"><device-group>
+<entry name="dg1"><address><entry name="web"><ip-netmask>10.1.0.10</ip-netmask></entry></address>
+<pre-rulebase><security><rules><entry name="dg1-rule"><source><member>web</member></source><destination><member>db</member></destination><service><member>any</member></service><application><member>any</member></application><action>allow</action></entry></rules></security></pre-rulebase></entry>
+<entry name="dg2"><address><entry name="web"><ip-netmask>10.2.0.10</ip-netmask></entry></address>
+<pre-rulebase><security><rules><entry name="dg2-rule"><source><member>web</member></source><destination><member>db</member></destination><service><member>any</member></service><application><member>any</member></application><action>allow</action></entry></rules></security></pre-rulebase></entry>
+</device-group></entry></devices>
+</config>`
+
+	rules, err := parsePANXML(strings.NewReader(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{"pan rule dg1-rule": {"10.1.0.10"}, "pan rule dg2-rule": {"10.2.0.10"}}
+	if len(rules) != len(want) {
+		t.Fatalf("got %d rules, want %d", len(rules), len(want))
+	}
+	for _, r := range rules {
+		if got := r.Src[0].Entries; !reflect.DeepEqual(got, want[r.Origin]) {
+			t.Errorf("%s source is %v, want %v", r.Origin, got, want[r.Origin])
+		}
+		if got := r.Dst[0].Entries; !reflect.DeepEqual(got, []string{"10.0.0.20"}) {
+			t.Errorf("%s destination is %v, want the shared db object", r.Origin, got)
+		}
+	}
+}
+
+func TestParseIPTablesReturn(t *testing.T) {
+	save := `*filter
+:INPUT DROP [0:0]
+:APP - [0:0]
+-A INPUT -j APP
+-A APP -p tcp --dport 443 -j ACCEPT
+-A APP -s 10.0.0.0/8 -j RETURN
+-A APP -p tcp --dport 22 -j ACCEPT
+-A INPUT -p tcp --dport 80 -j ACCEPT
+-A INPUT -j RETURN
+-A INPUT -p tcp --dport 8080 -j ACCEPT
+COMMIT
+`
+	rules, err := parseIPTables(strings.NewReader(save))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, r := range rules {
+		got = append(got, r.Origin)
+	}
+	if want := []string{"iptables APP line 5", "iptables INPUT line 8"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got rules %v, want %v", got, want)
+	}
+}
+
+func TestFilterDenies(t *testing.T) {
+	web := []fwAddr{{Entries: []string{"10.0.0.0/24"}}}
+	https := []fwService{{Ports: []fwPort{{Proto: 6, Port: 443, ToPort: -1}}}}
+	rules := []fwRule{
+		{Origin: "allow https", Action: "allow", Enabled: true, Src: web, Dst: []fwAddr{{Self: true}}, Svcs: https},
+		{Origin: "deny host", Action: "deny", Enabled: true, Src: []fwAddr{{Entries: []string{"10.0.0.5"}}}, Dst: []fwAddr{{Self: true}}, Svcs: []fwService{{Any: true}}},
+		{Origin: "drop all", Action: "deny", Enabled: true, Src: []fwAddr{anyAddr}, Dst: []fwAddr{{Self: true}}, Svcs: []fwService{{Any: true}}},
+	}
+
+	origins := func(rules []fwRule) []string {
+		o := []string{}
+		for _, r := range rules {
+			o = append(o, r.Origin)
+		}
+		return o
+	}
+
+	includeDeny = false
+	if got, want := origins(filterDenies(rules)), []string{"allow https"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("without --include-deny got %v, want %v", got, want)
+	}
+	includeDeny = true
+	defer func() { includeDeny = false }()
+	if got, want := origins(filterDenies(rules)), []string{"allow https", "deny host"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("with --include-deny got %v, want %v", got, want)
+	}
+	if !rules[1].overlaps(rules[0]) {
+		t.Error("deny of 10.0.0.5 does not overlap the allow of 10.0.0.0/24 on 443")
+	}
+	other := rules[1]
+	other.Src = []fwAddr{{Entries: []string{"10.0.1.0-10.0.1.255"}}}
+	if other.overlaps(rules[0]) {
+		t.Error("deny of 10.0.1.0-10.0.1.255 overlaps the allow of 10.0.0.0/24")
+	}
+}
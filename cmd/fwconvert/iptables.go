@@ -0,0 +1,322 @@
+package fwconvert
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/brian1917/workloader/utils"
+)
+
+// iptRule is a rule from iptables-save. Values are the raw option values.
+type iptRule struct {
+	line     int
+	chain    string
+	src      string
+	dst      string
+	proto    string
+	dports   string
+	icmpType string
+	target   string
+	comment  string
+	iface    string
+	skip     string
+}
+
+// icmpTypes are the icmp type names iptables accepts
+var icmpTypes = map[string]string{"any": "", "echo-reply": "0", "pong": "0", "destination-unreachable": "3", "source-quench": "4", "redirect": "5", "echo-request": "8", "ping": "8", "router-advertisement": "9", "router-solicitation": "10", "time-exceeded": "11", "ttl-exceeded": "11", "parameter-problem": "12", "timestamp-request": "13", "timestamp-reply": "14"}
+
+// tokenize splits an iptables-save line on spaces and keeps quoted values together
+func tokenize(line string) []string {
+	tokens := []string{}
+	var current strings.Builder
+	inQuote, escaped := false, false
+	for _, r := range line {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			inQuote = !inQuote
+		case r == ' ' && !inQuote:
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+	return tokens
+}
+
+// parseIPTablesRule parses the options of a -A line
+func parseIPTablesRule(tokens []string, line int) iptRule {
+	r := iptRule{line: line, chain: tokens[1]}
+	negated := false
+	for i := 2; i < len(tokens); i++ {
+		opt := tokens[i]
+		if opt == "!" {
+			negated = true
+			continue
+		}
+		if !strings.HasPrefix(opt, "-") {
+			continue
+		}
+
+		// Options are followed by a value unless they are flags (e.g., --syn)
+		value := ""
+		if i+1 < len(tokens) && !strings.HasPrefix(tokens[i+1], "-") && tokens[i+1] != "!" {
+			value = tokens[i+1]
+			i++
+		}
+		if negated {
+			r.skip = fmt.Sprintf("negated match on %s %s", opt, value)
+			negated = false
+		}
+
+		switch opt {
+		case "-s", "--source":
+			r.src = value
+		case "-d", "--destination":
+			r.dst = value
+		case "-p", "--protocol":
+			r.proto = value
+		case "--dport", "--destination-port", "--dports", "--destination-ports":
+			r.dports = value
+		case "--sport", "--source-port", "--sports", "--source-ports":
+			r.skip = "source port matches cannot be converted"
+		case "--icmp-type", "--icmpv6-type":
+			r.icmpType = value
+		case "-j", "--jump", "-g", "--goto":
+			r.target = value
+		case "--comment":
+			r.comment = value
+		case "-i", "--in-interface", "-o", "--out-interface":
+			r.iface = value
+			if value == "lo" {
+				r.skip = "loopback interface"
+			}
+		case "--state", "--ctstate":
+			if !strings.Contains(value, "NEW") && !strings.Contains(value, "UNTRACKED") {
+				r.skip = fmt.Sprintf("state %s is implicitly allowed by the stateful enforcement", value)
+			}
+		case "--match-set":
+			r.skip = "ipset matches cannot be converted"
+		}
+	}
+	return r
+}
+
+// conditional returns true if the rule matches only some packets. State matches are ignored since only new connections are converted.
+func (r iptRule) conditional() bool {
+	return r.src != "" || r.dst != "" || r.proto != "" || r.dports != "" || r.icmpType != "" || r.iface != "" || (r.skip != "" && !strings.HasPrefix(r.skip, "state "))
+}
+
+// mergeIPTablesRules combines the matches of a jump rule with a rule in the target chain
+func mergeIPTablesRules(jump, r iptRule) (iptRule, error) {
+	merged := r
+	for _, field := range []struct {
+		name      string
+		from, to  string
+		mergedPtr *string
+	}{{"source", jump.src, r.src, &merged.src}, {"destination", jump.dst, r.dst, &merged.dst}, {"protocol", jump.proto, r.proto, &merged.proto}, {"destination ports", jump.dports, r.dports, &merged.dports}} {
+		if field.from == "" {
+			continue
+		}
+		if field.to != "" && field.to != field.from {
+			return merged, fmt.Errorf("%s %s in chain %s conflicts with %s from the jump on line %d", field.name, field.to, r.chain, field.from, jump.line)
+		}
+		*field.mergedPtr = field.from
+	}
+	if merged.comment == "" {
+		merged.comment = jump.comment
+	}
+	if jump.skip != "" {
+		merged.skip = jump.skip
+	}
+	return merged, nil
+}
+
+// parseIPTables parses the filter table of iptables-save or ip6tables-save output
+func parseIPTables(r io.Reader) ([]fwRule, error) {
+	chains := make(map[string][]iptRule)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1024*1024), 10*1024*1024)
+	table := ""
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(text, "*"):
+			table = strings.TrimPrefix(text, "*")
+		case table != "filter":
+			continue
+		case strings.HasPrefix(text, ":"):
+			fields := strings.Fields(strings.TrimPrefix(text, ":"))
+			if len(fields) > 1 && fields[1] != "-" {
+				utils.LogInfo(fmt.Sprintf("iptables %s chain default policy is %s", fields[0], fields[1]), false)
+			}
+		case strings.HasPrefix(text, "-A "):
+			tokens := tokenize(text)
+			if len(tokens) < 2 {
+				continue
+			}
+			rule := parseIPTablesRule(tokens, line)
+			chains[rule.chain] = append(chains[rule.chain], rule)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(chains) == 0 {
+		return nil, fmt.Errorf("no rules in the filter table. input must be iptables-save output")
+	}
+
+	rules := []fwRule{}
+	var walk func(chain, builtin string, jump *iptRule, depth int)
+	walk = func(chain, builtin string, jump *iptRule, depth int) {
+		if depth > 10 {
+			utils.LogWarningf(true, "iptables chain %s - jumps nested more than 10 chains deep. skipping.", chain)
+			return
+		}
+		for _, r := range chains[chain] {
+			// Rules after a RETURN only match packets the RETURN did not. Stop at an unconditional RETURN and
+			// skip the rest of the chain after a conditional one since the exclusion cannot be converted.
+			if r.target == "RETURN" {
+				if r.conditional() {
+					utils.LogWarningf(true, "iptables line %d - RETURN with matches in chain %s. skipping the rest of the chain since the rules after it cannot be converted without the exclusion.", r.line, chain)
+				}
+				return
+			}
+			if jump != nil {
+				var err error
+				if r, err = mergeIPTablesRules(*jump, r); err != nil {
+					utils.LogWarningf(true, "iptables line %d - skipping - %s", r.line, err)
+					continue
+				}
+			}
+			switch r.target {
+			case "ACCEPT", "DROP", "REJECT":
+			case "LOG", "MARK", "CONNMARK", "NFLOG", "":
+				continue
+			default:
+				if _, ok := chains[r.target]; ok {
+					jumpRule := r
+					walk(r.target, builtin, &jumpRule, depth+1)
+				} else {
+					utils.LogWarningf(false, "iptables line %d - skipping - target %s is not supported", r.line, r.target)
+				}
+				continue
+			}
+			if r.skip != "" {
+				utils.LogWarningf(false, "iptables line %d - skipping - %s", r.line, r.skip)
+				continue
+			}
+			rule, err := iptRuleToFWRule(r, builtin)
+			if err != nil {
+				utils.LogWarningf(true, "iptables line %d - skipping - %s", r.line, err)
+				continue
+			}
+			rules = append(rules, rule)
+		}
+	}
+	for _, builtin := range []string{"INPUT", "FORWARD", "OUTPUT"} {
+		walk(builtin, builtin, nil, 0)
+	}
+	return rules, nil
+}
+
+// iptAddr converts an iptables address option. Missing addresses are the protected host for the local side of INPUT and OUTPUT.
+func iptAddr(value string, self bool) ([]fwAddr, error) {
+	if value == "" {
+		if self {
+			return []fwAddr{{Self: true}}, nil
+		}
+		return []fwAddr{anyAddr}, nil
+	}
+	addr := fwAddr{}
+	for _, v := range strings.Split(value, ",") {
+		entry, err := normalizeEntry(v)
+		if err != nil {
+			return nil, err
+		}
+		if isAnyEntry(entry) {
+			return []fwAddr{anyAddr}, nil
+		}
+		addr.Entries = append(addr.Entries, entry)
+	}
+	return []fwAddr{addr}, nil
+}
+
+// iptRuleToFWRule converts an iptables rule
+func iptRuleToFWRule(r iptRule, builtin string) (fwRule, error) {
+	rule := fwRule{Origin: fmt.Sprintf("iptables %s line %d", r.chain, r.line), Comment: r.comment, Action: "allow", Enabled: true}
+	if r.target != "ACCEPT" {
+		rule.Action = "deny"
+	}
+
+	var err error
+	if rule.Src, err = iptAddr(r.src, builtin == "OUTPUT"); err != nil {
+		return rule, err
+	}
+	if rule.Dst, err = iptAddr(r.dst, builtin == "INPUT"); err != nil {
+		return rule, err
+	}
+
+	proto, err := protocolNumber(r.proto)
+	if r.proto == "" {
+		proto, err = -1, nil
+	}
+	if err != nil {
+		return rule, err
+	}
+	switch {
+	case proto == -1:
+		rule.Svcs = []fwService{{Any: true}}
+	case proto == 1 || proto == 58:
+		port := fwPort{Proto: proto, Port: -1, ToPort: -1}
+		if r.icmpType != "" {
+			typeCode := strings.Split(r.icmpType, "/")
+			if t, ok := icmpTypes[typeCode[0]]; ok {
+				typeCode[0] = t
+			}
+			if typeCode[0] != "" {
+				if port.Port, err = strconv.Atoi(typeCode[0]); err != nil {
+					return rule, fmt.Errorf("icmp type %s is not supported", r.icmpType)
+				}
+			}
+			if len(typeCode) == 2 {
+				if port.ToPort, err = strconv.Atoi(typeCode[1]); err != nil {
+					return rule, fmt.Errorf("icmp code %s is not supported", r.icmpType)
+				}
+			}
+		}
+		rule.Svcs = []fwService{{Ports: []fwPort{port}}}
+	case r.dports == "":
+		rule.Svcs = []fwService{{Ports: []fwPort{{Proto: proto, Port: -1, ToPort: -1}}}}
+	default:
+		for _, p := range strings.Split(r.dports, ",") {
+			port := fwPort{Proto: proto, ToPort: -1}
+			fromTo := strings.Split(p, ":")
+			if port.Port, err = strconv.Atoi(fromTo[0]); err != nil {
+				return rule, fmt.Errorf("port %s is not valid", p)
+			}
+			if len(fromTo) == 2 {
+				if port.ToPort, err = strconv.Atoi(fromTo[1]); err != nil {
+					return rule, fmt.Errorf("port %s is not valid", p)
+				}
+			}
+			rule.Svcs = append(rule.Svcs, fwService{Ports: []fwPort{port}})
+		}
+	}
+	return rule, nil
+}
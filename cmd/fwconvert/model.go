@@ -0,0 +1,131 @@
+package fwconvert
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// fwRule is a firewall rule normalized from any of the input formats
+type fwRule struct {
+	Origin  string
+	Comment string
+	Action  string
+	Enabled bool
+	Src     []fwAddr
+	Dst     []fwAddr
+	Svcs    []fwService
+}
+
+// fwAddr is one side of a rule. Self is the host or group the rulebase protects. Group is a security group reference.
+type fwAddr struct {
+	Name    string
+	Entries []string
+	FQDNs   []string
+	Any     bool
+	Self    bool
+	Group   string
+}
+
+// fwService is a service object or inline port. An empty Ports slice with Any set is all services.
+type fwService struct {
+	Name  string
+	Ports []fwPort
+	Any   bool
+}
+
+// fwPort is a protocol and port range. For ICMP the port is the type and the to port is the code. -1 is any.
+type fwPort struct {
+	Proto  int
+	Port   int
+	ToPort int
+}
+
+// key is used to compare ports to existing PCE services
+func (p fwPort) key() string {
+	return fmt.Sprintf("%d/%d/%d", p.Proto, p.Port, p.ToPort)
+}
+
+// portsKey is the sorted key of a set of ports
+func portsKey(ports []fwPort) string {
+	keys := []string{}
+	for _, p := range ports {
+		keys = append(keys, p.key())
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ";")
+}
+
+// anyAddr is the address for any
+var anyAddr = fwAddr{Any: true}
+
+// protocolNumbers are protocol names used by the input formats
+var protocolNumbers = map[string]int{"icmp": 1, "tcp": 6, "udp": 17, "gre": 47, "esp": 50, "ah": 51, "icmpv6": 58, "ipv6-icmp": 58, "sctp": 132}
+
+// protocolNumber converts a protocol name or number. -1 and all are any protocol.
+func protocolNumber(proto string) (int, error) {
+	proto = strings.ToLower(proto)
+	if proto == "all" || proto == "-1" {
+		return -1, nil
+	}
+	if n, ok := protocolNumbers[proto]; ok {
+		return n, nil
+	}
+	n, err := strconv.Atoi(proto)
+	if err != nil || n < 0 || n > 255 {
+		return 0, fmt.Errorf("%s is not a valid protocol", proto)
+	}
+	return n, nil
+}
+
+// normalizeEntry validates an ip, cidr, or range. Host cidrs are converted to the ip.
+func normalizeEntry(entry string) (string, error) {
+	entry = strings.TrimSpace(entry)
+	if strings.Contains(entry, "-") {
+		r := strings.Split(entry, "-")
+		if len(r) != 2 || net.ParseIP(r[0]) == nil || net.ParseIP(r[1]) == nil {
+			return "", fmt.Errorf("%s is not a valid ip range", entry)
+		}
+		return entry, nil
+	}
+	if strings.Contains(entry, "/") {
+		ip, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return "", fmt.Errorf("%s is not a valid cidr", entry)
+		}
+		if ones, bits := ipNet.Mask.Size(); ones == bits {
+			return ip.String(), nil
+		}
+		return ipNet.String(), nil
+	}
+	if net.ParseIP(entry) == nil {
+		return "", fmt.Errorf("%s is not a valid ip address", entry)
+	}
+	return entry, nil
+}
+
+// isAnyEntry checks if an entry is 0.0.0.0/0 or ::/0
+func isAnyEntry(entry string) bool {
+	return entry == "0.0.0.0/0" || entry == "::/0"
+}
+
+// entryContains checks if an ip is in an ip, cidr, or range entry
+func entryContains(entry string, ip net.IP) bool {
+	switch {
+	case strings.Contains(entry, "-"):
+		r := strings.Split(entry, "-")
+		from, to := net.ParseIP(r[0]), net.ParseIP(r[1])
+		if from == nil || to == nil || (from.To4() == nil) != (ip.To4() == nil) {
+			return false
+		}
+		return bytes.Compare(ip.To16(), from.To16()) >= 0 && bytes.Compare(ip.To16(), to.To16()) <= 0
+	case strings.Contains(entry, "/"):
+		_, ipNet, err := net.ParseCIDR(entry)
+		return err == nil && ipNet.Contains(ip)
+	default:
+		return net.ParseIP(entry).Equal(ip)
+	}
+}
@@ -0,0 +1,338 @@
+package fwconvert
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/brian1917/workloader/utils"
+)
+
+// xmlNode is a generic xml element used to walk PAN-OS and Panorama configurations
+type xmlNode struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Text     string     `xml:",chardata"`
+	Children []xmlNode  `xml:",any"`
+}
+
+func (n xmlNode) attr(name string) string {
+	for _, a := range n.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func (n xmlNode) child(name string) (xmlNode, bool) {
+	for _, c := range n.Children {
+		if c.XMLName.Local == name {
+			return c, true
+		}
+	}
+	return xmlNode{}, false
+}
+
+// text returns the trimmed text of a child element
+func (n xmlNode) text(name string) string {
+	c, _ := n.child(name)
+	return strings.TrimSpace(c.Text)
+}
+
+// members returns the member values of a child element
+func (n xmlNode) members(name string) []string {
+	c, ok := n.child(name)
+	if !ok {
+		return nil
+	}
+	members := []string{}
+	for _, m := range c.Children {
+		if m.XMLName.Local == "member" {
+			members = append(members, strings.TrimSpace(m.Text))
+		}
+	}
+	return members
+}
+
+// walk calls f for every element with its parent name and scope. The scope is the device group or vsys the element is in
+// and empty for shared.
+func (n xmlNode) walk(parent, scope string, f func(parent, scope string, node xmlNode)) {
+	f(parent, scope, n)
+	if n.XMLName.Local == "entry" && (parent == "device-group" || parent == "vsys") {
+		scope = fmt.Sprintf("%s %s", parent, n.attr("name"))
+	}
+	for _, c := range n.Children {
+		c.walk(n.XMLName.Local, scope, f)
+	}
+}
+
+// objectKey is the name of an object in a device group, vsys, or shared
+type objectKey struct {
+	scope string
+	name  string
+}
+
+// panObjects are the address and service objects in a PAN-OS or Panorama configuration by scope and name
+type panObjects struct {
+	addresses     map[objectKey]fwAddr
+	addressGroups map[objectKey][]string
+	services      map[objectKey]fwService
+	serviceGroups map[objectKey][]string
+}
+
+// panRuleNode is a security rule and the device group or vsys it is in
+type panRuleNode struct {
+	scope string
+	node  xmlNode
+}
+
+// lookupScopes returns the scopes an object name is resolved in. Objects in the scope take precedence over shared objects.
+func lookupScopes(scope string) []string {
+	if scope == "" {
+		return []string{""}
+	}
+	return []string{scope, ""}
+}
+
+// parsePANXML parses the security rules of a PAN-OS or Panorama configuration export. Objects are resolved in the device group
+// or vsys of the rule and then in shared.
+func parsePANXML(r io.Reader) ([]fwRule, error) {
+	var root xmlNode
+	if err := xml.NewDecoder(r).Decode(&root); err != nil {
+		return nil, fmt.Errorf("parsing pan xml - %s", err)
+	}
+
+	objects := panObjects{addresses: make(map[objectKey]fwAddr), addressGroups: make(map[objectKey][]string), services: make(map[objectKey]fwService), serviceGroups: make(map[objectKey][]string)}
+	ruleNodes := []panRuleNode{}
+	root.walk("", "", func(parent, scope string, node xmlNode) {
+		if node.XMLName.Local != "entry" {
+			return
+		}
+		name := node.attr("name")
+		key := objectKey{scope: scope, name: name}
+		switch parent {
+		case "address":
+			addr := fwAddr{Name: name}
+			if v := node.text("ip-netmask"); v != "" {
+				addr.Entries = []string{v}
+			}
+			if v := node.text("ip-range"); v != "" {
+				addr.Entries = []string{v}
+			}
+			if v := node.text("fqdn"); v != "" {
+				addr.FQDNs = []string{v}
+			}
+			objects.addresses[key] = addr
+		case "address-group":
+			static, _ := node.child("static")
+			for _, m := range static.Children {
+				objects.addressGroups[key] = append(objects.addressGroups[key], strings.TrimSpace(m.Text))
+			}
+			if _, ok := node.child("dynamic"); ok {
+				utils.LogWarningf(true, "address group %s is dynamic and cannot be converted", name)
+			}
+		case "service":
+			proto, ok := node.child("protocol")
+			if !ok {
+				return
+			}
+			svc := fwService{Name: name}
+			for _, p := range proto.Children {
+				protoNum, err := protocolNumber(p.XMLName.Local)
+				if err != nil {
+					continue
+				}
+				for _, port := range strings.Split(p.text("port"), ",") {
+					fp := fwPort{Proto: protoNum, ToPort: -1}
+					fromTo := strings.Split(strings.TrimSpace(port), "-")
+					var err error
+					if fp.Port, err = strconv.Atoi(fromTo[0]); err != nil {
+						utils.LogWarningf(true, "service %s - port %s is not valid", name, port)
+						continue
+					}
+					if len(fromTo) == 2 {
+						if fp.ToPort, err = strconv.Atoi(fromTo[1]); err != nil {
+							utils.LogWarningf(true, "service %s - port %s is not valid", name, port)
+							continue
+						}
+					}
+					svc.Ports = append(svc.Ports, fp)
+				}
+			}
+			objects.services[key] = svc
+		case "service-group":
+			objects.serviceGroups[key] = node.members("members")
+		case "rules":
+			ruleNodes = append(ruleNodes, panRuleNode{scope: scope, node: node})
+		}
+	})
+
+	// Rules without an action or source (e.g., nat rules) are skipped
+	rules := []fwRule{}
+	for _, rn := range ruleNodes {
+		n := rn.node
+		if _, ok := n.child("action"); !ok || n.members("source") == nil {
+			continue
+		}
+		name := n.attr("name")
+		rule := fwRule{Origin: fmt.Sprintf("pan rule %s", name), Comment: n.text("description"), Action: "allow", Enabled: n.text("disabled") != "yes"}
+		switch action := n.text("action"); action {
+		case "allow":
+		case "deny", "drop", "reset-client", "reset-server", "reset-both":
+			rule.Action = "deny"
+		default:
+			utils.LogWarningf(true, "%s - skipping - action %s is not supported", rule.Origin, action)
+			continue
+		}
+		if n.text("negate-source") == "yes" || n.text("negate-destination") == "yes" {
+			utils.LogWarningf(true, "%s - skipping - negated addresses cannot be converted", rule.Origin)
+			continue
+		}
+
+		var err error
+		if rule.Src, err = objects.resolveAddresses(n.members("source"), rn.scope); err != nil {
+			utils.LogWarningf(true, "%s - skipping - %s", rule.Origin, err)
+			continue
+		}
+		if rule.Dst, err = objects.resolveAddresses(n.members("destination"), rn.scope); err != nil {
+			utils.LogWarningf(true, "%s - skipping - %s", rule.Origin, err)
+			continue
+		}
+
+		// Services. Application default ports are only known for the any application.
+		apps := n.members("application")
+		anyApp := len(apps) == 0 || (len(apps) == 1 && apps[0] == "any")
+		services := n.members("service")
+		if len(services) == 1 && services[0] == "application-default" {
+			if !anyApp {
+				utils.LogWarningf(true, "%s - skipping - application-default ports for applications %s cannot be converted. use a service in the rule.", rule.Origin, strings.Join(apps, ", "))
+				continue
+			}
+			services = []string{"any"}
+		}
+		if !anyApp {
+			utils.LogWarningf(false, "%s - applications %s are not converted. only the services are used.", rule.Origin, strings.Join(apps, ", "))
+			rule.Comment = strings.TrimSpace(fmt.Sprintf("%s applications: %s", rule.Comment, strings.Join(apps, ";")))
+		}
+		if rule.Svcs, err = objects.resolveServices(services, rn.scope, 0); err != nil {
+			utils.LogWarningf(true, "%s - skipping - %s", rule.Origin, err)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("no security rules in the input. input must be a pan-os or panorama configuration xml")
+	}
+	return rules, nil
+}
+
+// resolveAddresses converts the members of a source or destination in a scope to addresses. Groups are expanded with the
+// members resolved in the scope of the group.
+func (o panObjects) resolveAddresses(members []string, scope string) ([]fwAddr, error) {
+	addrs := []fwAddr{}
+	var resolve func(member, scope string, depth int) error
+	resolve = func(member, scope string, depth int) error {
+		if depth > 10 {
+			return fmt.Errorf("address group %s is nested more than 10 groups deep", member)
+		}
+		if member == "any" {
+			addrs = append(addrs, anyAddr)
+			return nil
+		}
+		for _, s := range lookupScopes(scope) {
+			if addr, ok := o.addresses[objectKey{scope: s, name: member}]; ok {
+				entries := make([]string, len(addr.Entries))
+				for i, e := range addr.Entries {
+					entry, err := normalizeEntry(e)
+					if err != nil {
+						return fmt.Errorf("address %s - %s", member, err)
+					}
+					entries[i] = entry
+				}
+				addr.Entries = entries
+				addrs = append(addrs, addr)
+				return nil
+			}
+			if group, ok := o.addressGroups[objectKey{scope: s, name: member}]; ok {
+				for _, g := range group {
+					if err := resolve(g, s, depth+1); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+		}
+
+		// Rules can use an ip, cidr, or range without an object
+		entry, err := normalizeEntry(member)
+		if err != nil {
+			return fmt.Errorf("%s is not an address object, address group, or ip", member)
+		}
+		if isAnyEntry(entry) {
+			addrs = append(addrs, anyAddr)
+			return nil
+		}
+		addrs = append(addrs, fwAddr{Entries: []string{entry}})
+		return nil
+	}
+	for _, m := range members {
+		if err := resolve(m, scope, 0); err != nil {
+			return nil, err
+		}
+	}
+	for _, a := range addrs {
+		if a.Any {
+			return []fwAddr{anyAddr}, nil
+		}
+	}
+	return addrs, nil
+}
+
+// resolveServices converts the service members of a rule in a scope. Groups are expanded with the members resolved in the
+// scope of the group.
+func (o panObjects) resolveServices(members []string, scope string, depth int) ([]fwService, error) {
+	if depth > 10 {
+		return nil, fmt.Errorf("service group is nested more than 10 groups deep")
+	}
+	svcs := []fwService{}
+	for _, m := range members {
+		switch {
+		case m == "any":
+			return []fwService{{Any: true}}, nil
+		case m == "service-http":
+			svcs = append(svcs, fwService{Name: m, Ports: []fwPort{{Proto: 6, Port: 80, ToPort: -1}, {Proto: 6, Port: 8080, ToPort: -1}}})
+		case m == "service-https":
+			svcs = append(svcs, fwService{Name: m, Ports: []fwPort{{Proto: 6, Port: 443, ToPort: -1}}})
+		default:
+			found := false
+			for _, s := range lookupScopes(scope) {
+				if svc, ok := o.services[objectKey{scope: s, name: m}]; ok {
+					svcs = append(svcs, svc)
+					found = true
+					break
+				}
+				if group, ok := o.serviceGroups[objectKey{scope: s, name: m}]; ok {
+					groupSvcs, err := o.resolveServices(group, s, depth+1)
+					if err != nil {
+						return nil, err
+					}
+					svcs = append(svcs, groupSvcs...)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("%s is not a service or service group", m)
+			}
+		}
+	}
+	for _, s := range svcs {
+		if s.Any {
+			return []fwService{{Any: true}}, nil
+		}
+	}
+	return svcs, nil
+}
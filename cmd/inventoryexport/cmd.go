@@ -0,0 +1,181 @@
+package inventoryexport
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	ia "github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// Declare local global variables
+var format, groupBy, labelKeys, hostVarsHost, outputFileName string
+var list, managedOnly, onlineOnly, noAnsibleHost bool
+
+func init() {
+	InventoryExportCmd.Flags().StringVarP(&format, "format", "f", "ini", "inventory file format. options are ini, yaml, or json.")
+	InventoryExportCmd.Flags().StringVarP(&groupBy, "group-by", "g", "app+env", "comma-separated list of label key combinations for groups. keys in a combination are separated by +. use \"\" for no combination groups.")
+	InventoryExportCmd.Flags().StringVar(&labelKeys, "label-keys", "", "comma-separated list of label keys for key:value groups. default is all label keys.")
+	InventoryExportCmd.Flags().BoolVarP(&managedOnly, "managed-only", "m", false, "only include managed workloads.")
+	InventoryExportCmd.Flags().BoolVarP(&onlineOnly, "online-only", "o", false, "only include online workloads.")
+	InventoryExportCmd.Flags().BoolVar(&noAnsibleHost, "no-ansible-host", false, "do not set ansible_host to the ip address with the default gateway. ansible connects with the hostname.")
+	InventoryExportCmd.Flags().BoolVar(&list, "list", false, "dynamic inventory mode. print the inventory json to stdout.")
+	InventoryExportCmd.Flags().StringVar(&hostVarsHost, "host", "", "dynamic inventory mode. print the host vars json of the host to stdout.")
+	InventoryExportCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the output file location. default is current location with a timestamped filename.")
+	InventoryExportCmd.Flags().SortFlags = false
+}
+
+// InventoryExportCmd exports the workloads as an ansible inventory
+var InventoryExportCmd = &cobra.Command{
+	Use:   "inventory-export",
+	Short: "Export workloads as an Ansible inventory grouped by labels.",
+	Long: `
+Export workloads as an Ansible inventory grouped by labels.
+
+Hosts are the workload hostnames (or names if there is no hostname). Each host has the following host vars:
+- ansible_host is the ip address with the default gateway. Use --no-ansible-host to connect with the hostname.
+- illumio_href, illumio_enforcement_mode, illumio_visibility_level, illumio_ven_version, illumio_os_id, illumio_os_detail, and illumio_online.
+- illumio_label_<key> for each label (e.g., illumio_label_app: erp).
+
+Hosts are grouped two ways:
+- A group for each label key:value (e.g., app_erp). Use --label-keys to limit the keys.
+- A group for each label combination in --group-by (e.g., app_erp_env_prod for the default app+env). Workloads missing a label in the combination are not in the combination group. Use --group-by "app+env,app+env+role" for more combinations.
+
+Characters that are not valid in ansible group names are replaced with an underscore.
+
+The --format flag sets the file format:
+- ini is the default ansible format.
+- yaml is the ansible yaml inventory format.
+- json is the dynamic inventory json format.
+
+Dynamic inventory:
+Use --list or --host <hostname> to print the dynamic inventory json to stdout instead of writing a file. Ansible calls an inventory script with these flags. Create an executable script such as the one below and use it with ansible -i:
+#!/bin/sh
+exec /path/to/workloader --config-file /path/to/pce.yaml --log-file /tmp/workloader.log inventory-export --group-by app+env "$@"
+
+The update-pce and --no-prompt flags are ignored for this command.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// Dynamic inventory output is parsed by ansible so only json goes to stdout
+		dynamic := list || hostVarsHost != ""
+		if dynamic {
+			viper.Set("json_stdout", true)
+		}
+
+		// Get the PCE
+		pce, err := utils.GetTargetPCEV2(true)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+
+		exportInventory(pce, dynamic)
+	},
+}
+
+func exportInventory(pce ia.PCE, dynamic bool) {
+
+	format = strings.ToLower(format)
+	if format != "ini" && format != "yaml" && format != "json" {
+		utils.LogErrorf("%s is not a valid format. options are ini, yaml, or json.", format)
+	}
+
+	// Parse the group options
+	keys := []string{}
+	for _, k := range strings.Split(labelKeys, ",") {
+		if strings.TrimSpace(k) != "" {
+			keys = append(keys, strings.TrimSpace(k))
+		}
+	}
+	combos := [][]string{}
+	for _, c := range strings.Split(groupBy, ",") {
+		combo := []string{}
+		for _, k := range strings.Split(c, "+") {
+			if strings.TrimSpace(k) != "" {
+				combo = append(combo, strings.TrimSpace(k))
+			}
+		}
+		if len(combo) > 1 {
+			combos = append(combos, combo)
+		} else if len(combo) == 1 {
+			utils.LogWarningf(!dynamic, "%s in --group-by is a single key. key:value groups are already created for each key.", combo[0])
+		}
+	}
+
+	// Get the workloads
+	load := ia.LoadInput{Workloads: true, Labels: true, WorkloadsQueryParameters: make(map[string]string)}
+	if managedOnly {
+		load.WorkloadsQueryParameters["managed"] = "true"
+	}
+	if onlineOnly {
+		load.WorkloadsQueryParameters["online"] = "true"
+	}
+	apiResps, err := pce.Load(load, utils.UseMulti())
+	utils.LogMultiAPIRespV2(apiResps)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
+	inv := buildInventory(pce, keys, combos, !noAnsibleHost)
+	utils.LogInfof(!dynamic, "%d hosts in %d groups", len(inv.hostVars), len(inv.groups))
+
+	// Dynamic inventory writes to stdout
+	if list {
+		printJSON(inv.list())
+		return
+	}
+	if hostVarsHost != "" {
+		vars := inv.hostVars[hostVarsHost]
+		if vars == nil {
+			utils.LogWarningf(false, "%s is not in the inventory", hostVarsHost)
+			vars = map[string]string{}
+		}
+		printJSON(vars)
+		return
+	}
+
+	// Write the file
+	var data []byte
+	switch format {
+	case "ini":
+		data = []byte(inv.ini())
+	case "yaml":
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(inv.yaml()); err != nil {
+			utils.LogError(err.Error())
+		}
+		if err := enc.Close(); err != nil {
+			utils.LogError(err.Error())
+		}
+		data = buf.Bytes()
+	case "json":
+		data, err = json.MarshalIndent(inv.list(), "", "  ")
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+	}
+	if outputFileName == "" {
+		outputFileName = fmt.Sprintf("workloader-inventory-export-%s.%s", time.Now().Format("20060102_150405"), format)
+	}
+	if err := os.WriteFile(outputFileName, data, 0644); err != nil {
+		utils.LogError(err.Error())
+	}
+	utils.LogInfof(true, "created %s", outputFileName)
+}
+
+// printJSON writes the dynamic inventory json to stdout
+func printJSON(v any) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	fmt.Println(string(data))
+}
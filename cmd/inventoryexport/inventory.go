@@ -0,0 +1,218 @@
+package inventoryexport
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	ia "github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/utils"
+)
+
+// inventory is the ansible inventory built from the workloads
+type inventory struct {
+	hostVars map[string]map[string]string
+	groups   map[string]map[string]bool
+}
+
+var invalidGroupChars = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// groupName creates a valid ansible group name from label keys and values
+func groupName(parts ...string) string {
+	return strings.Trim(invalidGroupChars.ReplaceAllString(strings.Join(parts, "_"), "_"), "_")
+}
+
+// buildInventory groups the workloads by label key:value and by the label combinations
+func buildInventory(pce ia.PCE, labelKeys []string, combos [][]string, ansibleHost bool) inventory {
+	inv := inventory{hostVars: make(map[string]map[string]string), groups: make(map[string]map[string]bool)}
+	targetKeys := make(map[string]bool)
+	for _, k := range labelKeys {
+		targetKeys[k] = true
+	}
+
+	for _, w := range pce.WorkloadsSlice {
+		name := ia.PtrToVal(w.Hostname)
+		if name == "" {
+			name = ia.PtrToVal(w.Name)
+		}
+		if name == "" {
+			utils.LogWarningf(false, "%s does not have a hostname or name. skipping.", w.Href)
+			continue
+		}
+		if _, ok := inv.hostVars[name]; ok {
+			utils.LogWarningf(false, "%s is the hostname of more than one workload. skipping %s.", name, w.Href)
+			continue
+		}
+
+		// Host vars
+		vars := map[string]string{
+			"illumio_href":             w.Href,
+			"illumio_enforcement_mode": w.GetMode(),
+			"illumio_visibility_level": w.GetVisibilityLevel(),
+			"illumio_os_id":            ia.PtrToVal(w.OsID),
+			"illumio_os_detail":        ia.PtrToVal(w.OsDetail),
+			"illumio_online":           strconv.FormatBool(ia.PtrToVal(w.Online)),
+		}
+		if w.Agent != nil && w.Agent.Href != "" {
+			vars["illumio_ven_version"] = w.Agent.Status.AgentVersion
+		}
+		if ansibleHost && w.GetIPWithDefaultGW() != "NA" {
+			vars["ansible_host"] = w.GetIPWithDefaultGW()
+		}
+		labels := make(map[string]string)
+		for _, l := range ia.PtrToVal(w.Labels) {
+			labels[pce.Labels[l.Href].Key] = pce.Labels[l.Href].Value
+			vars["illumio_label_"+groupName(pce.Labels[l.Href].Key)] = pce.Labels[l.Href].Value
+		}
+		for k, v := range vars {
+			if v == "" {
+				delete(vars, k)
+			}
+		}
+		inv.hostVars[name] = vars
+
+		// Label key:value groups
+		for k, v := range labels {
+			if len(targetKeys) == 0 || targetKeys[k] {
+				inv.add(groupName(k, v), name)
+			}
+		}
+
+		// Label combination groups. Workloads missing a label in the combination are not added.
+	combos:
+		for _, combo := range combos {
+			parts := []string{}
+			for _, k := range combo {
+				if labels[k] == "" {
+					continue combos
+				}
+				parts = append(parts, k, labels[k])
+			}
+			inv.add(groupName(parts...), name)
+		}
+	}
+
+	return inv
+}
+
+func (inv inventory) add(group, host string) {
+	if inv.groups[group] == nil {
+		inv.groups[group] = make(map[string]bool)
+	}
+	inv.groups[group][host] = true
+}
+
+// hostNames returns the sorted host names of a group or all hosts when the group is empty
+func (inv inventory) hostNames(group string) []string {
+	names := []string{}
+	if group == "" {
+		for h := range inv.hostVars {
+			names = append(names, h)
+		}
+	} else {
+		for h := range inv.groups[group] {
+			names = append(names, h)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// groupNames returns the sorted group names
+func (inv inventory) groupNames() []string {
+	names := []string{}
+	for g := range inv.groups {
+		names = append(names, g)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ungrouped returns the hosts that are not in a group
+func (inv inventory) ungrouped() []string {
+	grouped := make(map[string]bool)
+	for _, hosts := range inv.groups {
+		for h := range hosts {
+			grouped[h] = true
+		}
+	}
+	names := []string{}
+	for _, h := range inv.hostNames("") {
+		if !grouped[h] {
+			names = append(names, h)
+		}
+	}
+	return names
+}
+
+var iniSafe = regexp.MustCompile(`^[A-Za-z0-9_.:/@+-]*$`)
+
+// ini returns the inventory in ini format. Host vars are on the host lines before the first group.
+func (inv inventory) ini() string {
+	var b strings.Builder
+	for _, h := range inv.hostNames("") {
+		b.WriteString(h)
+		keys := []string{}
+		for k := range inv.hostVars[h] {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			v := inv.hostVars[h][k]
+			if !iniSafe.MatchString(v) {
+				v = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+			}
+			fmt.Fprintf(&b, " %s=%s", k, v)
+		}
+		b.WriteString("\n")
+	}
+	for _, g := range inv.groupNames() {
+		fmt.Fprintf(&b, "\n[%s]\n", g)
+		for _, h := range inv.hostNames(g) {
+			b.WriteString(h + "\n")
+		}
+	}
+	return b.String()
+}
+
+// yaml returns the inventory as the object for the ansible yaml format
+func (inv inventory) yaml() map[string]any {
+	hosts := make(map[string]any)
+	for h, vars := range inv.hostVars {
+		hosts[h] = vars
+	}
+	children := make(map[string]any)
+	for _, g := range inv.groupNames() {
+		groupHosts := make(map[string]any)
+		for _, h := range inv.hostNames(g) {
+			groupHosts[h] = nil
+		}
+		children[g] = map[string]any{"hosts": groupHosts}
+	}
+	all := map[string]any{"hosts": hosts}
+	if len(children) > 0 {
+		all["children"] = children
+	}
+	return map[string]any{"all": all}
+}
+
+// list returns the inventory as the object for the dynamic inventory --list json
+func (inv inventory) list() map[string]any {
+	hostVars := make(map[string]any)
+	for h, vars := range inv.hostVars {
+		hostVars[h] = vars
+	}
+	l := map[string]any{"_meta": map[string]any{"hostvars": hostVars}}
+	children := []string{}
+	for _, g := range inv.groupNames() {
+		l[g] = map[string]any{"hosts": inv.hostNames(g)}
+		children = append(children, g)
+	}
+	if ungrouped := inv.ungrouped(); len(ungrouped) > 0 {
+		l["ungrouped"] = map[string]any{"hosts": ungrouped}
+	}
+	l["all"] = map[string]any{"children": append(children, "ungrouped")}
+	return l
+}
@@ -0,0 +1,302 @@
+package iploptimize
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	ia "github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/cmd/iplimport"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+)
+
+// Declare local global variables
+var iplNames []string
+var cidrOnly bool
+var outputFileName string
+
+func init() {
+	IplOptimizeCmd.Flags().StringSliceVar(&iplNames, "ipl", nil, "comma-separated ip list names to check. default is all ip lists.")
+	IplOptimizeCmd.Flags().BoolVar(&cidrOnly, "cidr-only", false, "write the minimized entries only as addresses and CIDRs. by default contiguous CIDRs are written as one from-to range.")
+	IplOptimizeCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the report output file location. default is current location with a timestamped filename. the ipl-import file uses the same name with a -ipl-import suffix.")
+	IplOptimizeCmd.Flags().SortFlags = false
+}
+
+// IplOptimizeCmd finds redundant ip list entries and minimizes ip lists
+var IplOptimizeCmd = &cobra.Command{
+	Use:   "ipl-optimize",
+	Short: "Find duplicate, subset, and overlapping ip list entries and ip lists and create an ipl-import csv with minimized ranges.",
+	Long: `
+Find duplicate, subset, and overlapping ip list entries and ip lists and create an ipl-import csv with minimized ranges.
+
+The draft ip lists are checked for:
+- duplicate_entry: the same range is in the list more than once.
+- subset_entry: the range is inside another range of the same type (include or exclude) in the list.
+- overlapping_entries: two ranges of the same type in the list partially overlap.
+- exclusion_outside_includes: the exclusion does not overlap any include range so it has no effect.
+- invalid_entry: the entry cannot be parsed. the list is not minimized.
+- duplicate_list, subset_list, overlapping_lists: the addresses of two lists (includes minus exclusions) are the same, one is inside the other, or they share addresses. The Any (0.0.0.0/0 and ::/0) list is not compared.
+- minimized: the number of entries in the list before and after minimizing.
+
+Minimizing uses the same logic as csp-iplist: ranges are split into CIDRs, CIDRs inside other CIDRs are removed, and consecutive CIDRs are merged. Contiguous CIDRs are then written as one from-to range unless --cidr-only is set. Include and exclude entries are minimized separately and exclusions outside the includes are dropped, so the addresses in the list do not change. Entry descriptions are kept for entries that are not changed. ipl-import cannot read descriptions with spaces, semicolons, or # so those descriptions are dropped with a warning and removed from the ip list on import.
+
+The output files are:
+- workloader-ipl-optimize-<timestamp>.csv with the findings.
+- workloader-ipl-optimize-<timestamp>-ipl-import.csv with the minimized lists that changed. FQDNs and external data are not changed.
+
+Review the ipl-import file and run workloader ipl-import <file> --update-pce --provision.
+
+The update-pce and --no-prompt flags are ignored for this command.`,
+	Example: `# Check all ip lists
+workloader ipl-optimize
+
+# Check two ip lists and only use CIDRs
+workloader ipl-optimize --ipl "corp-dns,corp-ntp" --cidr-only`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// Get the PCE
+		pce, err := utils.GetTargetPCEV2(true)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+
+		iplOptimize(pce)
+	},
+}
+
+// Findings
+const (
+	findingDuplicateEntry    = "duplicate_entry"
+	findingSubsetEntry       = "subset_entry"
+	findingOverlappingEntry  = "overlapping_entries"
+	findingExclusionOutside  = "exclusion_outside_includes"
+	findingInvalidEntry      = "invalid_entry"
+	findingDuplicateList     = "duplicate_list"
+	findingSubsetList        = "subset_list"
+	findingOverlappingLists  = "overlapping_lists"
+	findingMinimized         = "minimized"
+	anyIPListName            = "Any (0.0.0.0/0 and ::/0)"
+	maxOverlapSummaryEntries = 3
+)
+
+// entry is a parsed ip list entry
+type entry struct {
+	r           ipRange
+	text        string
+	exclusion   bool
+	description string
+}
+
+// entryText returns the ip list entry as it is shown in the PCE
+func entryText(from, to string, exclusion bool) string {
+	text := from
+	if to != "" {
+		text = fmt.Sprintf("%s-%s", from, to)
+	}
+	if exclusion {
+		text = "!" + text
+	}
+	return text
+}
+
+// checkEntries reports duplicate, subset, and overlapping entries of one type
+func checkEntries(name string, entries []entry) [][]string {
+	rows := [][]string{}
+	seen := make(map[ipRange]string)
+	for i, e := range entries {
+		if first, ok := seen[e.r]; ok {
+			rows = append(rows, []string{findingDuplicateEntry, name, e.text, "", first, "same addresses"})
+			continue
+		}
+		seen[e.r] = e.text
+		for j, o := range entries {
+			if i == j || e.r == o.r {
+				continue
+			}
+			if o.r.contains(e.r) {
+				rows = append(rows, []string{findingSubsetEntry, name, e.text, "", o.text, fmt.Sprintf("%s is inside %s", e.r, o.r)})
+				break
+			}
+		}
+	}
+	for i, e := range entries {
+		for _, o := range entries[i+1:] {
+			if e.r.overlaps(o.r) && !e.r.contains(o.r) && !o.r.contains(e.r) {
+				rows = append(rows, []string{findingOverlappingEntry, name, e.text, "", o.text, "partial overlap"})
+			}
+		}
+	}
+	return rows
+}
+
+func ranges(entries []entry) []ipRange {
+	r := []ipRange{}
+	for _, e := range entries {
+		r = append(r, e.r)
+	}
+	return r
+}
+
+// importEntries returns the ipl-import value for the minimized ranges. Descriptions are kept for unchanged entries.
+// ipl-import removes spaces and splits on ; and # so descriptions with those characters are dropped with a warning.
+func importEntries(iplName string, minimized []ipRange, original []entry) string {
+	kept := make(map[ipRange]bool)
+	for _, r := range minimized {
+		kept[r] = true
+	}
+	descriptions := make(map[ipRange]string)
+	for _, e := range original {
+		if e.description == "" || !kept[e.r] {
+			continue
+		}
+		if strings.ContainsAny(e.description, " \t;#") {
+			utils.LogWarningf(true, "%s - the description of %s cannot be written for ipl-import and is dropped: %s", iplName, e.text, e.description)
+			continue
+		}
+		descriptions[e.r] = e.description
+	}
+	values := []string{}
+	for _, r := range minimized {
+		if d := descriptions[r]; d != "" {
+			values = append(values, fmt.Sprintf("%s#%s", r, d))
+		} else {
+			values = append(values, r.String())
+		}
+	}
+	return strings.Join(values, ";")
+}
+
+func iplOptimize(pce ia.PCE) {
+
+	// Get the draft ip lists
+	a, err := pce.GetIPLists(nil, "draft")
+	utils.LogAPIRespV2("GetAllDraftIPLists", a)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	include := make(map[string]bool)
+	for _, n := range iplNames {
+		if _, ok := pce.IPLists[n]; !ok {
+			utils.LogErrorf("%s does not exist as an ip list in the PCE", n)
+		}
+		include[n] = true
+	}
+
+	report := [][]string{{"finding", "ip_list", "entry", "other_ip_list", "other_entry", "detail"}}
+	importData := [][]string{{iplimport.HeaderName, iplimport.HeaderDescription, iplimport.HeaderInclude, iplimport.HeaderExclude, iplimport.HeaderFqdns, iplimport.HeaderExternalDataSet, iplimport.HeaderExternalDataRef, iplimport.HeaderHref}}
+
+	type listAddresses struct {
+		name      string
+		addresses []ipRange
+	}
+	lists := []listAddresses{}
+
+	for _, ipl := range pce.IPListsSlice {
+		if len(include) > 0 && !include[ipl.Name] {
+			continue
+		}
+
+		// Parse the entries
+		includes, exclusions := []entry{}, []entry{}
+		invalid := false
+		for _, r := range ia.PtrToVal(ipl.IPRanges) {
+			parsed, err := parseRange(r.FromIP, r.ToIP)
+			if err != nil {
+				report = append(report, []string{findingInvalidEntry, ipl.Name, entryText(r.FromIP, r.ToIP, r.Exclusion), "", "", err.Error()})
+				invalid = true
+				continue
+			}
+			e := entry{r: parsed, text: entryText(r.FromIP, r.ToIP, r.Exclusion), exclusion: r.Exclusion, description: r.Description}
+			if r.Exclusion {
+				exclusions = append(exclusions, e)
+			} else {
+				includes = append(includes, e)
+			}
+		}
+		if len(includes)+len(exclusions) == 0 {
+			continue
+		}
+
+		// Check the entries in the list
+		report = append(report, checkEntries(ipl.Name, includes)...)
+		report = append(report, checkEntries(ipl.Name, exclusions)...)
+		includeUnion := union(ranges(includes))
+		effectiveExclusions := []entry{}
+		for _, e := range exclusions {
+			if len(intersect([]ipRange{e.r}, includeUnion)) == 0 {
+				report = append(report, []string{findingExclusionOutside, ipl.Name, e.text, "", "", "dropped from the minimized list"})
+				continue
+			}
+			effectiveExclusions = append(effectiveExclusions, e)
+		}
+		addresses := subtract(includeUnion, union(ranges(exclusions)))
+		if ipl.Name != anyIPListName && len(addresses) > 0 {
+			lists = append(lists, listAddresses{name: ipl.Name, addresses: addresses})
+		}
+		if invalid {
+			utils.LogWarningf(true, "%s - has invalid entries and is not minimized", ipl.Name)
+			continue
+		}
+
+		// Minimize the list and make sure the addresses did not change
+		minIncludes, minExclusions := minimize(ranges(includes), cidrOnly), minimize(ranges(effectiveExclusions), cidrOnly)
+		if !equal(addresses, subtract(union(minIncludes), union(minExclusions))) {
+			utils.LogWarningf(true, "%s - minimized entries do not match the original addresses. skipping.", ipl.Name)
+			continue
+		}
+		before, after := len(includes)+len(exclusions), len(minIncludes)+len(minExclusions)
+		if after >= before {
+			continue
+		}
+		report = append(report, []string{findingMinimized, ipl.Name, "", "", "", fmt.Sprintf("%d entries to %d entries", before, after)})
+		fqdns := []string{}
+		for _, f := range ia.PtrToVal(ipl.FQDNs) {
+			fqdns = append(fqdns, f.FQDN)
+		}
+		importData = append(importData, []string{ipl.Name, ia.PtrToVal(ipl.Description), importEntries(ipl.Name, minIncludes, includes), importEntries(ipl.Name, minExclusions, effectiveExclusions), strings.Join(fqdns, ";"), ia.PtrToVal(ipl.ExternalDataSet), ia.PtrToVal(ipl.ExternalDataReference), ipl.Href})
+	}
+
+	// Compare the addresses of the lists
+	for i, l := range lists {
+		for _, o := range lists[i+1:] {
+			shared := intersect(l.addresses, o.addresses)
+			switch {
+			case len(shared) == 0:
+				continue
+			case equal(l.addresses, o.addresses):
+				report = append(report, []string{findingDuplicateList, l.name, "", o.name, "", "same addresses"})
+			case equal(shared, l.addresses):
+				report = append(report, []string{findingSubsetList, l.name, "", o.name, "", fmt.Sprintf("%s is inside %s", l.name, o.name)})
+			case equal(shared, o.addresses):
+				report = append(report, []string{findingSubsetList, o.name, "", l.name, "", fmt.Sprintf("%s is inside %s", o.name, l.name)})
+			default:
+				report = append(report, []string{findingOverlappingLists, l.name, "", o.name, "", summary(shared, maxOverlapSummaryEntries)})
+			}
+		}
+	}
+
+	if len(report) == 1 {
+		utils.LogInfo("no duplicate, subset, or overlapping ip list entries or ip lists", true)
+		return
+	}
+
+	// Write the files
+	if outputFileName == "" {
+		outputFileName = fmt.Sprintf("workloader-ipl-optimize-%s.csv", time.Now().Format("20060102_150405"))
+	}
+	utils.WriteOutput(report, report, outputFileName)
+	counts := make(map[string]int)
+	for _, row := range report[1:] {
+		counts[row[0]]++
+	}
+	utils.LogInfof(true, "%d findings: %d duplicate, %d subset, and %d overlapping entries, %d duplicate, %d subset, and %d overlapping lists", len(report)-1, counts[findingDuplicateEntry], counts[findingSubsetEntry], counts[findingOverlappingEntry], counts[findingDuplicateList], counts[findingSubsetList], counts[findingOverlappingLists])
+	if len(importData) == 1 {
+		utils.LogInfo("no ip lists can be minimized", true)
+		return
+	}
+	importFileName := fmt.Sprintf("%s-ipl-import.csv", strings.TrimSuffix(outputFileName, ".csv"))
+	utils.WriteOutput(importData, nil, importFileName)
+	utils.LogInfof(true, "%d ip lists minimized in %s", len(importData)-1, importFileName)
+	utils.LogInfo(fmt.Sprintf("review the file and run: workloader ipl-import %s --update-pce --provision", importFileName), true)
+}
@@ -0,0 +1,237 @@
+package iploptimize
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+
+	"github.com/brian1917/workloader/cmd/cspiplist"
+)
+
+// ipRange is an inclusive range of addresses in one address family
+type ipRange struct {
+	from, to netip.Addr
+}
+
+// parseRange parses an ip list entry. The from value can be an address or a CIDR and the optional to value is the end of a range.
+func parseRange(from, to string) (ipRange, error) {
+	from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+	var r ipRange
+	if strings.Contains(from, "/") {
+		p, err := netip.ParsePrefix(from)
+		if err != nil {
+			return r, fmt.Errorf("invalid cidr %s", from)
+		}
+		p = p.Masked()
+		r = ipRange{from: p.Addr(), to: lastAddr(p)}
+	} else {
+		a, err := netip.ParseAddr(from)
+		if err != nil {
+			return r, fmt.Errorf("invalid ip address %s", from)
+		}
+		r = ipRange{from: a.Unmap(), to: a.Unmap()}
+	}
+	if to != "" {
+		a, err := netip.ParseAddr(to)
+		if err != nil {
+			return r, fmt.Errorf("invalid ip address %s", to)
+		}
+		r.to = a.Unmap()
+	}
+	if r.from.Is4() != r.to.Is4() || r.to.Less(r.from) {
+		return r, fmt.Errorf("invalid range %s-%s", from, to)
+	}
+	return r, nil
+}
+
+// lastAddr returns the last address of a prefix
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Addr().AsSlice()
+	for i := range b {
+		if bits := p.Bits() - i*8; bits <= 0 {
+			b[i] = 0xff
+		} else if bits < 8 {
+			b[i] |= 0xff >> bits
+		}
+	}
+	a, _ := netip.AddrFromSlice(b)
+	return a
+}
+
+func (r ipRange) contains(o ipRange) bool {
+	return r.from.Is4() == o.from.Is4() && !o.from.Less(r.from) && !r.to.Less(o.to)
+}
+
+func (r ipRange) overlaps(o ipRange) bool {
+	return r.from.Is4() == o.from.Is4() && !r.to.Less(o.from) && !o.to.Less(r.from)
+}
+
+// String returns the range as an address, a CIDR, or a from-to range
+func (r ipRange) String() string {
+	if r.from == r.to {
+		return r.from.String()
+	}
+	if p, ok := r.prefix(); ok {
+		return p.String()
+	}
+	return fmt.Sprintf("%s-%s", r.from, r.to)
+}
+
+// prefix returns the CIDR of the range if the range is exactly one CIDR
+func (r ipRange) prefix() (netip.Prefix, bool) {
+	for bits := 0; bits <= r.from.BitLen(); bits++ {
+		p := netip.PrefixFrom(r.from, bits)
+		if p.Masked().Addr() == r.from && lastAddr(p) == r.to {
+			return p, true
+		}
+	}
+	return netip.Prefix{}, false
+}
+
+// cidrs splits the range into the CIDRs that cover exactly the same addresses
+func (r ipRange) cidrs() []string {
+	cidrs := []string{}
+	from := r.from
+	for {
+		// The largest aligned prefix starting at from that does not go past to
+		bits := from.BitLen()
+		for bits > 0 {
+			p := netip.PrefixFrom(from, bits-1)
+			if p.Masked().Addr() != from || r.to.Less(lastAddr(p)) {
+				break
+			}
+			bits--
+		}
+		p := netip.PrefixFrom(from, bits)
+		cidrs = append(cidrs, p.String())
+		last := lastAddr(p)
+		if last == r.to || !last.Next().IsValid() {
+			return cidrs
+		}
+		from = last.Next()
+	}
+}
+
+// sortRanges sorts ranges with ipv4 before ipv6
+func sortRanges(ranges []ipRange) {
+	sort.Slice(ranges, func(i, j int) bool {
+		if ranges[i].from.Is4() != ranges[j].from.Is4() {
+			return ranges[i].from.Is4()
+		}
+		if ranges[i].from != ranges[j].from {
+			return ranges[i].from.Less(ranges[j].from)
+		}
+		return ranges[i].to.Less(ranges[j].to)
+	})
+}
+
+// union returns the sorted ranges with overlapping and adjacent ranges joined
+func union(ranges []ipRange) []ipRange {
+	sorted := append([]ipRange{}, ranges...)
+	sortRanges(sorted)
+	out := []ipRange{}
+	for _, r := range sorted {
+		if n := len(out); n > 0 && out[n-1].from.Is4() == r.from.Is4() && (!out[n-1].to.Less(r.from) || out[n-1].to.Next() == r.from) {
+			if out[n-1].to.Less(r.to) {
+				out[n-1].to = r.to
+			}
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// subtract returns the addresses in a that are not in b. Both must be the output of union.
+func subtract(a, b []ipRange) []ipRange {
+	out := []ipRange{}
+	for _, r := range a {
+		pieces := []ipRange{r}
+		for _, e := range b {
+			next := []ipRange{}
+			for _, p := range pieces {
+				if !p.overlaps(e) {
+					next = append(next, p)
+					continue
+				}
+				if p.from.Less(e.from) {
+					next = append(next, ipRange{from: p.from, to: e.from.Prev()})
+				}
+				if e.to.Less(p.to) {
+					next = append(next, ipRange{from: e.to.Next(), to: p.to})
+				}
+			}
+			pieces = next
+		}
+		out = append(out, pieces...)
+	}
+	return out
+}
+
+// intersect returns the addresses in both a and b. Both must be the output of union.
+func intersect(a, b []ipRange) []ipRange {
+	out := []ipRange{}
+	for _, r := range a {
+		for _, o := range b {
+			if !r.overlaps(o) {
+				continue
+			}
+			i := r
+			if i.from.Less(o.from) {
+				i.from = o.from
+			}
+			if o.to.Less(i.to) {
+				i.to = o.to
+			}
+			out = append(out, i)
+		}
+	}
+	return union(out)
+}
+
+func equal(a, b []ipRange) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// minimize returns the fewest entries that cover exactly the addresses in the ranges. The ranges are converted to CIDRs,
+// subsets are removed and consecutive CIDRs are merged. Unless cidrOnly is set, contiguous CIDRs are written as one from-to range.
+func minimize(ranges []ipRange, cidrOnly bool) []ipRange {
+	cidrs := []string{}
+	for _, r := range ranges {
+		cidrs = append(cidrs, r.cidrs()...)
+	}
+	merged := []ipRange{}
+	for _, c := range cspiplist.MergeConsecutiveRanges(cspiplist.RemoveSubsetIPs(cidrs)) {
+		r, err := parseRange(c, "")
+		if err == nil {
+			merged = append(merged, r)
+		}
+	}
+	sortRanges(merged)
+	if cidrOnly {
+		return merged
+	}
+	return union(merged)
+}
+
+// summary returns the first ranges and the number of remaining ranges
+func summary(ranges []ipRange, max int) string {
+	s := []string{}
+	for i, r := range ranges {
+		if i == max {
+			s = append(s, fmt.Sprintf("+%d more", len(ranges)-max))
+			break
+		}
+		s = append(s, r.String())
+	}
+	return strings.Join(s, "; ")
+}
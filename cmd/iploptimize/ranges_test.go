@@ -0,0 +1,177 @@
+package iploptimize
+
+import (
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/brian1917/workloader/utils"
+)
+
+func TestMain(m *testing.M) {
+	utils.Logger.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// parseRanges parses entries in the from or from-to format
+func parseRanges(t *testing.T, entries ...string) []ipRange {
+	t.Helper()
+	out := []ipRange{}
+	for _, e := range entries {
+		from, to, _ := strings.Cut(e, "-")
+		r, err := parseRange(from, to)
+		if err != nil {
+			t.Fatalf("parsing %s - %s", e, err)
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+func strs(ranges []ipRange) []string {
+	s := []string{}
+	for _, r := range ranges {
+		s = append(s, r.String())
+	}
+	return s
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     string
+		wantErr  bool
+	}{
+		{from: "10.0.0.1", want: "10.0.0.1"},
+		{from: " 10.0.0.0/24 ", want: "10.0.0.0/24"},
+		{from: "10.0.0.7/24", want: "10.0.0.0/24"},
+		{from: "10.0.0.1", to: "10.0.0.10", want: "10.0.0.1-10.0.0.10"},
+		{from: "10.0.0.0", to: "10.0.0.255", want: "10.0.0.0/24"},
+		{from: "0.0.0.0/0", want: "0.0.0.0/0"},
+		{from: "::/0", want: "::/0"},
+		{from: "2001:db8::/32", want: "2001:db8::/32"},
+		{from: "2001:db8::1", to: "2001:db8::ff", want: "2001:db8::1-2001:db8::ff"},
+		{from: "::ffff:10.0.0.1", want: "10.0.0.1"},
+		{from: "10.0.0.10", to: "10.0.0.1", wantErr: true},
+		{from: "10.0.0.1", to: "2001:db8::1", wantErr: true},
+		{from: "10.0.0.0/33", wantErr: true},
+		{from: "host.example.com", wantErr: true},
+	}
+	for _, tc := range tests {
+		r, err := parseRange(tc.from, tc.to)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("parseRange(%q, %q) error is %v, want error %t", tc.from, tc.to, err, tc.wantErr)
+			continue
+		}
+		if err == nil && r.String() != tc.want {
+			t.Errorf("parseRange(%q, %q) is %s, want %s", tc.from, tc.to, r, tc.want)
+		}
+	}
+}
+
+func TestCIDRs(t *testing.T) {
+	tests := []struct {
+		entry string
+		want  []string
+	}{
+		{entry: "10.0.0.1", want: []string{"10.0.0.1/32"}},
+		{entry: "10.0.0.0/24", want: []string{"10.0.0.0/24"}},
+		{entry: "10.0.0.1-10.0.0.10", want: []string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/30", "10.0.0.8/31", "10.0.0.10/32"}},
+		{entry: "10.0.0.0-10.0.2.255", want: []string{"10.0.0.0/23", "10.0.2.0/24"}},
+		{entry: "0.0.0.0/0", want: []string{"0.0.0.0/0"}},
+		{entry: "255.255.255.254-255.255.255.255", want: []string{"255.255.255.254/31"}},
+		{entry: "::/0", want: []string{"::/0"}},
+		{entry: "2001:db8::1-2001:db8::3", want: []string{"2001:db8::1/128", "2001:db8::2/127"}},
+	}
+	for _, tc := range tests {
+		if got := parseRanges(t, tc.entry)[0].cidrs(); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("cidrs of %s are %v, want %v", tc.entry, got, tc.want)
+		}
+	}
+}
+
+func TestUnion(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []string
+		want    []string
+	}{
+		{name: "adjacent", entries: []string{"10.0.1.0/24", "10.0.0.0/24"}, want: []string{"10.0.0.0/23"}},
+		{name: "overlapping", entries: []string{"10.0.0.0-10.0.0.100", "10.0.0.50-10.0.0.200"}, want: []string{"10.0.0.0-10.0.0.200"}},
+		{name: "subset", entries: []string{"10.0.0.0/16", "10.0.5.5"}, want: []string{"10.0.0.0/16"}},
+		{name: "gap", entries: []string{"10.0.0.1", "10.0.0.3"}, want: []string{"10.0.0.1", "10.0.0.3"}},
+		{name: "families are not joined", entries: []string{"::/0", "0.0.0.0/0"}, want: []string{"0.0.0.0/0", "::/0"}},
+		{name: "ipv6 adjacent", entries: []string{"2001:db8::/33", "2001:db8:8000::/33"}, want: []string{"2001:db8::/32"}},
+	}
+	for _, tc := range tests {
+		if got := strs(union(parseRanges(t, tc.entries...))); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s - union is %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestSubtract(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		want    []string
+	}{
+		{name: "middle", include: []string{"10.0.0.0/24"}, exclude: []string{"10.0.0.128/26"}, want: []string{"10.0.0.0/25", "10.0.0.192/26"}},
+		{name: "partly outside", include: []string{"10.0.0.0/24"}, exclude: []string{"10.0.0.200-10.0.1.50"}, want: []string{"10.0.0.0-10.0.0.199"}},
+		{name: "fully outside", include: []string{"10.0.0.0/24"}, exclude: []string{"192.168.0.0/16"}, want: []string{"10.0.0.0/24"}},
+		{name: "all", include: []string{"10.0.0.0/24"}, exclude: []string{"0.0.0.0/0"}, want: []string{}},
+		{name: "other family", include: []string{"10.0.0.0/24"}, exclude: []string{"::/0"}, want: []string{"10.0.0.0/24"}},
+		{name: "from any", include: []string{"0.0.0.0/0"}, exclude: []string{"10.0.0.0/8"}, want: []string{"0.0.0.0-9.255.255.255", "11.0.0.0-255.255.255.255"}},
+		{name: "ipv6", include: []string{"::/0"}, exclude: []string{"::-7fff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"}, want: []string{"8000::/1"}},
+	}
+	for _, tc := range tests {
+		got := strs(subtract(union(parseRanges(t, tc.include...)), union(parseRanges(t, tc.exclude...))))
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s - subtract is %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestIntersect(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		want []string
+	}{
+		{name: "overlapping", a: []string{"10.0.0.0-10.0.0.100"}, b: []string{"10.0.0.50-10.0.0.200"}, want: []string{"10.0.0.50-10.0.0.100"}},
+		{name: "adjacent", a: []string{"10.0.0.0/24"}, b: []string{"10.0.1.0/24"}, want: []string{}},
+		{name: "any", a: []string{"0.0.0.0/0", "::/0"}, b: []string{"10.0.0.0/8", "2001:db8::/32"}, want: []string{"10.0.0.0/8", "2001:db8::/32"}},
+		{name: "other family", a: []string{"::/0"}, b: []string{"10.0.0.0/8"}, want: []string{}},
+		{name: "joined", a: []string{"10.0.0.0/24"}, b: []string{"10.0.0.0/25", "10.0.0.128/25"}, want: []string{"10.0.0.0/24"}},
+	}
+	for _, tc := range tests {
+		if got := strs(intersect(union(parseRanges(t, tc.a...)), union(parseRanges(t, tc.b...)))); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s - intersect is %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestMinimize(t *testing.T) {
+	tests := []struct {
+		name     string
+		entries  []string
+		cidrOnly bool
+		want     []string
+	}{
+		{name: "adjacent", entries: []string{"10.0.0.0/25", "10.0.0.128/25"}, want: []string{"10.0.0.0/24"}},
+		{name: "subset", entries: []string{"10.0.0.0/16", "10.0.1.0/24", "10.0.1.5"}, want: []string{"10.0.0.0/16"}},
+		{name: "not a cidr", entries: []string{"10.0.0.1-10.0.0.10"}, want: []string{"10.0.0.1-10.0.0.10"}},
+		{name: "not a cidr cidr only", entries: []string{"10.0.0.1-10.0.0.10"}, cidrOnly: true, want: []string{"10.0.0.1", "10.0.0.2/31", "10.0.0.4/30", "10.0.0.8/31", "10.0.0.10"}},
+		{name: "overlapping", entries: []string{"10.0.0.0-10.0.0.100", "10.0.0.50-10.0.0.255"}, want: []string{"10.0.0.0/24"}},
+		{name: "any", entries: []string{"0.0.0.0/0", "10.0.0.0/8", "::/0", "2001:db8::1"}, want: []string{"0.0.0.0/0", "::/0"}},
+		{name: "ipv6", entries: []string{"2001:db8::/33", "2001:db8:8000::/33", "2001:db9::5"}, want: []string{"2001:db8::/32", "2001:db9::5"}},
+	}
+	for _, tc := range tests {
+		if got := strs(minimize(parseRanges(t, tc.entries...), tc.cidrOnly)); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s - minimize is %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -8,4 +8,6 @@ const (
 	HeaderMemberLabelGroups    = "member_label_groups"
 	HeaderFullyExpandedMembers = "fully_expanded_members"
 	HeaderHref                 = "href"
+	HeaderExternalDataSet      = "external_data_set"
+	HeaderExternalDataRef      = "external_data_reference"
 )
@@ -42,11 +42,12 @@ The update-pce and --no-prompt flags are ignored for this command.`,
 			utils.LogError(err.Error())
 		}
 
-		exportLabels()
+		ExportLabelGroups(pce, useActive, noHref, outputFileName)
 	},
 }
 
-func exportLabels() {
+// ExportLabelGroups exports the label groups in the PCE to a CSV file.
+func ExportLabelGroups(pce illumioapi.PCE, useActive, noHref bool, outputFileName string) {
 
 	// Check active/draft
 	provisionStatus := "draft"
@@ -56,9 +57,9 @@ func exportLabels() {
 	utils.LogInfo(fmt.Sprintf("provision status: %s", provisionStatus), false)
 
 	// Start the data slice with headers
-	csvData := [][]string{{HeaderName, HeaderKey, HeaderDescription, HeaderMemberLabels, HeaderMemberLabelGroups, HeaderFullyExpandedMembers, HeaderHref}}
+	csvData := [][]string{{HeaderName, HeaderKey, HeaderDescription, HeaderMemberLabels, HeaderMemberLabelGroups, HeaderFullyExpandedMembers, HeaderExternalDataSet, HeaderExternalDataRef, HeaderHref}}
 	if noHref {
-		csvData = [][]string{{HeaderName, HeaderKey, HeaderDescription, HeaderMemberLabels, HeaderMemberLabelGroups, HeaderFullyExpandedMembers}}
+		csvData = [][]string{{HeaderName, HeaderKey, HeaderDescription, HeaderMemberLabels, HeaderMemberLabelGroups, HeaderFullyExpandedMembers, HeaderExternalDataSet, HeaderExternalDataRef}}
 
 	}
 	// GetAllLabelGroups
@@ -91,9 +92,9 @@ func exportLabels() {
 
 		// Append to data slice
 		if noHref {
-			csvData = append(csvData, []string{lg.Name, lg.Key, lg.Description, strings.Join(labels, "; "), strings.Join(sgs, ";"), strings.Join(fullLabels, "; ")})
+			csvData = append(csvData, []string{lg.Name, lg.Key, lg.Description, strings.Join(labels, "; "), strings.Join(sgs, ";"), strings.Join(fullLabels, "; "), lg.ExternalDataSet, lg.ExternalDataReference})
 		} else {
-			csvData = append(csvData, []string{lg.Name, lg.Key, lg.Description, strings.Join(labels, "; "), strings.Join(sgs, ";"), strings.Join(fullLabels, "; "), lg.Href})
+			csvData = append(csvData, []string{lg.Name, lg.Key, lg.Description, strings.Join(labels, "; "), strings.Join(sgs, ";"), strings.Join(fullLabels, "; "), lg.ExternalDataSet, lg.ExternalDataReference, lg.Href})
 		}
 	}
 
@@ -0,0 +1,250 @@
+package labelsuggest
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	ia "github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/cmd/wkldexport"
+	"github.com/brian1917/workloader/cmd/wkldimport"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Declare local global variables
+var keys, start, end, weight, outputFileName string
+var minConfidence float64
+var iterations int
+var noOrphans, updatePCE, noPrompt bool
+
+func init() {
+	LabelSuggestCmd.Flags().StringVarP(&keys, "keys", "k", "app,role", "comma-separated label keys to suggest.")
+	LabelSuggestCmd.Flags().StringVarP(&start, "start", "s", time.Now().AddDate(0, 0, -88).In(time.UTC).Format("2006-01-02"), "start date in the format of yyyy-mm-dd.")
+	LabelSuggestCmd.Flags().StringVarP(&end, "end", "e", time.Now().Add(time.Hour*24).Format("2006-01-02"), "end date in the format of yyyy-mm-dd.")
+	LabelSuggestCmd.Flags().StringVarP(&weight, "weight", "w", "flows", "edge weight between workloads. options are flows (number of port and protocol flows) or connections (number of connections).")
+	LabelSuggestCmd.Flags().Float64VarP(&minConfidence, "min-confidence", "m", 0.5, "minimum confidence (0 to 1) for a suggestion to be in the wkld-import csv. all suggestions are in the report.")
+	LabelSuggestCmd.Flags().IntVar(&iterations, "iterations", 10, "maximum label propagation iterations.")
+	LabelSuggestCmd.Flags().BoolVar(&noOrphans, "no-orphans", false, "only suggest labels for workloads missing the key. by default, workloads whose value is not used by any of their labeled neighbors are included.")
+	LabelSuggestCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the wkld-import output file location. default is current location with a timestamped filename. the report uses the same name with a -report suffix.")
+	LabelSuggestCmd.Flags().SortFlags = false
+}
+
+// LabelSuggestCmd suggests labels for workloads from traffic
+var LabelSuggestCmd = &cobra.Command{
+	Use:   "label-suggest",
+	Short: "Suggest labels for unlabeled and orphaned workloads from traffic and create a wkld-import CSV.",
+	Long: `
+Suggest labels for unlabeled and orphaned workloads from traffic and create a wkld-import CSV.
+
+Explorer is queried for traffic between workloads in the time window. Each workload is a node in a graph and the traffic between two workloads is an edge. UDP ports 5355 (DNSCache) and 137, 138, 139 (NETBIOS) are ignored.
+
+Workloads are targets for a key if they do not have the key (unlabeled) or if they have the key and talk to at least two workloads with the key but none with the same value (orphan). Use --no-orphans to only include unlabeled workloads. Orphans are not used for role.
+
+Role suggestions use the services a workload provides. Each labeled workload votes for its role with the Jaccard similarity of its provided services and the target's provided services. The confidence is the winning role's share of the votes multiplied by the highest similarity for that role. Workloads that do not provide services do not get a role suggestion.
+
+Other keys (e.g., app) use label propagation. Each target takes the value with the most weight from its neighbors. Targets that are neighbors vote with their suggestion from the previous iteration weighted by its confidence. The confidence is the weight of the winning value divided by the weight of all the target's neighbors, so unlabeled neighbors lower the confidence. Use --weight to set the edge weight to the number of flows or connections.
+
+The output files are:
+- workloader-label-suggest-<timestamp>.csv for wkld-import with the suggestions at or above --min-confidence. Blank values do not change the workload.
+- workloader-label-suggest-report-<timestamp>.csv with every suggestion, the current value, the confidence, and the runner up.
+
+Review the suggestions before importing. With --update-pce, the wkld-import csv is passed into wkld-import.`,
+	Example: `# Suggest app and role labels and review the csvs
+workloader label-suggest
+
+# Suggest app labels for unlabeled workloads and apply suggestions with at least 0.8 confidence
+workloader label-suggest --keys app --no-orphans --min-confidence 0.8 --update-pce`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// Get the PCE
+		pce, err := utils.GetTargetPCEV2(true)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+
+		// Get the viper values
+		updatePCE = viper.GetBool("update_pce")
+		noPrompt = viper.GetBool("no_prompt")
+
+		labelSuggest(pce)
+	},
+}
+
+func labelSuggest(pce ia.PCE) {
+
+	// Validate the flags
+	weight = strings.ToLower(weight)
+	if weight != "flows" && weight != "connections" {
+		utils.LogErrorf("%s is not a valid weight. options are flows or connections.", weight)
+	}
+	if minConfidence < 0 || minConfidence > 1 {
+		utils.LogError("min confidence must be between 0 and 1")
+	}
+	if iterations < 1 {
+		utils.LogError("iterations must be at least 1")
+	}
+	labelKeys := []string{}
+	for _, k := range strings.Split(keys, ",") {
+		if strings.TrimSpace(k) != "" {
+			labelKeys = append(labelKeys, strings.TrimSpace(k))
+		}
+	}
+	if len(labelKeys) == 0 {
+		utils.LogError("at least one label key is required")
+	}
+
+	// Get the PCE objects
+	apiResps, err := pce.Load(ia.LoadInput{Labels: true, Workloads: true}, utils.UseMulti())
+	utils.LogMultiAPIRespV2(apiResps)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
+	// Build the current labels of each workload
+	labels := make(map[string]map[string]string)
+	for _, w := range pce.WorkloadsSlice {
+		labels[w.Href] = make(map[string]string)
+		for _, l := range ia.PtrToVal(w.Labels) {
+			labels[w.Href][pce.Labels[l.Href].Key] = pce.Labels[l.Href].Value
+		}
+	}
+
+	// Build the traffic query
+	tq := ia.TrafficQuery{
+		PolicyStatuses:                  []string{"allowed", "potentially_blocked", "blocked"},
+		PortProtoExclude:                [][2]int{{5355, 17}, {137, 17}, {138, 17}, {139, 17}},
+		MaxFLows:                        200000,
+		ExcludeWorkloadsFromIPListQuery: true,
+		TransmissionExcludes:            []string{"broadcast", "multicast"},
+	}
+	tq.StartTime, err = time.Parse("2006-01-02 MST", fmt.Sprintf("%s %s", start, "UTC"))
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	tq.StartTime = tq.StartTime.In(time.UTC)
+	tq.EndTime, err = time.Parse("2006-01-02 15:04:05 MST", fmt.Sprintf("%s 23:59:59 %s", end, "UTC"))
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	tq.EndTime = tq.EndTime.In(time.UTC)
+
+	traffic, a, err := pce.GetTrafficAnalysis(tq)
+	utils.LogAPIRespV2("GetTrafficAnalysis", a)
+	utils.LogInfof(false, "explorer query body: %s", a.ReqBody)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	utils.LogInfof(true, "%d traffic records", len(traffic))
+	if len(traffic) == tq.MaxFLows {
+		utils.LogWarningf(true, "the query returned the max results. use a smaller time window.")
+	}
+
+	// Build the graph from the flows between workloads
+	protocols := ia.ProtocolList()
+	g := newGraph()
+	for _, t := range traffic {
+		if t.Src.Workload == nil || t.Dst.Workload == nil {
+			continue
+		}
+		w := 1.0
+		if weight == "connections" {
+			w = float64(t.NumConnections)
+		}
+		g.addFlow(t.Src.Workload.Href, t.Dst.Workload.Href, fmt.Sprintf("%d %s", t.ExpSrv.Port, strings.ToLower(protocols[t.ExpSrv.Proto])), w)
+	}
+	utils.LogInfof(true, "%d workloads with traffic to other workloads", len(g.weights))
+
+	// Get the suggestions for each key
+	suggestions := []suggestion{}
+	for _, key := range labelKeys {
+		var keySuggestions map[string]suggestion
+		if key == "role" {
+			keySuggestions = g.serviceVote(key, labels, g.targets(key, labels, false))
+		} else {
+			keySuggestions = g.neighborVote(key, labels, g.targets(key, labels, !noOrphans), iterations)
+		}
+		n := 0
+		for _, s := range keySuggestions {
+			if s.value == s.current {
+				continue
+			}
+			suggestions = append(suggestions, s)
+			n++
+		}
+		utils.LogInfof(true, "%d %s suggestions", n, key)
+	}
+	if len(suggestions) == 0 {
+		utils.LogInfo("no label suggestions", true)
+		return
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].href != suggestions[j].href {
+			return suggestions[i].href < suggestions[j].href
+		}
+		return suggestions[i].key < suggestions[j].key
+	})
+
+	// Build the wkld-import and report data
+	hostname := func(href string) string {
+		w := pce.Workloads[href]
+		if ia.PtrToVal(w.Hostname) != "" {
+			return ia.PtrToVal(w.Hostname)
+		}
+		return ia.PtrToVal(w.Name)
+	}
+	reportData := [][]string{{wkldexport.HeaderHref, wkldexport.HeaderHostname, "key", "current_value", "suggested_value", "confidence", "runner_up", "reason", "neighbors"}}
+	importRows := make(map[string][]string)
+	importHrefs := []string{}
+	for _, s := range suggestions {
+		reportData = append(reportData, []string{s.href, hostname(s.href), s.key, s.current, s.value, strconv.FormatFloat(s.confidence, 'f', 2, 64), s.runnerUp, s.reason, strconv.Itoa(s.neighbors)})
+		if s.confidence < minConfidence {
+			continue
+		}
+		if _, ok := importRows[s.href]; !ok {
+			importRows[s.href] = append([]string{s.href, hostname(s.href)}, make([]string, len(labelKeys))...)
+			importHrefs = append(importHrefs, s.href)
+		}
+		for i, k := range labelKeys {
+			if k == s.key {
+				importRows[s.href][i+2] = s.value
+			}
+		}
+	}
+	importData := [][]string{append([]string{wkldexport.HeaderHref, wkldexport.HeaderHostname}, labelKeys...)}
+	for _, h := range importHrefs {
+		importData = append(importData, importRows[h])
+	}
+
+	// Write the output files
+	ts := time.Now().Format("20060102_150405")
+	if outputFileName == "" {
+		outputFileName = fmt.Sprintf("workloader-label-suggest-%s.csv", ts)
+	}
+	reportFileName := fmt.Sprintf("%s-report.csv", strings.TrimSuffix(outputFileName, ".csv"))
+	utils.WriteOutput(reportData, nil, reportFileName)
+	utils.LogInfof(true, "%d suggestions in %s", len(reportData)-1, reportFileName)
+	if len(importData) == 1 {
+		utils.LogInfof(true, "no suggestions at or above the min confidence of %.2f", minConfidence)
+		return
+	}
+	utils.WriteOutput(importData, nil, outputFileName)
+	utils.LogInfof(true, "%d workloads with suggestions at or above the min confidence of %.2f in %s", len(importData)-1, minConfidence, outputFileName)
+
+	// Pass the output into wkld-import
+	utils.LogInfo("passing output into wkld-import...", true)
+	wkldimport.ImportWkldsFromCSV(wkldimport.Input{
+		PCE:             pce,
+		ImportFile:      outputFileName,
+		RemoveValue:     "label-suggest-delete",
+		Umwl:            false,
+		UpdateWorkloads: true,
+		UpdatePCE:       updatePCE,
+		NoPrompt:        noPrompt,
+		MaxUpdate:       -1,
+		MaxCreate:       -1,
+	})
+}
@@ -0,0 +1,219 @@
+package labelsuggest
+
+import (
+	"sort"
+)
+
+// graph is the workload communication graph built from traffic
+type graph struct {
+	// weights is the undirected edge weight between two workload hrefs
+	weights map[string]map[string]float64
+	// provided is the services (e.g., 443 tcp) each workload provides
+	provided map[string]map[string]bool
+}
+
+func newGraph() *graph {
+	return &graph{weights: make(map[string]map[string]float64), provided: make(map[string]map[string]bool)}
+}
+
+// addFlow adds a flow between two workloads. Flows between a workload and itself are ignored.
+func (g *graph) addFlow(src, dst, service string, weight float64) {
+	if src == dst || src == "" || dst == "" {
+		return
+	}
+	for _, pair := range [][2]string{{src, dst}, {dst, src}} {
+		if g.weights[pair[0]] == nil {
+			g.weights[pair[0]] = make(map[string]float64)
+		}
+		g.weights[pair[0]][pair[1]] += weight
+	}
+	if g.provided[dst] == nil {
+		g.provided[dst] = make(map[string]bool)
+	}
+	g.provided[dst][service] = true
+}
+
+// nodes returns the workload hrefs in the graph sorted
+func (g *graph) nodes() []string {
+	nodes := []string{}
+	for n := range g.weights {
+		nodes = append(nodes, n)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// suggestion is a proposed label value for a workload
+type suggestion struct {
+	href       string
+	key        string
+	current    string
+	value      string
+	runnerUp   string
+	confidence float64
+	reason     string
+	neighbors  int
+}
+
+// Reasons a workload is a target for a suggestion
+const (
+	reasonUnlabeled = "unlabeled"
+	reasonOrphan    = "orphan"
+)
+
+// targets returns the workloads that need a value for the key and the reason.
+// Workloads are unlabeled if they do not have the key. Workloads are orphans if they talk to at least two workloads with the key and none have the same value.
+// A workload that only talks to one labeled workload is not an orphan because either side of the pair could be the mislabeled one.
+func (g *graph) targets(key string, labels map[string]map[string]string, orphans bool) map[string]string {
+	targets := make(map[string]string)
+	for _, n := range g.nodes() {
+		value := labels[n][key]
+		if value == "" {
+			targets[n] = reasonUnlabeled
+			continue
+		}
+		if !orphans {
+			continue
+		}
+		labeledNeighbors, sameValue := 0, false
+		for neighbor := range g.weights[n] {
+			if v := labels[neighbor][key]; v != "" {
+				labeledNeighbors++
+				if v == value {
+					sameValue = true
+					break
+				}
+			}
+		}
+		if labeledNeighbors > 1 && !sameValue {
+			targets[n] = reasonOrphan
+		}
+	}
+	return targets
+}
+
+// vote is the weight for each value
+type vote map[string]float64
+
+// winner returns the value with the most weight and the runner up. Ties go to the first value alphabetically.
+func (v vote) winner() (winner, runnerUp string) {
+	values := []string{}
+	for value := range v {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if v[values[i]] != v[values[j]] {
+			return v[values[i]] > v[values[j]]
+		}
+		return values[i] < values[j]
+	})
+	if len(values) > 0 {
+		winner = values[0]
+	}
+	if len(values) > 1 {
+		runnerUp = values[1]
+	}
+	return winner, runnerUp
+}
+
+// neighborVote runs label propagation for the targets. Each target takes the value with the most weight from its neighbors.
+// Neighbors that are targets vote with their suggestion from the previous iteration weighted by its confidence.
+// The confidence is the weight of the winning value divided by the weight of all the target's neighbors.
+func (g *graph) neighborVote(key string, labels map[string]map[string]string, targets map[string]string, iterations int) map[string]suggestion {
+
+	targetHrefs := []string{}
+	for t := range targets {
+		targetHrefs = append(targetHrefs, t)
+	}
+	sort.Strings(targetHrefs)
+
+	current := make(map[string]suggestion)
+	for i := 0; i < iterations; i++ {
+		next := make(map[string]suggestion)
+		changed := false
+		for _, t := range targetHrefs {
+			v, total := make(vote), 0.0
+			for neighbor, w := range g.weights[t] {
+				total += w
+				if _, ok := targets[neighbor]; ok {
+					if s, ok := current[neighbor]; ok {
+						v[s.value] += w * s.confidence
+					}
+					continue
+				}
+				if value := labels[neighbor][key]; value != "" {
+					v[value] += w
+				}
+			}
+			if len(v) == 0 || total == 0 {
+				continue
+			}
+			winner, runnerUp := v.winner()
+			s := suggestion{href: t, key: key, current: labels[t][key], value: winner, runnerUp: runnerUp, confidence: v[winner] / total, reason: targets[t], neighbors: len(g.weights[t])}
+			if current[t].value != s.value {
+				changed = true
+			}
+			next[t] = s
+		}
+		current = next
+		if !changed {
+			break
+		}
+	}
+
+	return current
+}
+
+// serviceVote suggests values for the targets from workloads that provide the same services.
+// The similarity of two workloads is the Jaccard index of their provided services and each labeled workload votes with its similarity.
+// The confidence is the share of the winning value multiplied by the highest similarity for that value.
+func (g *graph) serviceVote(key string, labels map[string]map[string]string, targets map[string]string) map[string]suggestion {
+
+	suggestions := make(map[string]suggestion)
+	for t := range targets {
+		if len(g.provided[t]) == 0 {
+			continue
+		}
+		v, best, total := make(vote), make(map[string]float64), 0.0
+		for n, services := range g.provided {
+			if _, ok := targets[n]; ok {
+				continue
+			}
+			value := labels[n][key]
+			if value == "" {
+				continue
+			}
+			sim := jaccard(g.provided[t], services)
+			if sim == 0 {
+				continue
+			}
+			v[value] += sim
+			total += sim
+			if sim > best[value] {
+				best[value] = sim
+			}
+		}
+		if len(v) == 0 {
+			continue
+		}
+		winner, runnerUp := v.winner()
+		suggestions[t] = suggestion{href: t, key: key, current: labels[t][key], value: winner, runnerUp: runnerUp, confidence: v[winner] / total * best[winner], reason: targets[t], neighbors: len(g.weights[t])}
+	}
+
+	return suggestions
+}
+
+// jaccard returns the size of the intersection divided by the size of the union
+func jaccard(a, b map[string]bool) float64 {
+	intersection := 0
+	for k := range a {
+		if b[k] {
+			intersection++
+		}
+	}
+	union := len(a) + len(b) - intersection
+	if union == 0 {
+		return 0
+	}
+	return float64(intersection) / float64(union)
+}
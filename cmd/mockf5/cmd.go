@@ -0,0 +1,71 @@
+package mockf5
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+)
+
+var port int
+var address, user, password, fixtureDir string
+
+func init() {
+	MockF5Cmd.Flags().IntVar(&port, "port", 8444, "port for the mock f5 to listen on.")
+	MockF5Cmd.Flags().StringVar(&address, "address", "127.0.0.1", "address for the mock f5 to listen on.")
+	MockF5Cmd.Flags().StringVar(&user, "user", "admin", "user the mock f5 accepts.")
+	MockF5Cmd.Flags().StringVar(&password, "password", "admin", "password the mock f5 accepts.")
+	MockF5Cmd.Flags().StringVar(&fixtureDir, "fixtures", "", "optional directory of json fixtures. files named virtual.json, pool.json, snatpool.json, snat-translation.json, and self.json replace the built-in fixture for that collection.")
+
+	MockF5Cmd.Flags().SortFlags = false
+}
+
+// MockF5Cmd runs the mock-f5 command
+var MockF5Cmd = &cobra.Command{
+	Use:   "mock-f5",
+	Short: "Run a local stub of the F5 BIG-IP iControl REST API for testing f5-sync.",
+	Long: `
+Run a local stub of the F5 BIG-IP iControl REST API for testing f5-sync.
+
+The mock f5 is an HTTPS server with a self-signed certificate that implements the iControl REST calls f5-sync uses:
+- token login at /mgmt/shared/authn/login
+- ltm virtual, pool (with expanded members), snatpool, and snat-translation
+- net self
+
+The built-in fixtures have virtual servers with pool members that match the mock-pce workloads, a SNAT pool, automap, and a virtual server on any port in another partition. Use the --fixtures flag to point to a directory with any of the following files to replace the built-in data: virtual.json, pool.json, snatpool.json, snat-translation.json, self.json. Each file is a json array of objects in the same format as the items in the iControl REST response.
+
+Run the mock f5 in a separate terminal and point f5-sync to it:
+workloader f5-sync --f5-server 127.0.0.1:8444 --f5-user admin --f5-pwd admin --insecure
+
+The update-pce and --no-prompt flags are ignored for this command.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		s, err := NewServer(user, password, fixtureDir)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+
+		if err := ListenAndServe(s, fmt.Sprintf("%s:%d", address, port)); err != nil {
+			utils.LogError(err.Error())
+		}
+	},
+}
+
+// ListenAndServe serves the mock f5 over https with a generated self-signed certificate
+func ListenAndServe(handler http.Handler, addr string) error {
+	cert, err := utils.SelfSignedCert()
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Addr:      addr,
+		Handler:   handler,
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+	}
+
+	utils.LogInfof(true, "mock f5 listening on https://%s. press ctrl+c to stop.", addr)
+	return server.ListenAndServeTLS("", "")
+}
@@ -0,0 +1,121 @@
+package mockf5
+
+import (
+	"crypto/subtle"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/brian1917/workloader/utils"
+	"github.com/google/uuid"
+)
+
+//go:embed fixtures/*.json
+var fixtureFS embed.FS
+
+// collections are the iControl REST paths served by the mock f5 and their fixture file
+var collections = map[string]string{
+	"/mgmt/tm/ltm/virtual":          "virtual.json",
+	"/mgmt/tm/ltm/pool":             "pool.json",
+	"/mgmt/tm/ltm/snatpool":         "snatpool.json",
+	"/mgmt/tm/ltm/snat-translation": "snat-translation.json",
+	"/mgmt/tm/net/self":             "self.json",
+}
+
+// Server is an in-memory BIG-IP that serves the iControl REST calls used by f5-sync
+type Server struct {
+	mu       sync.Mutex
+	User     string
+	Password string
+	items    map[string]json.RawMessage
+	tokens   map[string]bool
+}
+
+// NewServer creates a mock f5 loaded with the embedded fixtures.
+// Files in fixtureDir with the same names override the embedded fixture for that collection.
+func NewServer(user, password, fixtureDir string) (*Server, error) {
+	s := &Server{User: user, Password: password, items: make(map[string]json.RawMessage), tokens: make(map[string]bool)}
+
+	for path, file := range collections {
+		data, err := fixtureFS.ReadFile("fixtures/" + file)
+		if err != nil {
+			return nil, err
+		}
+		if fixtureDir != "" {
+			if custom, err := os.ReadFile(filepath.Join(fixtureDir, file)); err == nil {
+				utils.LogInfof(false, "mock-f5 - using %s for %s", filepath.Join(fixtureDir, file), path)
+				data = custom
+			}
+		}
+		var items []interface{}
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil, fmt.Errorf("%s fixture - %s", file, err)
+		}
+		s.items[path] = data
+	}
+
+	return s, nil
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(data)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	writeJSON(w, statusCode, map[string]interface{}{"code": statusCode, "message": message, "errorStack": []string{}})
+}
+
+// ServeHTTP routes requests to the mock f5 endpoints
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	utils.LogDebug(fmt.Sprintf("mock-f5 - %s %s", r.Method, r.URL.String()))
+
+	// Token login
+	if r.URL.Path == "/mgmt/shared/authn/login" {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "login requires POST")
+			return
+		}
+		var login struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&login); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if login.Username != s.User || subtle.ConstantTimeCompare([]byte(login.Password), []byte(s.Password)) != 1 {
+			writeError(w, http.StatusUnauthorized, "Authentication failed.")
+			return
+		}
+		token := uuid.New().String()
+		s.tokens[token] = true
+		writeJSON(w, http.StatusOK, map[string]interface{}{"username": login.Username, "token": map[string]interface{}{"token": token, "timeout": 1200}})
+		return
+	}
+
+	// All other endpoints require a token
+	if !s.tokens[r.Header.Get("X-F5-Auth-Token")] {
+		writeError(w, http.StatusUnauthorized, "X-F5-Auth-Token does not exist.")
+		return
+	}
+
+	items, ok := s.items[r.URL.Path]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("%s is not supported by mock-f5", r.URL.Path))
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "mock-f5 is read-only")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"kind": "tm:collectionstate", "selfLink": "https://localhost" + r.URL.Path, "items": items})
+}
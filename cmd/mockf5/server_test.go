@@ -0,0 +1,165 @@
+package mockf5
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/brian1917/workloader/cmd/f5sync"
+	"github.com/brian1917/workloader/cmd/mockpce"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/viper"
+)
+
+func TestMain(m *testing.M) {
+	utils.Logger.SetOutput(io.Discard)
+	viper.Set("no_prompt", true)
+	os.Exit(m.Run())
+}
+
+// TestRecordedLoginIsRedacted records an f5 login and a call with the auth token and checks no credentials are saved
+func TestRecordedLoginIsRedacted(t *testing.T) {
+	s, err := NewServer("admin", "f5-test-password", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewTLSServer(s)
+	defer ts.Close()
+
+	recordDir := t.TempDir()
+	if err := utils.SetUpRecording(recordDir, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	f5 := f5sync.F5{Server: ts.URL, User: "admin", Password: "f5-test-password", Insecure: true}
+	if err := f5.Login(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f5.GetVirtualServers(); err != nil {
+		t.Fatal(err)
+	}
+
+	secrets := []string{"f5-test-password"}
+	for token := range s.tokens {
+		secrets = append(secrets, token)
+	}
+	if len(secrets) != 2 {
+		t.Fatalf("mock f5 issued %d tokens, want 1", len(secrets)-1)
+	}
+
+	files, err := filepath.Glob(filepath.Join(recordDir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) < 2 {
+		t.Fatalf("%d exchanges recorded, want at least 2", len(files))
+	}
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, secret := range secrets {
+			if strings.Contains(string(data), secret) {
+				t.Errorf("%s contains %s", filepath.Base(f), secret)
+			}
+		}
+	}
+}
+
+// getPCE gets a collection from the mock pce and returns the values of field sorted
+func getPCE(t *testing.T, pceURL, path, field string) []string {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, pceURL+"/api/v2/orgs/1/"+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth("mock", "mock")
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	objects := []map[string]interface{}{}
+	if err := json.NewDecoder(resp.Body).Decode(&objects); err != nil {
+		t.Fatal(err)
+	}
+	values := []string{}
+	for _, o := range objects {
+		switch v := o[field].(type) {
+		case string:
+			values = append(values, v)
+		case map[string]interface{}:
+			values = append(values, v["href"].(string))
+		}
+	}
+	sort.Strings(values)
+	return values
+}
+
+// TestF5SyncPartitions syncs only the Common partition against an f5 with Common and Tenant1 and a pce with stale objects in both.
+// Stale Common objects are removed and Tenant1 objects are not changed.
+func TestF5SyncPartitions(t *testing.T) {
+	pceServer, err := mockpce.NewServer(filepath.Join("testdata", "partitions"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pceTS := httptest.NewTLSServer(pceServer)
+	defer pceTS.Close()
+	u, err := url.Parse(pceTS.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	viper.Set("target_pce", "mock")
+	viper.Set("mock.fqdn", u.Hostname())
+	viper.Set("mock.port", u.Port())
+	viper.Set("mock.org", 1)
+	viper.Set("mock.user", "mock")
+	viper.Set("mock.key", "mock")
+	viper.Set("mock.disableTLSChecking", true)
+	viper.Set("update_pce", true)
+	defer viper.Set("update_pce", false)
+
+	s, err := NewServer("admin", "f5-test-password", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewTLSServer(s)
+	defer ts.Close()
+
+	flags := map[string]string{"f5-server": ts.URL, "f5-user": "admin", "f5-pwd": "f5-test-password", "insecure": "true", "partitions": "Common"}
+	for k, v := range flags {
+		if err := f5sync.F5SyncCmd.Flags().Set(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer f5sync.F5SyncCmd.Flags().Set("partitions", "")
+	f5sync.F5SyncCmd.Run(f5sync.F5SyncCmd, nil)
+
+	if got, want := getPCE(t, pceTS.URL, "sec_policy/draft/virtual_services", "name"), []string{"Tenant1/app1/vs_retired", "vs_crm_web", "vs_erp_web"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("virtual services are %v, want %v", got, want)
+	}
+	if got, want := getPCE(t, pceTS.URL, "workloads", "hostname"), []string{"10.0.100.50-snat", "10.0.200.50-snat", "crm-web-01", "erp-db-01", "erp-web-01", "internal-float-self", "internal-self-self", "legacy-mainframe", "legacy-snat", "snat_dmz_2-snat"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("workloads are %v, want %v", got, want)
+	}
+	if got, want := getPCE(t, pceTS.URL, "workloads?hostname=10.0.100.50-snat", "external_data_reference"), []string{"/Common/10.0.100.50"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("snat workload external data reference is %v, want %v", got, want)
+	}
+	bindings := getPCE(t, pceTS.URL, "service_bindings", "workload")
+	if got, want := bindings, []string{"/orgs/1/workloads/1", "/orgs/1/workloads/2", "/orgs/1/workloads/3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("bound workloads are %v, want %v", got, want)
+	}
+	if got := getPCE(t, pceTS.URL, "service_bindings?virtual_service=/orgs/1/sec_policy/active/virtual_services/2", "href"); !reflect.DeepEqual(got, []string{"/orgs/1/service_bindings/b1"}) {
+		t.Errorf("Tenant1 virtual service bindings are %v, want the existing binding", got)
+	}
+}
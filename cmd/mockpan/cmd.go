@@ -0,0 +1,82 @@
+package mockpan
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+)
+
+var port, failEvery, maxEntries int
+var address, key, devicesFile string
+
+func init() {
+	MockPANCmd.Flags().IntVar(&port, "port", 9443, "port for the mock pan to listen on.")
+	MockPANCmd.Flags().StringVar(&address, "address", "127.0.0.1", "address for the mock pan to listen on.")
+	MockPANCmd.Flags().StringVar(&key, "key", "mock", "api key the mock pan accepts.")
+	MockPANCmd.Flags().StringVar(&devicesFile, "devices", "", "optional json file with the panorama device groups. see description for format.")
+	MockPANCmd.Flags().IntVar(&failEvery, "fail-every", 0, "return an http 503 for every nth user-id call to test retries. 0 disables.")
+	MockPANCmd.Flags().IntVar(&maxEntries, "max-entries", 0, "reject user-id calls with more than this many entries to test batching. 0 disables.")
+
+	MockPANCmd.Flags().SortFlags = false
+}
+
+// MockPANCmd runs the mock-pan command
+var MockPANCmd = &cobra.Command{
+	Use:   "mock-pan",
+	Short: "Run a local stub PAN XML API for testing dag-sync.",
+	Long: `
+Run a local stub PAN XML API for testing dag-sync.
+
+The mock pan is an in-memory HTTPS server with a self-signed certificate that implements the XML API calls dag-sync uses:
+- show high-availability state. HA is always disabled.
+- set target-vsys
+- show registered-ip with paging
+- user-id register and unregister
+- show devicegroups
+
+Calls without a target act as a firewall. Calls with a target serial act as Panorama redirecting to that firewall. Each firewall and vsys has its own registered IPs. Changes are kept in memory and reset when the mock pan stops.
+
+The built-in device groups are dg1 with fw1 and fw2 connected and fw3 disconnected, and dg2 with fw4 using vsys1 and vsys2. Use --devices to provide a json file instead:
+[
+  {"name": "dg1", "devices": [{"serial": "007951000000001", "hostname": "fw1", "connected": true, "vsys": ["vsys1"]}]}
+]
+
+Run the mock pan in a separate terminal and point dag-sync to it:
+workloader dag-sync --url https://127.0.0.1:9443 --key mock --insecure
+workloader dag-sync --url https://127.0.0.1:9443 --key mock --insecure --device-group dg1,dg2 --batch-size 50
+
+The update-pce and --no-prompt flags are ignored for this command.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		s, err := NewServer(key, devicesFile)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		s.FailEvery = failEvery
+		s.MaxEntries = maxEntries
+
+		if err := ListenAndServe(s, fmt.Sprintf("%s:%d", address, port)); err != nil {
+			utils.LogError(err.Error())
+		}
+	},
+}
+
+// ListenAndServe serves the mock pan over https with a generated self-signed certificate
+func ListenAndServe(handler http.Handler, addr string) error {
+	cert, err := utils.SelfSignedCert()
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Addr:      addr,
+		Handler:   handler,
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+	}
+
+	utils.LogInfof(true, "mock pan listening on https://%s. press ctrl+c to stop.", addr)
+	return server.ListenAndServeTLS("", "")
+}
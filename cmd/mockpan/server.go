@@ -0,0 +1,288 @@
+package mockpan
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/brian1917/workloader/cmd/dagsync"
+	"github.com/brian1917/workloader/utils"
+)
+
+// Device is a firewall managed by the mock Panorama
+type Device struct {
+	Serial    string   `json:"serial"`
+	Hostname  string   `json:"hostname"`
+	Connected bool     `json:"connected"`
+	Vsys      []string `json:"vsys"`
+}
+
+// DeviceGroup is a Panorama device group in the devices file
+type DeviceGroup struct {
+	Name    string   `json:"name"`
+	Devices []Device `json:"devices"`
+}
+
+// defaultDeviceGroups are used when a devices file is not provided
+var defaultDeviceGroups = []DeviceGroup{
+	{Name: "dg1", Devices: []Device{
+		{Serial: "007951000000001", Hostname: "fw1", Connected: true},
+		{Serial: "007951000000002", Hostname: "fw2", Connected: true},
+		{Serial: "007951000000003", Hostname: "fw3", Connected: false},
+	}},
+	{Name: "dg2", Devices: []Device{
+		{Serial: "007951000000004", Hostname: "fw4", Connected: true, Vsys: []string{"vsys1", "vsys2"}},
+	}},
+}
+
+var (
+	targetVsysRegex = regexp.MustCompile(`<target-vsys>(.*?)</target-vsys>`)
+	limitRegex      = regexp.MustCompile(`<limit>(\d+)</limit>`)
+	startPointRegex = regexp.MustCompile(`<start-point>(\d+)</start-point>`)
+	dgNameRegex     = regexp.MustCompile(`<name>(.*?)</name>`)
+)
+
+// pageSize is the number of registered IPs returned by show registered-ip all
+const pageSize = 500
+
+// Server is an in-memory PAN XML API that serves the calls used by dag-sync.
+// It acts as a firewall for calls without a target and as Panorama for calls with a target serial.
+type Server struct {
+	mu           sync.Mutex
+	Key          string
+	FailEvery    int // return a 503 for every nth user-id call. 0 disables.
+	MaxEntries   int // reject user-id calls with more entries. 0 disables.
+	deviceGroups []DeviceGroup
+	devices      map[string]Device
+	targetVsys   map[string]string
+	registered   map[string]map[string]map[string]bool // target/vsys -> ip -> tags
+	userIDCalls  int
+}
+
+// NewServer creates a mock PAN. Device groups are loaded from devicesFile if it is provided.
+func NewServer(key, devicesFile string) (*Server, error) {
+	s := &Server{Key: key, deviceGroups: defaultDeviceGroups, devices: make(map[string]Device), targetVsys: make(map[string]string), registered: make(map[string]map[string]map[string]bool)}
+
+	if devicesFile != "" {
+		data, err := os.ReadFile(devicesFile)
+		if err != nil {
+			return nil, err
+		}
+		s.deviceGroups = []DeviceGroup{}
+		if err := json.Unmarshal(data, &s.deviceGroups); err != nil {
+			return nil, fmt.Errorf("devices file - %s", err)
+		}
+	}
+	for _, dg := range s.deviceGroups {
+		for _, d := range dg.Devices {
+			s.devices[d.Serial] = d
+		}
+	}
+
+	return s, nil
+}
+
+// writeXML writes a PAN API response
+func writeXML(w http.ResponseWriter, statusCode int, resp dagsync.DagResponse) {
+	data, err := xml.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=UTF-8")
+	w.WriteHeader(statusCode)
+	w.Write(data)
+}
+
+func errorResponse(msg string) dagsync.DagResponse {
+	return dagsync.DagResponse{Status: "error", Result: dagsync.Result{Error: msg}}
+}
+
+// ServeHTTP handles /api requests
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.URL.Path != "/api" && r.URL.Path != "/api/" {
+		http.NotFound(w, r)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeXML(w, http.StatusBadRequest, errorResponse(err.Error()))
+		return
+	}
+	utils.LogDebug(fmt.Sprintf("mock-pan - %s type=%s target=%s vsys=%s cmd=%s", r.Method, r.Form.Get("type"), r.Form.Get("target"), r.Form.Get("vsys"), r.Form.Get("cmd")))
+
+	if r.Form.Get("key") != s.Key {
+		writeXML(w, http.StatusForbidden, errorResponse("Invalid Credential"))
+		return
+	}
+
+	// Calls with a target are redirected by Panorama to the managed firewall
+	target := r.Form.Get("target")
+	if target != "" {
+		if d, ok := s.devices[target]; !ok || !d.Connected {
+			writeXML(w, http.StatusOK, errorResponse(fmt.Sprintf("device %s is not connected", target)))
+			return
+		}
+	}
+
+	switch r.Form.Get("type") {
+	case "op":
+		writeXML(w, http.StatusOK, s.op(target, r.Form.Get("vsys"), r.Form.Get("cmd")))
+	case "user-id":
+		s.userIDCalls++
+		if s.FailEvery > 0 && s.userIDCalls%s.FailEvery == 0 {
+			writeXML(w, http.StatusServiceUnavailable, errorResponse("injected failure"))
+			return
+		}
+		writeXML(w, http.StatusOK, s.userID(target, r.Form.Get("vsys"), r.Form.Get("cmd")))
+	default:
+		writeXML(w, http.StatusOK, errorResponse(fmt.Sprintf("type %s is not supported by mock-pan", r.Form.Get("type"))))
+	}
+}
+
+// deviceKey is the key for a device's registered IPs. The target-vsys setting takes precedence over the vsys parameter.
+func (s *Server) deviceKey(target, vsys string) string {
+	if tv := s.targetVsys[target]; tv != "" && tv != "none" {
+		vsys = tv
+	}
+	if vsys == "" {
+		vsys = "vsys1"
+	}
+	return target + "/" + vsys
+}
+
+func (s *Server) op(target, vsys, cmd string) dagsync.DagResponse {
+	success := dagsync.DagResponse{Status: "success"}
+
+	switch {
+	case strings.Contains(cmd, "<high-availability>"):
+		success.Result.Enabled = "no"
+		return success
+
+	case strings.Contains(cmd, "<target-vsys>"):
+		m := targetVsysRegex.FindStringSubmatch(cmd)
+		s.targetVsys[target] = m[1]
+		return success
+
+	case strings.Contains(cmd, "<registered-ip>"):
+		registered := s.registered[s.deviceKey(target, vsys)]
+		ips := []string{}
+		for ip := range registered {
+			ips = append(ips, ip)
+		}
+		sort.Strings(ips)
+
+		start, limit := 1, pageSize
+		if m := startPointRegex.FindStringSubmatch(cmd); m != nil {
+			start, _ = strconv.Atoi(m[1])
+		}
+		if m := limitRegex.FindStringSubmatch(cmd); m != nil {
+			limit, _ = strconv.Atoi(m[1])
+		}
+		for i := start - 1; i >= 0 && i < len(ips) && i < start-1+limit; i++ {
+			tags := []string{}
+			for t := range registered[ips[i]] {
+				tags = append(tags, t)
+			}
+			sort.Strings(tags)
+			entry := dagsync.Entry{IP: ips[i], FromAgent: "0", Persistent: "1"}
+			for _, t := range tags {
+				entry.Tag.Members = append(entry.Tag.Members, dagsync.Member{Member: t})
+			}
+			success.Result.Entry = append(success.Result.Entry, entry)
+		}
+		success.Result.Count = len(success.Result.Entry)
+		return success
+
+	case strings.Contains(cmd, "<devicegroups>"):
+		if target != "" {
+			return errorResponse("show devicegroups is only supported on Panorama")
+		}
+		name := ""
+		if m := dgNameRegex.FindStringSubmatch(cmd); m != nil {
+			name = m[1]
+		}
+		for _, dg := range s.deviceGroups {
+			if name != "" && dg.Name != name {
+				continue
+			}
+			entry := dagsync.DeviceGroup{Name: dg.Name}
+			for _, d := range dg.Devices {
+				device := dagsync.Device{Name: d.Serial, Serial: d.Serial, Hostname: d.Hostname, Connected: "no"}
+				if d.Connected {
+					device.Connected = "yes"
+				}
+				for _, v := range d.Vsys {
+					device.Vsys.Entry = append(device.Vsys.Entry, dagsync.VsysEntry{Name: v})
+				}
+				entry.Devices.Entry = append(entry.Devices.Entry, device)
+			}
+			success.Result.DeviceGroups.Entry = append(success.Result.DeviceGroups.Entry, entry)
+		}
+		return success
+	}
+
+	return errorResponse("command is not supported by mock-pan")
+}
+
+func (s *Server) userID(target, vsys, cmd string) dagsync.DagResponse {
+	var request dagsync.DagRequest
+	if err := xml.Unmarshal([]byte(cmd), &request); err != nil {
+		return errorResponse(fmt.Sprintf("invalid uid-message - %s", err))
+	}
+
+	register := request.Payload.Register.Entry
+	unregister := request.Payload.Unregister.Entry
+	if s.MaxEntries > 0 && len(register)+len(unregister) > s.MaxEntries {
+		resp := dagsync.DagResponse{Status: "error"}
+		for _, e := range register {
+			resp.MSG.Line.UIDResponse.Payload.Register.Entry = append(resp.MSG.Line.UIDResponse.Payload.Register.Entry, dagsync.Entry{IP: e.IP, Message: fmt.Sprintf("more than %d entries in the request", s.MaxEntries)})
+		}
+		for _, e := range unregister {
+			resp.MSG.Line.UIDResponse.Payload.Unregister.Entry = append(resp.MSG.Line.UIDResponse.Payload.Unregister.Entry, dagsync.Entry{IP: e.IP, Message: fmt.Sprintf("more than %d entries in the request", s.MaxEntries)})
+		}
+		return resp
+	}
+
+	key := s.deviceKey(target, vsys)
+	if s.registered[key] == nil {
+		s.registered[key] = make(map[string]map[string]bool)
+	}
+	registered := s.registered[key]
+
+	for _, e := range register {
+		if registered[e.IP] == nil {
+			registered[e.IP] = make(map[string]bool)
+		}
+		for _, m := range e.Tag.Members {
+			registered[e.IP][m.Member] = true
+		}
+	}
+
+	// An entry without tags unregisters the ip
+	for _, e := range unregister {
+		if len(e.Tag.Members) == 0 {
+			delete(registered, e.IP)
+			continue
+		}
+		for _, m := range e.Tag.Members {
+			delete(registered[e.IP], m.Member)
+		}
+		if len(registered[e.IP]) == 0 {
+			delete(registered, e.IP)
+		}
+	}
+
+	utils.LogInfof(false, "mock-pan - %s - registered %d and unregistered %d entries. %d registered ips.", key, len(register), len(unregister), len(registered))
+
+	return dagsync.DagResponse{Status: "success"}
+}
@@ -0,0 +1,128 @@
+package mockpan
+
+import (
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/brian1917/workloader/cmd/dagsync"
+	"github.com/brian1917/workloader/cmd/mockpce"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/viper"
+)
+
+func TestMain(m *testing.M) {
+	utils.Logger.SetOutput(io.Discard)
+	viper.Set("output_format", "csv")
+	viper.Set("no_prompt", true)
+	os.Exit(m.Run())
+}
+
+// newTestPAN starts a mock pan and a mock pce with the built-in fixtures and points dag-sync at them
+func newTestPAN(t *testing.T) (*Server, string) {
+	t.Helper()
+
+	pceServer, err := mockpce.NewServer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pceTS := httptest.NewTLSServer(pceServer)
+	t.Cleanup(pceTS.Close)
+	u, err := url.Parse(pceTS.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	viper.Set("target_pce", "mock")
+	viper.Set("mock.fqdn", u.Hostname())
+	viper.Set("mock.port", u.Port())
+	viper.Set("mock.org", 1)
+	viper.Set("mock.user", "mock")
+	viper.Set("mock.key", "mock")
+	viper.Set("mock.disableTLSChecking", true)
+
+	s, err := NewServer("mock", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewTLSServer(s)
+	t.Cleanup(ts.Close)
+
+	return s, ts.URL
+}
+
+// runDAGSync runs dag-sync with the flags. Flags not provided are set to their defaults.
+func runDAGSync(t *testing.T, flags map[string]string) {
+	t.Helper()
+	values := map[string]string{"key": "mock", "vsys": "vsys1", "insecure": "true", "update-panos": "true", "device-group": "", "batch-size": "500", "retries": "0", "include-unlabeled": "false", "tag-template": "{value}", "output-file": filepath.Join(t.TempDir(), "dag-sync.csv")}
+	for k, v := range flags {
+		values[k] = v
+	}
+	for k, v := range values {
+		if err := dagsync.DAGSyncCmd.Flags().Set(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dagsync.DAGSyncCmd.Run(dagsync.DAGSyncCmd, nil)
+}
+
+// tags returns the sorted tags registered for an ip on a device
+func (s *Server) tags(device, ip string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tags := []string{}
+	for t := range s.registered[device][ip] {
+		tags = append(tags, t)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+func TestDAGSyncFirewall(t *testing.T) {
+	s, panURL := newTestPAN(t)
+
+	runDAGSync(t, map[string]string{"url": panURL})
+
+	want := map[string][]string{
+		"10.0.1.10": {"/orgs/1/workloads/1", "dc1", "erp", "prod", "web"},
+		"10.0.2.10": {"/orgs/1/workloads/2", "db", "dc1", "erp", "prod"},
+		"10.1.1.10": {"/orgs/1/workloads/3", "crm", "dev", "web"},
+	}
+	for ip, tags := range want {
+		if got := s.tags("/vsys1", ip); !reflect.DeepEqual(got, tags) {
+			t.Errorf("%s registered with %v, want %v", ip, got, tags)
+		}
+	}
+	if got := s.tags("/vsys1", "10.9.9.9"); len(got) != 0 {
+		t.Errorf("unlabeled workload registered with %v without --include-unlabeled", got)
+	}
+
+	// A second sync with a new template replaces the tags and registers the unlabeled workload
+	runDAGSync(t, map[string]string{"url": panURL, "tag-template": "illumio.{key}.{value}", "include-unlabeled": "true"})
+	if got, want := s.tags("/vsys1", "10.1.1.10"), []string{"/orgs/1/workloads/3", "illumio.app.crm", "illumio.env.dev", "illumio.role.web"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("10.1.1.10 registered with %v after template change, want %v", got, want)
+	}
+	if got, want := s.tags("/vsys1", "10.9.9.9"), []string{"/orgs/1/workloads/4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unlabeled workload registered with %v, want %v", got, want)
+	}
+}
+
+func TestDAGSyncDeviceGroups(t *testing.T) {
+	s, panURL := newTestPAN(t)
+	s.MaxEntries = 2
+
+	runDAGSync(t, map[string]string{"url": panURL, "device-group": "dg1,dg2", "batch-size": "2"})
+
+	for _, device := range []string{"007951000000001/vsys1", "007951000000002/vsys1", "007951000000004/vsys1", "007951000000004/vsys2"} {
+		if got := s.tags(device, "10.0.2.10"); len(got) != 5 {
+			t.Errorf("10.0.2.10 registered on %s with %v, want 5 tags", device, got)
+		}
+	}
+	if _, ok := s.registered["007951000000003/vsys1"]; ok {
+		t.Error("disconnected firewall fw3 was programmed")
+	}
+}
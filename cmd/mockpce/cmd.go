@@ -0,0 +1,74 @@
+package mockpce
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+)
+
+var port int
+var address, fixtureDir string
+
+func init() {
+	MockPCECmd.Flags().IntVar(&port, "port", 8443, "port for the mock pce to listen on.")
+	MockPCECmd.Flags().StringVar(&address, "address", "127.0.0.1", "address for the mock pce to listen on.")
+	MockPCECmd.Flags().StringVar(&fixtureDir, "fixtures", "", "optional directory of json fixtures. files named <collection>.json (e.g., workloads.json) replace the built-in fixture for that collection.")
+
+	MockPCECmd.Flags().SortFlags = false
+}
+
+// MockPCECmd runs the mock-pce command
+var MockPCECmd = &cobra.Command{
+	Use:   "mock-pce",
+	Short: "Run a local mock PCE for offline testing and demos.",
+	Long: `
+Run a local mock PCE for offline testing and demos.
+
+The mock pce is an in-memory HTTPS server with a self-signed certificate that implements the PCE endpoints workloader uses:
+- labels and label_dimensions
+- workloads including bulk_create, bulk_update, and bulk_delete
+- vens and events
+- ip_lists, services, label_groups, rule_sets, and virtual_services (draft and active share the same objects)
+- service_bindings
+- sec_rules within rulesets
+- sec_policy for provisioning
+- traffic_flows async_queries. queries complete immediately and return the traffic_flows fixture.
+
+Objects are loaded from built-in fixtures. Use the --fixtures flag to point to a directory with any of the following files to replace the built-in data: labels.json, label_dimensions.json, workloads.json, vens.json, ip_lists.json, services.json, label_groups.json, rule_sets.json, traffic_flows.json, events.json, virtual_services.json, service_bindings.json. Each file is a json array of objects in the same format as the PCE API. Changes are kept in memory and reset when the mock pce stops.
+
+Any api user and secret are accepted. Add the mock pce in a separate terminal with:
+workloader pce-add --name mock-pce --fqdn 127.0.0.1 --port 8443 --api-key --api-user mock --api-secret mock --org 1 --disable-tls-verification true
+
+The update-pce and --no-prompt flags are ignored for this command.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		s, err := NewServer(fixtureDir)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+
+		if err := ListenAndServe(s, fmt.Sprintf("%s:%d", address, port)); err != nil {
+			utils.LogError(err.Error())
+		}
+	},
+}
+
+// ListenAndServe serves the mock pce over https with a generated self-signed certificate
+func ListenAndServe(handler http.Handler, addr string) error {
+	cert, err := utils.SelfSignedCert()
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Addr:      addr,
+		Handler:   handler,
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+	}
+
+	utils.LogInfof(true, "mock pce listening on https://%s. press ctrl+c to stop.", addr)
+	return server.ListenAndServeTLS("", "")
+}
@@ -0,0 +1,530 @@
+package mockpce
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brian1917/workloader/utils"
+	"github.com/google/uuid"
+)
+
+//go:embed fixtures/*.json
+var fixtureFS embed.FS
+
+// collections are the object types served by the mock pce. The fixture file for each is <collection>.json.
+var collections = []string{"labels", "label_dimensions", "workloads", "vens", "ip_lists", "services", "label_groups", "rule_sets", "traffic_flows", "events", "virtual_services", "service_bindings"}
+
+// policyCollections are served under /sec_policy/draft and /sec_policy/active
+var policyCollections = map[string]bool{"ip_lists": true, "services": true, "label_groups": true, "rule_sets": true, "virtual_services": true}
+
+// query parameters that are not used to filter objects
+var ignoredParams = map[string]bool{"max_results": true, "representation": true, "usage": true, "include_deleted": true}
+
+type object map[string]interface{}
+
+// Server is an in-memory PCE that serves the endpoints used by workloader
+type Server struct {
+	mu             sync.Mutex
+	Version        string
+	objects        map[string][]object
+	asyncQueries   []object
+	policyVersions []object
+	nextID         int
+}
+
+// NewServer creates a mock pce loaded with the embedded fixtures.
+// Files in fixtureDir named <collection>.json override the embedded fixture for that collection.
+func NewServer(fixtureDir string) (*Server, error) {
+	s := &Server{Version: "23.2.0", objects: make(map[string][]object), nextID: 1000}
+
+	for _, c := range collections {
+		data, err := fixtureFS.ReadFile("fixtures/" + c + ".json")
+		if err != nil {
+			return nil, err
+		}
+		if fixtureDir != "" {
+			if custom, err := os.ReadFile(filepath.Join(fixtureDir, c+".json")); err == nil {
+				utils.LogInfof(false, "mock-pce - using %s for %s", filepath.Join(fixtureDir, c+".json"), c)
+				data = custom
+			}
+		}
+		objects := []object{}
+		if err := json.Unmarshal(data, &objects); err != nil {
+			return nil, fmt.Errorf("%s fixture - %s", c, err)
+		}
+		s.objects[c] = objects
+	}
+
+	return s, nil
+}
+
+// ServeHTTP routes requests to the mock pce endpoints
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	utils.LogDebug(fmt.Sprintf("mock-pce - %s %s", r.Method, r.URL.String()))
+
+	// All endpoints require basic auth like the real pce
+	if _, _, ok := r.BasicAuth(); !ok {
+		writeJSON(w, http.StatusUnauthorized, []object{{"token": "authentication_required", "message": "basic authentication is required"}})
+		return
+	}
+
+	// Some v1 api calls have a double slash (e.g., /orgs/1//sec_policy)
+	path := strings.ReplaceAll(strings.TrimPrefix(r.URL.Path, "/api/v2"), "//", "/")
+	if path == "/product_version" {
+		writeJSON(w, http.StatusOK, object{"version": s.Version, "build": 0, "long_display": s.Version + "-0", "short_display": s.Version})
+		return
+	}
+
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 3 || parts[0] != "orgs" {
+		writeJSON(w, http.StatusNotFound, []object{{"token": "not_found", "message": path + " is not implemented in mock-pce"}})
+		return
+	}
+	rest := parts[2:]
+
+	// Policy versions and provisioning
+	if rest[0] == "sec_policy" && len(rest) == 1 {
+		s.secPolicy(w, r, parts[1])
+		return
+	}
+
+	// Policy objects are stored with draft hrefs
+	if rest[0] == "sec_policy" && len(rest) > 2 {
+		if !policyCollections[rest[2]] {
+			writeJSON(w, http.StatusNotFound, []object{{"token": "not_found", "message": path + " is not implemented in mock-pce"}})
+			return
+		}
+		rest = rest[2:]
+		path = strings.Replace(path, "/sec_policy/active/", "/sec_policy/draft/", 1)
+	}
+
+	switch {
+	case rest[0] == "traffic_flows":
+		s.trafficFlows(w, r, rest, parts[1])
+	case rest[0] == "workloads" && len(rest) == 2 && strings.HasPrefix(rest[1], "bulk_"):
+		s.bulkWorkloads(w, r, rest[1], parts[1])
+	case rest[0] == "service_bindings" && len(rest) == 1 && r.Method == http.MethodPost:
+		s.serviceBindings(w, r, path)
+	case rest[0] == "rule_sets" && len(rest) >= 3 && rest[2] == "sec_rules":
+		s.rules(w, r, path, rest)
+	case len(rest) == 1:
+		s.collection(w, r, rest[0], path)
+	case len(rest) == 2:
+		s.item(w, r, rest[0], path)
+	default:
+		writeJSON(w, http.StatusNotFound, []object{{"token": "not_found", "message": path + " is not implemented in mock-pce"}})
+	}
+}
+
+// collection handles GET (list) and POST (create) on a collection
+func (s *Server) collection(w http.ResponseWriter, r *http.Request, name, path string) {
+	if _, ok := s.objects[name]; !ok {
+		writeJSON(w, http.StatusNotFound, []object{{"token": "not_found", "message": name + " is not implemented in mock-pce"}})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		results := []object{}
+		for _, o := range s.objects[name] {
+			if matchQuery(o, r.URL.Query()) {
+				results = append(results, o)
+			}
+		}
+		// The pce returns the newest events first
+		if name == "events" {
+			sort.SliceStable(results, func(i, j int) bool {
+				return fmt.Sprintf("%v", results[i]["timestamp"]) > fmt.Sprintf("%v", results[j]["timestamp"])
+			})
+		}
+		total := len(results)
+		if maxResults, err := strconv.Atoi(r.URL.Query().Get("max_results")); err == nil && maxResults >= 0 && maxResults < len(results) {
+			results = results[:maxResults]
+		}
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		writeJSON(w, http.StatusOK, results)
+	case http.MethodPost:
+		o, err := readObject(r)
+		if err != nil {
+			writeJSON(w, http.StatusNotAcceptable, []object{{"token": "invalid_json", "message": err.Error()}})
+			return
+		}
+		o["href"] = fmt.Sprintf("%s/%d", path, s.newID())
+		o["created_at"] = time.Now().UTC().Format(time.RFC3339)
+		s.objects[name] = append(s.objects[name], o)
+		writeJSON(w, http.StatusCreated, o)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// item handles GET, PUT, and DELETE on a single object
+func (s *Server) item(w http.ResponseWriter, r *http.Request, name, href string) {
+	index := -1
+	for i, o := range s.objects[name] {
+		if o["href"] == href {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		writeJSON(w, http.StatusNotFound, []object{{"token": "not_found", "message": href + " does not exist"}})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.objects[name][index])
+	case http.MethodPut:
+		update, err := readObject(r)
+		if err != nil {
+			writeJSON(w, http.StatusNotAcceptable, []object{{"token": "invalid_json", "message": err.Error()}})
+			return
+		}
+		for k, v := range update {
+			s.objects[name][index][k] = v
+		}
+		s.objects[name][index]["href"] = href
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		s.objects[name] = append(s.objects[name][:index], s.objects[name][index+1:]...)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// bulkWorkloads handles the bulk_create, bulk_update, and bulk_delete workload endpoints
+func (s *Server) bulkWorkloads(w http.ResponseWriter, r *http.Request, action, org string) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, []object{{"token": "invalid_body", "message": err.Error()}})
+		return
+	}
+	wklds := []object{}
+	if err := json.Unmarshal(body, &wklds); err != nil {
+		writeJSON(w, http.StatusNotAcceptable, []object{{"token": "invalid_json", "message": err.Error()}})
+		return
+	}
+
+	results := []object{}
+	for _, wkld := range wklds {
+		href, _ := wkld["href"].(string)
+		switch action {
+		case "bulk_create":
+			wkld["href"] = fmt.Sprintf("/orgs/%s/workloads/%s", org, uuid.New().String())
+			s.objects["workloads"] = append(s.objects["workloads"], wkld)
+			results = append(results, object{"href": wkld["href"], "status": "created"})
+		case "bulk_update", "bulk_delete":
+			found := false
+			for i, existing := range s.objects["workloads"] {
+				if existing["href"] != href {
+					continue
+				}
+				found = true
+				if action == "bulk_delete" {
+					s.objects["workloads"] = append(s.objects["workloads"][:i], s.objects["workloads"][i+1:]...)
+					results = append(results, object{"href": href, "status": "deleted"})
+				} else {
+					for k, v := range wkld {
+						existing[k] = v
+					}
+					results = append(results, object{"href": href, "status": "updated"})
+				}
+				break
+			}
+			if !found {
+				results = append(results, object{"href": href, "status": "validation_failure", "errors": []object{{"token": "not_found", "message": href + " does not exist"}}})
+			}
+		default:
+			writeJSON(w, http.StatusNotFound, []object{{"token": "not_found", "message": action + " is not implemented in mock-pce"}})
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, results)
+}
+
+// serviceBindings creates service bindings. The pce creates bindings from a list.
+func (s *Server) serviceBindings(w http.ResponseWriter, r *http.Request, path string) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, []object{{"token": "invalid_body", "message": err.Error()}})
+		return
+	}
+	bindings := []object{}
+	if err := json.Unmarshal(body, &bindings); err != nil {
+		writeJSON(w, http.StatusNotAcceptable, []object{{"token": "invalid_json", "message": err.Error()}})
+		return
+	}
+	results := []object{}
+	for _, b := range bindings {
+		b["href"] = fmt.Sprintf("%s/%s", path, uuid.New().String())
+		s.objects["service_bindings"] = append(s.objects["service_bindings"], b)
+		results = append(results, object{"href": b["href"]})
+	}
+	writeJSON(w, http.StatusCreated, results)
+}
+
+// rules handles sec_rules within a ruleset
+func (s *Server) rules(w http.ResponseWriter, r *http.Request, path string, rest []string) {
+	rulesetHref := strings.Split(path, "/sec_rules")[0]
+	var ruleset object
+	for _, rs := range s.objects["rule_sets"] {
+		if rs["href"] == rulesetHref {
+			ruleset = rs
+			break
+		}
+	}
+	if ruleset == nil {
+		writeJSON(w, http.StatusNotFound, []object{{"token": "not_found", "message": rulesetHref + " does not exist"}})
+		return
+	}
+	rules, _ := ruleset["rules"].([]interface{})
+
+	// Create a rule
+	if len(rest) == 3 {
+		if r.Method != http.MethodPost {
+			writeJSON(w, http.StatusOK, rules)
+			return
+		}
+		rule, err := readObject(r)
+		if err != nil {
+			writeJSON(w, http.StatusNotAcceptable, []object{{"token": "invalid_json", "message": err.Error()}})
+			return
+		}
+		rule["href"] = fmt.Sprintf("%s/%d", path, s.newID())
+		ruleset["rules"] = append(rules, map[string]interface{}(rule))
+		writeJSON(w, http.StatusCreated, rule)
+		return
+	}
+
+	// Act on an existing rule
+	for i, rule := range rules {
+		ruleMap, ok := rule.(map[string]interface{})
+		if !ok || ruleMap["href"] != path {
+			continue
+		}
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, ruleMap)
+		case http.MethodPut:
+			update, err := readObject(r)
+			if err != nil {
+				writeJSON(w, http.StatusNotAcceptable, []object{{"token": "invalid_json", "message": err.Error()}})
+				return
+			}
+			for k, v := range update {
+				ruleMap[k] = v
+			}
+			ruleMap["href"] = path
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodDelete:
+			ruleset["rules"] = append(rules[:i], rules[i+1:]...)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+		return
+	}
+	writeJSON(w, http.StatusNotFound, []object{{"token": "not_found", "message": path + " does not exist"}})
+}
+
+// secPolicy lists policy versions and provisions changes
+func (s *Server) secPolicy(w http.ResponseWriter, r *http.Request, org string) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("X-Total-Count", strconv.Itoa(len(s.policyVersions)))
+		writeJSON(w, http.StatusOK, s.policyVersions)
+	case http.MethodPost:
+		provision, err := readObject(r)
+		if err != nil {
+			writeJSON(w, http.StatusNotAcceptable, []object{{"token": "invalid_json", "message": err.Error()}})
+			return
+		}
+		version := len(s.policyVersions) + 1
+		pv := object{
+			"href":           fmt.Sprintf("/orgs/%s/sec_policy/%d", org, version),
+			"version":        version,
+			"commit_message": provision["update_description"],
+			"created_at":     time.Now().UTC().Format(time.RFC3339),
+			"object_counts":  object{},
+		}
+		s.policyVersions = append([]object{pv}, s.policyVersions...)
+		writeJSON(w, http.StatusCreated, pv)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// trafficFlows handles async traffic queries. Queries complete immediately and return the traffic_flows fixture.
+func (s *Server) trafficFlows(w http.ResponseWriter, r *http.Request, rest []string, org string) {
+	if len(rest) < 2 || rest[1] != "async_queries" {
+		writeJSON(w, http.StatusNotFound, []object{{"token": "not_found", "message": strings.Join(rest, "/") + " is not implemented in mock-pce"}})
+		return
+	}
+
+	// Create or list queries
+	if len(rest) == 2 {
+		if r.Method == http.MethodGet {
+			writeJSON(w, http.StatusOK, s.asyncQueries)
+			return
+		}
+		query, err := readObject(r)
+		if err != nil {
+			writeJSON(w, http.StatusNotAcceptable, []object{{"token": "invalid_json", "message": err.Error()}})
+			return
+		}
+		href := fmt.Sprintf("/orgs/%s/traffic_flows/async_queries/%s", org, uuid.New().String())
+		aq := object{
+			"href":             href,
+			"status":           "completed",
+			"result":           href + "/download",
+			"query_parameters": query,
+			"created_at":       time.Now().UTC().Format(time.RFC3339),
+			"updated_at":       time.Now().UTC().Format(time.RFC3339),
+		}
+		s.asyncQueries = append(s.asyncQueries, aq)
+		writeJSON(w, http.StatusAccepted, aq)
+		return
+	}
+
+	// Find the query
+	href := "/orgs/" + org + "/traffic_flows/async_queries/" + rest[2]
+	var aq object
+	for _, q := range s.asyncQueries {
+		if q["href"] == href {
+			aq = q
+		}
+	}
+	if aq == nil {
+		writeJSON(w, http.StatusNotFound, []object{{"token": "not_found", "message": href + " does not exist"}})
+		return
+	}
+	if len(rest) == 3 {
+		writeJSON(w, http.StatusOK, aq)
+		return
+	}
+
+	// Download the results applying max results and policy decisions from the query
+	query, _ := aq["query_parameters"].(object)
+	decisions := make(map[string]bool)
+	if pds, ok := query["policy_decisions"].([]interface{}); ok {
+		for _, pd := range pds {
+			decisions[fmt.Sprintf("%v", pd)] = true
+		}
+	}
+	flows := []object{}
+	for _, f := range s.objects["traffic_flows"] {
+		if len(decisions) > 0 && !decisions[fmt.Sprintf("%v", f["policy_decision"])] {
+			continue
+		}
+		flows = append(flows, f)
+	}
+	if maxResults, ok := query["max_results"].(float64); ok && int(maxResults) < len(flows) {
+		flows = flows[:int(maxResults)]
+	}
+	writeJSON(w, http.StatusOK, flows)
+}
+
+// matchQuery checks an object against the query parameters.
+// Top-level string fields and object hrefs must match exactly, labels uses the pce's [[href,...]] format, managed checks for a ven,
+// and timestamp[gte] and timestamp[lte] filter events.
+func matchQuery(o object, query map[string][]string) bool {
+	for param, values := range query {
+		if ignoredParams[param] || len(values) == 0 {
+			continue
+		}
+		value := values[0]
+		switch param {
+		case "labels":
+			labelSets := [][]string{}
+			if err := json.Unmarshal([]byte(value), &labelSets); err != nil {
+				continue
+			}
+			objectLabels := make(map[string]bool)
+			if labels, ok := o["labels"].([]interface{}); ok {
+				for _, l := range labels {
+					if lm, ok := l.(map[string]interface{}); ok {
+						objectLabels[fmt.Sprintf("%v", lm["href"])] = true
+					}
+				}
+			}
+			anySetMatch := false
+			for _, set := range labelSets {
+				setMatch := true
+				for _, href := range set {
+					if !objectLabels[href] {
+						setMatch = false
+						break
+					}
+				}
+				if setMatch {
+					anySetMatch = true
+					break
+				}
+			}
+			if !anySetMatch {
+				return false
+			}
+		case "timestamp[gte]", "timestamp[lte]":
+			ts, err := time.Parse(time.RFC3339, fmt.Sprintf("%v", o["timestamp"]))
+			limit, limitErr := time.Parse(time.RFC3339, value)
+			if err != nil || limitErr != nil {
+				continue
+			}
+			if (param == "timestamp[gte]" && ts.Before(limit)) || (param == "timestamp[lte]" && ts.After(limit)) {
+				return false
+			}
+		case "managed":
+			_, hasVen := o["ven"]
+			if strconv.FormatBool(hasVen) != strings.ToLower(value) {
+				return false
+			}
+		default:
+			if field, ok := o[param].(string); ok && field != value {
+				return false
+			}
+			if field, ok := o[param].(map[string]interface{}); ok && fmt.Sprintf("%v", field["href"]) != value {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (s *Server) newID() int {
+	s.nextID++
+	return s.nextID
+}
+
+func readObject(r *http.Request) (object, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	o := object{}
+	if err := json.Unmarshal(body, &o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,120 @@
+package mockpce
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	ia "github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/cmd/svcexport"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/viper"
+)
+
+func TestMain(m *testing.M) {
+	utils.Logger.SetOutput(io.Discard)
+	viper.Set("output_format", "csv")
+	os.Exit(m.Run())
+}
+
+// newTestPCE starts the mock pce with the built-in fixtures and returns a pce pointed at it
+func newTestPCE(t *testing.T) (*httptest.Server, ia.PCE) {
+	t.Helper()
+	s, err := NewServer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewTLSServer(s)
+	t.Cleanup(ts.Close)
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts, ia.PCE{FQDN: u.Hostname(), Port: port, Org: 1, User: "mock", Key: "mock", DisableTLSChecking: true}
+}
+
+func TestAuthenticationRequired(t *testing.T) {
+	ts, _ := newTestPCE(t)
+	resp, err := ts.Client().Get(ts.URL + "/api/v2/orgs/1/labels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status code is %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+}
+
+func TestGetLabelsAndWorkloads(t *testing.T) {
+	_, pce := newTestPCE(t)
+
+	if _, err := pce.GetLabels(nil); err != nil {
+		t.Fatal(err)
+	}
+	if l := pce.Labels["/orgs/1/labels/3"]; l.Key != "app" || l.Value != "erp" {
+		t.Errorf("label 3 is %s:%s, want app:erp", l.Key, l.Value)
+	}
+
+	if _, err := pce.GetWklds(map[string]string{"hostname": "erp-web-01"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(pce.WorkloadsSlice) != 1 || pce.WorkloadsSlice[0].Href != "/orgs/1/workloads/1" {
+		t.Errorf("hostname filter returned %d workloads, want /orgs/1/workloads/1", len(pce.WorkloadsSlice))
+	}
+}
+
+func TestBulkUpdateWorkloads(t *testing.T) {
+	_, pce := newTestPCE(t)
+
+	if _, err := pce.GetWklds(map[string]string{"hostname": "erp-web-01"}); err != nil {
+		t.Fatal(err)
+	}
+	wkld := pce.WorkloadsSlice[0]
+	wkld.EnforcementMode = ia.Ptr("selective")
+	if _, err := pce.BulkWorkload([]ia.Workload{wkld}, "update", true); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := pce.GetWklds(map[string]string{"hostname": "erp-web-01"}); err != nil {
+		t.Fatal(err)
+	}
+	if mode := ia.PtrToVal(pce.WorkloadsSlice[0].EnforcementMode); mode != "selective" {
+		t.Errorf("enforcement mode is %s after bulk update, want selective", mode)
+	}
+}
+
+// TestSvcExport runs svc-export against the mock pce and checks the csv
+func TestSvcExport(t *testing.T) {
+	_, pce := newTestPCE(t)
+
+	outputFile := filepath.Join(t.TempDir(), "services.csv")
+	svcexport.ExportServices(pce, true, outputFile, []string{})
+
+	data, err := utils.ParseCSV(outputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := make(map[string]int)
+	for i, h := range data[0] {
+		headers[h] = i
+	}
+	ports := make(map[string]string)
+	for _, row := range data[1:] {
+		ports[row[headers[svcexport.HeaderName]]] = row[headers[svcexport.HeaderPort]] + "/" + row[headers[svcexport.HeaderProto]]
+	}
+	for name, want := range map[string]string{"HTTPS": "443/tcp", "PostgreSQL": "5432/tcp", "SMB": "445/tcp"} {
+		if ports[name] != want {
+			t.Errorf("%s exported as %q, want %q", name, ports[name], want)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package netpolexport
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	ia "github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// Declare local global variables
+var clusterName, rulesetNames, policyVersion, podLabelPrefix string
+var egress, defaultDeny, cilium, includeWorkloads bool
+
+func init() {
+	NetPolExportCmd.Flags().StringVarP(&clusterName, "cluster", "c", "", "name of the container cluster. default is all container clusters.")
+	NetPolExportCmd.Flags().StringVarP(&rulesetNames, "rulesets", "r", "", "comma-separated list of ruleset names to export. default is all rulesets scoped to container workload profile labels.")
+	NetPolExportCmd.Flags().StringVar(&policyVersion, "policy-version", "active", "policy version to export. options are active or draft.")
+	NetPolExportCmd.Flags().StringVar(&podLabelPrefix, "pod-label-prefix", "com.illumio.", "prefix of the pod label keys for illumio label keys not assigned by the container workload profile.")
+	NetPolExportCmd.Flags().BoolVar(&egress, "egress", false, "also create egress policies for the consumer pods. required for rules with ip list and workload providers.")
+	NetPolExportCmd.Flags().BoolVar(&defaultDeny, "default-deny", false, "add a default deny policy to each container workload profile namespace.")
+	NetPolExportCmd.Flags().BoolVar(&cilium, "cilium", false, "also create CiliumNetworkPolicy yaml with icmp, deny rules, and fqdns.")
+	NetPolExportCmd.Flags().BoolVar(&includeWorkloads, "include-workloads", false, "add the ip addresses of non-container workloads with matching labels as ip blocks.")
+	NetPolExportCmd.Flags().SortFlags = false
+}
+
+// NetPolExportCmd exports rules as kubernetes network policies
+var NetPolExportCmd = &cobra.Command{
+	Use:   "netpol-export",
+	Short: "Export rulesets scoped to container workload profile labels as Kubernetes NetworkPolicy (and optionally Cilium) yaml.",
+	Long: `
+Export rulesets scoped to container workload profile labels as Kubernetes NetworkPolicy (and optionally Cilium) yaml.
+
+The command is for clusters without C-VEN enforcement. A ruleset is exported for a cluster when at least one of its scopes matches the labels assigned by a container workload profile in that cluster.
+
+Rules are mapped as follows:
+- Labels assigned by a container workload profile map to the profile's namespace with a namespaceSelector on kubernetes.io/metadata.name.
+- Labels not assigned by the profile map to a podSelector on the pod label <pod-label-prefix><key> (e.g., com.illumio.role: web). Pods must have these labels.
+- Label exclusions map to NotIn selectors.
+- IP lists map to ipBlocks. Exclusions inside an include range are excepts.
+- Workloads map to ipBlocks with their ip addresses. Use --include-workloads to add the ip addresses of non-container workloads with matching labels.
+- Services map to ports with port ranges as endPort. All Services has no ports.
+
+Each rule is an ingress policy selecting the provider pods. With --egress, each rule is also an egress policy selecting the consumer pods. Egress policies are needed for rules with ip list and workload providers. Egress policies also block traffic not in a rule (e.g., DNS) for the selected pods.
+
+With --cilium, a CiliumNetworkPolicy file is also created. Cilium policies include icmp, deny rules as ingressDeny and egressDeny, and ip list fqdns as toFQDNs (Cilium needs a DNS rule to resolve them). Cilium does not allow fqdns in deny rules, so they are reported and deny rules with only fqdn providers are skipped.
+
+Anything that cannot be represented is written to workloader-netpol-export-report-<timestamp>.csv. This includes label groups, virtual services, user groups, windows services, deny rules without --cilium, and options such as machine authentication.
+
+The output files are workloader-netpol-export-<cluster>-<timestamp>.yaml and workloader-netpol-export-cilium-<cluster>-<timestamp>.yaml. Review and apply with kubectl apply -f.
+
+The update-pce and --no-prompt flags are ignored for this command.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// Get the PCE
+		pce, err := utils.GetTargetPCEV2(true)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+
+		exportNetPols(pce)
+	},
+}
+
+func exportNetPols(pce ia.PCE) {
+
+	if policyVersion != "active" && policyVersion != "draft" {
+		utils.LogErrorf("%s is not a valid policy version. options are active or draft.", policyVersion)
+	}
+
+	// Get the container clusters and profiles
+	a, err := pce.GetContainerClusters(nil)
+	utils.LogAPIRespV2("GetContainerClusters", a)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	exporters := []*exporter{}
+	for _, cc := range pce.ContainerClustersSlice {
+		if clusterName != "" && cc.Name != clusterName {
+			continue
+		}
+		a, err := pce.GetContainerWkldProfiles(nil, cc.ID())
+		utils.LogAPIRespV2("GetContainerWkldProfiles", a)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		e := &exporter{cluster: cc.Name, names: make(map[string]int)}
+		for _, cp := range pce.ContainerWorkloadProfilesSlice {
+			if ia.PtrToVal(cp.Name) == "Default Profile" || cp.Namespace == "" {
+				continue
+			}
+			p := profile{namespace: cp.Namespace, labels: make(map[string]string)}
+			for _, l := range ia.PtrToVal(cp.Labels) {
+				if v := cp.GetLabelByKey(l.Key); v != "" {
+					p.labels[l.Key] = v
+				}
+			}
+			e.profiles = append(e.profiles, p)
+		}
+		utils.LogInfof(false, "%s container cluster has %d container workload profiles with namespaces", cc.Name, len(e.profiles))
+		exporters = append(exporters, e)
+	}
+	if len(exporters) == 0 {
+		if clusterName != "" {
+			utils.LogErrorf("%s does not exist as a container cluster", clusterName)
+		}
+		utils.LogInfo("no container clusters in the pce", true)
+		return
+	}
+
+	// Get the rulesets
+	a, err = pce.GetRulesets(nil, policyVersion)
+	utils.LogAPIRespV2("GetRulesets", a)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	ruleSets := []ia.RuleSet{}
+	targetRuleSets := make(map[string]bool)
+	for _, n := range strings.Split(rulesetNames, ",") {
+		if strings.TrimSpace(n) != "" {
+			targetRuleSets[strings.TrimSpace(n)] = true
+		}
+	}
+	needWklds := includeWorkloads
+	for _, rs := range pce.RuleSetsSlice {
+		if len(targetRuleSets) > 0 && !targetRuleSets[rs.Name] {
+			continue
+		}
+		ruleSets = append(ruleSets, rs)
+		for _, rule := range rs.AllRules {
+			for _, a := range append(ia.PtrToVal(rule.Consumers), ia.PtrToVal(rule.Providers)...) {
+				if a.Workload != nil {
+					needWklds = true
+				}
+			}
+		}
+	}
+
+	// Get the objects used in rules
+	apiResps, err := pce.Load(ia.LoadInput{Labels: true, IPLists: true, Services: true, LabelGroups: true, Workloads: needWklds, ProvisionStatus: policyVersion}, utils.UseMulti())
+	utils.LogMultiAPIRespV2(apiResps)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
+	// Export each cluster
+	ts := time.Now().Format("20060102_150405")
+	report := [][]string{{"container_cluster", "ruleset", "rule_href", "not_exported"}}
+	for _, e := range exporters {
+		e.pce = pce
+		for _, rs := range ruleSets {
+			e.exportRuleSet(rs)
+		}
+		report = append(report, e.report...)
+		if len(e.policies) == 0 && len(e.cilium) == 0 {
+			utils.LogInfof(true, "%s - no rules to export", e.cluster)
+			continue
+		}
+		if defaultDeny {
+			e.addDefaultDeny()
+		}
+
+		fileCluster := regexp.MustCompile(`[^A-Za-z0-9_.-]+`).ReplaceAllString(e.cluster, "-")
+		if len(e.policies) > 0 {
+			docs := []any{}
+			for _, p := range e.policies {
+				docs = append(docs, p)
+			}
+			writeYAML(fmt.Sprintf("workloader-netpol-export-%s-%s.yaml", fileCluster, ts), docs)
+		}
+		if cilium && len(e.cilium) > 0 {
+			docs := []any{}
+			for _, p := range e.cilium {
+				docs = append(docs, p)
+			}
+			writeYAML(fmt.Sprintf("workloader-netpol-export-cilium-%s-%s.yaml", fileCluster, ts), docs)
+		}
+		utils.LogInfof(true, "%s - %d network policies and %d cilium network policies", e.cluster, len(e.policies), len(e.cilium))
+	}
+
+	if len(report) > 1 {
+		utils.WriteOutput(report, nil, fmt.Sprintf("workloader-netpol-export-report-%s.csv", ts))
+		utils.LogInfof(true, "%d items could not be exported. see the report for details.", len(report)-1)
+	}
+}
+
+// writeYAML writes the objects as a multi-document yaml file
+func writeYAML(fileName string, docs []any) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	for _, d := range docs {
+		if err := enc.Encode(d); err != nil {
+			utils.LogError(err.Error())
+		}
+	}
+	if err := enc.Close(); err != nil {
+		utils.LogError(err.Error())
+	}
+	if err := os.WriteFile(fileName, buf.Bytes(), 0644); err != nil {
+		utils.LogError(err.Error())
+	}
+	utils.LogInfof(true, "created %s with %d objects", fileName, len(docs))
+}
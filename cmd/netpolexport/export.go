@@ -0,0 +1,359 @@
+package netpolexport
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	ia "github.com/brian1917/illumioapi/v2"
+)
+
+// exporter builds the policies for one container cluster
+type exporter struct {
+	pce      ia.PCE
+	cluster  string
+	profiles []profile
+	policies []networkPolicy
+	cilium   []ciliumNetworkPolicy
+	names    map[string]int
+	report   [][]string
+}
+
+// unsupportedf adds an entry to the report of what could not be represented
+func (e *exporter) unsupportedf(rs ia.RuleSet, ruleHref, format string, a ...any) {
+	e.report = append(e.report, []string{e.cluster, rs.Name, ruleHref, fmt.Sprintf(format, a...)})
+}
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// policyName returns a unique dns-1123 name in the namespace
+func (e *exporter) policyName(namespace, base string) string {
+	name := strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(base), "-"), "-")
+	if len(name) > 55 {
+		name = strings.Trim(name[:55], "-")
+	}
+	e.names[namespace+"/"+name]++
+	if count := e.names[namespace+"/"+name]; count > 1 {
+		name = fmt.Sprintf("%s-%d", name, count)
+	}
+	return name
+}
+
+func (e *exporter) metadata(namespace, name string, rs ia.RuleSet, rule ia.Rule) objectMeta {
+	return objectMeta{
+		Name:        name,
+		Namespace:   namespace,
+		Labels:      map[string]string{"app.kubernetes.io/managed-by": "workloader"},
+		Annotations: map[string]string{"illumio.com/ruleset": rs.Name, "illumio.com/rule": rule.Href},
+	}
+}
+
+// scopeConstraints converts the ruleset scopes. Scopes with label groups are reported and skipped.
+func (e *exporter) scopeConstraints(rs ia.RuleSet) []constraint {
+	scopes := ia.PtrToVal(rs.Scopes)
+	if len(scopes) == 0 {
+		scopes = [][]ia.Scopes{{}}
+	}
+	constraints := []constraint{}
+scopes:
+	for _, scope := range scopes {
+		c := newConstraint()
+		for _, s := range scope {
+			if s.LabelGroup != nil {
+				e.unsupportedf(rs, "", "scope with label group %s is skipped", e.pce.LabelGroups[s.LabelGroup.Href].Name)
+				continue scopes
+			}
+			if s.Label == nil {
+				continue
+			}
+			l := e.pce.Labels[s.Label.Href]
+			if ia.PtrToVal(s.Exclusion) {
+				c.notIn[l.Key] = append(c.notIn[l.Key], l.Value)
+			} else {
+				c.in[l.Key] = append(c.in[l.Key], l.Value)
+			}
+		}
+		constraints = append(constraints, c)
+	}
+	return constraints
+}
+
+// inCluster checks if a scope matches the labels a container workload profile assigns
+func (e *exporter) inCluster(c constraint) bool {
+	for _, p := range e.profiles {
+		if match, relevant := c.matches(p.labels); match && relevant {
+			return true
+		}
+	}
+	return false
+}
+
+// k8sPeers converts pods and ip blocks to network policy peers
+func k8sPeers(pods []podTarget, blocks []ipBlock) []networkPolicyPeer {
+	peers := []networkPolicyPeer{}
+	for _, p := range pods {
+		peer := networkPolicyPeer{NamespaceSelector: &labelSelector{}}
+		if p.namespace != "" {
+			peer.NamespaceSelector.MatchLabels = map[string]string{"kubernetes.io/metadata.name": p.namespace}
+		}
+		if len(p.pods.MatchLabels) > 0 || len(p.pods.MatchExpressions) > 0 {
+			pods := p.pods
+			peer.PodSelector = &pods
+		}
+		peers = append(peers, peer)
+	}
+	for _, b := range blocks {
+		block := b
+		peers = append(peers, networkPolicyPeer{IPBlock: &block})
+	}
+	return peers
+}
+
+// ciliumEndpoints converts pods to cilium endpoint selectors with the namespace
+func ciliumEndpoints(pods []podTarget) []labelSelector {
+	selectors := []labelSelector{}
+	for _, p := range pods {
+		s := labelSelector{MatchLabels: map[string]string{}, MatchExpressions: append([]labelSelectorRequirement{}, p.pods.MatchExpressions...)}
+		for k, v := range p.pods.MatchLabels {
+			s.MatchLabels[k] = v
+		}
+		if p.namespace != "" {
+			s.MatchLabels["k8s:io.kubernetes.pod.namespace"] = p.namespace
+		} else {
+			s.MatchExpressions = append(s.MatchExpressions, labelSelectorRequirement{Key: "k8s:io.kubernetes.pod.namespace", Operator: "Exists"})
+		}
+		selectors = append(selectors, s)
+	}
+	return selectors
+}
+
+// k8sPorts converts services to network policy ports
+func k8sPorts(svc serviceResult) []networkPolicyPort {
+	ports := []networkPolicyPort{}
+	for _, p := range svc.ports {
+		ports = append(ports, networkPolicyPort{Protocol: p.protocol, Port: p.port, EndPort: p.endPort})
+	}
+	return ports
+}
+
+// ciliumRules builds cilium rules for the peers. Ports and icmp types are separate rules with the same peers.
+func ciliumRules(peer ciliumRule, svc serviceResult) []ciliumRule {
+	if svc.all {
+		return []ciliumRule{peer}
+	}
+	rules := []ciliumRule{}
+	if len(svc.ports) > 0 {
+		r := peer
+		ports := []ciliumPort{}
+		for _, p := range svc.ports {
+			ports = append(ports, ciliumPort{Port: strconv.Itoa(p.port), EndPort: p.endPort, Protocol: p.protocol})
+		}
+		r.ToPorts = []ciliumPortRule{{Ports: ports}}
+		rules = append(rules, r)
+	}
+	if len(svc.icmps) > 0 {
+		r := peer
+		fields := []ciliumICMPField{}
+		for _, i := range svc.icmps {
+			fields = append(fields, ciliumICMPField{Type: i.icmpType, Family: i.family})
+		}
+		r.ICMPs = []ciliumICMPRule{{Fields: fields}}
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// exportRuleSet converts the rules of a ruleset for the scopes that match profiles in the cluster
+func (e *exporter) exportRuleSet(rs ia.RuleSet) {
+	if !ia.PtrToVal(rs.Enabled) {
+		return
+	}
+	scopes := []constraint{}
+	for _, c := range e.scopeConstraints(rs) {
+		if e.inCluster(c) {
+			scopes = append(scopes, c)
+		}
+	}
+	if len(scopes) == 0 {
+		return
+	}
+
+	for _, rule := range rs.AllRules {
+		if !ia.PtrToVal(rule.Enabled) {
+			continue
+		}
+		deny := rule.RuleType == "deny" || rule.RuleType == "override_deny"
+		if deny && !cilium {
+			e.unsupportedf(rs, rule.Href, "deny rules cannot be represented in a NetworkPolicy. use --cilium for ingressDeny and egressDeny.")
+			continue
+		}
+		if rule.RuleType == "override_deny" {
+			e.unsupportedf(rs, rule.Href, "override deny rule is exported as a cilium deny rule. cilium deny rules always take precedence.")
+		}
+		if len(ia.PtrToVal(rule.ConsumingSecurityPrincipals)) > 0 {
+			e.unsupportedf(rs, rule.Href, "user groups are not exported")
+		}
+		if ia.PtrToVal(rule.MachineAuth) || ia.PtrToVal(rule.SecConnect) || ia.PtrToVal(rule.Stateless) {
+			e.unsupportedf(rs, rule.Href, "machine authentication, secure connect, and stateless options are not exported")
+		}
+
+		svc := e.resolveServices(ia.PtrToVal(rule.IngressServices))
+		for _, u := range svc.unsupported {
+			e.unsupportedf(rs, rule.Href, "service %s is not exported", u)
+		}
+		if !svc.all && len(svc.ports) == 0 && len(svc.icmps) == 0 {
+			e.unsupportedf(rs, rule.Href, "rule has no services that can be exported")
+			continue
+		}
+		k8sOK := !deny && (svc.all || len(svc.ports) > 0)
+		if !deny && len(svc.icmps) > 0 {
+			if cilium {
+				e.unsupportedf(rs, rule.Href, "icmp is only exported in the cilium policy")
+			} else {
+				e.unsupportedf(rs, rule.Href, "icmp can only be exported with --cilium")
+			}
+		}
+
+		unscoped := ia.PtrToVal(rule.UnscopedConsumers)
+		for _, scope := range scopes {
+			providers := e.resolveActors(ia.PtrToVal(rule.Providers), scope, true, true)
+			consumers := e.resolveActors(ia.PtrToVal(rule.Consumers), scope, !unscoped, false)
+			for _, u := range append(providers.unsupported, consumers.unsupported...) {
+				e.unsupportedf(rs, rule.Href, "%s is not exported", u)
+			}
+			if len(consumers.fqdns) > 0 {
+				e.unsupportedf(rs, rule.Href, "fqdns in consumer ip lists are not exported")
+			}
+
+			// Ingress to provider pods
+			if len(providers.pods) > 0 {
+				if len(consumers.pods) == 0 && len(consumers.blocks) == 0 {
+					e.unsupportedf(rs, rule.Href, "no consumers can be exported")
+				} else {
+					e.addIngress(rs, rule, providers.pods, consumers, svc, deny, k8sOK)
+				}
+			}
+
+			// Egress from consumer pods
+			if len(providers.blocks) > 0 || len(providers.fqdns) > 0 {
+				if !egress {
+					e.unsupportedf(rs, rule.Href, "ip list and workload providers are outbound rules and are exported with --egress")
+				}
+			}
+			if egress {
+				consumerPods := e.resolveActors(ia.PtrToVal(rule.Consumers), scope, !unscoped, true).pods
+				if len(consumerPods) > 0 && (len(providers.pods) > 0 || len(providers.blocks) > 0 || len(providers.fqdns) > 0) {
+					if len(providers.fqdns) > 0 && !cilium {
+						e.unsupportedf(rs, rule.Href, "fqdns can only be exported with --cilium")
+					}
+					e.addEgress(rs, rule, consumerPods, providers, svc, deny, k8sOK)
+				}
+			}
+		}
+	}
+}
+
+// addIngress adds policies selecting the provider pods
+func (e *exporter) addIngress(rs ia.RuleSet, rule ia.Rule, targets []podTarget, consumers actorResult, svc serviceResult, deny, k8sOK bool) {
+	base := fmt.Sprintf("illumio-%s-%s-ingress", rs.Name, rule.Href[strings.LastIndex(rule.Href, "/")+1:])
+	for _, t := range targets {
+		if k8sOK {
+			np := networkPolicy{APIVersion: "networking.k8s.io/v1", Kind: "NetworkPolicy", Metadata: e.metadata(t.namespace, e.policyName(t.namespace, base), rs, rule)}
+			np.Spec.PodSelector = t.pods
+			np.Spec.PolicyTypes = []string{"Ingress"}
+			np.Spec.Ingress = []networkPolicyRule{{From: k8sPeers(consumers.pods, consumers.blocks)}}
+			if !svc.all {
+				np.Spec.Ingress[0].Ports = k8sPorts(svc)
+			}
+			e.policies = append(e.policies, np)
+		}
+		if cilium {
+			peer := ciliumRule{FromEndpoints: ciliumEndpoints(consumers.pods), FromCIDRSet: consumers.blocks}
+			cnp := ciliumNetworkPolicy{APIVersion: "cilium.io/v2", Kind: "CiliumNetworkPolicy", Metadata: e.metadata(t.namespace, e.policyName("cilium/"+t.namespace, base), rs, rule)}
+			cnp.Spec.EndpointSelector = t.pods
+			if deny {
+				cnp.Spec.IngressDeny = ciliumRules(peer, svc)
+			} else {
+				cnp.Spec.Ingress = ciliumRules(peer, svc)
+			}
+			e.cilium = append(e.cilium, cnp)
+		}
+	}
+}
+
+// addEgress adds policies selecting the consumer pods
+func (e *exporter) addEgress(rs ia.RuleSet, rule ia.Rule, targets []podTarget, providers actorResult, svc serviceResult, deny, k8sOK bool) {
+	base := fmt.Sprintf("illumio-%s-%s-egress", rs.Name, rule.Href[strings.LastIndex(rule.Href, "/")+1:])
+
+	// Cilium does not allow fqdns in deny rules. An empty peer selects nothing in an allow rule and everything in a deny rule
+	// so the cilium policy is skipped.
+	peer := ciliumRule{ToEndpoints: ciliumEndpoints(providers.pods), ToCIDRSet: providers.blocks}
+	ciliumOK := cilium
+	if cilium {
+		if deny && len(providers.fqdns) > 0 {
+			e.unsupportedf(rs, rule.Href, "fqdns cannot be used in cilium deny rules and are not exported")
+		}
+		if !deny {
+			for _, f := range providers.fqdns {
+				if strings.Contains(f, "*") {
+					peer.ToFQDNs = append(peer.ToFQDNs, fqdnSelector{MatchPattern: f})
+				} else {
+					peer.ToFQDNs = append(peer.ToFQDNs, fqdnSelector{MatchName: f})
+				}
+			}
+		}
+		if len(peer.ToEndpoints) == 0 && len(peer.ToCIDRSet) == 0 && len(peer.ToFQDNs) == 0 {
+			e.unsupportedf(rs, rule.Href, "no providers can be exported to the cilium policy")
+			ciliumOK = false
+		}
+	}
+
+	for _, t := range targets {
+		if k8sOK && (len(providers.pods) > 0 || len(providers.blocks) > 0) {
+			np := networkPolicy{APIVersion: "networking.k8s.io/v1", Kind: "NetworkPolicy", Metadata: e.metadata(t.namespace, e.policyName(t.namespace, base), rs, rule)}
+			np.Spec.PodSelector = t.pods
+			np.Spec.PolicyTypes = []string{"Egress"}
+			np.Spec.Egress = []networkPolicyRule{{To: k8sPeers(providers.pods, providers.blocks)}}
+			if !svc.all {
+				np.Spec.Egress[0].Ports = k8sPorts(svc)
+			}
+			e.policies = append(e.policies, np)
+		}
+		if ciliumOK {
+			cnp := ciliumNetworkPolicy{APIVersion: "cilium.io/v2", Kind: "CiliumNetworkPolicy", Metadata: e.metadata(t.namespace, e.policyName("cilium/"+t.namespace, base), rs, rule)}
+			cnp.Spec.EndpointSelector = t.pods
+			if deny {
+				cnp.Spec.EgressDeny = ciliumRules(peer, svc)
+			} else {
+				cnp.Spec.Egress = ciliumRules(peer, svc)
+			}
+			e.cilium = append(e.cilium, cnp)
+		}
+	}
+}
+
+// addDefaultDeny adds a policy to each profile namespace that selects all pods so only exported rules are allowed
+func (e *exporter) addDefaultDeny() {
+	policies, ciliumPolicies := []networkPolicy{}, []ciliumNetworkPolicy{}
+	seen := make(map[string]bool)
+	for _, p := range e.profiles {
+		if seen[p.namespace] {
+			continue
+		}
+		seen[p.namespace] = true
+		meta := objectMeta{Name: "illumio-default-deny", Namespace: p.namespace, Labels: map[string]string{"app.kubernetes.io/managed-by": "workloader"}}
+		np := networkPolicy{APIVersion: "networking.k8s.io/v1", Kind: "NetworkPolicy", Metadata: meta}
+		np.Spec.PolicyTypes = []string{"Ingress"}
+		cnp := ciliumNetworkPolicy{APIVersion: "cilium.io/v2", Kind: "CiliumNetworkPolicy", Metadata: meta}
+		cnp.Spec.Ingress = []ciliumRule{{}}
+		if egress {
+			np.Spec.PolicyTypes = append(np.Spec.PolicyTypes, "Egress")
+			cnp.Spec.Egress = []ciliumRule{{}}
+		}
+		policies = append(policies, np)
+		ciliumPolicies = append(ciliumPolicies, cnp)
+	}
+	e.policies = append(policies, e.policies...)
+	e.cilium = append(ciliumPolicies, e.cilium...)
+}
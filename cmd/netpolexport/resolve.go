@@ -0,0 +1,466 @@
+package netpolexport
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strings"
+
+	ia "github.com/brian1917/illumioapi/v2"
+)
+
+// profile is a container workload profile namespace and the labels it assigns
+type profile struct {
+	namespace string
+	labels    map[string]string
+}
+
+// constraint is a set of label requirements. Values for the same key are ORed and keys are ANDed.
+type constraint struct {
+	in    map[string][]string
+	notIn map[string][]string
+	none  bool
+}
+
+func newConstraint() constraint {
+	return constraint{in: make(map[string][]string), notIn: make(map[string][]string)}
+}
+
+// and combines two constraints. Keys in both are intersected.
+func (c constraint) and(o constraint) constraint {
+	n := newConstraint()
+	n.none = c.none || o.none
+	for k, v := range c.in {
+		n.in[k] = append([]string{}, v...)
+	}
+	for k, v := range o.in {
+		existing, ok := n.in[k]
+		if !ok {
+			n.in[k] = append([]string{}, v...)
+			continue
+		}
+		both := []string{}
+		for _, value := range v {
+			if contains(existing, value) {
+				both = append(both, value)
+			}
+		}
+		if len(both) == 0 {
+			n.none = true
+		}
+		n.in[k] = both
+	}
+	for _, m := range []map[string][]string{c.notIn, o.notIn} {
+		for k, v := range m {
+			n.notIn[k] = append(n.notIn[k], v...)
+		}
+	}
+	return n
+}
+
+// matches checks labels by key against the constraint. Keys that are not in the labels are ignored.
+// Relevant is true if at least one key of the constraint is in the labels.
+func (c constraint) matches(labels map[string]string) (match, relevant bool) {
+	match = true
+	for k, values := range c.in {
+		if v, ok := labels[k]; ok {
+			relevant = true
+			if !contains(values, v) {
+				match = false
+			}
+		}
+	}
+	for k, values := range c.notIn {
+		if v, ok := labels[k]; ok {
+			relevant = true
+			if contains(values, v) {
+				match = false
+			}
+		}
+	}
+	return match, relevant
+}
+
+func contains(s []string, v string) bool {
+	for _, x := range s {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// labelValueRegex is the kubernetes label value format
+var labelValueRegex = regexp.MustCompile(`^(([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9])?$`)
+
+// selector builds a pod selector for the keys of a constraint that are not assigned by the profile
+func selector(c constraint, assigned map[string]string) (labelSelector, error) {
+	s := labelSelector{}
+	keys := []string{}
+	for k := range c.in {
+		keys = append(keys, k)
+	}
+	for k := range c.notIn {
+		if _, ok := c.in[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if _, ok := assigned[k]; ok {
+			continue
+		}
+		for _, v := range append(append([]string{}, c.in[k]...), c.notIn[k]...) {
+			if len(v) > 63 || !labelValueRegex.MatchString(v) {
+				return s, fmt.Errorf("%s label %s is not a valid kubernetes label value", k, v)
+			}
+		}
+		key := podLabelPrefix + k
+		if values := c.in[k]; len(values) == 1 {
+			if s.MatchLabels == nil {
+				s.MatchLabels = make(map[string]string)
+			}
+			s.MatchLabels[key] = values[0]
+		} else if len(values) > 1 {
+			sorted := append([]string{}, values...)
+			sort.Strings(sorted)
+			s.MatchExpressions = append(s.MatchExpressions, labelSelectorRequirement{Key: key, Operator: "In", Values: sorted})
+		}
+		if values := c.notIn[k]; len(values) > 0 {
+			sorted := append([]string{}, values...)
+			sort.Strings(sorted)
+			s.MatchExpressions = append(s.MatchExpressions, labelSelectorRequirement{Key: key, Operator: "NotIn", Values: sorted})
+		}
+	}
+	return s, nil
+}
+
+// podTarget is a namespace and pod selector. An empty namespace is all namespaces.
+type podTarget struct {
+	namespace string
+	pods      labelSelector
+}
+
+// podTargets resolves a constraint to the namespaces whose profiles assign matching labels. If no profile assigns any of the keys,
+// the selector applies to all namespaces. When perNamespace is true, all namespaces is expanded to each profile namespace.
+func (e *exporter) podTargets(c constraint, perNamespace bool) ([]podTarget, error) {
+	if c.none {
+		return nil, nil
+	}
+	targets := []podTarget{}
+	anyRelevant := false
+	for _, p := range e.profiles {
+		match, relevant := c.matches(p.labels)
+		if !relevant {
+			continue
+		}
+		anyRelevant = true
+		if !match {
+			continue
+		}
+		s, err := selector(c, p.labels)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, podTarget{namespace: p.namespace, pods: s})
+	}
+	if anyRelevant {
+		return targets, nil
+	}
+
+	// No profile assigns the keys so pods must carry the labels
+	s, err := selector(c, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !perNamespace {
+		return []podTarget{{pods: s}}, nil
+	}
+	for _, p := range e.profiles {
+		targets = append(targets, podTarget{namespace: p.namespace, pods: s})
+	}
+	return targets, nil
+}
+
+// actorResult is a consumer or provider list resolved to kubernetes peers
+type actorResult struct {
+	pods        []podTarget
+	blocks      []ipBlock
+	fqdns       []string
+	unsupported []string
+}
+
+// resolveActors resolves rule consumers or providers. Labels are combined with the scope when useScope is true.
+func (e *exporter) resolveActors(actors []ia.ConsumerOrProvider, scope constraint, useScope, perNamespace bool) actorResult {
+	r := actorResult{}
+	labels := newConstraint()
+	hasLabels, allWorkloads := false, false
+	for _, a := range actors {
+		switch {
+		case ia.PtrToVal(a.Actors) == "ams":
+			allWorkloads = true
+		case a.Label != nil:
+			hasLabels = true
+			l := e.pce.Labels[a.Label.Href]
+			if ia.PtrToVal(a.Exclusion) {
+				labels.notIn[l.Key] = append(labels.notIn[l.Key], l.Value)
+			} else {
+				labels.in[l.Key] = append(labels.in[l.Key], l.Value)
+			}
+		case a.IPList != nil:
+			blocks, fqdns := ipListBlocks(e.pce.IPLists[a.IPList.Href])
+			r.blocks = append(r.blocks, blocks...)
+			r.fqdns = append(r.fqdns, fqdns...)
+		case a.Workload != nil:
+			w, ok := e.pce.Workloads[a.Workload.Href]
+			if !ok {
+				r.unsupported = append(r.unsupported, fmt.Sprintf("workload %s does not exist", a.Workload.Href))
+				continue
+			}
+			r.blocks = append(r.blocks, workloadBlocks(w)...)
+		case a.LabelGroup != nil:
+			r.unsupported = append(r.unsupported, fmt.Sprintf("label group %s", e.pce.LabelGroups[a.LabelGroup.Href].Name))
+		case a.VirtualService != nil:
+			r.unsupported = append(r.unsupported, "virtual services")
+		case a.VirtualServer != nil:
+			r.unsupported = append(r.unsupported, "virtual servers")
+		}
+	}
+
+	// Labels and all workloads resolve to pods
+	if hasLabels || allWorkloads {
+		c := labels
+		if allWorkloads {
+			c = newConstraint()
+		}
+		if useScope {
+			c = scope.and(c)
+		}
+		pods, err := e.podTargets(c, perNamespace)
+		if err != nil {
+			r.unsupported = append(r.unsupported, err.Error())
+		}
+		r.pods = pods
+
+		// Non-container workloads with the same labels
+		if includeWorkloads && !c.none {
+			for _, w := range e.pce.WorkloadsSlice {
+				wLabels := make(map[string]string)
+				for _, l := range ia.PtrToVal(w.Labels) {
+					wLabels[e.pce.Labels[l.Href].Key] = e.pce.Labels[l.Href].Value
+				}
+				if e.workloadMatches(c, wLabels) {
+					r.blocks = append(r.blocks, workloadBlocks(w)...)
+				}
+			}
+		}
+	}
+	return r
+}
+
+// workloadMatches checks that a workload has every label the constraint requires
+func (e *exporter) workloadMatches(c constraint, labels map[string]string) bool {
+	for k, values := range c.in {
+		if !contains(values, labels[k]) {
+			return false
+		}
+	}
+	for k, values := range c.notIn {
+		if contains(values, labels[k]) {
+			return false
+		}
+	}
+	return true
+}
+
+// workloadBlocks is the host cidrs of a workload's interfaces
+func workloadBlocks(w ia.Workload) []ipBlock {
+	blocks := []ipBlock{}
+	seen := make(map[string]bool)
+	for _, i := range ia.PtrToVal(w.Interfaces) {
+		addr, err := netip.ParseAddr(i.Address)
+		if err != nil || seen[addr.String()] {
+			continue
+		}
+		seen[addr.String()] = true
+		blocks = append(blocks, ipBlock{CIDR: netip.PrefixFrom(addr, addr.BitLen()).String()})
+	}
+	return blocks
+}
+
+// rangeToPrefixes converts an ip, cidr, or range to cidrs
+func rangeToPrefixes(from, to string) ([]netip.Prefix, error) {
+	if to == "" {
+		if strings.Contains(from, "/") {
+			p, err := netip.ParsePrefix(from)
+			if err != nil {
+				return nil, err
+			}
+			return []netip.Prefix{p.Masked()}, nil
+		}
+		addr, err := netip.ParseAddr(from)
+		if err != nil {
+			return nil, err
+		}
+		return []netip.Prefix{netip.PrefixFrom(addr, addr.BitLen())}, nil
+	}
+	start, err := netip.ParseAddr(from)
+	if err != nil {
+		return nil, err
+	}
+	end, err := netip.ParseAddr(to)
+	if err != nil {
+		return nil, err
+	}
+	if start.Is4() != end.Is4() || end.Less(start) {
+		return nil, fmt.Errorf("%s-%s is not a valid range", from, to)
+	}
+
+	// Take the largest prefix starting at start that does not go past end
+	prefixes := []netip.Prefix{}
+	for {
+		bits := start.BitLen()
+		for bits > 0 {
+			p := netip.PrefixFrom(start, bits-1).Masked()
+			if p.Addr() != start || lastAddr(p).Compare(end) > 0 {
+				break
+			}
+			bits--
+		}
+		p := netip.PrefixFrom(start, bits)
+		prefixes = append(prefixes, p)
+		last := lastAddr(p)
+		if last.Compare(end) >= 0 || !last.Next().IsValid() {
+			return prefixes, nil
+		}
+		start = last.Next()
+	}
+}
+
+// lastAddr is the last address in a prefix
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Masked().Addr().AsSlice()
+	for i := p.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 1 << (7 - uint(i%8))
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+// ipListBlocks converts an ip list to ip blocks with exclusions as excepts. FQDNs are returned separately.
+func ipListBlocks(ipl ia.IPList) ([]ipBlock, []string) {
+	includes, excludes := []netip.Prefix{}, []netip.Prefix{}
+	for _, r := range ia.PtrToVal(ipl.IPRanges) {
+		prefixes, err := rangeToPrefixes(r.FromIP, r.ToIP)
+		if err != nil {
+			continue
+		}
+		if r.Exclusion {
+			excludes = append(excludes, prefixes...)
+		} else {
+			includes = append(includes, prefixes...)
+		}
+	}
+	blocks := []ipBlock{}
+	for _, i := range includes {
+		block := ipBlock{CIDR: i.String()}
+		excluded := false
+		for _, x := range excludes {
+			switch {
+			case x.Bits() <= i.Bits() && x.Contains(i.Addr()):
+				excluded = true
+			case x.Bits() > i.Bits() && i.Contains(x.Addr()):
+				block.Except = append(block.Except, x.String())
+			}
+		}
+		if !excluded {
+			blocks = append(blocks, block)
+		}
+	}
+	fqdns := []string{}
+	for _, f := range ia.PtrToVal(ipl.FQDNs) {
+		fqdns = append(fqdns, f.FQDN)
+	}
+	return blocks, fqdns
+}
+
+// portSpec is a protocol and port range. A port of 0 is all ports.
+type portSpec struct {
+	protocol string
+	port     int
+	endPort  int
+}
+
+// icmpSpec is an icmp type for cilium
+type icmpSpec struct {
+	icmpType int
+	family   string
+}
+
+// serviceResult is rule services resolved to ports
+type serviceResult struct {
+	all         bool
+	ports       []portSpec
+	icmps       []icmpSpec
+	unsupported []string
+}
+
+var protocolNames = map[int]string{6: "TCP", 17: "UDP", 132: "SCTP"}
+
+// addPort adds a protocol and port range from a service or inline port. An icmp type of -1 is all types.
+func (s *serviceResult) addPort(protocol, port, toPort, icmpType int) {
+	switch protocol {
+	case -1:
+		s.all = true
+	case 1, 58:
+		if icmpType < 0 {
+			s.unsupported = append(s.unsupported, "all icmp types")
+			return
+		}
+		family := "IPv4"
+		if protocol == 58 {
+			family = "IPv6"
+		}
+		s.icmps = append(s.icmps, icmpSpec{icmpType: icmpType, family: family})
+	default:
+		p, ok := protocolNames[protocol]
+		if !ok {
+			s.unsupported = append(s.unsupported, fmt.Sprintf("protocol %d", protocol))
+			return
+		}
+		spec := portSpec{protocol: p, port: port}
+		if toPort > port {
+			spec.endPort = toPort
+		}
+		s.ports = append(s.ports, spec)
+	}
+}
+
+// resolveServices converts the ingress services of a rule
+func (e *exporter) resolveServices(services []ia.IngressServices) serviceResult {
+	s := serviceResult{}
+	for _, is := range services {
+		if is.Href == "" {
+			s.addPort(ia.PtrToVal(is.Protocol), ia.PtrToVal(is.Port), ia.PtrToVal(is.ToPort), -1)
+			continue
+		}
+		svc := e.pce.Services[is.Href]
+		if svc.Name == "All Services" {
+			s.all = true
+			continue
+		}
+		if len(ia.PtrToVal(svc.WindowsServices)) > 0 {
+			s.unsupported = append(s.unsupported, fmt.Sprintf("windows service %s", svc.Name))
+		}
+		for _, sp := range ia.PtrToVal(svc.ServicePorts) {
+			// The pce returns no icmp type or code for all icmp
+			icmpType := sp.IcmpType
+			if icmpType == 0 && sp.IcmpCode == 0 {
+				icmpType = -1
+			}
+			s.addPort(sp.Protocol, ia.PtrToVal(sp.Port), sp.ToPort, icmpType)
+		}
+	}
+	return s
+}
@@ -0,0 +1,109 @@
+package netpolexport
+
+// Kubernetes NetworkPolicy types. Only the fields workloader writes are included.
+
+type objectMeta struct {
+	Name        string            `yaml:"name"`
+	Namespace   string            `yaml:"namespace"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+type labelSelector struct {
+	MatchLabels      map[string]string          `yaml:"matchLabels,omitempty"`
+	MatchExpressions []labelSelectorRequirement `yaml:"matchExpressions,omitempty"`
+}
+
+type labelSelectorRequirement struct {
+	Key      string   `yaml:"key"`
+	Operator string   `yaml:"operator"`
+	Values   []string `yaml:"values,omitempty"`
+}
+
+type networkPolicy struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   objectMeta        `yaml:"metadata"`
+	Spec       networkPolicySpec `yaml:"spec"`
+}
+
+type networkPolicySpec struct {
+	PodSelector labelSelector       `yaml:"podSelector"`
+	PolicyTypes []string            `yaml:"policyTypes"`
+	Ingress     []networkPolicyRule `yaml:"ingress,omitempty"`
+	Egress      []networkPolicyRule `yaml:"egress,omitempty"`
+}
+
+type networkPolicyRule struct {
+	From  []networkPolicyPeer `yaml:"from,omitempty"`
+	To    []networkPolicyPeer `yaml:"to,omitempty"`
+	Ports []networkPolicyPort `yaml:"ports,omitempty"`
+}
+
+type networkPolicyPeer struct {
+	NamespaceSelector *labelSelector `yaml:"namespaceSelector,omitempty"`
+	PodSelector       *labelSelector `yaml:"podSelector,omitempty"`
+	IPBlock           *ipBlock       `yaml:"ipBlock,omitempty"`
+}
+
+type ipBlock struct {
+	CIDR   string   `yaml:"cidr"`
+	Except []string `yaml:"except,omitempty"`
+}
+
+type networkPolicyPort struct {
+	Protocol string `yaml:"protocol"`
+	Port     int    `yaml:"port,omitempty"`
+	EndPort  int    `yaml:"endPort,omitempty"`
+}
+
+// Cilium CiliumNetworkPolicy types
+
+type ciliumNetworkPolicy struct {
+	APIVersion string     `yaml:"apiVersion"`
+	Kind       string     `yaml:"kind"`
+	Metadata   objectMeta `yaml:"metadata"`
+	Spec       ciliumSpec `yaml:"spec"`
+}
+
+type ciliumSpec struct {
+	EndpointSelector labelSelector `yaml:"endpointSelector"`
+	Ingress          []ciliumRule  `yaml:"ingress,omitempty"`
+	IngressDeny      []ciliumRule  `yaml:"ingressDeny,omitempty"`
+	Egress           []ciliumRule  `yaml:"egress,omitempty"`
+	EgressDeny       []ciliumRule  `yaml:"egressDeny,omitempty"`
+}
+
+type ciliumRule struct {
+	FromEndpoints []labelSelector  `yaml:"fromEndpoints,omitempty"`
+	FromCIDRSet   []ipBlock        `yaml:"fromCIDRSet,omitempty"`
+	ToEndpoints   []labelSelector  `yaml:"toEndpoints,omitempty"`
+	ToCIDRSet     []ipBlock        `yaml:"toCIDRSet,omitempty"`
+	ToFQDNs       []fqdnSelector   `yaml:"toFQDNs,omitempty"`
+	ToPorts       []ciliumPortRule `yaml:"toPorts,omitempty"`
+	ICMPs         []ciliumICMPRule `yaml:"icmps,omitempty"`
+}
+
+type fqdnSelector struct {
+	MatchName    string `yaml:"matchName,omitempty"`
+	MatchPattern string `yaml:"matchPattern,omitempty"`
+}
+
+type ciliumPortRule struct {
+	Ports []ciliumPort `yaml:"ports"`
+}
+
+type ciliumPort struct {
+	Port     string `yaml:"port"`
+	EndPort  int    `yaml:"endPort,omitempty"`
+	Protocol string `yaml:"protocol"`
+}
+
+type ciliumICMPRule struct {
+	Fields []ciliumICMPField `yaml:"fields"`
+}
+
+type ciliumICMPField struct {
+	Type   int    `yaml:"type"`
+	Family string `yaml:"family"`
+}
@@ -44,6 +44,11 @@ Recommended to run without --update-pce first to log of what will change.`,
 			utils.LogError(err.Error())
 		}
 
+		// Route the netscaler through the recorder. The library manages its own connections.
+		if netscaler.Server, err = utils.RecordHost(netscaler.Server, true); err != nil {
+			utils.LogError(err.Error())
+		}
+
 		// Login in to the netscaler
 		_, err := netscaler.Login()
 		if err != nil {
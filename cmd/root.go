@@ -23,30 +23,45 @@ import (
 	"github.com/brian1917/workloader/cmd/cspiplist"
 	"github.com/brian1917/workloader/cmd/cwpexport"
 	"github.com/brian1917/workloader/cmd/cwpimport"
+	"github.com/brian1917/workloader/cmd/daemon"
 	"github.com/brian1917/workloader/cmd/dagsync"
 	"github.com/brian1917/workloader/cmd/deletehrefs"
 	"github.com/brian1917/workloader/cmd/deleteunusedlabels"
 	"github.com/brian1917/workloader/cmd/denyruleexport"
 	"github.com/brian1917/workloader/cmd/denyruleimport"
+	"github.com/brian1917/workloader/cmd/drift"
 	"github.com/brian1917/workloader/cmd/dupecheck"
+	"github.com/brian1917/workloader/cmd/edlserve"
+	"github.com/brian1917/workloader/cmd/enforcementreadiness"
+	"github.com/brian1917/workloader/cmd/eventexport"
+	"github.com/brian1917/workloader/cmd/exporter"
 	"github.com/brian1917/workloader/cmd/extract"
+	"github.com/brian1917/workloader/cmd/f5sync"
 	"github.com/brian1917/workloader/cmd/findfqdn"
 	"github.com/brian1917/workloader/cmd/flowimport"
+	"github.com/brian1917/workloader/cmd/fwconvert"
 	"github.com/brian1917/workloader/cmd/gcplabel"
 	"github.com/brian1917/workloader/cmd/getpairingkey"
 	"github.com/brian1917/workloader/cmd/hostparse"
 	"github.com/brian1917/workloader/cmd/increasevenupdaterate"
+	"github.com/brian1917/workloader/cmd/inventoryexport"
 	"github.com/brian1917/workloader/cmd/iplexport"
 	"github.com/brian1917/workloader/cmd/iplimport"
+	"github.com/brian1917/workloader/cmd/iploptimize"
 	"github.com/brian1917/workloader/cmd/iplreplace"
 	"github.com/brian1917/workloader/cmd/labeldimension"
 	"github.com/brian1917/workloader/cmd/labelexport"
 	"github.com/brian1917/workloader/cmd/labelgroupexport"
 	"github.com/brian1917/workloader/cmd/labelgroupimport"
 	"github.com/brian1917/workloader/cmd/labelimport"
+	"github.com/brian1917/workloader/cmd/labelsuggest"
 	explorer "github.com/brian1917/workloader/cmd/legacy-explorer"
 	"github.com/brian1917/workloader/cmd/mislabel"
+	"github.com/brian1917/workloader/cmd/mockf5"
+	"github.com/brian1917/workloader/cmd/mockpan"
+	"github.com/brian1917/workloader/cmd/mockpce"
 	"github.com/brian1917/workloader/cmd/nen"
+	"github.com/brian1917/workloader/cmd/netpolexport"
 	"github.com/brian1917/workloader/cmd/netscalersync"
 	"github.com/brian1917/workloader/cmd/nicexport"
 	"github.com/brian1917/workloader/cmd/nicmanage"
@@ -58,19 +73,24 @@ import (
 	"github.com/brian1917/workloader/cmd/processexport"
 	"github.com/brian1917/workloader/cmd/ruleexport"
 	"github.com/brian1917/workloader/cmd/ruleimport"
+	"github.com/brian1917/workloader/cmd/rulerecommend"
 	"github.com/brian1917/workloader/cmd/rulesetexport"
 	"github.com/brian1917/workloader/cmd/rulesetimport"
 	"github.com/brian1917/workloader/cmd/secprincipalexport"
 	"github.com/brian1917/workloader/cmd/secprincipalimport"
 	"github.com/brian1917/workloader/cmd/servicefinder"
 	"github.com/brian1917/workloader/cmd/subnet"
+	"github.com/brian1917/workloader/cmd/supportbundle"
 	"github.com/brian1917/workloader/cmd/svcexport"
 	"github.com/brian1917/workloader/cmd/svcimport"
 	"github.com/brian1917/workloader/cmd/templateimport"
 	"github.com/brian1917/workloader/cmd/templatelist"
+	"github.com/brian1917/workloader/cmd/tfexport"
 	"github.com/brian1917/workloader/cmd/traffic"
+	"github.com/brian1917/workloader/cmd/trafficdiff"
 	"github.com/brian1917/workloader/cmd/umwlcleanup"
 	"github.com/brian1917/workloader/cmd/unpair"
+	"github.com/brian1917/workloader/cmd/unusedobjects"
 	"github.com/brian1917/workloader/cmd/unusedumwl"
 	"github.com/brian1917/workloader/cmd/upgrade"
 	"github.com/brian1917/workloader/cmd/venexport"
@@ -111,6 +131,11 @@ Workloader is a tool that helps manage resources in an Illumio PCE.`,
 		// Set up Logging
 		utils.SetUpLogging()
 
+		// Set up recording or replaying of http exchanges
+		if err := utils.SetUpRecording(recordDir, replayDir); err != nil {
+			utils.LogError(err.Error())
+		}
+
 		//Output format
 		outFormat = strings.ToLower(outFormat)
 		if outFormat != "both" && outFormat != "stdout" && outFormat != "csv" {
@@ -139,7 +164,7 @@ Workloader is a tool that helps manage resources in an Illumio PCE.`,
 }
 
 var updatePCE, continueOnError, noPrompt, debug, verbose bool
-var outFormat, targetPCE, configFile, logFile string
+var outFormat, targetPCE, configFile, logFile, recordDir, replayDir string
 
 // All subcommand flags are taken care of in their package's init.
 // Root init sets up everything else - all usage templates, Viper, etc.
@@ -157,6 +182,8 @@ func init() {
 	RootCmd.AddCommand(pcemgmt.SetProxyCmd)
 	RootCmd.AddCommand(pcemgmt.ClearProxyCmd)
 	RootCmd.AddCommand(SettingsCmd)
+	RootCmd.AddCommand(mockpce.MockPCECmd)
+	RootCmd.AddCommand(supportbundle.SupportBundleCmd)
 
 	// Import/Export
 	RootCmd.AddCommand(wkldexport.WkldExportCmd)
@@ -178,9 +205,14 @@ func init() {
 	RootCmd.AddCommand(rulesetimport.RuleSetImportCmd)
 	RootCmd.AddCommand(ruleexport.RuleExportCmd)
 	RootCmd.AddCommand(ruleimport.RuleImportCmd)
+	RootCmd.AddCommand(rulerecommend.RuleRecommendCmd)
 	RootCmd.AddCommand(denyruleexport.DenyRuleExportCmd)
 	RootCmd.AddCommand(denyruleimport.DenyRuleImportCmd)
 	RootCmd.AddCommand(cwpexport.ContainerProfileExportCmd)
+	RootCmd.AddCommand(netpolexport.NetPolExportCmd)
+	RootCmd.AddCommand(tfexport.TFExportCmd)
+	RootCmd.AddCommand(inventoryexport.InventoryExportCmd)
+	RootCmd.AddCommand(eventexport.EventExportCmd)
 	RootCmd.AddCommand(cwpimport.ContainerProfileImportCmd)
 	RootCmd.AddCommand(adgroupexport.ADGroupExportCmd)
 	RootCmd.AddCommand(adgroupimport.AdGroupImportCmd)
@@ -191,6 +223,7 @@ func init() {
 	RootCmd.AddCommand(pairingprofileexport.PairingProfileExportCmd)
 	RootCmd.AddCommand(virtualserviceexport.VsExportCmd)
 	RootCmd.AddCommand(flowimport.FlowImportCmd)
+	RootCmd.AddCommand(fwconvert.FWConvertCmd)
 	RootCmd.AddCommand(templateimport.TemplateImportCmd)
 	RootCmd.AddCommand(templatelist.TemplateListCmd)
 	// RootCmd.AddCommand(templatecreate.TemplateCreateCmd)
@@ -208,12 +241,16 @@ func init() {
 	RootCmd.AddCommand(subnet.SubnetCmd)
 	RootCmd.AddCommand(hostparse.HostnameCmd)
 	RootCmd.AddCommand(dagsync.DAGSyncCmd)
+	RootCmd.AddCommand(mockpan.MockPANCmd)
+	RootCmd.AddCommand(edlserve.EDLServeCmd)
 	RootCmd.AddCommand(vmsync.VCenterSyncCmd)
 	RootCmd.AddCommand(nen.NENSWITCHCmd)
 	RootCmd.AddCommand(nen.NENACLCmd)
 	RootCmd.AddCommand(ccupdate.ContainerClusterUpdateCmd)
 	RootCmd.AddCommand(cspiplist.CspIplistCmd)
+	RootCmd.AddCommand(iploptimize.IplOptimizeCmd)
 	RootCmd.AddCommand(autodenyrules.AutoDenyRulesCmd)
+	RootCmd.AddCommand(daemon.DaemonCmd)
 
 	// Workload management
 	RootCmd.AddCommand(wkldcleanup.WkldCleanUpCmd)
@@ -235,11 +272,15 @@ func init() {
 	// Reporting
 	RootCmd.AddCommand(findfqdn.FindFQDNCmd)
 	RootCmd.AddCommand(ruleexport.RuleUsageCmd)
+	RootCmd.AddCommand(unusedobjects.UnusedObjectsCmd)
 	RootCmd.AddCommand(portusage.PortUsageCmd)
 	RootCmd.AddCommand(mislabel.MisLabelCmd)
+	RootCmd.AddCommand(labelsuggest.LabelSuggestCmd)
 	RootCmd.AddCommand(dupecheck.DupeCheckCmd)
 	RootCmd.AddCommand(appgroupflowsummary.AppGroupFlowSummaryCmd)
 	RootCmd.AddCommand(traffic.TrafficCmd)
+	RootCmd.AddCommand(trafficdiff.TrafficDiffCmd)
+	RootCmd.AddCommand(enforcementreadiness.EnforcementReadinessCmd)
 	RootCmd.AddCommand(explorer.ExplorerCmd)
 	RootCmd.AddCommand(nicexport.NICExportCmd)
 	RootCmd.AddCommand(servicefinder.ServiceFinderCmd)
@@ -247,6 +288,8 @@ func init() {
 	RootCmd.AddCommand(wkldiplmapping.WkldIPLMappingCmd)
 	RootCmd.AddCommand(venhealth.VenHealthCmd)
 	RootCmd.AddCommand(unusedumwl.UnusedUmwlCmd)
+	RootCmd.AddCommand(drift.DriftCmd)
+	RootCmd.AddCommand(exporter.ExporterCmd)
 
 	// Version Commands
 	RootCmd.AddCommand(versionCmd)
@@ -255,6 +298,10 @@ func init() {
 	// NetScaler Sync
 	RootCmd.AddCommand(netscalersync.NetScalerSyncCmd)
 
+	// F5 Sync
+	RootCmd.AddCommand(f5sync.F5SyncCmd)
+	RootCmd.AddCommand(mockf5.MockF5Cmd)
+
 	// Undocumented
 	RootCmd.AddCommand(extract.ExtractCmd)
 
@@ -277,6 +324,10 @@ func init() {
 	RootCmd.PersistentFlags().BoolVar(&verbose, "verbose", false, "When debug is enabled, include the raw API responses. This makes workloader.log increase in size significantly.")
 	RootCmd.PersistentFlags().StringVar(&outFormat, "out", "csv", "Output format. 3 options: csv, stdout, both")
 	RootCmd.PersistentFlags().StringVar(&targetPCE, "pce", "", "PCE to use in command if not using default PCE.")
+	RootCmd.PersistentFlags().StringVar(&recordDir, "record", "", "Record every PCE and third-party HTTP exchange with secrets redacted to a directory. Use --record=<dir> to set the directory (default workloader-recording). Use workloader support-bundle to package recordings.")
+	RootCmd.PersistentFlags().Lookup("record").NoOptDefVal = "workloader-recording"
+	RootCmd.PersistentFlags().StringVar(&replayDir, "replay", "", "Serve HTTP responses from a directory created with --record (default workloader-recording) to re-run a command offline. Use --replay=<dir> to set the directory.")
+	RootCmd.PersistentFlags().Lookup("replay").NoOptDefVal = "workloader-recording"
 
 	RootCmd.Flags().SortFlags = false
 
@@ -83,14 +83,14 @@ The update-pce and --no-prompt flags are ignored for this command.`,
 func (r *RuleExport) ExportToCsv() {
 
 	// Initialize Slice
-	input.RulesetHrefs = &[]string{}
+	r.RulesetHrefs = &[]string{}
 
 	// Removing Version check for subnets since customers are off version 22
 	pceVersionIncludesUseSubnets := true
 
 	// GetAllRulesets first to see what objects we need.
 	utils.LogInfo("getting all rulesets...", true)
-	a, err := input.PCE.GetRulesets(nil, input.PolicyVersion)
+	a, err := r.PCE.GetRulesets(nil, r.PolicyVersion)
 	utils.LogAPIRespV2("GetAllRuleSets", a)
 	if err != nil {
 		utils.LogError(err.Error())
@@ -104,21 +104,21 @@ func (r *RuleExport) ExportToCsv() {
 		}
 		for _, row := range data {
 			if strings.Contains(row[0], "/orgs/") {
-				*input.RulesetHrefs = append(*input.RulesetHrefs, row[0])
+				*r.RulesetHrefs = append(*r.RulesetHrefs, row[0])
 			}
 		}
 	}
 
 	allRuleSets := []ia.RuleSet{}
-	if len(*input.RulesetHrefs) == 0 {
-		allRuleSets = input.PCE.RuleSetsSlice
+	if len(*r.RulesetHrefs) == 0 {
+		allRuleSets = r.PCE.RuleSetsSlice
 	} else {
 		// Create a map
 		targetRuleSets := make(map[string]bool)
-		for _, h := range *input.RulesetHrefs {
+		for _, h := range *r.RulesetHrefs {
 			targetRuleSets[h] = true
 		}
-		for _, rs := range input.PCE.RuleSetsSlice {
+		for _, rs := range r.PCE.RuleSetsSlice {
 			if targetRuleSets[rs.Href] {
 				allRuleSets = append(allRuleSets, rs)
 			}
@@ -134,8 +134,8 @@ func (r *RuleExport) ExportToCsv() {
 	}
 
 	// If rules is more than 500 with traffic
-	if input.TrafficCount && totalNumRules > input.TrafficRuleLimit {
-		utils.LogError(fmt.Sprintf("traffic-rule-limit set to %d and total rules is %d. either use --rulset-hrefs flag to limit rules in analysis or increase limit with --traffic-rule-limit flag (potential performance impacts).", input.TrafficRuleLimit, totalNumRules))
+	if r.TrafficCount && totalNumRules > r.TrafficRuleLimit {
+		utils.LogError(fmt.Sprintf("traffic-rule-limit set to %d and total rules is %d. either use --rulset-hrefs flag to limit rules in analysis or increase limit with --traffic-rule-limit flag (potential performance impacts).", r.TrafficRuleLimit, totalNumRules))
 	}
 
 	// Run through rulesets to see what we need
@@ -197,7 +197,7 @@ func (r *RuleExport) ExportToCsv() {
 		neededObjectsSlice = append(neededObjectsSlice, n)
 	}
 	utils.LogInfo(fmt.Sprintf("getting %s ...", strings.Join(neededObjectsSlice, ", ")), true)
-	apiResps, err := input.PCE.Load(ia.LoadInput{
+	apiResps, err := r.PCE.Load(ia.LoadInput{
 		Labels:                      true,
 		IPLists:                     true,
 		Services:                    true,
@@ -206,7 +206,7 @@ func (r *RuleExport) ExportToCsv() {
 		Workloads:                   needWklds,
 		VirtualServices:             needVirtualServices,
 		VirtualServers:              needVirtualServers,
-		ProvisionStatus:             input.PolicyVersion,
+		ProvisionStatus:             r.PolicyVersion,
 	}, utils.UseMulti())
 	utils.LogMultiAPIRespV2(apiResps)
 	if err != nil {
@@ -216,23 +216,23 @@ func (r *RuleExport) ExportToCsv() {
 	// Check if we need workloads for checking detail
 	lowCount := 0
 	noCount := 0
-	if input.TrafficCount && !input.SkipWkldDetailCheck {
+	if r.TrafficCount && !r.SkipWkldDetailCheck {
 		if !needWklds {
-			api, err := input.PCE.GetWklds(map[string]string{"visibility_level": "flow_off"})
+			api, err := r.PCE.GetWklds(map[string]string{"visibility_level": "flow_off"})
 			utils.LogAPIRespV2("GetWklds?visibility_level=flow_off", api)
 			if err != nil {
 				utils.LogError(err.Error())
 			}
-			noCount = len(input.PCE.WorkloadsSlice)
+			noCount = len(r.PCE.WorkloadsSlice)
 
-			api, err = input.PCE.GetWklds(map[string]string{"visibility_level": "flow_drops"})
+			api, err = r.PCE.GetWklds(map[string]string{"visibility_level": "flow_drops"})
 			utils.LogAPIRespV2("GetWklds?visibility_level=flow_drops", api)
 			if err != nil {
 				utils.LogError(err.Error())
 			}
-			lowCount = len(input.PCE.WorkloadsSlice)
+			lowCount = len(r.PCE.WorkloadsSlice)
 		} else {
-			for _, wkld := range input.PCE.Workloads {
+			for _, wkld := range r.PCE.Workloads {
 				if wkld.GetMode() == "enforced-low" {
 					lowCount++
 				}
@@ -256,12 +256,12 @@ func (r *RuleExport) ExportToCsv() {
 
 	// Start the headers
 	var headerSlice []string
-	if input.TrafficCount {
-		headerSlice = append(getCSVHeaders(input.NoHref), []string{"async_query_href", "async_query_status", "flows", "flows_by_port", "query_body"}...)
+	if r.TrafficCount {
+		headerSlice = append(getCSVHeaders(r.NoHref), []string{"async_query_href", "async_query_status", "flows", "flows_by_port", "query_body"}...)
 	} else {
-		headerSlice = getCSVHeaders(input.NoHref)
+		headerSlice = getCSVHeaders(r.NoHref)
 	}
-	if input.IncludePolicyVersionNumber {
+	if r.IncludePolicyVersionNumber {
 		headerSlice = append(headerSlice, "policy_version_number")
 	}
 
@@ -278,17 +278,17 @@ func (r *RuleExport) ExportToCsv() {
 	}
 
 	// Start the otuput file
-	if input.OutputFileName == "" {
-		input.OutputFileName = fmt.Sprintf("workloader-rule-export-%s.csv", time.Now().Format("20060102_150405"))
+	if r.OutputFileName == "" {
+		r.OutputFileName = fmt.Sprintf("workloader-rule-export-%s.csv", time.Now().Format("20060102_150405"))
 	}
 	// Remove existing file so WriteLineOutput doesn't append to a previous run's output
-	os.Remove(input.OutputFileName)
-	utils.WriteLineOutput(headerSlice, input.OutputFileName)
+	os.Remove(r.OutputFileName)
+	utils.WriteLineOutput(headerSlice, r.OutputFileName)
 
 	var policyVersionNumberString string
-	if input.IncludePolicyVersionNumber {
+	if r.IncludePolicyVersionNumber {
 		// Get policy version number
-		policyVersion, api, err := input.PCE.GetMostRecentSecPolicy()
+		policyVersion, api, err := r.PCE.GetMostRecentSecPolicy()
 		utils.LogAPIRespV2("GetMostRecentSecPolicy", api)
 		if err != nil {
 			utils.LogErrorf("error getting most recent policy version number - %s", err.Error())
@@ -314,10 +314,10 @@ func (r *RuleExport) ExportToCsv() {
 			scopeStrSlice := []string{}
 			for _, scopeMember := range scope {
 				if scopeMember.Label != nil {
-					scopeStrSlice = append(scopeStrSlice, fmt.Sprintf("%s:%s", input.PCE.Labels[scopeMember.Label.Href].Key, input.PCE.Labels[scopeMember.Label.Href].Value))
+					scopeStrSlice = append(scopeStrSlice, fmt.Sprintf("%s:%s", r.PCE.Labels[scopeMember.Label.Href].Key, r.PCE.Labels[scopeMember.Label.Href].Value))
 				}
 				if scopeMember.LabelGroup != nil {
-					scopeStrSlice = append(scopeStrSlice, fmt.Sprintf("%s:%s", input.PCE.LabelGroups[scopeMember.LabelGroup.Href].Key, input.PCE.LabelGroups[scopeMember.LabelGroup.Href].Name))
+					scopeStrSlice = append(scopeStrSlice, fmt.Sprintf("%s:%s", r.PCE.LabelGroups[scopeMember.LabelGroup.Href].Key, r.PCE.LabelGroups[scopeMember.LabelGroup.Href].Name))
 				}
 			}
 			scopes = append(scopes, strings.Join(scopeStrSlice, ";"))
@@ -353,7 +353,7 @@ func (r *RuleExport) ExportToCsv() {
 			} else {
 				csvEntryMap[HeaderUpdateType] = rule.UpdateType
 			}
-			if input.IncludePolicyVersionNumber {
+			if r.IncludePolicyVersionNumber {
 				csvEntryMap[HeaderPolicyVersionNumber] = policyVersionNumberString
 			}
 
@@ -369,17 +369,17 @@ func (r *RuleExport) ExportToCsv() {
 				// IP List
 				if c.IPList != nil {
 					if val, ok := csvEntryMap[HeaderSrcIplists]; ok {
-						csvEntryMap[HeaderSrcIplists] = fmt.Sprintf("%s;%s", val, input.PCE.IPLists[c.IPList.Href].Name)
+						csvEntryMap[HeaderSrcIplists] = fmt.Sprintf("%s;%s", val, r.PCE.IPLists[c.IPList.Href].Name)
 					} else {
-						csvEntryMap[HeaderSrcIplists] = input.PCE.IPLists[c.IPList.Href].Name
+						csvEntryMap[HeaderSrcIplists] = r.PCE.IPLists[c.IPList.Href].Name
 					}
 				}
 				// Labels
 				if c.Label != nil {
 					if c.Exclusion != nil && *c.Exclusion {
-						consumerLabelsExcusions = append(consumerLabelsExcusions, fmt.Sprintf("%s:%s", input.PCE.Labels[c.Label.Href].Key, input.PCE.Labels[c.Label.Href].Value))
+						consumerLabelsExcusions = append(consumerLabelsExcusions, fmt.Sprintf("%s:%s", r.PCE.Labels[c.Label.Href].Key, r.PCE.Labels[c.Label.Href].Value))
 					} else {
-						consumerLabels = append(consumerLabels, fmt.Sprintf("%s:%s", input.PCE.Labels[c.Label.Href].Key, input.PCE.Labels[c.Label.Href].Value))
+						consumerLabels = append(consumerLabels, fmt.Sprintf("%s:%s", r.PCE.Labels[c.Label.Href].Key, r.PCE.Labels[c.Label.Href].Value))
 					}
 				}
 
@@ -387,30 +387,30 @@ func (r *RuleExport) ExportToCsv() {
 				if c.LabelGroup != nil {
 					if c.Exclusion != nil && *c.Exclusion {
 						if val, ok := csvEntryMap[HeaderSrcLabelGroup]; ok {
-							csvEntryMap[HeaderSrcLabelGroupExclusions] = fmt.Sprintf("%s;%s", val, input.PCE.LabelGroups[c.LabelGroup.Href].Name)
+							csvEntryMap[HeaderSrcLabelGroupExclusions] = fmt.Sprintf("%s;%s", val, r.PCE.LabelGroups[c.LabelGroup.Href].Name)
 						} else {
-							csvEntryMap[HeaderSrcLabelGroupExclusions] = input.PCE.LabelGroups[c.LabelGroup.Href].Name
+							csvEntryMap[HeaderSrcLabelGroupExclusions] = r.PCE.LabelGroups[c.LabelGroup.Href].Name
 						}
 					} else {
 						if val, ok := csvEntryMap[HeaderSrcLabelGroup]; ok {
-							csvEntryMap[HeaderSrcLabelGroup] = fmt.Sprintf("%s;%s", val, input.PCE.LabelGroups[c.LabelGroup.Href].Name)
+							csvEntryMap[HeaderSrcLabelGroup] = fmt.Sprintf("%s;%s", val, r.PCE.LabelGroups[c.LabelGroup.Href].Name)
 						} else {
-							csvEntryMap[HeaderSrcLabelGroup] = input.PCE.LabelGroups[c.LabelGroup.Href].Name
+							csvEntryMap[HeaderSrcLabelGroup] = r.PCE.LabelGroups[c.LabelGroup.Href].Name
 						}
 					}
 				}
 				// Virtual Services
 				if c.VirtualService != nil {
 					if val, ok := csvEntryMap[HeaderSrcVirtualServices]; ok {
-						csvEntryMap[HeaderSrcVirtualServices] = fmt.Sprintf("%s;%s", val, input.PCE.VirtualServices[c.VirtualService.Href].Name)
+						csvEntryMap[HeaderSrcVirtualServices] = fmt.Sprintf("%s;%s", val, r.PCE.VirtualServices[c.VirtualService.Href].Name)
 					} else {
-						csvEntryMap[HeaderSrcVirtualServices] = input.PCE.VirtualServices[c.VirtualService.Href].Name
+						csvEntryMap[HeaderSrcVirtualServices] = r.PCE.VirtualServices[c.VirtualService.Href].Name
 					}
 				}
 				if c.Workload != nil {
 					// Get the hostname
 					pceHostname := ""
-					if pceWorkload, ok := input.PCE.Workloads[c.Workload.Href]; ok {
+					if pceWorkload, ok := r.PCE.Workloads[c.Workload.Href]; ok {
 						if ia.PtrToVal(pceWorkload.Hostname) != "" {
 							pceHostname = ia.PtrToVal(pceWorkload.Hostname)
 						} else {
@@ -430,7 +430,7 @@ func (r *RuleExport) ExportToCsv() {
 			// Consuming Security Principals
 			consumingSecPrincipals := []string{}
 			for _, csp := range ia.PtrToVal(rule.ConsumingSecurityPrincipals) {
-				consumingSecPrincipals = append(consumingSecPrincipals, input.PCE.ConsumingSecurityPrincipals[csp.Href].Name)
+				consumingSecPrincipals = append(consumingSecPrincipals, r.PCE.ConsumingSecurityPrincipals[csp.Href].Name)
 			}
 			csvEntryMap[HeaderSrcUserGroups] = strings.Join(consumingSecPrincipals, ";")
 
@@ -446,17 +446,17 @@ func (r *RuleExport) ExportToCsv() {
 				// IP List
 				if p.IPList != nil {
 					if val, ok := csvEntryMap[HeaderDstIplists]; ok {
-						csvEntryMap[HeaderDstIplists] = fmt.Sprintf("%s;%s", val, input.PCE.IPLists[p.IPList.Href].Name)
+						csvEntryMap[HeaderDstIplists] = fmt.Sprintf("%s;%s", val, r.PCE.IPLists[p.IPList.Href].Name)
 					} else {
-						csvEntryMap[HeaderDstIplists] = input.PCE.IPLists[p.IPList.Href].Name
+						csvEntryMap[HeaderDstIplists] = r.PCE.IPLists[p.IPList.Href].Name
 					}
 				}
 				// Labels
 				if p.Label != nil {
 					if p.Exclusion != nil && *p.Exclusion {
-						providerLabelsExclusions = append(providerLabelsExclusions, fmt.Sprintf("%s:%s", input.PCE.Labels[p.Label.Href].Key, input.PCE.Labels[p.Label.Href].Value))
+						providerLabelsExclusions = append(providerLabelsExclusions, fmt.Sprintf("%s:%s", r.PCE.Labels[p.Label.Href].Key, r.PCE.Labels[p.Label.Href].Value))
 					} else {
-						providerLabels = append(providerLabels, fmt.Sprintf("%s:%s", input.PCE.Labels[p.Label.Href].Key, input.PCE.Labels[p.Label.Href].Value))
+						providerLabels = append(providerLabels, fmt.Sprintf("%s:%s", r.PCE.Labels[p.Label.Href].Key, r.PCE.Labels[p.Label.Href].Value))
 					}
 				}
 
@@ -464,31 +464,31 @@ func (r *RuleExport) ExportToCsv() {
 				if p.LabelGroup != nil {
 					if p.Exclusion != nil && *p.Exclusion {
 						if val, ok := csvEntryMap[HeaderDstLabelGroups]; ok {
-							csvEntryMap[HeaderDstLabelGroupsExclusions] = fmt.Sprintf("%s;%s", val, input.PCE.LabelGroups[p.LabelGroup.Href].Name)
+							csvEntryMap[HeaderDstLabelGroupsExclusions] = fmt.Sprintf("%s;%s", val, r.PCE.LabelGroups[p.LabelGroup.Href].Name)
 						} else {
-							csvEntryMap[HeaderDstLabelGroupsExclusions] = input.PCE.LabelGroups[p.LabelGroup.Href].Name
+							csvEntryMap[HeaderDstLabelGroupsExclusions] = r.PCE.LabelGroups[p.LabelGroup.Href].Name
 						}
 					} else {
 						if val, ok := csvEntryMap[HeaderDstLabelGroups]; ok {
-							csvEntryMap[HeaderDstLabelGroups] = fmt.Sprintf("%s;%s", val, input.PCE.LabelGroups[p.LabelGroup.Href].Name)
+							csvEntryMap[HeaderDstLabelGroups] = fmt.Sprintf("%s;%s", val, r.PCE.LabelGroups[p.LabelGroup.Href].Name)
 						} else {
-							csvEntryMap[HeaderDstLabelGroups] = input.PCE.LabelGroups[p.LabelGroup.Href].Name
+							csvEntryMap[HeaderDstLabelGroups] = r.PCE.LabelGroups[p.LabelGroup.Href].Name
 						}
 					}
 				}
 				// Virtual Services
 				if p.VirtualService != nil {
 					if val, ok := csvEntryMap[HeaderDstVirtualServices]; ok {
-						csvEntryMap[HeaderDstVirtualServices] = fmt.Sprintf("%s;%s", val, input.PCE.VirtualServices[p.VirtualService.Href].Name)
+						csvEntryMap[HeaderDstVirtualServices] = fmt.Sprintf("%s;%s", val, r.PCE.VirtualServices[p.VirtualService.Href].Name)
 					} else {
-						csvEntryMap[HeaderDstVirtualServices] = input.PCE.VirtualServices[p.VirtualService.Href].Name
+						csvEntryMap[HeaderDstVirtualServices] = r.PCE.VirtualServices[p.VirtualService.Href].Name
 					}
 				}
 				// Workloads
 				if p.Workload != nil {
 					// Get the hostname
 					pceHostname := ""
-					if pceWorkload, ok := input.PCE.Workloads[p.Workload.Href]; ok {
+					if pceWorkload, ok := r.PCE.Workloads[p.Workload.Href]; ok {
 						if ia.PtrToVal(pceWorkload.Hostname) != "" {
 							pceHostname = ia.PtrToVal(pceWorkload.Hostname)
 						} else {
@@ -506,9 +506,9 @@ func (r *RuleExport) ExportToCsv() {
 				// Virtual Servers
 				if p.VirtualServer != nil {
 					if val, ok := csvEntryMap[HeaderDstVirtualServers]; ok {
-						csvEntryMap[HeaderDstVirtualServers] = fmt.Sprintf("%s;%s", val, input.PCE.VirtualServers[p.VirtualServer.Href].Name)
+						csvEntryMap[HeaderDstVirtualServers] = fmt.Sprintf("%s;%s", val, r.PCE.VirtualServers[p.VirtualServer.Href].Name)
 					} else {
-						csvEntryMap[HeaderDstVirtualServers] = input.PCE.VirtualServers[p.VirtualServer.Href].Name
+						csvEntryMap[HeaderDstVirtualServers] = r.PCE.VirtualServers[p.VirtualServer.Href].Name
 					}
 				}
 			}
@@ -524,26 +524,26 @@ func (r *RuleExport) ExportToCsv() {
 			// Iterate through ingress service
 			for _, s := range ia.PtrToVal(rule.IngressServices) {
 				// Windows Services
-				if input.PCE.Services[s.Href].WindowsServices != nil {
-					a := input.PCE.Services[s.Href]
+				if r.PCE.Services[s.Href].WindowsServices != nil {
+					a := r.PCE.Services[s.Href]
 					b, _ := a.ParseService()
-					if !input.ExpandServices {
-						services = append(services, input.PCE.Services[s.Href].Name)
+					if !r.ExpandServices {
+						services = append(services, r.PCE.Services[s.Href].Name)
 					} else {
-						services = append(services, fmt.Sprintf("%s (%s)", input.PCE.Services[s.Href].Name, strings.Join(b, ";")))
+						services = append(services, fmt.Sprintf("%s (%s)", r.PCE.Services[s.Href].Name, strings.Join(b, ";")))
 					}
 				}
 				// Port/Proto Services
-				if input.PCE.Services[s.Href].ServicePorts != nil {
-					a := input.PCE.Services[s.Href]
+				if r.PCE.Services[s.Href].ServicePorts != nil {
+					a := r.PCE.Services[s.Href]
 					_, b := a.ParseService()
-					if input.PCE.Services[s.Href].Name == "All Services" {
+					if r.PCE.Services[s.Href].Name == "All Services" {
 						services = append(services, "All Services")
 					} else {
-						if !input.ExpandServices {
-							services = append(services, input.PCE.Services[s.Href].Name)
+						if !r.ExpandServices {
+							services = append(services, r.PCE.Services[s.Href].Name)
 						} else {
-							services = append(services, fmt.Sprintf("%s (%s)", input.PCE.Services[s.Href].Name, strings.Join(b, ";")))
+							services = append(services, fmt.Sprintf("%s (%s)", r.PCE.Services[s.Href].Name, strings.Join(b, ";")))
 						}
 					}
 				}
@@ -589,14 +589,14 @@ func (r *RuleExport) ExportToCsv() {
 				csvEntryMap[HeaderDstAllWorkloads] = "false"
 			}
 
-			if input.TrafficCount {
-				data, skipped := input.TrafficCounter(&rs, &rule, fmt.Sprintf("%d of %d", totalRules, totalNumRules))
+			if r.TrafficCount {
+				data, skipped := r.TrafficCounter(&rs, &rule, fmt.Sprintf("%d of %d", totalRules, totalNumRules))
 				if skipped {
 					skippedRules++
 				}
-				utils.WriteLineOutput(append(createEntrySlice(csvEntryMap, input.NoHref, pceVersionIncludesUseSubnets, input.IncludePolicyVersionNumber), data...), input.OutputFileName)
+				utils.WriteLineOutput(append(createEntrySlice(csvEntryMap, r.NoHref, pceVersionIncludesUseSubnets, r.IncludePolicyVersionNumber), data...), r.OutputFileName)
 			} else {
-				utils.WriteLineOutput(createEntrySlice(csvEntryMap, input.NoHref, pceVersionIncludesUseSubnets, input.IncludePolicyVersionNumber), input.OutputFileName)
+				utils.WriteLineOutput(createEntrySlice(csvEntryMap, r.NoHref, pceVersionIncludesUseSubnets, r.IncludePolicyVersionNumber), r.OutputFileName)
 			}
 
 		}
@@ -606,6 +606,6 @@ func (r *RuleExport) ExportToCsv() {
 	if skippedRules > 0 {
 		utils.LogWarning(fmt.Sprintf("%d rules skipped because could not create valid traffic query", skippedRules), true)
 	}
-	utils.LogInfo(fmt.Sprintf("output file: %s", input.OutputFileName), true)
+	utils.LogInfo(fmt.Sprintf("output file: %s", r.OutputFileName), true)
 
 }
@@ -0,0 +1,272 @@
+package rulerecommend
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	ia "github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/cmd/iplimport"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+)
+
+// Declare local global variables
+var appGroups []string
+var aggregate, start, end, rulesetPrefix, iplPrefix, outputFileName string
+var exclAllowed, exclPotentiallyBlocked, exclBlocked bool
+
+func init() {
+	RuleRecommendCmd.Flags().StringArrayVarP(&appGroups, "app-group", "a", nil, "app group as semicolon separated key:value labels (e.g., app:erp;env:prod). repeat the flag for more app groups.")
+	RuleRecommendCmd.Flags().StringVarP(&aggregate, "aggregate", "g", "role,app,env", "comma-separated label keys used to describe workloads in rules. keys in the app group are dropped for workloads inside the app group.")
+	RuleRecommendCmd.Flags().StringVarP(&start, "start", "s", time.Now().AddDate(0, 0, -30).In(time.UTC).Format("2006-01-02"), "start date in the format of yyyy-mm-dd.")
+	RuleRecommendCmd.Flags().StringVarP(&end, "end", "e", time.Now().Add(time.Hour*24).Format("2006-01-02"), "end date in the format of yyyy-mm-dd.")
+	RuleRecommendCmd.Flags().BoolVar(&exclAllowed, "excl-allowed", false, "excludes allowed traffic flows.")
+	RuleRecommendCmd.Flags().BoolVar(&exclPotentiallyBlocked, "excl-potentially-blocked", false, "excludes potentially blocked traffic flows.")
+	RuleRecommendCmd.Flags().BoolVar(&exclBlocked, "excl-blocked", false, "excludes blocked traffic flows.")
+	RuleRecommendCmd.Flags().StringVar(&rulesetPrefix, "ruleset-prefix", "rr-", "prefix for the names of rulesets that do not exist. the name is the prefix and the app group label values (e.g., rr-erp-prod).")
+	RuleRecommendCmd.Flags().StringVar(&iplPrefix, "ipl-prefix", "rr-", "prefix for the names of ip lists created for ip addresses that are not in an existing ip list.")
+	RuleRecommendCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the rules output file location. default is current location with a timestamped filename. the other files use the same name with -rulesets, -iplists, and -report suffixes.")
+	RuleRecommendCmd.Flags().SortFlags = false
+}
+
+// RuleRecommendCmd creates rule-import csvs from traffic
+var RuleRecommendCmd = &cobra.Command{
+	Use:   "rule-recommend",
+	Short: "Recommend label-based rules for app groups from traffic and create rule-import and ruleset-import CSVs.",
+	Long: `
+Recommend label-based rules for app groups from traffic and create rule-import and ruleset-import CSVs.
+
+Explorer is queried for traffic to and from each app group in the time window. Flows are collapsed into rules in a ruleset scoped to the app group:
+- Intra-scope rules are for traffic between workloads in the app group. The consumer and provider are the --aggregate labels without the app group keys (e.g., role:web to role:db). If --aggregate has only app group keys, the consumer and provider are All Workloads in the app group. Workloads without any of the labels are used as the workload itself so an unlabeled workload never opens a rule to All Workloads. Label them to get aggregated rules.
+- Extra-scope rules are for traffic from workloads outside the app group. The consumer is the --aggregate labels of the source (e.g., role:web;app:crm;env:prod).
+- IP addresses that are not workloads use the most specific existing IP list with the address (other than the Any IP list). Addresses not in an IP list are grouped into new IP lists for the rules with the same provider and services. Traffic from the app group to IP addresses is an intra-scope rule with an IP list provider.
+- Ports use an existing service with only that port and protocol. Otherwise TCP and UDP ports are used in the rule and other protocols are in the report.
+- Traffic from the app group to workloads outside all the app groups is in the report. The rule belongs in the ruleset of the destination app group.
+
+The aggregation level is set with --aggregate. Use role,app,env (default) for the most specific rules, app,env to allow extra-scope app groups to all workloads, or app to allow extra-scope apps in any environment.
+
+The output files are:
+- workloader-rule-recommend-rules-<timestamp>.csv for rule-import.
+- workloader-rule-recommend-rulesets-<timestamp>.csv for ruleset-import with the app group rulesets that do not exist. An existing ruleset is used if its only scope is the app group.
+- workloader-rule-recommend-iplists-<timestamp>.csv for ipl-import if IP lists are needed.
+- workloader-rule-recommend-report-<timestamp>.csv with the flows that are not in a rule.
+
+Review the rules before importing. Import the files in the order of ruleset-import, ipl-import, and rule-import.
+
+The update-pce and --no-prompt flags are ignored for this command.`,
+	Example: `# Recommend rules for two app groups
+workloader rule-recommend --app-group "app:erp;env:prod" --app-group "app:crm;env:prod"
+
+# Recommend rules with extra-scope consumers at the app group level
+workloader rule-recommend -a "app:erp;env:prod" --aggregate app,env`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		if len(appGroups) == 0 {
+			utils.LogError("at least one --app-group is required")
+		}
+
+		// Get the PCE
+		pce, err := utils.GetTargetPCEV2(true)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+
+		recommend(pce)
+	},
+}
+
+func recommend(pce ia.PCE) {
+
+	// Get the PCE objects
+	apiResps, err := pce.Load(ia.LoadInput{Labels: true, Workloads: true, IPLists: true, Services: true, RuleSets: true, ProvisionStatus: "draft"}, utils.UseMulti())
+	utils.LogMultiAPIRespV2(apiResps)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
+	// Parse the app groups
+	scopes := []*appScope{}
+	for _, ag := range appGroups {
+		s := &appScope{labels: make(map[string]string)}
+		values := []string{}
+		for _, kv := range strings.Split(ag, ";") {
+			key, value, found := strings.Cut(strings.TrimSpace(kv), ":")
+			if !found {
+				utils.LogErrorf("%s is not in the format of key:value", kv)
+			}
+			label, ok := pce.Labels[key+value]
+			if !ok {
+				utils.LogErrorf("%s does not exist as a %s label", value, key)
+			}
+			s.labels[key] = value
+			s.hrefs = append(s.hrefs, label.Href)
+			values = append(values, value)
+		}
+		s.value = strings.Join(values, " | ")
+		s.ruleset = rulesetPrefix + strings.Join(values, "-")
+		if name, ok := existingRuleset(pce, s.hrefs); ok {
+			s.ruleset, s.exists = name, true
+			utils.LogInfof(true, "%s - using the existing %s ruleset", s.value, name)
+		}
+		scopes = append(scopes, s)
+	}
+	aggregateKeys := []string{}
+	for _, k := range strings.Split(aggregate, ",") {
+		if strings.TrimSpace(k) != "" {
+			aggregateKeys = append(aggregateKeys, strings.TrimSpace(k))
+		}
+	}
+
+	// Build the traffic query
+	tq := ia.TrafficQuery{MaxFLows: 200000, ExcludeWorkloadsFromIPListQuery: true, TransmissionExcludes: []string{"broadcast", "multicast"}}
+	if !exclAllowed {
+		tq.PolicyStatuses = append(tq.PolicyStatuses, "allowed")
+	}
+	if !exclPotentiallyBlocked {
+		tq.PolicyStatuses = append(tq.PolicyStatuses, "potentially_blocked")
+	}
+	if !exclBlocked {
+		tq.PolicyStatuses = append(tq.PolicyStatuses, "blocked")
+	}
+	tq.StartTime, err = time.Parse("2006-01-02 MST", fmt.Sprintf("%s %s", start, "UTC"))
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	tq.StartTime = tq.StartTime.In(time.UTC)
+	tq.EndTime, err = time.Parse("2006-01-02 15:04:05 MST", fmt.Sprintf("%s 23:59:59 %s", end, "UTC"))
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	tq.EndTime = tq.EndTime.In(time.UTC)
+
+	// Query traffic from and to each app group. Flows in more than one query are only counted once.
+	flows := make(map[flow]bool)
+	for _, s := range scopes {
+		for _, direction := range []string{"source", "destination"} {
+			q := tq
+			if direction == "source" {
+				q.SourcesInclude = [][]string{s.hrefs}
+			} else {
+				q.DestinationsInclude = [][]string{s.hrefs}
+			}
+			traffic, a, err := pce.GetTrafficAnalysis(q)
+			utils.LogAPIRespV2("GetTrafficAnalysis", a)
+			utils.LogInfof(false, "explorer query body: %s", a.ReqBody)
+			if err != nil {
+				utils.LogError(err.Error())
+			}
+			utils.LogInfof(true, "%s - %d traffic records as the %s", s.value, len(traffic), direction)
+			if len(traffic) == q.MaxFLows {
+				utils.LogWarningf(true, "%s - the query returned the max results. use a smaller time window.", s.value)
+			}
+			for _, t := range traffic {
+				f := flow{srcIP: t.Src.IP, dstIP: t.Dst.IP, port: t.ExpSrv.Port, proto: t.ExpSrv.Proto, connections: int(t.NumConnections)}
+				if t.Src.Workload != nil {
+					f.srcHref = t.Src.Workload.Href
+				}
+				if t.Dst.Workload != nil {
+					f.dstHref = t.Dst.Workload.Href
+				}
+				flows[f] = true
+			}
+		}
+	}
+
+	// Build the rules
+	r := newRecommender(pce, scopes, aggregateKeys)
+	for f := range flows {
+		r.addFlow(f)
+	}
+	r.collapseIPs(iplPrefix)
+	if len(r.rules) == 0 {
+		utils.LogInfo("no rules to recommend", true)
+		return
+	}
+
+	// Write the output files. The other files are named after the rules file.
+	ts := time.Now().Format("20060102_150405")
+	fileName := func(kind string) string {
+		if outputFileName == "" {
+			return fmt.Sprintf("workloader-rule-recommend-%s-%s.csv", kind, ts)
+		}
+		if kind == "rules" {
+			return outputFileName
+		}
+		return fmt.Sprintf("%s-%s.csv", strings.TrimSuffix(outputFileName, ".csv"), kind)
+	}
+	steps := []string{}
+
+	rulesetData := [][]string{{"name", "enabled", "description", "scope"}}
+	for _, s := range scopes {
+		if s.exists {
+			continue
+		}
+		rulesetData = append(rulesetData, []string{s.ruleset, "true", fmt.Sprintf("created by rule-recommend for %s", s.value), rulesetScope(s)})
+	}
+	if len(rulesetData) > 1 {
+		utils.WriteOutput(rulesetData, nil, fileName("rulesets"))
+		steps = append(steps, fmt.Sprintf("workloader ruleset-import %s", fileName("rulesets")))
+	}
+	if len(r.generatedIPL) > 0 {
+		iplData := [][]string{{iplimport.HeaderName, iplimport.HeaderDescription, iplimport.HeaderInclude, iplimport.HeaderExternalDataSet, iplimport.HeaderExternalDataRef}}
+		for name, ips := range r.generatedIPL {
+			sort.Strings(ips)
+			iplData = append(iplData, []string{name, "created by rule-recommend", strings.Join(ips, ";"), "workloader-rule-recommend", name})
+		}
+		sort.Slice(iplData[1:], func(i, j int) bool { return iplData[i+1][0] < iplData[j+1][0] })
+		utils.WriteOutput(iplData, nil, fileName("iplists"))
+		steps = append(steps, fmt.Sprintf("workloader ipl-import %s", fileName("iplists")))
+	}
+	ruleData := r.ruleRows()
+	utils.WriteOutput(ruleData, nil, fileName("rules"))
+	steps = append(steps, fmt.Sprintf("workloader rule-import %s", fileName("rules")))
+	if len(r.report) > 0 {
+		utils.WriteOutput(append([][]string{{"src_ip", "dst_ip", "port", "proto", "connections", "reason"}}, r.report...), nil, fileName("report"))
+		utils.LogInfof(true, "%d flows are not in a rule. see %s.", len(r.report), fileName("report"))
+	}
+
+	utils.LogInfof(true, "recommended %d rules from %d flows with %d rulesets and %d ip lists to create", len(ruleData)-1, len(flows), len(rulesetData)-1, len(r.generatedIPL))
+	for i, s := range steps {
+		utils.LogInfof(true, "import step %d: %s", i+1, s)
+	}
+}
+
+// rulesetScope returns the ruleset-import scope of an app group
+func rulesetScope(s *appScope) string {
+	keys := []string{}
+	for k := range s.labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	scope := []string{}
+	for _, k := range keys {
+		scope = append(scope, fmt.Sprintf("%s:%s", k, s.labels[k]))
+	}
+	return strings.Join(scope, ";")
+}
+
+// existingRuleset returns the name of a ruleset whose only scope is the labels
+func existingRuleset(pce ia.PCE, hrefs []string) (string, bool) {
+	target := make(map[string]bool)
+	for _, h := range hrefs {
+		target[h] = true
+	}
+	for _, rs := range pce.RuleSetsSlice {
+		scopes := ia.PtrToVal(rs.Scopes)
+		if len(scopes) != 1 || len(scopes[0]) != len(target) {
+			continue
+		}
+		match := true
+		for _, s := range scopes[0] {
+			if s.Label == nil || ia.PtrToVal(s.Exclusion) || !target[s.Label.Href] {
+				match = false
+			}
+		}
+		if match {
+			return rs.Name, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,418 @@
+package rulerecommend
+
+import (
+	"fmt"
+	"math"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+
+	ia "github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/cmd/ruleexport"
+)
+
+// appScope is an app group with the ruleset its rules are written to
+type appScope struct {
+	labels  map[string]string
+	hrefs   []string
+	value   string
+	ruleset string
+	exists  bool
+}
+
+func (s appScope) contains(labels map[string]string) bool {
+	for k, v := range s.labels {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// side is the consumer or provider of a recommended rule
+type side struct {
+	allWorkloads bool
+	labels       []string
+	workload     string
+	iplist       string
+	ip           string
+}
+
+func (s side) key() string {
+	return fmt.Sprintf("%t|%s|%s|%s|%s", s.allWorkloads, strings.Join(s.labels, ";"), s.workload, s.iplist, s.ip)
+}
+
+// rule is a recommended rule. The services are rule-import values.
+type rule struct {
+	scope    *appScope
+	consumer side
+	provider side
+	unscoped bool
+	services map[string]bool
+	flows    int
+}
+
+func (r *rule) serviceList() []string {
+	list := []string{}
+	for s := range r.services {
+		list = append(list, s)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// ipRange is an ip list range used to match ip addresses
+type ipRange struct {
+	from, to  netip.Addr
+	exclusion bool
+}
+
+// ipList is an existing ip list with its parsed ranges and size for picking the most specific match
+type ipList struct {
+	name   string
+	ranges []ipRange
+	size   float64
+}
+
+func (l ipList) contains(ip netip.Addr) bool {
+	included := false
+	for _, r := range l.ranges {
+		if ip.Compare(r.from) >= 0 && ip.Compare(r.to) <= 0 {
+			if r.exclusion {
+				return false
+			}
+			included = true
+		}
+	}
+	return included
+}
+
+// parseRange parses an ip list range entry. The from ip can be an address or cidr and the to ip is optional.
+func parseRange(fromIP, toIP string) (from, to netip.Addr, err error) {
+	if strings.Contains(fromIP, "/") {
+		p, err := netip.ParsePrefix(fromIP)
+		if err != nil {
+			return from, to, err
+		}
+		p = p.Masked()
+		from = p.Addr()
+		to = from
+		hostBits := from.BitLen() - p.Bits()
+		b := to.AsSlice()
+		for i := len(b) - 1; i >= 0 && hostBits > 0; i-- {
+			n := min(hostBits, 8)
+			b[i] |= byte(1<<n - 1)
+			hostBits -= n
+		}
+		to, _ = netip.AddrFromSlice(b)
+		return from, to, nil
+	}
+	if from, err = netip.ParseAddr(fromIP); err != nil {
+		return from, to, err
+	}
+	to = from
+	if toIP != "" {
+		if to, err = netip.ParseAddr(toIP); err != nil {
+			return from, to, err
+		}
+	}
+	return from, to, nil
+}
+
+// rangeSize returns the approximate number of addresses in a range
+func rangeSize(from, to netip.Addr) float64 {
+	f, t := from.As16(), to.As16()
+	size := 0.0
+	for i := 0; i < 16; i++ {
+		size += (float64(t[i]) - float64(f[i])) * math.Pow(256, float64(15-i))
+	}
+	return size + 1
+}
+
+// recommender builds the recommended rules from the traffic
+type recommender struct {
+	pce          ia.PCE
+	scopes       []*appScope
+	scopeKeys    map[string]bool
+	aggregate    []string
+	ipLists      []ipList
+	services     map[string]string
+	rules        map[string]*rule
+	generatedIPL map[string][]string
+	report       [][]string
+}
+
+func newRecommender(pce ia.PCE, scopes []*appScope, aggregate []string) *recommender {
+	r := &recommender{pce: pce, scopes: scopes, aggregate: aggregate, scopeKeys: make(map[string]bool), services: make(map[string]string), rules: make(map[string]*rule), generatedIPL: make(map[string][]string)}
+	for _, s := range scopes {
+		for k := range s.labels {
+			r.scopeKeys[k] = true
+		}
+	}
+
+	// IP lists other than the any ip list can be matched to ip addresses
+	for _, ipl := range pce.IPListsSlice {
+		if ipl.Name == "Any (0.0.0.0/0 and ::/0)" {
+			continue
+		}
+		l := ipList{name: ipl.Name}
+		for _, ipr := range ia.PtrToVal(ipl.IPRanges) {
+			from, to, err := parseRange(ipr.FromIP, ipr.ToIP)
+			if err != nil {
+				continue
+			}
+			l.ranges = append(l.ranges, ipRange{from: from, to: to, exclusion: ipr.Exclusion})
+			if !ipr.Exclusion {
+				l.size += rangeSize(from, to)
+			}
+		}
+		if len(l.ranges) > 0 {
+			r.ipLists = append(r.ipLists, l)
+		}
+	}
+	sort.SliceStable(r.ipLists, func(i, j int) bool { return r.ipLists[i].size < r.ipLists[j].size })
+
+	// Services with a single port are used when the port and protocol match
+	for _, s := range pce.ServicesSlice {
+		ports := ia.PtrToVal(s.ServicePorts)
+		if s.Name == "All Services" || len(ports) != 1 || len(ia.PtrToVal(s.WindowsServices)) > 0 || ports[0].Port == nil || (ports[0].ToPort != 0 && ports[0].ToPort != *ports[0].Port) {
+			continue
+		}
+		key := fmt.Sprintf("%d-%d", *ports[0].Port, ports[0].Protocol)
+		if existing, ok := r.services[key]; !ok || s.Name < existing {
+			r.services[key] = s.Name
+		}
+	}
+
+	return r
+}
+
+// workloadLabels returns the key:value labels of a workload
+func (r *recommender) workloadLabels(href string) map[string]string {
+	labels := make(map[string]string)
+	w, ok := r.pce.Workloads[href]
+	if !ok {
+		return labels
+	}
+	for _, l := range ia.PtrToVal(w.Labels) {
+		labels[r.pce.Labels[l.Href].Key] = r.pce.Labels[l.Href].Value
+	}
+	return labels
+}
+
+// workloadSide returns the aggregate labels of a workload. Scope keys are dropped inside the scope.
+// Inside the scope, the side is all workloads when every aggregate key is a scope key. Otherwise a workload
+// without any of the labels is the workload itself so the rule is not opened to all workloads.
+func (r *recommender) workloadSide(href string, labels map[string]string, inScope bool) side {
+	s := side{}
+	aggregated := false
+	for _, k := range r.aggregate {
+		if inScope && r.scopeKeys[k] {
+			continue
+		}
+		aggregated = true
+		if labels[k] != "" {
+			s.labels = append(s.labels, fmt.Sprintf("%s:%s", k, labels[k]))
+		}
+	}
+	switch {
+	case len(s.labels) > 0:
+	case !aggregated:
+		s.allWorkloads = true
+	default:
+		s.workload = r.workloadName(href)
+	}
+	return s
+}
+
+// workloadName returns the hostname of a workload or the name if there is no hostname. rule-import matches workloads by hostname.
+func (r *recommender) workloadName(href string) string {
+	w := r.pce.Workloads[href]
+	if ia.PtrToVal(w.Hostname) != "" {
+		return ia.PtrToVal(w.Hostname)
+	}
+	return ia.PtrToVal(w.Name)
+}
+
+// ipSide returns the most specific existing ip list for an ip address or the ip address to add to a generated ip list
+func (r *recommender) ipSide(ip string) side {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return side{ip: ip}
+	}
+	for _, l := range r.ipLists {
+		if l.contains(addr) {
+			return side{iplist: l.name}
+		}
+	}
+	return side{ip: addr.String()}
+}
+
+// service returns the rule-import value for a port and protocol
+func (r *recommender) service(port, proto int) (string, bool) {
+	if name, ok := r.services[fmt.Sprintf("%d-%d", port, proto)]; ok {
+		return name, true
+	}
+	switch proto {
+	case 6:
+		return fmt.Sprintf("%d tcp", port), true
+	case 17:
+		return fmt.Sprintf("%d udp", port), true
+	}
+	return "", false
+}
+
+// flow is an explorer result reduced to the fields used for the rules. The hrefs are empty for ip addresses.
+type flow struct {
+	srcHref, srcIP string
+	dstHref, dstIP string
+	port, proto    int
+	connections    int
+}
+
+// addFlow adds a flow to the rules of each scope it belongs to
+func (r *recommender) addFlow(f flow) {
+	srcLabels, dstLabels := r.workloadLabels(f.srcHref), r.workloadLabels(f.dstHref)
+	svc, ok := r.service(f.port, f.proto)
+	if !ok {
+		r.reportFlow(f, fmt.Sprintf("no existing service for %s port %d", ia.ProtocolList()[f.proto], f.port))
+		return
+	}
+
+	for _, s := range r.scopes {
+		srcIn := f.srcHref != "" && s.contains(srcLabels)
+		dstIn := f.dstHref != "" && s.contains(dstLabels)
+		var consumer, provider side
+		unscoped := false
+		switch {
+		case dstIn && srcIn:
+			consumer, provider = r.workloadSide(f.srcHref, srcLabels, true), r.workloadSide(f.dstHref, dstLabels, true)
+		case dstIn && f.srcHref != "":
+			consumer, provider, unscoped = r.workloadSide(f.srcHref, srcLabels, false), r.workloadSide(f.dstHref, dstLabels, true), true
+		case dstIn:
+			consumer, provider, unscoped = r.ipSide(f.srcIP), r.workloadSide(f.dstHref, dstLabels, true), true
+		case srcIn && f.dstHref == "":
+			consumer, provider = r.workloadSide(f.srcHref, srcLabels, true), r.ipSide(f.dstIP)
+		case srcIn:
+			r.reportFlow(f, fmt.Sprintf("outbound from %s to a workload outside the app groups. the rule belongs in the ruleset of the destination.", s.value))
+			continue
+		default:
+			continue
+		}
+		key := fmt.Sprintf("%s|%s|%s|%t", s.ruleset, consumer.key(), provider.key(), unscoped)
+		if _, ok := r.rules[key]; !ok {
+			r.rules[key] = &rule{scope: s, consumer: consumer, provider: provider, unscoped: unscoped, services: make(map[string]bool)}
+		}
+		r.rules[key].services[svc] = true
+		r.rules[key].flows += f.connections
+	}
+}
+
+func (r *recommender) reportFlow(f flow, reason string) {
+	r.report = append(r.report, []string{f.srcIP, f.dstIP, strconv.Itoa(f.port), ia.ProtocolList()[f.proto], strconv.Itoa(f.connections), reason})
+}
+
+// collapseIPs merges rules with ip addresses that have no existing ip list into rules with generated ip lists.
+// Rules are merged when the other side, the scope, and the services are the same.
+func (r *recommender) collapseIPs(iplPrefix string) {
+	merged := make(map[string]*rule)
+	used := make(map[string]bool)
+	for _, l := range r.pce.IPListsSlice {
+		used[l.Name] = true
+	}
+	keys := []string{}
+	for k := range r.rules {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		rr := r.rules[k]
+		if rr.consumer.ip == "" && rr.provider.ip == "" {
+			continue
+		}
+		delete(r.rules, k)
+		ipSide, otherSide := &rr.consumer, rr.provider
+		direction := "src"
+		if rr.provider.ip != "" {
+			ipSide, otherSide, direction = &rr.provider, rr.consumer, "dst"
+		}
+		mergeKey := fmt.Sprintf("%s|%s|%s|%s|%t", rr.scope.ruleset, direction, otherSide.key(), strings.Join(rr.serviceList(), ";"), rr.unscoped)
+		m, ok := merged[mergeKey]
+		if !ok {
+			name := fmt.Sprintf("%s%s-%s", iplPrefix, rr.scope.ruleset, direction)
+			for i := 2; used[name]; i++ {
+				name = fmt.Sprintf("%s%s-%s-%d", iplPrefix, rr.scope.ruleset, direction, i)
+			}
+			used[name] = true
+			m = &rule{scope: rr.scope, consumer: rr.consumer, provider: rr.provider, unscoped: rr.unscoped, services: rr.services}
+			if direction == "src" {
+				m.consumer = side{iplist: name}
+			} else {
+				m.provider = side{iplist: name}
+			}
+			merged[mergeKey] = m
+			r.rules[mergeKey] = m
+		}
+		m.flows += rr.flows
+		listName := m.consumer.iplist
+		if direction == "dst" {
+			listName = m.provider.iplist
+		}
+		r.generatedIPL[listName] = append(r.generatedIPL[listName], ipSide.ip)
+	}
+}
+
+// ruleHeaders are the rule-import columns written by rule-recommend
+var ruleHeaders = []string{ruleexport.HeaderRulesetName, ruleexport.HeaderRuleType, ruleexport.HeaderRuleDescription, ruleexport.HeaderRuleEnabled, ruleexport.HeaderUnscopedConsumers, ruleexport.HeaderSrcAllWorkloads, ruleexport.HeaderSrcLabels, ruleexport.HeaderSrcWorkloads, ruleexport.HeaderSrcIplists, ruleexport.HeaderDstAllWorkloads, ruleexport.HeaderDstLabels, ruleexport.HeaderDstWorkloads, ruleexport.HeaderDstIplists, ruleexport.HeaderServices, ruleexport.HeaderSrcResolveLabelsAs, ruleexport.HeaderDstResolveLabelsAs, ruleexport.HeaderExternalDataSet, ruleexport.HeaderExternalDataReference}
+
+// ruleRows returns the rule-import rows sorted by ruleset, intra-scope rules first
+func (r *recommender) ruleRows() [][]string {
+	rules := []*rule{}
+	for _, rr := range r.rules {
+		rules = append(rules, rr)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].scope.ruleset != rules[j].scope.ruleset {
+			return rules[i].scope.ruleset < rules[j].scope.ruleset
+		}
+		if rules[i].unscoped != rules[j].unscoped {
+			return !rules[i].unscoped
+		}
+		return rules[i].flows > rules[j].flows
+	})
+
+	data := [][]string{ruleHeaders}
+	for i, rr := range rules {
+		scopeType := "intra-scope"
+		if rr.unscoped {
+			scopeType = "extra-scope"
+		}
+		values := map[string]string{
+			ruleexport.HeaderRulesetName:           rr.scope.ruleset,
+			ruleexport.HeaderRuleType:              "allow",
+			ruleexport.HeaderRuleDescription:       fmt.Sprintf("recommended %s rule from %d flows", scopeType, rr.flows),
+			ruleexport.HeaderRuleEnabled:           "true",
+			ruleexport.HeaderUnscopedConsumers:     strconv.FormatBool(rr.unscoped),
+			ruleexport.HeaderSrcAllWorkloads:       strconv.FormatBool(rr.consumer.allWorkloads),
+			ruleexport.HeaderSrcLabels:             strings.Join(rr.consumer.labels, ";"),
+			ruleexport.HeaderSrcWorkloads:          rr.consumer.workload,
+			ruleexport.HeaderSrcIplists:            rr.consumer.iplist,
+			ruleexport.HeaderDstAllWorkloads:       strconv.FormatBool(rr.provider.allWorkloads),
+			ruleexport.HeaderDstLabels:             strings.Join(rr.provider.labels, ";"),
+			ruleexport.HeaderDstWorkloads:          rr.provider.workload,
+			ruleexport.HeaderDstIplists:            rr.provider.iplist,
+			ruleexport.HeaderServices:              strings.Join(rr.serviceList(), ";"),
+			ruleexport.HeaderSrcResolveLabelsAs:    "workloads",
+			ruleexport.HeaderDstResolveLabelsAs:    "workloads",
+			ruleexport.HeaderExternalDataSet:       "workloader-rule-recommend",
+			ruleexport.HeaderExternalDataReference: fmt.Sprintf("%s-%d", rr.scope.ruleset, i+1),
+		}
+		row := []string{}
+		for _, h := range ruleHeaders {
+			row = append(row, values[h])
+		}
+		data = append(data, row)
+	}
+	return data
+}
@@ -49,7 +49,7 @@ The update-pce and --no-prompt flags are ignored for this command.`,
 func ExportRuleSets(pce illumioapi.PCE, outputFileName string, templateFormat bool, hrefs []string) {
 
 	// Start the csvData
-	headers := []string{"ruleset_name", "enabled", "description", "scope", "contains_custom_iptables_rules"}
+	headers := []string{"ruleset_name", "enabled", "description", "scope", "contains_custom_iptables_rules", "external_data_set", "external_data_reference"}
 	if !templateFormat {
 		headers = append(headers, "href")
 	}
@@ -141,7 +141,7 @@ func ExportRuleSets(pce illumioapi.PCE, outputFileName string, templateFormat bo
 		}
 
 		// Append to the CSV data
-		entry := []string{rs.Name, strconv.FormatBool(*rs.Enabled), illumioapi.PtrToVal(rs.Description), strings.Join(allScopesSlice, "|"), strconv.FormatBool(customIPTables)}
+		entry := []string{rs.Name, strconv.FormatBool(*rs.Enabled), illumioapi.PtrToVal(rs.Description), strings.Join(allScopesSlice, "|"), strconv.FormatBool(customIPTables), illumioapi.PtrToVal(rs.ExternalDataSet), illumioapi.PtrToVal(rs.ExternalDataReference)}
 		if !templateFormat {
 			entry = append(entry, rs.Href)
 		}
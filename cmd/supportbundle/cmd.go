@@ -0,0 +1,147 @@
+package supportbundle
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var recordingDir, outputFileName string
+
+func init() {
+	SupportBundleCmd.Flags().StringVar(&recordingDir, "recording-dir", "workloader-recording", "directory of recordings created with the --record flag.")
+	SupportBundleCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the output file location. default is current location with a timestamped filename.")
+
+	SupportBundleCmd.Flags().SortFlags = false
+}
+
+// SupportBundleCmd runs the support-bundle command
+var SupportBundleCmd = &cobra.Command{
+	Use:   "support-bundle",
+	Short: "Zip recordings, config without credentials, and logs for troubleshooting.",
+	Long: `
+Zip recordings, config without credentials, and logs for troubleshooting.
+
+Run the command having the issue with the global --record flag first. Every PCE and third-party HTTP exchange (PCE, PAN, F5, vCenter, NetScaler) is saved as a json file in the recording directory with authorization headers, session tokens, passwords, and keys redacted.
+
+The support bundle includes:
+- the recording directory
+- the workloader log file
+- the workloader config file with api users, api keys, and proxy credentials removed
+
+The command can be re-run offline from the recordings with the global --replay flag:
+workloader wkld-export --record
+workloader support-bundle
+workloader wkld-export --replay
+
+Review the bundle before sharing it. Response bodies contain PCE objects such as workload hostnames and IP addresses.
+
+The update-pce and --no-prompt flags are ignored for this command.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		supportBundle()
+	},
+}
+
+// sanitizeConfig removes credentials from the workloader config settings
+func sanitizeConfig(settings map[string]interface{}) map[string]interface{} {
+	for name, value := range settings {
+		pceSettings, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if _, isPCE := pceSettings["fqdn"]; !isPCE {
+			continue
+		}
+		delete(pceSettings, "user")
+		delete(pceSettings, "key")
+		if proxy, ok := pceSettings["proxy"].(string); ok && proxy != "" {
+			if u, err := url.Parse(proxy); err == nil && u.User != nil {
+				u.User = nil
+				pceSettings["proxy"] = u.String()
+			}
+		}
+		settings[name] = pceSettings
+	}
+	return settings
+}
+
+func copyFile(source, target string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = io.Copy(out, in)
+	return err
+}
+
+func supportBundle() {
+
+	// Stage everything in a directory to zip
+	bundleName := fmt.Sprintf("workloader-support-bundle-%s", time.Now().Format("20060102_150405"))
+	stagingDir, err := os.MkdirTemp("", "workloader-support-")
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	defer os.RemoveAll(stagingDir)
+	bundleDir := filepath.Join(stagingDir, bundleName)
+	if err := os.MkdirAll(filepath.Join(bundleDir, "recording"), 0700); err != nil {
+		utils.LogError(err.Error())
+	}
+
+	// Recordings
+	recordings, err := filepath.Glob(filepath.Join(recordingDir, "*.json"))
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	if len(recordings) == 0 {
+		utils.LogWarningf(true, "%s does not have any recordings. use the --record flag on the command to troubleshoot.", recordingDir)
+	}
+	for _, r := range recordings {
+		if err := copyFile(r, filepath.Join(bundleDir, "recording", filepath.Base(r))); err != nil {
+			utils.LogError(err.Error())
+		}
+	}
+	utils.LogInfof(true, "added %d recordings from %s", len(recordings), recordingDir)
+
+	// Log file
+	if utils.LogFileName() != "" {
+		if err := copyFile(utils.LogFileName(), filepath.Join(bundleDir, filepath.Base(utils.LogFileName()))); err != nil {
+			utils.LogWarningf(true, "could not add log file - %s", err)
+		} else {
+			utils.LogInfof(true, "added log file %s", utils.LogFileName())
+		}
+	}
+
+	// Config without credentials
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.MergeConfigMap(sanitizeConfig(viper.AllSettings())); err != nil {
+		utils.LogError(err.Error())
+	}
+	if err := v.WriteConfigAs(filepath.Join(bundleDir, "pce.yaml")); err != nil {
+		utils.LogError(err.Error())
+	}
+	utils.LogInfo("added config with api users, api keys, and proxy credentials removed", true)
+
+	// Zip it
+	if outputFileName == "" {
+		outputFileName = bundleName + ".zip"
+	}
+	if err := utils.ZipDir(bundleDir, outputFileName); err != nil {
+		utils.LogError(err.Error())
+	}
+	utils.LogInfof(true, "support bundle created - %s", outputFileName)
+}
@@ -108,6 +108,7 @@ func ExportServices(pce illumioapi.PCE, templateFormat bool, outputFileName stri
 		if !templateFormat {
 			headers = append(headers, HeaderHref)
 		}
+		headers = append(headers, HeaderExternalDataSet, HeaderExternalDataReference)
 		if riskData {
 			headers = append(headers, "ransomware_category", "ransomware_severity", "ransomware_os_platform")
 		}
@@ -137,6 +138,7 @@ func ExportServices(pce illumioapi.PCE, templateFormat bool, outputFileName stri
 				if !templateFormat {
 					entry = append(entry, s.Href)
 				}
+				entry = append(entry, illumioapi.PtrToVal(s.ExternalDataSet), illumioapi.PtrToVal(s.ExternalDataReference))
 				if riskData && s.RiskDetails != nil {
 					entry = append(entry, s.RiskDetails.Ransomware.Category, s.RiskDetails.Ransomware.Severity, strings.Join(s.RiskDetails.Ransomware.OsPlatforms, ";"))
 				}
@@ -162,6 +164,7 @@ func ExportServices(pce illumioapi.PCE, templateFormat bool, outputFileName stri
 				if !templateFormat {
 					entry = append(entry, s.Href)
 				}
+				entry = append(entry, illumioapi.PtrToVal(s.ExternalDataSet), illumioapi.PtrToVal(s.ExternalDataReference))
 
 				if riskData && s.RiskDetails != nil {
 					entry = append(entry, s.RiskDetails.Ransomware.Category, s.RiskDetails.Ransomware.Severity, strings.Join(s.RiskDetails.Ransomware.OsPlatforms, ";"))
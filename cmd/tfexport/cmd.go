@@ -0,0 +1,142 @@
+package tfexport
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	ia "github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+)
+
+// Declare local global variables
+var outputDir, rulesetNames string
+var noProvider bool
+
+func init() {
+	TFExportCmd.Flags().StringVar(&outputDir, "output-dir", "", "directory for the terraform files. default is workloader-tf-export-<timestamp> in the current location.")
+	TFExportCmd.Flags().StringVarP(&rulesetNames, "rulesets", "r", "", "comma-separated list of ruleset names to export. default is all rulesets.")
+	TFExportCmd.Flags().BoolVar(&noProvider, "no-provider", false, "do not write the versions.tf and provider.tf files. use when adding the files to an existing configuration.")
+	TFExportCmd.Flags().SortFlags = false
+}
+
+// TFExportCmd writes terraform configuration for the pce policy objects
+var TFExportCmd = &cobra.Command{
+	Use:   "tf-export",
+	Short: "Export labels, label groups, services, IP lists, rulesets, and rules as Terraform HCL for the illumio-core provider.",
+	Long: `
+Export labels, label groups, services, IP lists, rulesets, and rules as Terraform HCL for the illumio-core provider.
+
+The output directory has the following files:
+- versions.tf and provider.tf for the illumio/illumio-core provider. Set the ILLUMIO_API_KEY_USERNAME and ILLUMIO_API_KEY_SECRET environment variables for the api credentials.
+- labels.tf, label_groups.tf, services.tf, ip_lists.tf, and rule_sets.tf with a resource for each object. Rules are illumio-core_security_rule resources in rule_sets.tf.
+- imports.tf with an import block for each resource so terraform plan imports the existing objects instead of creating them. Import blocks need Terraform 1.5 or later.
+
+Resources reference each other (e.g., illumio-core_label.app_erp.href) instead of using hrefs. Objects that are not exported (workloads, virtual services, and user groups) use their hrefs. The built-in All Services service and Any (0.0.0.0/0 and ::/0) ip list are data sources because they cannot be created or deleted.
+
+Draft policy is exported. Provision pending changes before the export so the import matches the active policy. Deny rules are not exported.
+
+After the export, run terraform init and terraform plan. The plan should only show imports.
+
+The update-pce and --no-prompt flags are ignored for this command.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// Get the PCE
+		pce, err := utils.GetTargetPCEV2(true)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+
+		tfExport(pce)
+	},
+}
+
+func tfExport(pce ia.PCE) {
+
+	// Get the policy objects
+	apiResps, err := pce.Load(ia.LoadInput{Labels: true, LabelGroups: true, Services: true, IPLists: true, ProvisionStatus: "draft"}, utils.UseMulti())
+	utils.LogMultiAPIRespV2(apiResps)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	a, err := pce.GetRulesets(nil, "draft")
+	utils.LogAPIRespV2("GetRulesets", a)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	ruleSets := pce.RuleSetsSlice
+	if rulesetNames != "" {
+		targets := make(map[string]bool)
+		for _, n := range strings.Split(rulesetNames, ",") {
+			targets[strings.TrimSpace(n)] = true
+		}
+		ruleSets = nil
+		for _, rs := range pce.RuleSetsSlice {
+			if targets[rs.Name] {
+				ruleSets = append(ruleSets, rs)
+				delete(targets, rs.Name)
+			}
+		}
+		for n := range targets {
+			utils.LogWarningf(true, "%s does not exist as a ruleset", n)
+		}
+	}
+
+	// Build the files. Objects that are referenced are built first so references resolve.
+	e := exporter{pce: pce, addresses: make(map[string]string), names: make(names), count: make(map[string]int)}
+	files := [][2]string{
+		{"labels.tf", e.labels()},
+		{"label_groups.tf", e.labelGroups()},
+		{"services.tf", e.services()},
+		{"ip_lists.tf", e.ipLists()},
+		{"rule_sets.tf", e.ruleSets(ruleSets)},
+	}
+	files = append(files, [2]string{"data.tf", e.data.String()}, [2]string{"imports.tf", e.imports.String()})
+	if !noProvider {
+		files = append(files, [2]string{"versions.tf", versionsTF()}, [2]string{"provider.tf", providerTF(pce)})
+	}
+
+	// Write the files
+	if outputDir == "" {
+		outputDir = fmt.Sprintf("workloader-tf-export-%s", time.Now().Format("20060102_150405"))
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		utils.LogError(err.Error())
+	}
+	for _, f := range files {
+		if f[1] == "" {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(outputDir, f[0]), []byte(strings.TrimSuffix(f[1], "\n")+"\n"), 0644); err != nil {
+			utils.LogError(err.Error())
+		}
+	}
+	utils.LogInfof(true, "exported %d labels, %d label groups, %d services, %d ip lists, %d rulesets, and %d rules to %s", e.count["label"], e.count["label_group"], e.count["service"], e.count["ip_list"], e.count["rule_set"], e.count["security_rule"], outputDir)
+	utils.LogInfo(fmt.Sprintf("run terraform init and terraform plan in %s. the plan should only show imports.", outputDir), true)
+}
+
+func versionsTF() string {
+	w := &hclWriter{}
+	w.open("terraform")
+	w.expr("required_version", quote(">= 1.5.0"))
+	w.open("required_providers")
+	w.open(provider + " =")
+	w.str("source", "illumio/illumio-core")
+	w.close()
+	w.close()
+	w.close()
+	return w.String()
+}
+
+func providerTF(pce ia.PCE) string {
+	w := &hclWriter{}
+	w.open(fmt.Sprintf("provider %q", provider))
+	w.comment("api_username and api_secret are read from ILLUMIO_API_KEY_USERNAME and ILLUMIO_API_KEY_SECRET")
+	w.str("pce_host", fmt.Sprintf("https://%s:%d", pce.FQDN, pce.Port))
+	w.number("org_id", pce.Org)
+	w.close()
+	return w.String()
+}
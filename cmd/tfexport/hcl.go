@@ -0,0 +1,118 @@
+package tfexport
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// hclWriter writes terraform blocks formatted the same as terraform fmt
+type hclWriter struct {
+	b       strings.Builder
+	depth   int
+	pending [][2]string
+}
+
+// flush writes the pending attributes with the equal signs aligned
+func (w *hclWriter) flush() {
+	width := 0
+	for _, a := range w.pending {
+		if len(a[0]) > width {
+			width = len(a[0])
+		}
+	}
+	for _, a := range w.pending {
+		fmt.Fprintf(&w.b, "%s%-*s = %s\n", strings.Repeat("  ", w.depth), width, a[0], a[1])
+	}
+	w.pending = nil
+}
+
+// open starts a block
+func (w *hclWriter) open(header string) {
+	if len(w.pending) > 0 {
+		w.flush()
+		w.b.WriteString("\n")
+	}
+	fmt.Fprintf(&w.b, "%s%s {\n", strings.Repeat("  ", w.depth), header)
+	w.depth++
+}
+
+// close ends a block. Empty blocks are written as {}.
+func (w *hclWriter) close() {
+	w.flush()
+	w.depth--
+	s := w.b.String()
+	if strings.HasSuffix(s, " {\n") {
+		w.b.Reset()
+		w.b.WriteString(strings.TrimSuffix(s, "\n") + "}\n")
+	} else {
+		fmt.Fprintf(&w.b, "%s}\n", strings.Repeat("  ", w.depth))
+	}
+	if w.depth == 0 {
+		w.b.WriteString("\n")
+	}
+}
+
+// expr adds an attribute with an expression value
+func (w *hclWriter) expr(name, value string) {
+	w.pending = append(w.pending, [2]string{name, value})
+}
+
+// str adds a quoted attribute if the value is not empty
+func (w *hclWriter) str(name, value string) {
+	if value != "" {
+		w.expr(name, quote(value))
+	}
+}
+
+func (w *hclWriter) boolean(name string, value bool) {
+	w.expr(name, strconv.FormatBool(value))
+}
+
+func (w *hclWriter) number(name string, value int) {
+	w.expr(name, strconv.Itoa(value))
+}
+
+// list adds a list of quoted strings
+func (w *hclWriter) list(name string, values []string) {
+	quoted := []string{}
+	for _, v := range values {
+		quoted = append(quoted, quote(v))
+	}
+	w.expr(name, "["+strings.Join(quoted, ", ")+"]")
+}
+
+// comment adds a comment line
+func (w *hclWriter) comment(text string) {
+	w.flush()
+	fmt.Fprintf(&w.b, "%s# %s\n", strings.Repeat("  ", w.depth), text)
+}
+
+func (w *hclWriter) String() string {
+	return w.b.String()
+}
+
+// quote escapes a string for hcl including template sequences
+func quote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`, "${", "$${", "%{", "%%{")
+	return `"` + r.Replace(s) + `"`
+}
+
+var invalidIdentChars = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// names creates unique terraform resource names per resource type
+type names map[string]bool
+
+func (n names) unique(resourceType, base string) string {
+	name := strings.Trim(invalidIdentChars.ReplaceAllString(strings.ToLower(base), "_"), "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "r_" + name
+	}
+	candidate := name
+	for i := 2; n[resourceType+"."+candidate]; i++ {
+		candidate = fmt.Sprintf("%s_%d", name, i)
+	}
+	n[resourceType+"."+candidate] = true
+	return candidate
+}
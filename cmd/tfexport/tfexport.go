@@ -0,0 +1,293 @@
+package tfexport
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	ia "github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/utils"
+)
+
+const provider = "illumio-core"
+
+// exporter tracks the terraform address of every exported href
+type exporter struct {
+	pce       ia.PCE
+	addresses map[string]string
+	names     names
+	imports   hclWriter
+	data      hclWriter
+	count     map[string]int
+}
+
+// resource starts a resource block and adds the import block. The address is created unless it was reserved.
+func (e *exporter) resource(w *hclWriter, resourceType, base, href string) {
+	if _, ok := e.addresses[href]; !ok {
+		e.addresses[href] = fmt.Sprintf("%s_%s.%s", provider, resourceType, e.names.unique(resourceType, base))
+	}
+	address := e.addresses[href]
+	e.count[resourceType]++
+	w.open(fmt.Sprintf("resource %q %q", provider+"_"+resourceType, address[strings.Index(address, ".")+1:]))
+	e.imports.open("import")
+	e.imports.expr("to", address)
+	e.imports.str("id", href)
+	e.imports.close()
+}
+
+// dataSource adds a data source for built-in objects that cannot be created or deleted
+func (e *exporter) dataSource(resourceType, base, href string) {
+	name := e.names.unique("data."+resourceType, base)
+	e.addresses[href] = fmt.Sprintf("data.%s_%s.%s", provider, resourceType, name)
+	e.data.open(fmt.Sprintf("data %q %q", provider+"_"+resourceType, name))
+	e.data.str("href", href)
+	e.data.close()
+}
+
+// ref returns the href expression for an object. Objects that are not exported use the href.
+func (e *exporter) ref(w *hclWriter, href, kind string) {
+	if address, ok := e.addresses[href]; ok {
+		w.expr("href", address+".href")
+		return
+	}
+	utils.LogWarningf(false, "%s %s is not exported. using the href.", kind, href)
+	w.str("href", href)
+}
+
+// hrefBlock writes a nested block with an href reference
+func (e *exporter) hrefBlock(w *hclWriter, block, href, kind string) {
+	w.open(block)
+	e.ref(w, href, kind)
+	w.close()
+}
+
+func (e *exporter) labels() string {
+	w := &hclWriter{}
+	labels := append([]ia.Label{}, e.pce.LabelsSlice...)
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].Key+":"+labels[i].Value < labels[j].Key+":"+labels[j].Value
+	})
+	for _, l := range labels {
+		e.resource(w, "label", l.Key+"_"+l.Value, l.Href)
+		w.str("key", l.Key)
+		w.str("value", l.Value)
+		w.str("external_data_set", ia.PtrToVal(l.ExternalDataSet))
+		w.str("external_data_reference", ia.PtrToVal(l.ExternalDataReference))
+		w.close()
+	}
+	return w.String()
+}
+
+func (e *exporter) labelGroups() string {
+	w := &hclWriter{}
+
+	// Reserve the addresses so sub groups can be referenced before they are written
+	for _, lg := range e.pce.LabelGroupsSlice {
+		e.addresses[lg.Href] = fmt.Sprintf("%s_label_group.%s", provider, e.names.unique("label_group", lg.Key+"_"+lg.Name))
+	}
+	for _, lg := range e.pce.LabelGroupsSlice {
+		e.resource(w, "label_group", "", lg.Href)
+		w.str("key", lg.Key)
+		w.str("name", lg.Name)
+		w.str("description", ia.PtrToVal(lg.Description))
+		for _, l := range ia.PtrToVal(lg.Labels) {
+			e.hrefBlock(w, "labels", l.Href, "label")
+		}
+		for _, sg := range ia.PtrToVal(lg.SubGroups) {
+			e.hrefBlock(w, "sub_groups", sg.Href, "label group")
+		}
+		w.close()
+	}
+	return w.String()
+}
+
+func (e *exporter) services() string {
+	w := &hclWriter{}
+	for _, s := range e.pce.ServicesSlice {
+		if s.Name == "All Services" {
+			e.dataSource("service", "all_services", s.Href)
+			continue
+		}
+		e.resource(w, "service", s.Name, s.Href)
+		w.str("name", s.Name)
+		w.str("description", s.Description)
+		w.str("external_data_set", ia.PtrToVal(s.ExternalDataSet))
+		w.str("external_data_reference", ia.PtrToVal(s.ExternalDataReference))
+		for _, sp := range ia.PtrToVal(s.ServicePorts) {
+			w.open("service_ports")
+			w.number("proto", sp.Protocol)
+			if sp.Port != nil {
+				w.number("port", *sp.Port)
+			}
+			if sp.ToPort != 0 {
+				w.number("to_port", sp.ToPort)
+			}
+			if sp.Protocol == 1 || sp.Protocol == 58 {
+				w.number("icmp_type", sp.IcmpType)
+				w.number("icmp_code", sp.IcmpCode)
+			}
+			w.close()
+		}
+		for _, ws := range ia.PtrToVal(s.WindowsServices) {
+			w.open("windows_services")
+			w.str("service_name", ws.ServiceName)
+			w.str("process_name", ws.ProcessName)
+			if ws.Protocol != 0 {
+				w.number("proto", ws.Protocol)
+			}
+			if ws.Port != nil {
+				w.number("port", *ws.Port)
+			}
+			if ws.ToPort != 0 {
+				w.number("to_port", ws.ToPort)
+			}
+			if ws.Protocol == 1 || ws.Protocol == 58 {
+				w.number("icmp_type", ws.IcmpType)
+				w.number("icmp_code", ws.IcmpCode)
+			}
+			w.close()
+		}
+		w.close()
+	}
+	return w.String()
+}
+
+func (e *exporter) ipLists() string {
+	w := &hclWriter{}
+	for _, ipl := range e.pce.IPListsSlice {
+		if ipl.Name == "Any (0.0.0.0/0 and ::/0)" {
+			e.dataSource("ip_list", "any", ipl.Href)
+			continue
+		}
+		e.resource(w, "ip_list", ipl.Name, ipl.Href)
+		w.str("name", ipl.Name)
+		w.str("description", ia.PtrToVal(ipl.Description))
+		w.str("external_data_set", ia.PtrToVal(ipl.ExternalDataSet))
+		w.str("external_data_reference", ia.PtrToVal(ipl.ExternalDataReference))
+		for _, r := range ia.PtrToVal(ipl.IPRanges) {
+			w.open("ip_ranges")
+			w.str("from_ip", r.FromIP)
+			w.str("to_ip", r.ToIP)
+			w.str("description", r.Description)
+			w.boolean("exclusion", r.Exclusion)
+			w.close()
+		}
+		for _, f := range ia.PtrToVal(ipl.FQDNs) {
+			w.open("fqdns")
+			w.str("fqdn", f.FQDN)
+			w.close()
+		}
+		w.close()
+	}
+	return w.String()
+}
+
+// actors writes the consumers or providers blocks of a rule
+func (e *exporter) actors(w *hclWriter, block string, actors []ia.ConsumerOrProvider) {
+	for _, a := range actors {
+		w.open(block)
+		switch {
+		case ia.PtrToVal(a.Actors) != "":
+			w.str("actors", ia.PtrToVal(a.Actors))
+		case a.Label != nil:
+			e.hrefBlock(w, "label", a.Label.Href, "label")
+		case a.LabelGroup != nil:
+			e.hrefBlock(w, "label_group", a.LabelGroup.Href, "label group")
+		case a.IPList != nil:
+			e.hrefBlock(w, "ip_list", a.IPList.Href, "ip list")
+		case a.Workload != nil:
+			e.hrefBlock(w, "workload", a.Workload.Href, "workload")
+		case a.VirtualService != nil:
+			e.hrefBlock(w, "virtual_service", a.VirtualService.Href, "virtual service")
+		case a.VirtualServer != nil:
+			e.hrefBlock(w, "virtual_server", a.VirtualServer.Href, "virtual server")
+		}
+		if ia.PtrToVal(a.Exclusion) {
+			w.boolean("exclusion", true)
+		}
+		w.close()
+	}
+}
+
+func (e *exporter) ruleSets(ruleSets []ia.RuleSet) string {
+	w := &hclWriter{}
+	for _, rs := range ruleSets {
+		e.resource(w, "rule_set", rs.Name, rs.Href)
+		w.str("name", rs.Name)
+		w.str("description", ia.PtrToVal(rs.Description))
+		w.boolean("enabled", ia.PtrToVal(rs.Enabled))
+		for _, scope := range ia.PtrToVal(rs.Scopes) {
+			w.open("scopes")
+			for _, s := range scope {
+				switch {
+				case s.Label != nil:
+					w.open("label")
+				case s.LabelGroup != nil:
+					w.open("label_group")
+				default:
+					continue
+				}
+				if s.Label != nil {
+					e.ref(w, s.Label.Href, "label")
+				} else {
+					e.ref(w, s.LabelGroup.Href, "label group")
+				}
+				if ia.PtrToVal(s.Exclusion) {
+					w.boolean("exclusion", true)
+				}
+				w.close()
+			}
+			w.close()
+		}
+		w.close()
+
+		// Rules are separate resources that reference the ruleset
+		rsAddress := e.addresses[rs.Href]
+		for _, rule := range rs.AllRules {
+			if rule.RuleType != "" && rule.RuleType != "allow" {
+				utils.LogWarningf(true, "%s - %s rule %s is not supported by the %s provider and is not exported", rs.Name, rule.RuleType, rule.Href, provider)
+				continue
+			}
+			e.resource(w, "security_rule", fmt.Sprintf("%s_%s", rs.Name, rule.Href[strings.LastIndex(rule.Href, "/")+1:]), rule.Href)
+			w.expr("rule_set_href", rsAddress+".href")
+			w.boolean("enabled", ia.PtrToVal(rule.Enabled))
+			w.str("description", ia.PtrToVal(rule.Description))
+			w.boolean("unscoped_consumers", ia.PtrToVal(rule.UnscopedConsumers))
+			w.boolean("sec_connect", ia.PtrToVal(rule.SecConnect))
+			w.boolean("machine_auth", ia.PtrToVal(rule.MachineAuth))
+			w.boolean("stateless", ia.PtrToVal(rule.Stateless))
+			w.str("external_data_set", ia.PtrToVal(rule.ExternalDataSet))
+			w.str("external_data_reference", ia.PtrToVal(rule.ExternalDataReference))
+			if rule.ResolveLabelsAs != nil {
+				w.open("resolve_labels_as")
+				w.list("consumers", ia.PtrToVal(rule.ResolveLabelsAs.Consumers))
+				w.list("providers", ia.PtrToVal(rule.ResolveLabelsAs.Providers))
+				w.close()
+			}
+			e.actors(w, "consumers", ia.PtrToVal(rule.Consumers))
+			e.actors(w, "providers", ia.PtrToVal(rule.Providers))
+			for _, s := range ia.PtrToVal(rule.IngressServices) {
+				w.open("ingress_services")
+				if s.Href != "" {
+					e.ref(w, s.Href, "service")
+				} else {
+					w.number("proto", ia.PtrToVal(s.Protocol))
+					if s.Port != nil {
+						w.number("port", *s.Port)
+					}
+					if ia.PtrToVal(s.ToPort) != 0 {
+						w.number("to_port", ia.PtrToVal(s.ToPort))
+					}
+				}
+				w.close()
+			}
+			for _, csp := range ia.PtrToVal(rule.ConsumingSecurityPrincipals) {
+				w.open("consuming_security_principals")
+				w.str("href", csp.Href)
+				w.close()
+			}
+			w.close()
+		}
+	}
+	return w.String()
+}
@@ -0,0 +1,225 @@
+package trafficdiff
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	ia "github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+)
+
+// Declare local global variables
+var baselineFile, currentFile, baselineStart, baselineEnd, currentStart, currentEnd, appGroupKeys, outputFileName string
+var volumeThreshold float64
+var maxResults int
+var collapseIPs, noProcess bool
+
+func init() {
+	TrafficDiffCmd.Flags().StringVar(&baselineFile, "baseline-file", "", "traffic csv (e.g., from the traffic command) to use as the baseline instead of querying the baseline window.")
+	TrafficDiffCmd.Flags().StringVar(&currentFile, "current-file", "", "traffic csv (e.g., from the traffic command) to use as the current traffic instead of querying the current window.")
+	TrafficDiffCmd.Flags().StringVar(&baselineStart, "baseline-start", time.Now().AddDate(0, 0, -13).In(time.UTC).Format("2006-01-02"), "baseline start date in the format of yyyy-mm-dd or yyyy-mm-ddTHH:mm:ss. if no time is provided, 00:00:00 is used. all times in GMT.")
+	TrafficDiffCmd.Flags().StringVar(&baselineEnd, "baseline-end", time.Now().AddDate(0, 0, -7).In(time.UTC).Format("2006-01-02"), "baseline end date in the format of yyyy-mm-dd or yyyy-mm-ddTHH:mm:ss. if no time is provided, 23:59:59 is used. all times in GMT.")
+	TrafficDiffCmd.Flags().StringVar(&currentStart, "current-start", time.Now().AddDate(0, 0, -6).In(time.UTC).Format("2006-01-02"), "current start date in the format of yyyy-mm-dd or yyyy-mm-ddTHH:mm:ss. if no time is provided, 00:00:00 is used. all times in GMT.")
+	TrafficDiffCmd.Flags().StringVar(&currentEnd, "current-end", time.Now().In(time.UTC).Format("2006-01-02"), "current end date in the format of yyyy-mm-dd or yyyy-mm-ddTHH:mm:ss. if no time is provided, 23:59:59 is used. all times in GMT.")
+	TrafficDiffCmd.Flags().StringVarP(&appGroupKeys, "app-group-keys", "g", "app,env", "comma-separated label keys that make an app group.")
+	TrafficDiffCmd.Flags().Float64VarP(&volumeThreshold, "volume-threshold", "v", 50, "minimum percent change in connections for a flow to be reported as volume changed.")
+	TrafficDiffCmd.Flags().BoolVar(&collapseIPs, "collapse-ips", false, "group all ip addresses that are not workloads into one \"ip addresses\" app group.")
+	TrafficDiffCmd.Flags().BoolVar(&noProcess, "no-process", false, "do not use the process to normalize flows.")
+	TrafficDiffCmd.Flags().IntVarP(&maxResults, "max-results", "m", 100000, "max results in explorer for each window query. maximum value is 200000.")
+	TrafficDiffCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the output file location. default is current location with a timestamped filename.")
+	TrafficDiffCmd.Flags().SortFlags = false
+}
+
+// TrafficDiffCmd compares traffic between two windows
+var TrafficDiffCmd = &cobra.Command{
+	Use:   "traffic-diff",
+	Short: "Compare traffic between a baseline and current window to find new, disappeared, and changed flows.",
+	Long: `
+Compare traffic between a baseline and current window to find new, disappeared, and changed flows.
+
+Each window is an explorer query (--baseline-start and --baseline-end, --current-start and --current-end) or a saved traffic csv (--baseline-file, --current-file). The default windows are the last 7 days including today compared to the 7 days before. Windows of different lengths will show volume changes.
+
+Flows are normalized to the source app group, destination app group, port, protocol, and process. The app group is the values of the --app-group-keys labels. Workloads without those labels use the hostname and ip addresses that are not workloads use the address (or "ip addresses" with --collapse-ips). Traffic csvs need source ip, destination ip, port, and protocol columns. Labels are read from columns such as Source Application and Destination Environment or source and destination labels columns with key:value pairs.
+
+The changes reported are:
+- new: the flow is only in the current window.
+- disappeared: the flow is only in the baseline window.
+- volume_changed: the connections changed by at least --volume-threshold percent.
+- decision_changed: the policy decisions for the flow changed.
+
+The alert column highlights flows with a potentially_blocked or blocked decision in the current window that was not in the baseline and a destination app group that is enforced. An app group is enforced if at least one of its workloads is in full or selective enforcement in the PCE. Alerts are sorted to the top.
+
+The update-pce and --no-prompt flags are ignored for this command.`,
+	Example: `# Compare the last 7 days to the 7 days before
+workloader traffic-diff
+
+# Compare two weekly traffic exports
+workloader traffic-diff --baseline-file week1.csv --current-file week2.csv
+
+# Compare the week before and after a move to enforcement
+workloader traffic-diff --baseline-start 2024-03-01 --baseline-end 2024-03-07 --current-start 2024-03-08 --current-end 2024-03-14`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// Get the PCE
+		pce, err := utils.GetTargetPCEV2(true)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+
+		trafficDiff(pce)
+	},
+}
+
+func trafficDiff(pce ia.PCE) {
+
+	// Validate the flags
+	if maxResults < 1 || maxResults > 200000 {
+		utils.LogError("max-results must be between 1 and 200000")
+	}
+	if volumeThreshold < 0 {
+		utils.LogError("volume threshold must be 0 or greater")
+	}
+	n := normalizer{collapseIPs: collapseIPs, noProcess: noProcess}
+	for _, k := range strings.Split(appGroupKeys, ",") {
+		if strings.TrimSpace(k) != "" {
+			n.keys = append(n.keys, strings.TrimSpace(k))
+		}
+	}
+	if len(n.keys) == 0 {
+		utils.LogError("at least one app group key is required")
+	}
+
+	// Get the labels and workloads
+	apiResps, err := pce.Load(ia.LoadInput{Labels: true, Workloads: true}, utils.UseMulti())
+	utils.LogMultiAPIRespV2(apiResps)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
+	// Get the enforced app groups
+	enforced := make(map[string]bool)
+	for _, w := range pce.WorkloadsSlice {
+		if mode := ia.PtrToVal(w.EnforcementMode); mode == "full" || mode == "selective" {
+			enforced[n.appGroup(workloadLabels(pce, w), workloadName(w), "")] = true
+		}
+	}
+
+	// Get the windows
+	base := getWindow(pce, n, "baseline", baselineFile, baselineStart, baselineEnd)
+	current := getWindow(pce, n, "current", currentFile, currentStart, currentEnd)
+
+	// Compare the windows
+	rows := diff(base, current, volumeThreshold, enforced)
+	counts := make(map[string]int)
+	alerts := 0
+	for _, r := range rows {
+		for _, c := range r.changes {
+			counts[c]++
+		}
+		if r.alert != "" {
+			alerts++
+		}
+	}
+	utils.LogInfof(true, "%d new, %d disappeared, %d volume changed, and %d decision changed flows", counts[changeNew], counts[changeDisappeared], counts[changeVolume], counts[changeDecision])
+	if alerts > 0 {
+		utils.LogWarningf(true, "%d new potentially blocked or blocked flows into enforced app groups", alerts)
+	}
+	if len(rows) == 0 {
+		utils.LogInfo("no traffic changes", true)
+		return
+	}
+
+	if outputFileName == "" {
+		outputFileName = fmt.Sprintf("workloader-traffic-diff-%s.csv", time.Now().Format("20060102_150405"))
+	}
+	utils.WriteOutput(csvData(rows), csvData(rows), outputFileName)
+	utils.LogInfof(true, "%d changed flows exported", len(rows))
+}
+
+// workloadLabels returns the label values of a workload by key
+func workloadLabels(pce ia.PCE, w ia.Workload) map[string]string {
+	labels := make(map[string]string)
+	for _, l := range ia.PtrToVal(w.Labels) {
+		labels[pce.Labels[l.Href].Key] = pce.Labels[l.Href].Value
+	}
+	return labels
+}
+
+// workloadName returns the hostname or name of a workload
+func workloadName(w ia.Workload) string {
+	if ia.PtrToVal(w.Hostname) != "" {
+		return ia.PtrToVal(w.Hostname)
+	}
+	return ia.PtrToVal(w.Name)
+}
+
+// getWindow returns the normalized flows from a traffic csv or an explorer query
+func getWindow(pce ia.PCE, n normalizer, name, file, start, end string) window {
+
+	// Traffic csv
+	if file != "" {
+		data, err := utils.ParseCSV(file)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		w, err := n.fromCSV(data)
+		if err != nil {
+			utils.LogErrorf("%s - %s", file, err)
+		}
+		utils.LogInfof(true, "%s - %d traffic records from %s normalized to %d flows", name, len(data)-1, file, len(w))
+		return w
+	}
+
+	// Explorer query
+	tq := ia.TrafficQuery{
+		PolicyStatuses:                  []string{"allowed", "potentially_blocked", "blocked"},
+		MaxFLows:                        maxResults,
+		ExcludeWorkloadsFromIPListQuery: true,
+		TransmissionExcludes:            []string{"broadcast", "multicast"},
+	}
+	tq.StartTime, tq.EndTime = parseTime(start, false), parseTime(end, true)
+	traffic, a, err := pce.GetTrafficAnalysis(tq)
+	utils.LogAPIRespV2("GetTrafficAnalysis", a)
+	utils.LogInfof(false, "%s explorer query body: %s", name, a.ReqBody)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	if len(traffic) == tq.MaxFLows {
+		utils.LogWarningf(true, "%s - the query returned the max results. use a smaller time window.", name)
+	}
+
+	protocols := ia.ProtocolList()
+	w := make(window)
+	for _, t := range traffic {
+		src, dst := n.appGroup(nil, "", t.Src.IP), n.appGroup(nil, "", t.Dst.IP)
+		if t.Src.Workload != nil {
+			src = n.appGroup(workloadLabels(pce, pce.Workloads[t.Src.Workload.Href]), workloadName(pce.Workloads[t.Src.Workload.Href]), t.Src.IP)
+		}
+		if t.Dst.Workload != nil {
+			dst = n.appGroup(workloadLabels(pce, pce.Workloads[t.Dst.Workload.Href]), workloadName(pce.Workloads[t.Dst.Workload.Href]), t.Dst.IP)
+		}
+		w.add(n.key(src, dst, t.ExpSrv.Port, protocols[t.ExpSrv.Proto], t.ExpSrv.Process), int(t.NumConnections), t.PolicyDecision)
+	}
+	utils.LogInfof(true, "%s - %d traffic records from %s to %s normalized to %d flows", name, len(traffic), tq.StartTime.Format(time.RFC3339), tq.EndTime.Format(time.RFC3339), len(w))
+	return w
+}
+
+// parseTime parses a date or date and time in GMT. Dates without a time use the start or end of the day.
+func parseTime(s string, end bool) time.Time {
+	var t time.Time
+	var err error
+	switch {
+	case strings.Contains(s, ":"):
+		t, err = time.Parse("2006-01-02T15:04:05 MST", fmt.Sprintf("%s UTC", s))
+	case end:
+		t, err = time.Parse("2006-01-02 15:04:05 MST", fmt.Sprintf("%s 23:59:59 UTC", s))
+	default:
+		t, err = time.Parse("2006-01-02 MST", fmt.Sprintf("%s UTC", s))
+	}
+	if err != nil {
+		utils.LogErrorf("error parsing time %s: %s", s, err)
+	}
+	return t.In(time.UTC)
+}
@@ -0,0 +1,333 @@
+package trafficdiff
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	ia "github.com/brian1917/illumioapi/v2"
+)
+
+// flowKey is a normalized flow
+type flowKey struct {
+	src     string
+	dst     string
+	port    int
+	proto   string
+	process string
+}
+
+// flowStats is the volume and policy decisions of a normalized flow in a window
+type flowStats struct {
+	connections int
+	decisions   map[string]bool
+}
+
+// window is the normalized flows of a time window or traffic csv
+type window map[flowKey]*flowStats
+
+func (w window) add(k flowKey, connections int, decision string) {
+	if _, ok := w[k]; !ok {
+		w[k] = &flowStats{decisions: make(map[string]bool)}
+	}
+	w[k].connections += connections
+	if decision != "" {
+		w[k].decisions[decision] = true
+	}
+}
+
+// normalizer builds the app group names of flow endpoints
+type normalizer struct {
+	keys        []string
+	collapseIPs bool
+	noProcess   bool
+}
+
+// appGroup returns the label values of the keys joined with " | ". Endpoints without the labels use the name and endpoints without a name use the ip address.
+func (n normalizer) appGroup(labels map[string]string, name, ip string) string {
+	values, found := []string{}, false
+	for _, k := range n.keys {
+		values = append(values, labels[k])
+		if labels[k] != "" {
+			found = true
+		}
+	}
+	if found {
+		return strings.Join(values, " | ")
+	}
+	if name != "" {
+		return name
+	}
+	if n.collapseIPs {
+		return "ip addresses"
+	}
+	return ip
+}
+
+// key returns the normalized flow key
+func (n normalizer) key(src, dst string, port int, proto, process string) flowKey {
+	if n.noProcess {
+		process = ""
+	}
+	return flowKey{src: src, dst: dst, port: port, proto: strings.ToLower(proto), process: process}
+}
+
+// normalizeDecision converts csv policy decisions (e.g., Potentially Blocked) to the api format (e.g., potentially_blocked)
+func normalizeDecision(d string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(d)), " ", "_")
+}
+
+// labelColumnNames has the column names used in explorer csvs for the default label keys
+var labelColumnNames = map[string][]string{
+	"role": {"role"},
+	"app":  {"app", "application"},
+	"env":  {"env", "environment"},
+	"loc":  {"loc", "location"},
+}
+
+// csvColumns has the indexes of the columns in a traffic csv
+type csvColumns struct {
+	srcIP, dstIP, srcName, dstName, srcLabels, dstLabels, port, proto, process, decision, connections int
+	srcKeys, dstKeys                                                                                  map[string]int
+}
+
+// findColumns finds the columns in a traffic csv header. Header names are not case sensitive.
+func findColumns(header []string, keys []string) (csvColumns, error) {
+	index := make(map[string]int)
+	for i, h := range header {
+		index[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	find := func(names ...string) int {
+		for _, n := range names {
+			if i, ok := index[n]; ok {
+				return i
+			}
+		}
+		return -1
+	}
+	c := csvColumns{
+		srcIP:       find("source ip", "src_ip", "src ip"),
+		dstIP:       find("destination ip", "dst_ip", "dst ip"),
+		srcName:     find("source hostname", "source name", "src_hostname", "src_name"),
+		dstName:     find("destination hostname", "destination name", "dst_hostname", "dst_name"),
+		srcLabels:   find("source labels", "src_labels"),
+		dstLabels:   find("destination labels", "dst_labels"),
+		port:        find("port", "destination port", "dst_port"),
+		proto:       find("protocol", "proto"),
+		process:     find("process", "process name", "destination process", "dst_process"),
+		decision:    find("reported policy decision", "policy decision", "policy_decision"),
+		connections: find("num flows", "flows", "connections", "num_connections"),
+		srcKeys:     make(map[string]int),
+		dstKeys:     make(map[string]int),
+	}
+	for _, k := range keys {
+		names := labelColumnNames[k]
+		if names == nil {
+			names = []string{k}
+		}
+		for _, n := range names {
+			if i := find("source "+n, "src_"+n); i != -1 {
+				c.srcKeys[k] = i
+			}
+			if i := find("destination "+n, "dst_"+n); i != -1 {
+				c.dstKeys[k] = i
+			}
+		}
+	}
+	if c.srcIP == -1 || c.dstIP == -1 || c.port == -1 || c.proto == -1 {
+		return c, fmt.Errorf("the csv must have source ip, destination ip, port, and protocol columns")
+	}
+	return c, nil
+}
+
+// csvLabels returns the labels of an endpoint from the label key columns or a labels column with key:value pairs
+func csvLabels(row []string, keyColumns map[string]int, labelsColumn int) map[string]string {
+	labels := make(map[string]string)
+	for k, i := range keyColumns {
+		labels[k] = strings.TrimSpace(row[i])
+	}
+	if labelsColumn != -1 {
+		for _, kv := range strings.FieldsFunc(row[labelsColumn], func(r rune) bool { return r == ';' || r == ',' }) {
+			if key, value, found := strings.Cut(strings.TrimSpace(kv), ":"); found {
+				labels[strings.TrimSpace(key)] = strings.TrimSpace(value)
+			}
+		}
+	}
+	return labels
+}
+
+// fromCSV normalizes the flows in a traffic csv
+func (n normalizer) fromCSV(data [][]string) (window, error) {
+	w := make(window)
+	if len(data) == 0 {
+		return w, nil
+	}
+	c, err := findColumns(data[0], n.keys)
+	if err != nil {
+		return nil, err
+	}
+	protocols := make(map[string]string)
+	for num, name := range ia.ProtocolList() {
+		protocols[strconv.Itoa(num)] = name
+	}
+	value := func(row []string, i int) string {
+		if i == -1 || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+	for i, row := range data[1:] {
+		if len(row) != len(data[0]) {
+			return nil, fmt.Errorf("csv line %d has %d columns and the header has %d", i+2, len(row), len(data[0]))
+		}
+		port, err := strconv.Atoi(value(row, c.port))
+		if err != nil {
+			return nil, fmt.Errorf("csv line %d - invalid port %s", i+2, value(row, c.port))
+		}
+		proto := value(row, c.proto)
+		if name, ok := protocols[proto]; ok {
+			proto = name
+		}
+		connections := 1
+		if v := value(row, c.connections); v != "" {
+			if connections, err = strconv.Atoi(v); err != nil {
+				return nil, fmt.Errorf("csv line %d - invalid flow count %s", i+2, v)
+			}
+		}
+		src := n.appGroup(csvLabels(row, c.srcKeys, c.srcLabels), value(row, c.srcName), value(row, c.srcIP))
+		dst := n.appGroup(csvLabels(row, c.dstKeys, c.dstLabels), value(row, c.dstName), value(row, c.dstIP))
+		w.add(n.key(src, dst, port, proto, value(row, c.process)), connections, normalizeDecision(value(row, c.decision)))
+	}
+	return w, nil
+}
+
+// Change types
+const (
+	changeNew         = "new"
+	changeDisappeared = "disappeared"
+	changeVolume      = "volume_changed"
+	changeDecision    = "decision_changed"
+)
+
+// diffRow is a flow that changed between the baseline and current windows
+type diffRow struct {
+	key      flowKey
+	changes  []string
+	base     *flowStats
+	current  *flowStats
+	enforced bool
+	alert    string
+}
+
+// diff compares the windows. Volume changes are reported when the connections change by at least the threshold percent.
+// Alerts are potentially blocked or blocked decisions in the current window that were not in the baseline for destinations in enforced app groups.
+func diff(base, current window, threshold float64, enforced map[string]bool) []diffRow {
+	keys := make(map[flowKey]bool)
+	for k := range base {
+		keys[k] = true
+	}
+	for k := range current {
+		keys[k] = true
+	}
+
+	rows := []diffRow{}
+	for k := range keys {
+		r := diffRow{key: k, base: base[k], current: current[k], enforced: enforced[k.dst]}
+		switch {
+		case r.base == nil:
+			r.changes = append(r.changes, changeNew)
+		case r.current == nil:
+			r.changes = append(r.changes, changeDisappeared)
+		default:
+			if math.Abs(volumeChange(r.base, r.current)) >= threshold {
+				r.changes = append(r.changes, changeVolume)
+			}
+			if decisions(r.base) != decisions(r.current) {
+				r.changes = append(r.changes, changeDecision)
+			}
+		}
+		if len(r.changes) == 0 {
+			continue
+		}
+		if r.enforced && r.current != nil {
+			for _, d := range []string{"potentially_blocked", "blocked"} {
+				if r.current.decisions[d] && (r.base == nil || !r.base.decisions[d]) {
+					r.alert = fmt.Sprintf("new %s flow into enforced app group", d)
+					break
+				}
+			}
+		}
+		rows = append(rows, r)
+	}
+
+	// Alerts first, then by change type and flow
+	order := map[string]int{changeNew: 0, changeDecision: 1, changeVolume: 2, changeDisappeared: 3}
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if (a.alert != "") != (b.alert != "") {
+			return a.alert != ""
+		}
+		if order[a.changes[0]] != order[b.changes[0]] {
+			return order[a.changes[0]] < order[b.changes[0]]
+		}
+		if a.key.src != b.key.src {
+			return a.key.src < b.key.src
+		}
+		if a.key.dst != b.key.dst {
+			return a.key.dst < b.key.dst
+		}
+		if a.key.port != b.key.port {
+			return a.key.port < b.key.port
+		}
+		if a.key.proto != b.key.proto {
+			return a.key.proto < b.key.proto
+		}
+		return a.key.process < b.key.process
+	})
+	return rows
+}
+
+// volumeChange returns the percent change in connections
+func volumeChange(base, current *flowStats) float64 {
+	if base.connections == 0 {
+		if current.connections == 0 {
+			return 0
+		}
+		return 100
+	}
+	return float64(current.connections-base.connections) / float64(base.connections) * 100
+}
+
+// decisions returns the sorted policy decisions separated by semicolons
+func decisions(s *flowStats) string {
+	if s == nil {
+		return ""
+	}
+	d := []string{}
+	for decision := range s.decisions {
+		d = append(d, decision)
+	}
+	sort.Strings(d)
+	return strings.Join(d, ";")
+}
+
+// csvData returns the diff as csv rows
+func csvData(rows []diffRow) [][]string {
+	data := [][]string{{"change", "src_app_group", "dst_app_group", "port", "proto", "process", "baseline_connections", "current_connections", "volume_change_pct", "baseline_policy_decisions", "current_policy_decisions", "dst_enforced", "alert"}}
+	for _, r := range rows {
+		baseConns, currentConns, change := "", "", ""
+		if r.base != nil {
+			baseConns = strconv.Itoa(r.base.connections)
+		}
+		if r.current != nil {
+			currentConns = strconv.Itoa(r.current.connections)
+		}
+		if r.base != nil && r.current != nil {
+			change = strconv.FormatFloat(volumeChange(r.base, r.current), 'f', 1, 64)
+		}
+		data = append(data, []string{strings.Join(r.changes, ";"), r.key.src, r.key.dst, strconv.Itoa(r.key.port), r.key.proto, r.key.process, baseConns, currentConns, change, decisions(r.base), decisions(r.current), strconv.FormatBool(r.enforced), r.alert})
+	}
+	return data
+}
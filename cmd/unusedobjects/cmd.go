@@ -0,0 +1,319 @@
+package unusedobjects
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	ia "github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/cmd/ruleexport"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+)
+
+// Declare local global variables
+var ruleUsageFile, outputFileName string
+
+func init() {
+	UnusedObjectsCmd.Flags().StringVar(&ruleUsageFile, "rule-usage-file", "", "output of rule-usage. rules with completed traffic queries and 0 flows are unused and objects only used by them are unused.")
+	UnusedObjectsCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the report output file location. default is current location with a timestamped filename. the delete file uses the same name with a -delete suffix.")
+	UnusedObjectsCmd.Flags().SortFlags = false
+}
+
+// UnusedObjectsCmd finds unused policy objects
+var UnusedObjectsCmd = &cobra.Command{
+	Use:   "unused-objects",
+	Short: "Find unused services, ip lists, label groups, virtual services, rulesets, and rules and create a csv for the delete command.",
+	Long: `
+Find unused services, ip lists, label groups, virtual services, rulesets, and rules and create a csv for the delete command.
+
+The draft policy is cross-referenced to find what uses each object:
+- rules use ip lists, label groups, virtual services, and services. Rules that resolve labels as virtual services use the virtual services with matching labels (label groups match any value and exclusions and ruleset scopes are not checked).
+- ruleset scopes use label groups.
+- enforcement boundaries use ip lists, label groups, and services.
+- virtual services use services.
+- label groups use other label groups as sub groups.
+
+Virtual services with service bindings are always in use. An object is unused when nothing references it or when everything that references it is unused. Rulesets with no rules are unused. The Any (0.0.0.0/0 and ::/0) ip list and All Services service are never reported.
+
+Use --rule-usage-file with the output of rule-usage to include rules with 0 flows. Rulesets with only unused rules and objects only used by unused rules are also reported. Review the traffic window and workload logging levels of the rule-usage queries before deleting rules.
+
+The output files are:
+- workloader-unused-objects-<timestamp>.csv with the unused objects, the reason, and the objects that reference them.
+- workloader-unused-objects-<timestamp>-delete.csv with the hrefs in the order to delete them. Rules are first, then rulesets, virtual services, label groups (containing groups before their sub groups), services, and ip lists.
+
+Review the delete file and run workloader delete <file> --header href --provision --update-pce.
+
+The update-pce and --no-prompt flags are ignored for this command.`,
+	Example: `# Find unused objects
+workloader unused-objects
+
+# Include rules without traffic hits
+workloader rule-export --traffic-count
+workloader rule-usage workloader-rule-export-20240301_120000.csv
+workloader unused-objects --rule-usage-file workloader-ruleset-export-rule-usage-20240302_120000.csv`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// Get the PCE
+		pce, err := utils.GetTargetPCEV2(true)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+
+		unusedObjects(pce)
+	},
+}
+
+// draftHref converts an active policy href to the draft href
+func draftHref(href string) string {
+	return strings.Replace(href, "/sec_policy/active/", "/sec_policy/draft/", 1)
+}
+
+// activeHref converts a draft policy href to the active href
+func activeHref(href string) string {
+	return strings.Replace(href, "/sec_policy/draft/", "/sec_policy/active/", 1)
+}
+
+// serviceBinding is a service binding of a virtual service
+type serviceBinding struct {
+	Href string `json:"href"`
+}
+
+// actorsMatch checks if an object with the labels matches the label actors of a rule side. Labels of different keys must
+// all match and labels of the same key match any value. Label groups match any value of their key and exclusions are not
+// checked so objects are only reported as unused when no rule can use them.
+func actorsMatch(cops []ia.ConsumerOrProvider, label func(key string) string, pce ia.PCE) bool {
+	values := make(map[string][]string)
+	matched := false
+	for _, c := range cops {
+		switch {
+		case ia.PtrToVal(c.Actors) == "ams":
+			return true
+		case c.Exclusion != nil && *c.Exclusion:
+		case c.Label != nil:
+			l := pce.Labels[c.Label.Href]
+			values[l.Key] = append(values[l.Key], l.Value)
+			matched = true
+		case c.LabelGroup != nil:
+			values[pce.LabelGroups[c.LabelGroup.Href].Key] = append(values[pce.LabelGroups[c.LabelGroup.Href].Key], "*")
+			matched = true
+		}
+	}
+	if !matched {
+		return false
+	}
+	for key, vals := range values {
+		ok := false
+		for _, v := range vals {
+			if v == "*" || v == label(key) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// parseRuleUsage returns the flows of rules with completed traffic queries
+func parseRuleUsage(file string) (map[string]string, error) {
+	data, err := utils.ParseCSV(file)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%s is empty", file)
+	}
+	href, status, flows := -1, -1, -1
+	for i, h := range data[0] {
+		switch h {
+		case ruleexport.HeaderRuleHref:
+			href = i
+		case "async_query_status":
+			status = i
+		case "flows":
+			flows = i
+		}
+	}
+	if href == -1 || status == -1 || flows == -1 {
+		return nil, fmt.Errorf("%s must have %s, async_query_status, and flows headers. use the output of rule-usage", file, ruleexport.HeaderRuleHref)
+	}
+	usage := make(map[string]string)
+	for _, row := range data[1:] {
+		if row[status] == "completed" {
+			usage[draftHref(row[href])] = row[flows]
+		}
+	}
+	return usage, nil
+}
+
+func unusedObjects(pce ia.PCE) {
+
+	// Get the rule usage
+	usage := make(map[string]string)
+	if ruleUsageFile != "" {
+		var err error
+		usage, err = parseRuleUsage(ruleUsageFile)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		utils.LogInfof(true, "%d rules with completed traffic queries in %s", len(usage), ruleUsageFile)
+	}
+
+	// Get the draft policy objects
+	apiResps, err := pce.Load(ia.LoadInput{
+		RuleSets:              true,
+		IPLists:               true,
+		Services:              true,
+		LabelGroups:           true,
+		VirtualServices:       true,
+		EnforcementBoundaries: true,
+		Labels:                true,
+		ProvisionStatus:       "draft",
+	}, utils.UseMulti())
+	utils.LogMultiAPIRespV2(apiResps)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
+	// Add the objects
+	x := newXref()
+	for _, ipl := range pce.IPListsSlice {
+		x.add(ipl.Href, typeIPList, ipl.Name).protected = ipl.Name == "Any (0.0.0.0/0 and ::/0)"
+	}
+	for _, s := range pce.ServicesSlice {
+		x.add(s.Href, typeService, s.Name).protected = s.Name == "All Services"
+	}
+	for _, lg := range pce.LabelGroupsSlice {
+		x.add(lg.Href, typeLabelGroup, lg.Name)
+	}
+	for _, vs := range pce.VirtualServicesSlice {
+		x.add(vs.Href, typeVirtualService, vs.Name)
+	}
+	for _, eb := range pce.EnforcementBoundariesSlice {
+		x.add(eb.Href, typeEnforcementBoundary, eb.Name)
+	}
+	staleRules := make(map[string]bool)
+	for _, rs := range pce.RuleSetsSlice {
+		r := x.add(rs.Href, typeRuleset, rs.Name)
+		for i, rule := range rs.AllRules {
+			o := x.add(rule.Href, typeRule, fmt.Sprintf("%s rule %d", rs.Name, i+1))
+			o.flows = usage[rule.Href]
+			if flows, ok := usage[rule.Href]; ok && flows == "0" {
+				staleRules[rule.Href] = true
+			}
+			r.children = append(r.children, rule.Href)
+		}
+	}
+
+	// Add the references
+	actors := func(referrer string, cops []ia.ConsumerOrProvider) {
+		for _, c := range cops {
+			if c.IPList != nil {
+				x.reference(c.IPList.Href, referrer)
+			}
+			if c.LabelGroup != nil {
+				x.reference(c.LabelGroup.Href, referrer)
+			}
+			if c.VirtualService != nil {
+				x.reference(c.VirtualService.Href, referrer)
+			}
+		}
+	}
+	// Rules that resolve labels as virtual services use the virtual services with matching labels
+	labelVirtualServices := func(referrer string, cops []ia.ConsumerOrProvider, resolveAs []string) {
+		for _, r := range resolveAs {
+			if r != "virtual_services" {
+				continue
+			}
+			for _, vs := range pce.VirtualServicesSlice {
+				if actorsMatch(cops, func(key string) string { return vs.GetLabelByKey(key, pce.Labels).Value }, pce) {
+					x.reference(vs.Href, referrer)
+				}
+			}
+		}
+	}
+	for _, rs := range pce.RuleSetsSlice {
+		for _, scope := range ia.PtrToVal(rs.Scopes) {
+			for _, s := range scope {
+				if s.LabelGroup != nil {
+					x.reference(s.LabelGroup.Href, rs.Href)
+				}
+			}
+		}
+		for _, rule := range rs.AllRules {
+			actors(rule.Href, ia.PtrToVal(rule.Consumers))
+			actors(rule.Href, ia.PtrToVal(rule.Providers))
+			if rule.ResolveLabelsAs != nil {
+				labelVirtualServices(rule.Href, ia.PtrToVal(rule.Consumers), ia.PtrToVal(rule.ResolveLabelsAs.Consumers))
+				labelVirtualServices(rule.Href, ia.PtrToVal(rule.Providers), ia.PtrToVal(rule.ResolveLabelsAs.Providers))
+			}
+			for _, s := range ia.PtrToVal(rule.IngressServices) {
+				x.reference(s.Href, rule.Href)
+			}
+		}
+	}
+	for _, eb := range pce.EnforcementBoundariesSlice {
+		actors(eb.Href, ia.PtrToVal(eb.Consumers))
+		actors(eb.Href, ia.PtrToVal(eb.Providers))
+		for _, s := range ia.PtrToVal(eb.IngressServices) {
+			x.reference(s.Href, eb.Href)
+		}
+	}
+	for _, vs := range pce.VirtualServicesSlice {
+		if vs.Service != nil {
+			x.reference(vs.Service.Href, vs.Href)
+		}
+
+		// Virtual services with service bindings are in use. Virtual services that were never provisioned have no bindings.
+		if vs.UpdateType == "create" {
+			continue
+		}
+		bindings := []serviceBinding{}
+		api, err := pce.GetHref(fmt.Sprintf("/orgs/%d/service_bindings?virtual_service=%s", pce.Org, url.QueryEscape(activeHref(vs.Href))), &bindings)
+		utils.LogAPIRespV2("GetServiceBindings", api)
+		if err != nil {
+			utils.LogWarningf(true, "getting service bindings for %s - %s. the virtual service is treated as used.", vs.Name, err)
+		}
+		if err != nil || len(bindings) > 0 {
+			x.objects[vs.Href].protected = true
+		}
+	}
+	for _, lg := range pce.LabelGroupsSlice {
+		for _, sg := range ia.PtrToVal(lg.SubGroups) {
+			x.reference(sg.Href, lg.Href)
+		}
+	}
+
+	// Find the unused objects
+	x.resolve(staleRules)
+	unused := x.unused()
+	if len(unused) == 0 {
+		utils.LogInfo("no unused objects", true)
+		return
+	}
+
+	// Build the report and delete files
+	data := [][]string{{"delete_order", "object_type", "name", "reason", "referenced_by", "rule_usage_flows", "href"}}
+	deleteData := [][]string{{"href", "object_type", "name"}}
+	counts := make(map[string]int)
+	for i, o := range unused {
+		data = append(data, []string{strconv.Itoa(i + 1), o.objectType, o.name, o.reason, x.referencedBy(o), o.flows, o.href})
+		deleteData = append(deleteData, []string{o.href, o.objectType, o.name})
+		counts[o.objectType]++
+	}
+
+	// Write the files
+	if outputFileName == "" {
+		outputFileName = fmt.Sprintf("workloader-unused-objects-%s.csv", time.Now().Format("20060102_150405"))
+	}
+	utils.WriteOutput(data, data, outputFileName)
+	deleteFileName := fmt.Sprintf("%s-delete.csv", strings.TrimSuffix(outputFileName, ".csv"))
+	utils.WriteOutput(deleteData, nil, deleteFileName)
+	utils.LogInfof(true, "%d unused objects: %d rules, %d rulesets, %d virtual services, %d label groups, %d services, %d ip lists", len(unused), counts[typeRule], counts[typeRuleset], counts[typeVirtualService], counts[typeLabelGroup], counts[typeService], counts[typeIPList])
+	utils.LogInfof(true, "review the files and run: workloader delete %s --header href --provision --update-pce", deleteFileName)
+}
@@ -0,0 +1,165 @@
+package unusedobjects
+
+import (
+	"sort"
+	"strings"
+)
+
+// Object types
+const (
+	typeRule                = "rule"
+	typeRuleset             = "rule_set"
+	typeVirtualService      = "virtual_service"
+	typeLabelGroup          = "label_group"
+	typeService             = "service"
+	typeIPList              = "ip_list"
+	typeEnforcementBoundary = "enforcement_boundary"
+)
+
+// deleteOrder is the order object types are deleted in so objects are removed before the objects they reference
+var deleteOrder = map[string]int{typeRule: 0, typeRuleset: 1, typeVirtualService: 2, typeLabelGroup: 3, typeService: 4, typeIPList: 5}
+
+// object is a policy object and the objects that reference it
+type object struct {
+	href       string
+	objectType string
+	name       string
+	referrers  map[string]bool
+	children   []string // rules of a ruleset
+	flows      string   // rule-usage flows of a rule
+	protected  bool
+	unused     bool
+	reason     string
+	level      int // label group nesting under other unused label groups
+}
+
+// xref is the cross-reference of policy objects
+type xref struct {
+	objects map[string]*object
+}
+
+func newXref() *xref {
+	return &xref{objects: make(map[string]*object)}
+}
+
+// add adds an object. Adding an existing href returns the existing object.
+func (x *xref) add(href, objectType, name string) *object {
+	if o, ok := x.objects[href]; ok {
+		return o
+	}
+	o := &object{href: href, objectType: objectType, name: name, referrers: make(map[string]bool)}
+	x.objects[href] = o
+	return o
+}
+
+// reference records that referrer uses href. References to objects that are not tracked (e.g., labels) are ignored.
+func (x *xref) reference(href, referrer string) {
+	if o, ok := x.objects[href]; ok && href != referrer {
+		o.referrers[referrer] = true
+	}
+}
+
+// resolve marks the unused objects. Stale rules are unused. Rulesets are unused when all their rules are unused.
+// Virtual services, label groups, services, and ip lists are unused when every object referencing them is unused.
+func (x *xref) resolve(staleRules map[string]bool) {
+	for href := range staleRules {
+		if o, ok := x.objects[href]; ok && o.objectType == typeRule {
+			o.unused, o.reason = true, "no traffic hits in rule-usage"
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, o := range x.objects {
+			if o.unused || o.protected {
+				continue
+			}
+			switch o.objectType {
+			case typeRuleset:
+				if len(o.children) == 0 {
+					o.unused, o.reason = true, "no rules"
+					changed = true
+					continue
+				}
+				all := true
+				for _, c := range o.children {
+					if !x.objects[c].unused {
+						all = false
+						break
+					}
+				}
+				if all {
+					o.unused, o.reason = true, "all rules are unused"
+					changed = true
+				}
+			case typeVirtualService, typeLabelGroup, typeService, typeIPList:
+				if len(o.referrers) == 0 {
+					o.unused, o.reason = true, "not referenced"
+					changed = true
+					continue
+				}
+				all := true
+				for r := range o.referrers {
+					if !x.objects[r].unused {
+						all = false
+						break
+					}
+				}
+				if all {
+					o.unused, o.reason = true, "only referenced by unused objects"
+					changed = true
+				}
+			}
+		}
+	}
+
+	// Label groups are deleted after the unused label groups that contain them
+	for changed := true; changed; {
+		changed = false
+		for _, o := range x.objects {
+			if !o.unused || o.objectType != typeLabelGroup {
+				continue
+			}
+			for r := range o.referrers {
+				if p := x.objects[r]; p.objectType == typeLabelGroup && p.level+1 > o.level {
+					o.level = p.level + 1
+					changed = true
+				}
+			}
+		}
+	}
+}
+
+// referencedBy returns the sorted names of the objects referencing an object
+func (x *xref) referencedBy(o *object) string {
+	names := []string{}
+	for r := range o.referrers {
+		names = append(names, x.objects[r].objectType+":"+x.objects[r].name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, "; ")
+}
+
+// unused returns the unused objects in delete order
+func (x *xref) unused() []*object {
+	objects := []*object{}
+	for _, o := range x.objects {
+		if o.unused {
+			objects = append(objects, o)
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		a, b := objects[i], objects[j]
+		if deleteOrder[a.objectType] != deleteOrder[b.objectType] {
+			return deleteOrder[a.objectType] < deleteOrder[b.objectType]
+		}
+		if a.level != b.level {
+			return a.level < b.level
+		}
+		if a.name != b.name {
+			return a.name < b.name
+		}
+		return a.href < b.href
+	})
+	return objects
+}
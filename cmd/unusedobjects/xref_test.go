@@ -0,0 +1,87 @@
+package unusedobjects
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	x := newXref()
+	x.add("/rs/1", typeRuleset, "rs1").children = []string{"/rs/1/rules/1", "/rs/1/rules/2"}
+	x.add("/rs/1/rules/1", typeRule, "rs1 rule 1")
+	x.add("/rs/1/rules/2", typeRule, "rs1 rule 2")
+	x.add("/rs/2", typeRuleset, "rs2").children = []string{"/rs/2/rules/1"}
+	x.add("/rs/2/rules/1", typeRule, "rs2 rule 1")
+	x.add("/rs/3", typeRuleset, "empty")
+	x.add("/vs/1", typeVirtualService, "bound vs").protected = true
+	x.add("/vs/2", typeVirtualService, "stale vs")
+	x.add("/vs/3", typeVirtualService, "label vs")
+	x.add("/lg/1", typeLabelGroup, "parent")
+	x.add("/lg/2", typeLabelGroup, "child")
+	x.add("/svc/1", typeService, "https")
+	x.add("/svc/2", typeService, "All Services").protected = true
+	x.add("/ipl/1", typeIPList, "used")
+	x.add("/ipl/2", typeIPList, "orphan")
+
+	x.reference("/vs/2", "/rs/1/rules/2")
+	x.reference("/vs/3", "/rs/2/rules/1")
+	x.reference("/svc/1", "/vs/2")
+	x.reference("/lg/1", "/rs/1/rules/2")
+	x.reference("/lg/2", "/lg/1")
+	x.reference("/ipl/1", "/rs/1/rules/1")
+	x.reference("/ipl/1", "/rs/1")
+	x.reference("/ipl/1", "/ipl/1")
+	x.reference("/labels/1", "/rs/1")
+
+	x.resolve(map[string]bool{"/rs/1/rules/2": true, "/rs/2/rules/1": true, "/labels/1": true})
+
+	want := map[string]string{
+		"/rs/1/rules/2": "no traffic hits in rule-usage",
+		"/rs/2/rules/1": "no traffic hits in rule-usage",
+		"/rs/2":         "all rules are unused",
+		"/rs/3":         "no rules",
+		"/vs/2":         "only referenced by unused objects",
+		"/vs/3":         "only referenced by unused objects",
+		"/lg/1":         "only referenced by unused objects",
+		"/lg/2":         "only referenced by unused objects",
+		"/svc/1":        "only referenced by unused objects",
+		"/ipl/2":        "not referenced",
+	}
+	for href, o := range x.objects {
+		if reason, ok := want[href]; ok {
+			if !o.unused || o.reason != reason {
+				t.Errorf("%s is unused %t with reason %q, want unused with %q", href, o.unused, o.reason, reason)
+			}
+		} else if o.unused {
+			t.Errorf("%s is unused with reason %q, want used", href, o.reason)
+		}
+	}
+	if x.objects["/lg/2"].level != 1 {
+		t.Errorf("child label group level is %d, want 1", x.objects["/lg/2"].level)
+	}
+}
+
+func TestUnusedDeleteOrder(t *testing.T) {
+	x := newXref()
+	x.add("/ipl/1", typeIPList, "a ip list")
+	x.add("/svc/1", typeService, "a service")
+	x.add("/lg/1", typeLabelGroup, "z parent")
+	x.add("/lg/2", typeLabelGroup, "a child")
+	x.add("/lg/3", typeLabelGroup, "a grandchild")
+	x.add("/vs/1", typeVirtualService, "a vs")
+	x.add("/rs/1", typeRuleset, "a ruleset").children = []string{"/rs/1/rules/1"}
+	x.add("/rs/1/rules/1", typeRule, "a ruleset rule 1")
+	x.reference("/lg/2", "/lg/1")
+	x.reference("/lg/3", "/lg/2")
+
+	x.resolve(map[string]bool{"/rs/1/rules/1": true})
+
+	got := []string{}
+	for _, o := range x.unused() {
+		got = append(got, o.href)
+	}
+	want := []string{"/rs/1/rules/1", "/rs/1", "/vs/1", "/lg/1", "/lg/2", "/lg/3", "/svc/1", "/ipl/1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("delete order is %v, want %v", got, want)
+	}
+}
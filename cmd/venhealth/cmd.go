@@ -24,7 +24,8 @@ type uniqueEntry struct {
 	Events   map[string]int
 }
 
-var venHealthEvents []string = []string{
+// VenHealthEvents are the event types monitored for VEN health
+var VenHealthEvents []string = []string{
 	"agent.clone_detected",
 	"agent.deactivate",
 	"agent.missing_heartbeats_after_upgrade",
@@ -57,7 +58,7 @@ func init() {
 	VenHealthCmd.Flags().StringVar(&end, "end", "", "custom end date in RFC 3339 format.")
 	VenHealthCmd.Flags().IntVar(&maxResults, "max-results", 10000, "maximum results. max is 10,000.")
 	VenHealthCmd.Flags().BoolVar(&includeEventList, "include-event-list", false, "include output of full event list with th summarized report.")
-	VenHealthCmd.Flags().StringVar(&customEventList, "custom-event-list", "", fmt.Sprintf("text file with events on separate lines to override the default %d events", len(venHealthEvents)))
+	VenHealthCmd.Flags().StringVar(&customEventList, "custom-event-list", "", fmt.Sprintf("text file with events on separate lines to override the default %d events", len(VenHealthEvents)))
 	VenHealthCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the output file location. default is current location with a timestamped filename.")
 
 	VenHealthCmd.Flags().SortFlags = false
@@ -70,7 +71,7 @@ var VenHealthCmd = &cobra.Command{
 	Long: `
 Create a CSV report of VEN health events for specific time period
 
-The monitored events are listed below:` + "\r\n\r\n" + strings.Join(venHealthEvents, "\r\n"),
+The monitored events are listed below:` + "\r\n\r\n" + strings.Join(VenHealthEvents, "\r\n"),
 
 	Run: func(cmd *cobra.Command, args []string) {
 
@@ -88,17 +89,17 @@ The monitored events are listed below:` + "\r\n\r\n" + strings.Join(venHealthEve
 
 		// If the customEventList is provided, use that
 		if customEventList != "" {
-			venHealthEvents = []string{}
+			VenHealthEvents = []string{}
 			data, err := utils.ParseCSV(customEventList)
 			if err != nil {
 				utils.LogError(err.Error())
 			}
 			for _, d := range data {
-				venHealthEvents = append(venHealthEvents, d[0])
+				VenHealthEvents = append(VenHealthEvents, d[0])
 			}
 		}
 
-		eventMonitor(venHealthEvents)
+		eventMonitor(VenHealthEvents)
 	},
 }
 
@@ -12,9 +12,9 @@ var vcenter, datacenter, cluster, folder, userID, secret string
 
 var csvFile string
 var ignoreState, ignoreSubfolders, umwl, keepFile, keepFQDNHostname, deprecated, insecure, allIPs, vcName, ipv6 bool
-var updatePCE, noPrompt bool
+var toVCenter, updatePCE, noPrompt bool
 var vc VCenter
-var maxCreate, maxUpdate int
+var maxCreate, maxUpdate, maxChanges int
 
 // Init builds the commands
 func init() {
@@ -41,6 +41,8 @@ func init() {
 	//VCenterSyncCmd.Flags().BoolVarP(&deprecated, "deprecated", "", false, "Use this option if you are running an older version of the API (VCenter 6.5-7.0.u2")
 	VCenterSyncCmd.Flags().IntVar(&maxCreate, "max-create", -1, "maximum number of unmanaged workloads that can be created. -1 is unlimited.")
 	VCenterSyncCmd.Flags().IntVar(&maxUpdate, "max-update", -1, "maximum number of workloads that can be updated. -1 is unlimited.")
+	VCenterSyncCmd.Flags().BoolVar(&toVCenter, "to-vcenter", false, "reverse the sync direction. write pce labels to vcenter as tags in the mapped categories.")
+	VCenterSyncCmd.Flags().IntVar(&maxChanges, "max-changes", -1, "used with --to-vcenter. maximum number of tags that can be attached or detached. -1 is unlimited.")
 
 	VCenterSyncCmd.MarkFlagRequired("userID")
 	VCenterSyncCmd.MarkFlagRequired("secret")
@@ -60,6 +62,13 @@ A csv file is needed to map VCenter Categories to PCE label keys. The csv skips
 The VCenter category should be in the first column and the corredsponding illumio label key in the second.  
 
 For all VCenter object (datacenter, cluster, folder) you can enter more than one.  They need to be seperated by commas without spaces.
+
+Use --to-vcenter to reverse the direction and write PCE labels (e.g., labels assigned by hostparse or subnet) to VCenter as tags. The same csv maps each category to a label key. VMs are matched to PCE workloads the same way as the default direction. For each mapped category:
+- A missing category is created for VMs with single cardinality.
+- A missing tag is created for each label value.
+- The tag matching the workload's label is attached to the VM.
+- Other tags in the category are detached, including when the workload has no label for the key.
+The changes are written to a csv. VCenter is only changed with --update-pce. Use --max-changes to stop the run if too many tags would be attached or detached.
 	
 Support VCenter version > 7.0.u2`,
 
@@ -72,6 +81,11 @@ Support VCenter version > 7.0.u2`,
 		}
 		csvFile = args[0]
 
+		if toVCenter && umwl {
+			fmt.Println("Cannot use \"--umwl\" with \"--to-vcenter\".")
+			os.Exit(0)
+		}
+
 		if (!umwl && (allIPs || ipv6)) || (umwl && (ipv6 && !allIPs)) {
 			fmt.Println("Cannot use \"--allintf\" or \"--ipv6\" without \"--uwml\" with \"vmsync\".  \"--ipv6\" requires \"--allintf\"")
 			os.Exit(0)
@@ -93,6 +107,12 @@ Support VCenter version > 7.0.u2`,
 
 		vc.setupVCenterSession()
 
+		//Write PCE labels to VCenter tags
+		if toVCenter {
+			vc.syncToVCenter(keyMap)
+			return
+		}
+
 		vc.compileVMData(keyMap)
 		//Sync VMs to Workloads or create UMWL VMs for all machines in VCenter not running VEN
 
@@ -0,0 +1,294 @@
+package vmsync
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/viper"
+)
+
+// batchResult - response from the tag-association multiple object actions
+type batchResult struct {
+	Success       bool          `json:"success"`
+	ErrorMessages []interface{} `json:"error_messages"`
+}
+
+// tagChange - a tag to attach to or detach from a VM. Actions are create-category, create-tag, attach, and detach.
+type tagChange struct {
+	Action   string
+	VMID     string
+	VMName   string
+	Hostname string
+	Category string
+	Tag      string
+	TagID    string
+}
+
+// createCategory - Create a category for VMs that allows a single tag per object to match a PCE label type.
+func (vc *VCenter) createCategory(name string) string {
+
+	tmpurl := "/api/cis/tagging/category"
+	spec := map[string]interface{}{"name": name, "description": "created by workloader vmsync", "cardinality": "SINGLE", "associable_types": []string{"VirtualMachine"}}
+	var body interface{} = spec
+	if deprecated {
+		tmpurl = "/rest/com/vmware/cis/tagging/category"
+		body = map[string]interface{}{"create_spec": spec}
+	}
+
+	var obj string
+	vc.Post(tmpurl, body, &obj, false, "createCategory")
+	return obj
+}
+
+// createTag - Create a tag in the category.
+func (vc *VCenter) createTag(name, categoryID string) string {
+
+	tmpurl := "/api/cis/tagging/tag"
+	spec := map[string]interface{}{"name": name, "description": "created by workloader vmsync", "category_id": categoryID}
+	var body interface{} = spec
+	if deprecated {
+		tmpurl = "/rest/com/vmware/cis/tagging/tag"
+		body = map[string]interface{}{"create_spec": spec}
+	}
+
+	var obj string
+	vc.Post(tmpurl, body, &obj, false, "createTag")
+	return obj
+}
+
+// tagAssociation - Attach or detach a tag on a set of VMs. Action is attach or detach. VMs are sent NumVM at a time.
+func (vc *VCenter) tagAssociation(action, tagID string, vmIDs []string) {
+
+	tmpurl := fmt.Sprintf("/api/cis/tagging/tag-association/%s?action=%s-tag-to-multiple-objects", tagID, action)
+	if action == "detach" {
+		tmpurl = fmt.Sprintf("/api/cis/tagging/tag-association/%s?action=detach-tag-from-multiple-objects", tagID)
+	}
+	if deprecated {
+		tmpurl = strings.Replace(strings.Replace(tmpurl, "/api/cis/tagging/tag-association/", "/rest/com/vmware/cis/tagging/tag-association/id:", 1), "?action=", "?~action=", 1)
+	}
+
+	for start := 0; start < len(vmIDs); start += NumVM {
+		end := start + NumVM
+		if end > len(vmIDs) {
+			end = len(vmIDs)
+		}
+		var tmpvm []objects
+		for _, vmID := range vmIDs[start:end] {
+			tmpvm = append(tmpvm, objects{Type: "VirtualMachine", ID: vmID})
+		}
+
+		var obj batchResult
+		vc.Post(tmpurl, requestObject{ObjectId: tmpvm}, &obj, false, action+"Tag")
+		if !obj.Success {
+			utils.LogWarning(fmt.Sprintf("%s of tag %s was not successful on all %d vms - %v", action, tagID, len(tmpvm), obj.ErrorMessages), true)
+		}
+	}
+}
+
+// syncToVCenter - Reverse direction of vmsync. PCE labels of the mapped label types are written to VCenter as tags in
+// the mapped categories. Missing categories and tags are created, tags are attached to VMs matching a PCE workload, and other
+// tags in a mapped category are detached.
+func (vc *VCenter) syncToVCenter(keyMap map[string]string) {
+
+	//Get all the PCE data
+	pce, err := utils.GetTargetPCEV2(false)
+	if err != nil {
+		utils.LogError(fmt.Sprintf("Error getting PCE - %s", err.Error()))
+	}
+
+	//Make sure the keyMap file doesnt have incorrect labeltypes.  Exit if it does. This also loads workloads and labels.
+	validateKeyMap(keyMap, &pce)
+
+	//return all VMs with filters
+	if vc.getVCenterVMs() == 0 {
+		utils.LogInfo(fmt.Sprintf("No Vcenter VMs found with current filters datacenter:'%s' cluster:'%s' folder:'%s'", datacenter, cluster, folder), true)
+		return
+	}
+
+	//Have to build a map of PCE wklds with all the names lowercase
+	tmpWklds := make(map[string]illumioapi.Workload)
+	for key, wkldStruct := range pce.Workloads {
+		tmpWklds[strings.ToLower(nameCheck(key))] = wkldStruct
+	}
+
+	//Match VMs to PCE workloads and get the label value for each mapped label type.
+	vc.VCVMs = make(map[string]vcenterVM)
+	for _, tmpvm := range vc.VCVMSlice {
+		tmpvm.VCName = tmpvm.Name
+		if name := vc.getVMIdentity(tmpvm.VMID).HostName; name != "" && !vcName {
+			tmpvm.Name = name
+		}
+		wkld, ok := tmpWklds[strings.ToLower(nameCheck(tmpvm.Name))]
+		if !ok {
+			continue
+		}
+		tmpLabels := make(map[string]string)
+		for _, l := range illumioapi.PtrToVal(wkld.Labels) {
+			tmpLabels[pce.Labels[l.Href].Key] = pce.Labels[l.Href].Value
+		}
+		vc.VCVMs[tmpvm.VMID] = vcenterVM{VMID: tmpvm.VMID, VCName: tmpvm.VCName, Name: illumioapi.PtrToVal(wkld.Hostname), PowerState: tmpvm.PowerState, Tags: tmpLabels}
+	}
+	utils.LogInfo(fmt.Sprintf("%d of %d VCenter vms matched a pce workload", len(vc.VCVMs), len(vc.VCVMSlice)), true)
+	if len(vc.VCVMs) == 0 {
+		return
+	}
+
+	//Get the existing tags for the mapped categories.  Existing categories and tags are keyed by name.
+	vc.buildVCTagMap(keyMap)
+	categoryIDs := make(map[string]string)
+	tagIDs := make(map[string]map[string]string)
+	for _, category := range vc.Categories {
+		catDetail := vc.getCategoryDetail(category)
+		if _, ok := keyMap[catDetail.Name]; ok {
+			categoryIDs[catDetail.Name] = catDetail.ID
+			tagIDs[catDetail.Name] = make(map[string]string)
+		}
+	}
+	for tagID, tag := range vc.VCTags {
+		tagIDs[tag.Category][tag.Tag] = tagID
+	}
+
+	//Current tags in mapped categories on each VM
+	currentTags := make(map[string]map[string][]string)
+	for _, object := range vc.getTagsfromVMs(vc.VCVMs, vc.VCTags) {
+		for _, tagID := range object.TagIds {
+			if tag, ok := vc.VCTags[tagID]; ok {
+				if currentTags[object.ObjectId.ID] == nil {
+					currentTags[object.ObjectId.ID] = make(map[string][]string)
+				}
+				currentTags[object.ObjectId.ID][tag.Category] = append(currentTags[object.ObjectId.ID][tag.Category], tagID)
+			}
+		}
+	}
+
+	//Sort the categories and vms so the output is consistent.
+	categories := []string{}
+	for category := range keyMap {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	vmIDs := []string{}
+	for vmID := range vc.VCVMs {
+		vmIDs = append(vmIDs, vmID)
+	}
+	sort.Slice(vmIDs, func(i, j int) bool { return vc.VCVMs[vmIDs[i]].Name < vc.VCVMs[vmIDs[j]].Name })
+
+	//Compare the pce label to the tags in each mapped category
+	var changes []tagChange
+	newCategories := make(map[string]bool)
+	newTags := make(map[string]map[string]bool)
+	for _, category := range categories {
+		if _, ok := categoryIDs[category]; !ok {
+			newCategories[category] = true
+			changes = append(changes, tagChange{Action: "create-category", Category: category})
+		}
+		for _, vmID := range vmIDs {
+			vm := vc.VCVMs[vmID]
+			value := vm.Tags[keyMap[category]]
+			attached := false
+			for _, tagID := range currentTags[vmID][category] {
+				if vc.VCTags[tagID].Tag == value {
+					attached = true
+					continue
+				}
+				changes = append(changes, tagChange{Action: "detach", VMID: vmID, VMName: vm.VCName, Hostname: vm.Name, Category: category, Tag: vc.VCTags[tagID].Tag, TagID: tagID})
+			}
+			if value == "" || attached {
+				continue
+			}
+			if _, ok := tagIDs[category][value]; !ok && !newTags[category][value] {
+				if newTags[category] == nil {
+					newTags[category] = make(map[string]bool)
+				}
+				newTags[category][value] = true
+				changes = append(changes, tagChange{Action: "create-tag", Category: category, Tag: value})
+			}
+			changes = append(changes, tagChange{Action: "attach", VMID: vmID, VMName: vm.VCName, Hostname: vm.Name, Category: category, Tag: value, TagID: tagIDs[category][value]})
+		}
+	}
+
+	//Log the changes and write them to a csv.
+	attachCount, detachCount, tagCount := 0, 0, 0
+	csvData := [][]string{{"action", "vm_id", "vcenter_name", "hostname", "category", "tag"}}
+	for _, c := range changes {
+		csvData = append(csvData, []string{c.Action, c.VMID, c.VMName, c.Hostname, c.Category, c.Tag})
+		switch c.Action {
+		case "attach":
+			attachCount++
+		case "detach":
+			detachCount++
+		case "create-tag":
+			tagCount++
+		}
+	}
+	if len(changes) == 0 {
+		utils.LogInfo("vcenter tags match pce labels. nothing to do.", true)
+		return
+	}
+	outputFileName := fmt.Sprintf("workloader-vcenter-sync-to-vcenter-%s.csv", time.Now().Format("20060102_150405"))
+	utils.WriteOutput(csvData, nil, outputFileName)
+	utils.LogInfo(fmt.Sprintf("%d categories to create, %d tags to create, %d tags to attach, and %d tags to detach. see %s for details.", len(newCategories), tagCount, attachCount, detachCount, outputFileName), true)
+
+	// Check the maximum allowed changes
+	if maxChanges != -1 && attachCount+detachCount > maxChanges {
+		utils.LogErrorfCode(2, "tag change count for %s of %d exceeds maximum of %d. terminating run with exit code 2.", vc.VCenterURL, attachCount+detachCount, maxChanges)
+	}
+
+	// If updatePCE is disabled, we are just going to alert the user what will happen and log
+	if !updatePCE {
+		utils.LogInfo("See workloader.log for more details. To update vcenter, run again using --update-pce flag.", true)
+		return
+	}
+
+	// If updatePCE is set, but not noPrompt, we will prompt the user.
+	if updatePCE && !noPrompt {
+		var prompt string
+		fmt.Printf("\r\n%s [PROMPT] - workloader will create %d categories, create %d tags, attach %d tags, and detach %d tags in vcenter %s using labels from %s (%s). do you want to run the sync (yes/no)? ", time.Now().Format("2006-01-02 15:04:05 "), len(newCategories), tagCount, attachCount, detachCount, vc.VCenterURL, pce.FriendlyName, viper.GetString(pce.FriendlyName+".fqdn"))
+		fmt.Scanln(&prompt)
+		if strings.ToLower(prompt) != "yes" {
+			utils.LogInfo("prompt denied.", true)
+			return
+		}
+	}
+
+	//Create the missing categories and tags
+	for _, c := range changes {
+		switch c.Action {
+		case "create-category":
+			categoryIDs[c.Category] = vc.createCategory(c.Category)
+			tagIDs[c.Category] = make(map[string]string)
+			utils.LogInfo(fmt.Sprintf("created category %s - %s", c.Category, categoryIDs[c.Category]), true)
+		case "create-tag":
+			tagIDs[c.Category][c.Tag] = vc.createTag(c.Tag, categoryIDs[c.Category])
+			utils.LogInfo(fmt.Sprintf("created tag %s in category %s - %s", c.Tag, c.Category, tagIDs[c.Category][c.Tag]), true)
+		}
+	}
+
+	//Detach first so categories with single cardinality can take the new tag. Group vms by tag to attach or detach in bulk.
+	for _, action := range []string{"detach", "attach"} {
+		tagVMs := make(map[string][]string)
+		tagOrder := []string{}
+		for _, c := range changes {
+			if c.Action != action {
+				continue
+			}
+			tagID := c.TagID
+			if tagID == "" {
+				tagID = tagIDs[c.Category][c.Tag]
+			}
+			if _, ok := tagVMs[tagID]; !ok {
+				tagOrder = append(tagOrder, tagID)
+			}
+			tagVMs[tagID] = append(tagVMs[tagID], c.VMID)
+		}
+		for _, tagID := range tagOrder {
+			vc.tagAssociation(action, tagID, tagVMs[tagID])
+			utils.LogInfo(fmt.Sprintf("%s tag %s on %d vms", action, tagID, len(tagVMs[tagID])), true)
+		}
+	}
+	utils.LogInfo(fmt.Sprintf("vcenter sync complete - %d tags attached and %d tags detached", attachCount, detachCount), true)
+}
@@ -40,6 +40,7 @@ func httpCall(httpAction, apiURL string, body []byte, login bool) (illumioapi.AP
 	if insecure {
 		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
 	}
+	client.Transport = utils.WrapTransport(client.Transport)
 
 	req, err := http.NewRequest(httpAction, apiURL, httpBody)
 	if err != nil {
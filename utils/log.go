@@ -53,6 +53,11 @@ func SetUpLogging() {
 
 }
 
+// LogFileName returns the path of the log file set up by SetUpLogging
+func LogFileName() string {
+	return logFile
+}
+
 // LogError writes the error the workloader.log and always prints an error to stdout.
 func LogError(msg string) {
 
@@ -172,7 +177,8 @@ func LogStartCommand(fullCommand string) {
 // LogEndCommand is used at the end of each command
 func LogEndCommand(commandName string) {
 	stdOut := true
-	if commandName == "get-pk" {
+	// Commands printing json for other tools set json_stdout so the output can be parsed
+	if commandName == "get-pk" || viper.GetBool("json_stdout") {
 		stdOut = false
 	}
 	LogInfo(fmt.Sprintf("%s completed", commandName), stdOut)
@@ -73,6 +73,11 @@ func GetPCEbyName(name string, GetLabelMaps bool) (illumioapi.PCE, error) {
 		if viper.GetString(name+".proxy") != "" {
 			pce.Proxy = viper.GetString(name + ".proxy")
 		}
+		pce.Proxy, pce.DisableTLSChecking = RoutePCE(pce.FQDN, pce.Port, pce.DisableTLSChecking, pce.Proxy)
+		// Replays do not need credentials
+		if ReplayActive() && pce.User == "" && pce.Key == "" {
+			pce.User, pce.Key = "<redacted>", "<redacted>"
+		}
 		if GetLabelMaps {
 			apiResps, err := pce.Load(illumioapi.LoadInput{Labels: true})
 			LogMultiAPIResp(apiResps)
@@ -102,6 +107,11 @@ func GetPCENoAPI(name string) (illumioapi.PCE, error) {
 		if viper.GetString(name+".proxy") != "" {
 			pce.Proxy = viper.GetString(name + ".proxy")
 		}
+		pce.Proxy, pce.DisableTLSChecking = RoutePCE(pce.FQDN, pce.Port, pce.DisableTLSChecking, pce.Proxy)
+		// Replays do not need credentials
+		if ReplayActive() && pce.User == "" && pce.Key == "" {
+			pce.User, pce.Key = "<redacted>", "<redacted>"
+		}
 		return pce, nil
 	}
 
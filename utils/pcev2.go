@@ -73,6 +73,11 @@ func GetPCEbyNameV2(name string, GetLabelMaps bool) (illumioapi.PCE, error) {
 		if viper.GetString(name+".proxy") != "" {
 			pce.Proxy = viper.GetString(name + ".proxy")
 		}
+		pce.Proxy, pce.DisableTLSChecking = RoutePCE(pce.FQDN, pce.Port, pce.DisableTLSChecking, pce.Proxy)
+		// Replays do not need credentials
+		if ReplayActive() && pce.User == "" && pce.Key == "" {
+			pce.User, pce.Key = "<redacted>", "<redacted>"
+		}
 		if GetLabelMaps {
 			apiResp, err := pce.GetLabels(nil)
 			LogAPIRespV2("GetLabels", apiResp)
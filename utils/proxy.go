@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// PCECacheEnv is the environment variable with the proxy URL of a daemon's PCE cache
+const PCECacheEnv = "WORKLOADER_PCE_CACHE"
+
+// RoutePCE returns the proxy and TLS setting a PCE should use when a daemon PCE cache or recording is active.
+// The original values are returned when neither is active.
+func RoutePCE(fqdn string, port int, disableTLSChecking bool, proxy string) (string, bool) {
+	// The cache proxy is local and terminates tls with a self-signed certificate
+	if os.Getenv(PCECacheEnv) != "" {
+		proxy, disableTLSChecking = os.Getenv(PCECacheEnv), true
+	}
+	return RecordPCE(fqdn, port, disableTLSChecking, proxy)
+}
+
+// PCETransport builds a transport with a PCE's tls and proxy settings
+func PCETransport(disableTLSChecking bool, proxy string) *http.Transport {
+	transport := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: disableTLSChecking}}
+	if proxy != "" {
+		if proxyURL, err := url.Parse(proxy); err == nil {
+			transport.Proxy = http.ProxyURL(proxyURL)
+		}
+	}
+	return transport
+}
+
+// StartInterceptProxy starts a proxy on a random localhost port and returns its URL.
+// CONNECT requests are terminated with a self-signed certificate so every request can be passed to roundTrip.
+func StartInterceptProxy(roundTrip func(req *http.Request) (*http.Response, error)) (string, error) {
+	cert, err := SelfSignedCert()
+	if err != nil {
+		return "", err
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	go http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		// Plain http requests
+		if r.Method != http.MethodConnect {
+			r.RequestURI = ""
+			resp, err := roundTrip(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+			defer resp.Body.Close()
+			for k, v := range resp.Header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(resp.StatusCode)
+			io.Copy(w, resp.Body)
+			return
+		}
+
+		hijacker, ok := w.(http.Hijacker)
+		if !ok {
+			http.Error(w, "hijacking not supported", http.StatusInternalServerError)
+			return
+		}
+		conn, _, err := hijacker.Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+
+		tlsConn := tls.Server(conn, tlsConfig)
+		defer tlsConn.Close()
+		reader := bufio.NewReader(tlsConn)
+		host := r.Host
+		for {
+			req, err := http.ReadRequest(reader)
+			if err != nil {
+				return
+			}
+			req.URL.Scheme = "https"
+			req.URL.Host = host
+			req.RequestURI = ""
+			resp, err := roundTrip(req)
+			if err != nil {
+				resp = &http.Response{StatusCode: http.StatusBadGateway, ProtoMajor: 1, ProtoMinor: 1, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(err.Error())), ContentLength: int64(len(err.Error()))}
+			}
+			resp.Write(tlsConn)
+			resp.Body.Close()
+		}
+	}))
+
+	return "http://" + listener.Addr().String(), nil
+}
@@ -0,0 +1,343 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// RecordedExchange is a single HTTP request and response saved by --record
+type RecordedExchange struct {
+	Sequence        int                 `json:"sequence"`
+	Method          string              `json:"method"`
+	URL             string              `json:"url"`
+	RequestHeaders  map[string][]string `json:"request_headers"`
+	RequestBody     string              `json:"request_body"`
+	StatusCode      int                 `json:"status_code"`
+	ResponseHeaders map[string][]string `json:"response_headers"`
+	ResponseBody    string              `json:"response_body"`
+}
+
+// upstream holds how the recorder connects to a host the PCE library would have connected to directly
+type upstream struct {
+	insecure  bool
+	proxy     string
+	transport http.RoundTripper
+}
+
+type httpRecorder struct {
+	mu         sync.Mutex
+	dir        string
+	replay     bool
+	sequence   int
+	recordings map[string][]RecordedExchange
+	upstreams  map[string]upstream
+	proxyURL   string
+}
+
+var recorder *httpRecorder
+
+var redactedHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "X-Auth-Token", "Vmware-Api-Session-Id", "X-Pan-Key", "X-F5-Auth-Token", "Proxy-Authorization"}
+var redactedParams = []string{"key", "password", "pwd", "user", "api_key", "secret"}
+
+func redactSecrets(input string) string {
+	// JSON fields with credentials
+	re := regexp.MustCompile(`"(password|secret|auth_secret|auth_token|session_token|token|api_key|auth_username)"(\s*):(\s*)"[^"]*"`)
+	s := re.ReplaceAllString(input, `"$1"$2:$3"<redacted>"`)
+
+	// PAN XML keys
+	re = regexp.MustCompile(`<key>[^<]*</key>`)
+	s = re.ReplaceAllString(s, "<key><redacted></key>")
+
+	// Form and query parameters
+	for _, p := range redactedParams {
+		re = regexp.MustCompile(`(^|[?&])` + p + `=[^&]*`)
+		s = re.ReplaceAllString(s, "${1}"+p+"=<redacted>")
+	}
+
+	return redactApiCreds(s)
+}
+
+func redactHeaders(headers http.Header) map[string][]string {
+	redacted := make(map[string][]string)
+	for k, v := range headers {
+		redacted[k] = v
+	}
+	for _, h := range redactedHeaders {
+		if _, ok := redacted[http.CanonicalHeaderKey(h)]; ok {
+			redacted[http.CanonicalHeaderKey(h)] = []string{"<redacted>"}
+		}
+	}
+	return redacted
+}
+
+// recordingKey matches a request to a recording. Recorded URLs are redacted so the live URL is redacted before matching.
+func recordingKey(method, rawURL string) string {
+	return method + " " + redactSecrets(rawURL)
+}
+
+// SetUpRecording starts record or replay mode for all PCE and third-party HTTP calls.
+// Only one of recordDir and replayDir can be set. Both empty is a no-op.
+func SetUpRecording(recordDir, replayDir string) error {
+	if recordDir == "" && replayDir == "" {
+		return nil
+	}
+	if recordDir != "" && replayDir != "" {
+		return fmt.Errorf("record and replay cannot be used together")
+	}
+
+	recorder = &httpRecorder{recordings: make(map[string][]RecordedExchange), upstreams: make(map[string]upstream)}
+
+	if recordDir != "" {
+		if err := os.MkdirAll(recordDir, 0700); err != nil {
+			return err
+		}
+		recorder.dir = recordDir
+		// Continue the sequence if the directory already has recordings
+		files, _ := filepath.Glob(filepath.Join(recordDir, "*.json"))
+		recorder.sequence = len(files)
+		LogInfof(false, "recording http exchanges to %s", recordDir)
+	}
+
+	if replayDir != "" {
+		recorder.dir = replayDir
+		recorder.replay = true
+		files, err := filepath.Glob(filepath.Join(replayDir, "*.json"))
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			return fmt.Errorf("%s does not have any recordings", replayDir)
+		}
+		sort.Strings(files)
+		for _, f := range files {
+			data, err := os.ReadFile(f)
+			if err != nil {
+				return err
+			}
+			var e RecordedExchange
+			if err := json.Unmarshal(data, &e); err != nil {
+				return fmt.Errorf("%s - %s", f, err)
+			}
+			key := e.Method + " " + e.URL
+			recorder.recordings[key] = append(recorder.recordings[key], e)
+		}
+		LogInfof(true, "replaying %d http exchanges from %s", len(files), replayDir)
+	}
+
+	// Capture third-party clients that use the default transport
+	http.DefaultTransport = WrapTransport(http.DefaultTransport)
+
+	// The PCE library manages its own transport so PCE calls are routed through a local proxy
+	proxyURL, err := StartInterceptProxy(func(req *http.Request) (*http.Response, error) {
+		return recorder.roundTrip(req, recorder.upstreamTransport(req.URL.Host))
+	})
+	if err != nil {
+		return err
+	}
+	recorder.proxyURL = proxyURL
+
+	return nil
+}
+
+// RecordingActive returns true when --record or --replay is set
+func RecordingActive() bool {
+	return recorder != nil
+}
+
+// ReplayActive returns true when --replay is set
+func ReplayActive() bool {
+	return recorder != nil && recorder.replay
+}
+
+// RecordPCE routes a PCE through the recording proxy. The returned proxy and TLS setting should replace the PCE's values.
+func RecordPCE(fqdn string, port int, disableTLSChecking bool, proxy string) (string, bool) {
+	if recorder == nil {
+		return proxy, disableTLSChecking
+	}
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	recorder.upstreams[net.JoinHostPort(fqdn, strconv.Itoa(port))] = upstream{insecure: disableTLSChecking, proxy: proxy}
+
+	// The proxy terminates tls with a self-signed certificate
+	return recorder.proxyURL, true
+}
+
+type recordingTransport struct {
+	base http.RoundTripper
+}
+
+// WrapTransport returns a transport that records or replays exchanges. The base transport is returned when recording is not active.
+func WrapTransport(base http.RoundTripper) http.RoundTripper {
+	if recorder == nil {
+		return base
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if _, ok := base.(*recordingTransport); ok {
+		return base
+	}
+	return &recordingTransport{base: base}
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return recorder.roundTrip(req, t.base)
+}
+
+func (h *httpRecorder) roundTrip(req *http.Request, base http.RoundTripper) (*http.Response, error) {
+
+	// Read the request body so it can be recorded and still sent
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		reqBody, err = io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(strings.NewReader(string(reqBody)))
+	}
+
+	if h.replay {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		key := recordingKey(req.Method, req.URL.String())
+		queue := h.recordings[key]
+		if len(queue) == 0 {
+			LogWarningf(false, "replay - no recording for %s", key)
+			return nil, fmt.Errorf("replay - no recording for %s", key)
+		}
+		e := queue[0]
+		// Keep the last recording to serve repeated polling calls
+		if len(queue) > 1 {
+			h.recordings[key] = queue[1:]
+		}
+		LogDebug(fmt.Sprintf("replay - %s - recording %d", key, e.Sequence))
+		// Redaction can change the body length
+		header := http.Header(e.ResponseHeaders).Clone()
+		header.Del("Content-Length")
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+			StatusCode:    e.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(strings.NewReader(e.ResponseBody)),
+			ContentLength: int64(len(e.ResponseBody)),
+			Request:       req,
+		}, nil
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(strings.NewReader(string(respBody)))
+
+	// Session and login endpoints return tokens in the body so the body is not kept.
+	// The f5 login keeps a placeholder token so replays can log in.
+	recordedRespBody := redactSecrets(string(respBody))
+	if strings.HasSuffix(req.URL.Path, "/session") {
+		recordedRespBody = "<redacted>"
+	}
+	if strings.HasSuffix(req.URL.Path, "/authn/login") {
+		recordedRespBody = `{"token":{"token":"<redacted>"}}`
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sequence++
+	e := RecordedExchange{
+		Sequence:        h.sequence,
+		Method:          req.Method,
+		URL:             redactSecrets(req.URL.String()),
+		RequestHeaders:  redactHeaders(req.Header),
+		RequestBody:     redactSecrets(string(reqBody)),
+		StatusCode:      resp.StatusCode,
+		ResponseHeaders: redactHeaders(resp.Header),
+		ResponseBody:    recordedRespBody,
+	}
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(e); err != nil {
+		return resp, err
+	}
+	if err := os.WriteFile(filepath.Join(h.dir, fmt.Sprintf("%06d.json", e.Sequence)), data.Bytes(), 0600); err != nil {
+		LogWarningf(false, "record - %s", err)
+	}
+
+	return resp, nil
+}
+
+// RecordHost routes a third-party library that manages its own connections through the recorder.
+// The returned host:port replaces the library's server. It terminates tls with a self-signed certificate and forwards calls to host over https.
+func RecordHost(host string, insecure bool) (string, error) {
+	if recorder == nil {
+		return host, nil
+	}
+	recorder.mu.Lock()
+	recorder.upstreams[host] = upstream{insecure: insecure}
+	recorder.mu.Unlock()
+
+	cert, err := SelfSignedCert()
+	if err != nil {
+		return "", err
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+
+	go http.Serve(tls.NewListener(listener, &tls.Config{Certificates: []tls.Certificate{cert}}), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Record the real host so recordings replay against the same url
+		r.URL.Scheme = "https"
+		r.URL.Host = host
+		r.Host = ""
+		r.RequestURI = ""
+		resp, err := recorder.roundTrip(r, recorder.upstreamTransport(host))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		for k, v := range resp.Header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+
+	return listener.Addr().String(), nil
+}
+
+// upstreamTransport returns the transport to the real host using the PCE's original tls and proxy settings
+func (h *httpRecorder) upstreamTransport(host string) http.RoundTripper {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	u := h.upstreams[host]
+	if u.transport == nil {
+		u.transport = PCETransport(u.insecure, u.proxy)
+		h.upstreams[host] = u
+	}
+	return u.transport
+}
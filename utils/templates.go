@@ -5,16 +5,16 @@ func RootTemplate() string {
 	return `  Usage:{{if .Runnable}}
 	{{.CommandPath}} [command]
 
-  PCE Management Commands:{{range .Commands}}{{if (or (eq .Name "set-proxy") (eq .Name "clear-proxy") (eq .Name "pce-remove") (eq .Name "pce-add") (eq .Name "get-default") (eq .Name "settings") (eq .Name "pce-list"))}}
+  PCE Management Commands:{{range .Commands}}{{if (or (eq .Name "set-proxy") (eq .Name "clear-proxy") (eq .Name "pce-remove") (eq .Name "pce-add") (eq .Name "get-default") (eq .Name "settings") (eq .Name "pce-list") (eq .Name "mock-pce"))}}
 	{{rpad .Name .NamePadding }} {{.Short}}{{end}}{{end}}{{end}}{{if .HasAvailableLocalFlags}}
 
-  Import/Export Commands:{{range .Commands}}{{if (or (eq .Name "wkld-export") (eq .Name "wkld-import") (eq .Name "ven-export") (eq .Name "ven-import") (eq .Name "ipl-export") (eq .Name "ipl-import") (eq .Name "ipl-replace") (eq .Name "label-export") (eq .Name "label-import") (eq .Name "label-dimension-export") (eq .Name "label-dimension-import") (eq .Name "svc-export") (eq .Name "svc-import") (eq .Name "rule-export") (eq .Name "rule-import") (eq .Name "ruleset-export") (eq .Name "ruleset-import") (eq .Name "deny-rule-export") (eq .Name "deny-rule-import") (eq .Name "labelgroup-export") (eq .Name "labelgroup-import") (eq .Name "cwp-export") (eq .Name "cwp-import") (eq .Name "adgroup-export") (eq .Name "adgroup-import") (eq .Name "virtualservice-export") (eq .Name "sec-principal-export") (eq .Name "sec-principal-import") (eq .Name "permissions-export") (eq .Name "permissions-import") (eq .Name "flow-import"))}}
+  Import/Export Commands:{{range .Commands}}{{if (or (eq .Name "wkld-export") (eq .Name "wkld-import") (eq .Name "ven-export") (eq .Name "ven-import") (eq .Name "ipl-export") (eq .Name "ipl-import") (eq .Name "ipl-optimize") (eq .Name "ipl-replace") (eq .Name "label-export") (eq .Name "label-import") (eq .Name "label-dimension-export") (eq .Name "label-dimension-import") (eq .Name "svc-export") (eq .Name "svc-import") (eq .Name "rule-export") (eq .Name "rule-import") (eq .Name "ruleset-export") (eq .Name "ruleset-import") (eq .Name "deny-rule-export") (eq .Name "deny-rule-import") (eq .Name "labelgroup-export") (eq .Name "labelgroup-import") (eq .Name "cwp-export") (eq .Name "netpol-export") (eq .Name "tf-export") (eq .Name "inventory-export") (eq .Name "event-export") (eq .Name "rule-recommend") (eq .Name "cwp-import") (eq .Name "adgroup-export") (eq .Name "adgroup-import") (eq .Name "virtualservice-export") (eq .Name "sec-principal-export") (eq .Name "sec-principal-import") (eq .Name "permissions-export") (eq .Name "permissions-import") (eq .Name "flow-import") (eq .Name "fw-convert"))}}
 	{{rpad .Name .NamePadding }} {{.Short}}{{end}}{{end}}{{end}}{{if .HasAvailableLocalFlags}}
 	  
   Cloud Commands:{{range .Commands}}{{if (or (eq .Name "tenant-add") (eq .Name "cloud-inventory") (eq .Name "azure-vnet-peering-report"))}}
 	{{rpad .Name .NamePadding }} {{.Short}}{{end}}{{end}}{{end}}{{if .HasAvailableLocalFlags}}
   
-  Automation Commands:{{range .Commands}}{{if (or (eq .Name "azure-label") (eq .Name "aws-label") (eq .Name "gcp-label") (eq .Name "azure-network") (eq .Name "vmsync") (eq .Name "subnet") (eq .Name "hostparse") (eq .Name "dag-sync") (eq .Name "container-cluster-update") (eq .Name "auto-deny-rules"))}}
+  Automation Commands:{{range .Commands}}{{if (or (eq .Name "azure-label") (eq .Name "aws-label") (eq .Name "gcp-label") (eq .Name "azure-network") (eq .Name "vmsync") (eq .Name "subnet") (eq .Name "hostparse") (eq .Name "dag-sync") (eq .Name "mock-pan") (eq .Name "edl-serve") (eq .Name "f5-sync") (eq .Name "mock-f5") (eq .Name "container-cluster-update") (eq .Name "auto-deny-rules") (eq .Name "daemon"))}}
 	{{rpad .Name .NamePadding }} {{.Short}}{{end}}{{end}}{{end}}{{if .HasAvailableLocalFlags}}
 
   Workload Management Commands:{{range .Commands}}{{if (or (eq .Name "wkld-cleanup") (eq .Name "compatibility") (eq .Name "mode") (eq .Name "upgrade") (eq .Name "unpair") (eq .Name "get-pk") (eq .Name "umwl-cleanup") (eq .Name "nic-manage") (eq .Name "containment-switch") (eq .Name "increase-ven-rate") (eq .Name "wkld-replicate") (eq .Name "wkld-label"))}}
@@ -23,13 +23,13 @@ func RootTemplate() string {
   Label Management Commands:{{range .Commands}}{{if (or (eq .Name "labels-delete-unused") (eq .Name "label-rename"))}}
 	{{rpad .Name .NamePadding }} {{.Short}}{{end}}{{end}}{{end}}{{if .HasAvailableLocalFlags}}
 
-  Reporting Commands:{{range .Commands}}{{if (or (eq .Name "rule-usage") (eq .Name "find-fqdn") (eq .Name "port-usage") (eq .Name "mislabel") (eq .Name "dupecheck") (eq .Name "appgroup-flow-summary") (eq .Name "legacy-explorer") (eq .Name "traffic") (eq .Name "nic-export") (eq .Name "service-finder") (eq .Name "process-export") (eq .Name "wkld-ipl-mapping") (eq .Name "ven-health") (eq .Name "unused-umwl"))}}
+  Reporting Commands:{{range .Commands}}{{if (or (eq .Name "rule-usage") (eq .Name "unused-objects") (eq .Name "find-fqdn") (eq .Name "port-usage") (eq .Name "mislabel") (eq .Name "label-suggest") (eq .Name "dupecheck") (eq .Name "appgroup-flow-summary") (eq .Name "legacy-explorer") (eq .Name "traffic") (eq .Name "traffic-diff") (eq .Name "enforcement-readiness") (eq .Name "nic-export") (eq .Name "service-finder") (eq .Name "process-export") (eq .Name "wkld-ipl-mapping") (eq .Name "ven-health") (eq .Name "unused-umwl") (eq .Name "drift") (eq .Name "exporter"))}}
 	{{rpad .Name .NamePadding }} {{.Short}}{{end}}{{end}}{{end}}{{if .HasAvailableLocalFlags}}
 
   Multiple PCE Prefix Commands:{{range .Commands}}{{if (or (eq .Name "all-pces") (eq .Name "target-pces"))}}
 	{{rpad .Name .NamePadding }} {{.Short}}{{end}}{{end}}{{end}}{{if .HasAvailableLocalFlags}}
 
-  Other Commands:{{range .Commands}}{{if (or (eq .Name "delete"))}}
+  Other Commands:{{range .Commands}}{{if (or (eq .Name "delete") (eq .Name "support-bundle"))}}
 	{{rpad .Name .NamePadding }} {{.Short}}{{end}}{{end}}{{end}}{{if .HasAvailableLocalFlags}}
 
   Version Command:{{range .Commands}}{{if (or (eq .Name "version") (eq .Name "check-version"))}}
@@ -1,4 +1,4 @@
-package extract
+package utils
 
 import (
 	"archive/zip"
@@ -8,7 +8,8 @@ import (
 	"strings"
 )
 
-func zipit(source, target string) error {
+// ZipDir zips a file or directory to the target file
+func ZipDir(source, target string) error {
 	zipfile, err := os.Create(target)
 	if err != nil {
 		return err